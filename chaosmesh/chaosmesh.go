@@ -0,0 +1,341 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package chaosmesh realizes Chaos Mesh NetworkChaos specs with the test
+// proxies of this module, so that the chaos specs used for workloads running
+// in Kubernetes apply as is to processes running outside the cluster.
+//
+// The delay, loss and partition actions are supported. They are realized by
+// the proxies selected by the spec (see Controller), with these
+// approximations:
+//   - delays apply to every chunk forwarded by the proxy, in both
+//     directions, latency +/- jitter (uniformly distributed)
+//   - a lost packet is a dropped connection, as a TCP proxy can't lose
+//     packets without the loss being hidden by retransmissions
+//   - partitions block all traffic, whatever the direction, as one-way
+//     partitions stall TCP connections anyway
+//
+// Correlations are ignored.
+package chaosmesh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"gopkg.in/yaml.v3"
+)
+
+// NetworkChaos actions
+const (
+	ActionDelay     = "delay"
+	ActionLoss      = "loss"
+	ActionPartition = "partition"
+)
+
+// NetworkChaosKind is the kind of the supported Chaos Mesh objects
+const NetworkChaosKind = "NetworkChaos"
+
+// NetworkChaos is a Chaos Mesh NetworkChaos object
+type NetworkChaos struct {
+	APIVersion string           `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string           `yaml:"kind" json:"kind"`
+	Metadata   Metadata         `yaml:"metadata" json:"metadata"`
+	Spec       NetworkChaosSpec `yaml:"spec" json:"spec"`
+}
+
+// Metadata is the object metadata of a NetworkChaos
+type Metadata struct {
+	Name      string `yaml:"name" json:"name"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+}
+
+// Selector selects the targets of a NetworkChaos by label
+type Selector struct {
+	LabelSelectors map[string]string `yaml:"labelSelectors,omitempty" json:"labelSelectors,omitempty"`
+}
+
+// DelaySpec is the delay of the delay action
+type DelaySpec struct {
+	Latency     string `yaml:"latency" json:"latency"`
+	Jitter      string `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	Correlation string `yaml:"correlation,omitempty" json:"correlation,omitempty"`
+}
+
+// LossSpec is the loss of the loss action, Loss is a percentage
+type LossSpec struct {
+	Loss        string `yaml:"loss" json:"loss"`
+	Correlation string `yaml:"correlation,omitempty" json:"correlation,omitempty"`
+}
+
+// NetworkChaosSpec is the spec of a NetworkChaos
+type NetworkChaosSpec struct {
+	Action   string   `yaml:"action" json:"action"`
+	Mode     string   `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Selector Selector `yaml:"selector,omitempty" json:"selector,omitempty"`
+	// Direction is accepted but ignored, see the package documentation
+	Direction string     `yaml:"direction,omitempty" json:"direction,omitempty"`
+	Delay     *DelaySpec `yaml:"delay,omitempty" json:"delay,omitempty"`
+	Loss      *LossSpec  `yaml:"loss,omitempty" json:"loss,omitempty"`
+	// Duration is how long the chaos lasts, it lasts until reverted when
+	// empty
+	Duration string `yaml:"duration,omitempty" json:"duration,omitempty"`
+}
+
+// ParseNetworkChaos parses NetworkChaos objects from YAML (or JSON) data,
+// which may hold several YAML documents. Objects of other kinds are skipped.
+func ParseNetworkChaos(data []byte) ([]NetworkChaos, error) {
+	var chaos []NetworkChaos
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var c NetworkChaos
+		err := dec.Decode(&c)
+		if err == io.EOF {
+			return chaos, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Malformed chaos spec")
+		}
+		if c.Kind != NetworkChaosKind {
+			continue
+		}
+		if _, err := c.Spec.duration(); err != nil {
+			return nil, errors.Wrapf(err, "NetworkChaos %s", c.Metadata.Name)
+		}
+		if _, _, err := c.Spec.generators(); err != nil {
+			return nil, errors.Wrapf(err, "NetworkChaos %s", c.Metadata.Name)
+		}
+		chaos = append(chaos, c)
+	}
+}
+
+// ReadNetworkChaos reads the NetworkChaos objects of the file at path
+func ReadNetworkChaos(path string) ([]NetworkChaos, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read chaos spec %s", path)
+	}
+	return ParseNetworkChaos(data)
+}
+
+func (s NetworkChaosSpec) duration() (time.Duration, error) {
+	if s.Duration == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s.Duration)
+	return d, errors.Wrapf(err, "Invalid duration %q", s.Duration)
+}
+
+func parsePercentage(value string) (float32, error) {
+	p, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 32)
+	if err != nil || p < 0 || p > 100 {
+		return 0, errors.Errorf("Invalid percentage %q", value)
+	}
+	return float32(p / 100), nil
+}
+
+// generators returns the recv and accept generators realizing the action of
+// the spec
+func (s NetworkChaosSpec) generators() (
+	recvFg failuregen.FailureGenerator,
+	acceptFg failuregen.FailureGenerator,
+	err error,
+) {
+	recv := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	accept := failuregen.NewFailureGenerator()
+	switch s.Action {
+	case ActionDelay:
+		if s.Delay == nil {
+			return nil, nil, errors.New("Delay action without delay")
+		}
+		latency, err := time.ParseDuration(s.Delay.Latency)
+		if err != nil || latency < 0 {
+			return nil, nil, errors.Errorf(
+				"Invalid latency %q",
+				s.Delay.Latency)
+		}
+		jitter := time.Duration(0)
+		if s.Delay.Jitter != "" {
+			jitter, err = time.ParseDuration(s.Delay.Jitter)
+			if err != nil || jitter < 0 || jitter > latency {
+				return nil, nil, errors.Errorf(
+					"Invalid jitter %q",
+					s.Delay.Jitter)
+			}
+		}
+		// the generator draws the jitter in [0, 2 * jitter)
+		recv.DelayFn = func(d time.Duration) {
+			time.Sleep(latency - jitter + d)
+		}
+		if err := recv.SetDelayConfig(failuregen.DelayConfig{
+			MaxDelayMicros:   int32(2 * jitter.Microseconds()),
+			DelayProbability: 1,
+		}); err != nil {
+			return nil, nil, err
+		}
+	case ActionLoss:
+		if s.Loss == nil {
+			return nil, nil, errors.New("Loss action without loss")
+		}
+		p, err := parsePercentage(s.Loss.Loss)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := recv.SetFailureProbability(p); err != nil {
+			return nil, nil, err
+		}
+	case ActionPartition:
+		if err := recv.SetFailureProbability(1); err != nil {
+			return nil, nil, err
+		}
+		if err := accept.SetFailureProbability(1); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, errors.Errorf("Unsupported action %q", s.Action)
+	}
+	return recv, accept, nil
+}
+
+// Apply realizes chaos with proxy, replacing the recv and accept generators
+// of the proxy until revert is called. Existing connections are subject to
+// the chaos.
+func Apply(
+	proxy tcpproxy.Reconfigurer,
+	chaos NetworkChaos,
+) (revert func() error, err error) {
+	recvFg, acceptFg, err := chaos.Spec.generators()
+	if err != nil {
+		return nil, errors.Wrapf(err, "NetworkChaos %s", chaos.Metadata.Name)
+	}
+	original := proxy.Config()
+	cfg := original
+	cfg.RecvFg, cfg.AcceptFg = recvFg, acceptFg
+	if err := proxy.Reconfigure(cfg); err != nil {
+		return nil, err
+	}
+	return func() error { return proxy.Reconfigure(original) }, nil
+}
+
+type target struct {
+	labels map[string]string
+	proxy  tcpproxy.Reconfigurer
+}
+
+// Controller realizes NetworkChaos objects with the proxies registered with
+// it, the proxies are selected by the label selectors of the specs
+type Controller struct {
+	mu      sync.Mutex
+	targets []target
+}
+
+// NewController creates a controller without proxies
+func NewController() *Controller {
+	return &Controller{}
+}
+
+// Register makes proxy a target of the specs selecting labels, typically
+// the labels of the pods the process stands for
+func (c *Controller) Register(
+	labels map[string]string,
+	proxy tcpproxy.Reconfigurer,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = append(c.targets, target{labels: labels, proxy: proxy})
+}
+
+func (t target) matches(selector Selector) bool {
+	for k, v := range selector.LabelSelectors {
+		if t.labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// selected returns the proxies selected by spec, as per its selector and
+// mode ("one" or "all")
+func (c *Controller) selected(spec NetworkChaosSpec) (
+	[]tcpproxy.Reconfigurer,
+	error,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var proxies []tcpproxy.Reconfigurer
+	for _, t := range c.targets {
+		if t.matches(spec.Selector) {
+			proxies = append(proxies, t.proxy)
+		}
+	}
+	if len(proxies) == 0 {
+		return nil, errors.New("No proxy selected")
+	}
+	switch spec.Mode {
+	case "", "all":
+		return proxies, nil
+	case "one":
+		return proxies[:1], nil
+	}
+	return nil, errors.Errorf("Unsupported mode %q", spec.Mode)
+}
+
+// Apply realizes chaos with the selected proxies until revert is called
+func (c *Controller) Apply(chaos NetworkChaos) (
+	revert func() error,
+	err error,
+) {
+	proxies, err := c.selected(chaos.Spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NetworkChaos %s", chaos.Metadata.Name)
+	}
+	var reverts []func() error
+	revertAll := func() error {
+		var firstErr error
+		for _, r := range reverts {
+			if err := r(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+	for _, proxy := range proxies {
+		r, err := Apply(proxy, chaos)
+		if err != nil {
+			revertAll()
+			return nil, err
+		}
+		reverts = append(reverts, r)
+	}
+	return revertAll, nil
+}
+
+// Run realizes chaos for its duration, or until ctx is done if it has none,
+// and reverts it
+func (c *Controller) Run(ctx context.Context, chaos NetworkChaos) error {
+	d, err := chaos.Spec.duration()
+	if err != nil {
+		return err
+	}
+	revert, err := c.Apply(chaos)
+	if err != nil {
+		return err
+	}
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	} else {
+		<-ctx.Done()
+	}
+	return revert()
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Rubrik, Inc.
+
+package chaosmesh_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/chaosmesh"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"github.com/stretchr/testify/require"
+)
+
+const specs = `
+apiVersion: chaos-mesh.org/v1alpha1
+kind: NetworkChaos
+metadata:
+  name: slow-db
+spec:
+  action: delay
+  mode: all
+  selector:
+    labelSelectors:
+      app: db
+  delay:
+    latency: 50ms
+    jitter: 10ms
+  duration: 200ms
+---
+apiVersion: chaos-mesh.org/v1alpha1
+kind: PodChaos
+metadata:
+  name: ignored
+spec:
+  action: pod-kill
+---
+apiVersion: chaos-mesh.org/v1alpha1
+kind: NetworkChaos
+metadata:
+  name: db-partition
+spec:
+  action: partition
+  mode: one
+  selector:
+    labelSelectors:
+      app: db
+`
+
+func startEchoProxy(t *testing.T) *tcpproxy.Proxy {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { backend.Close() })
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	proxy, err := tcpproxy.NewProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		backend.Addr().String(),
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	t.Cleanup(proxy.Stop)
+	return proxy
+}
+
+// roundTrip echoes a message through proxy and returns how long it took
+func roundTrip(proxy *tcpproxy.Proxy) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.Dial("tcp", proxy.FrontendHostPort())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return 0, err
+	}
+	_, err = io.ReadFull(conn, make([]byte, 4))
+	return time.Since(start), err
+}
+
+func TestParseNetworkChaos(t *testing.T) {
+	chaos, err := chaosmesh.ParseNetworkChaos([]byte(specs))
+	require.NoError(t, err)
+	require.Len(t, chaos, 2)
+	require.Equal(t, "slow-db", chaos[0].Metadata.Name)
+	require.Equal(t, chaosmesh.ActionDelay, chaos[0].Spec.Action)
+	require.Equal(t, "50ms", chaos[0].Spec.Delay.Latency)
+	require.Equal(t, "db", chaos[1].Spec.Selector.LabelSelectors["app"])
+
+	for _, malformed := range []string{
+		"kind: NetworkChaos\nspec:\n  action: delay\n",
+		"kind: NetworkChaos\nspec:\n  action: loss\n  loss:\n    loss: '150'\n",
+		"kind: NetworkChaos\nspec:\n  action: bandwidth\n",
+		"kind: NetworkChaos\nspec:\n  action: partition\n  duration: soon\n",
+	} {
+		_, err := chaosmesh.ParseNetworkChaos([]byte(malformed))
+		require.Error(t, err, malformed)
+	}
+}
+
+func TestController(t *testing.T) {
+	chaos, err := chaosmesh.ParseNetworkChaos([]byte(specs))
+	require.NoError(t, err)
+	db := startEchoProxy(t)
+	web := startEchoProxy(t)
+	c := chaosmesh.NewController()
+	c.Register(map[string]string{"app": "db"}, db)
+	c.Register(map[string]string{"app": "web"}, web)
+
+	// the delay applies to both directions, for its duration
+	done := make(chan error)
+	go func() { done <- c.Run(context.Background(), chaos[0]) }()
+	time.Sleep(20 * time.Millisecond)
+	elapsed, err := roundTrip(db)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, elapsed, 80*time.Millisecond)
+	elapsed, err = roundTrip(web)
+	require.NoError(t, err)
+	require.Less(t, elapsed, 40*time.Millisecond)
+	require.NoError(t, <-done)
+	elapsed, err = roundTrip(db)
+	require.NoError(t, err)
+	require.Less(t, elapsed, 40*time.Millisecond)
+
+	revert, err := c.Apply(chaos[1])
+	require.NoError(t, err)
+	_, err = roundTrip(db)
+	require.Error(t, err)
+	require.NoError(t, revert())
+	_, err = roundTrip(db)
+	require.NoError(t, err)
+
+	chaos[1].Spec.Selector.LabelSelectors["app"] = "cache"
+	_, err = c.Apply(chaos[1])
+	require.Error(t, err)
+}
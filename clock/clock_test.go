@@ -0,0 +1,20 @@
+// Copyright 2024 Rubrik, Inc.
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockOnlyMovesWhenAdvanced(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("expected: %v, got: %v", start, c.Now())
+	}
+	c.Advance(time.Hour)
+	if !c.Now().Equal(start.Add(time.Hour)) {
+		t.Errorf("expected: %v, got: %v", start.Add(time.Hour), c.Now())
+	}
+}
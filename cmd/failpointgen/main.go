@@ -0,0 +1,92 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Command failpointgen instruments the failure-point annotations
+// (//failpoint:<label>) of Go sources with calls to the failure-point
+// registry, see package failpointgen. It takes files and directories, and
+// defaults to the file of the go:generate directive running it:
+//
+//	//go:generate go run github.com/rubrikinc/failure-test-utils/cmd/failpointgen .
+//
+// Production builds must strip the instrumentation with -disable.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rubrikinc/failure-test-utils/failpointgen"
+)
+
+func main() {
+	disable := flag.Bool("disable", false, "strip the instrumentation")
+	flag.Parse()
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		if gofile := os.Getenv("GOFILE"); gofile != "" {
+			paths = []string{gofile}
+		}
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: failpointgen [-disable] path...")
+		os.Exit(2)
+	}
+	for _, path := range paths {
+		files, err := goFiles(path)
+		if err == nil {
+			for _, file := range files {
+				if err = process(file, *disable); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failpointgen: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// goFiles returns path if it is a file, or the Go files of the directory
+// path
+func goFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+func process(file string, disable bool) error {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	if disable {
+		out = failpointgen.Disable(src)
+	} else if out, err = failpointgen.Enable(file, src); err != nil {
+		return err
+	}
+	if bytes.Equal(src, out) {
+		return nil
+	}
+	return os.WriteFile(file, out, 0644)
+}
@@ -0,0 +1,22 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Command faultctl serves JSON-RPC control requests for failure generators
+// and test proxies on stdin / stdout, see package stdioctl. It exits when
+// stdin is closed or on a shutdown request. Logs go to stderr.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rubrikinc/failure-test-utils/stdioctl"
+)
+
+func main() {
+	s := stdioctl.NewSupervisor(context.Background())
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "faultctl: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package coordfail wraps coordination clients (distributed locks, sessions
+// and watches as exposed by etcd or ZooKeeper clients) to inject session
+// expirations, lost watch events and delayed or failed lock grants. The
+// faults are injected at failure-points of a failuregen.Registry, named after
+// the prefix given to the wrapper and the fault (e.g. "coordfail.lock.grant"
+// for DefaultPrefix and LockGrant), so that they can be armed, listed and
+// tagged individually.
+package coordfail
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// DefaultPrefix is the prefix of the failure-points of wrappers of a single
+// coordination client
+const DefaultPrefix failuregen.FailurePoint = "coordfail"
+
+// Failure-points of the wrappers, relative to their prefix
+const (
+	// LockGrant is consulted before acquiring a lock: delays delay the
+	// grant, failures fail Lock without acquiring the lock
+	LockGrant failuregen.FailurePoint = "lock.grant"
+	// SessionExpiry is consulted periodically, failures expire the session
+	SessionExpiry failuregen.FailurePoint = "session.expiry"
+	// WatchEvent is consulted for every watch event, failures drop the event
+	WatchEvent failuregen.FailurePoint = "watch.event"
+)
+
+// descriptions of the failure-points, as registered
+var descriptions = map[failuregen.FailurePoint]string{
+	LockGrant:     "Delayed or failed grant of a distributed lock",
+	SessionExpiry: "Expiry of a coordination session",
+	WatchEvent:    "Lost watch event",
+}
+
+// register registers the failure-point of fault under prefix in r
+func register(
+	r *failuregen.Registry,
+	prefix failuregen.FailurePoint,
+	fault failuregen.FailurePoint,
+) (failuregen.FailurePoint, error) {
+	fp := prefix + "." + fault
+	return fp, errors.Wrapf(
+		r.RegisterFailurePoint(fp, descriptions[fault]),
+		"Couldn't register failure-point %s",
+		fp)
+}
+
+// Locker is a distributed lock, e.g. etcd's concurrency.Mutex
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+// Session is a lease-backed client session, e.g. etcd's concurrency.Session
+type Session interface {
+	// Done is closed when the session expires or is closed
+	Done() <-chan struct{}
+	Close() error
+}
+
+type faultyLocker struct {
+	Locker
+	registry *failuregen.Registry
+	fp       failuregen.FailurePoint
+}
+
+// NewLocker wraps l such that lock acquisition consults the LockGrant
+// failure-point under prefix in r first
+func NewLocker(
+	l Locker,
+	r *failuregen.Registry,
+	prefix failuregen.FailurePoint,
+) (Locker, error) {
+	fp, err := register(r, prefix, LockGrant)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyLocker{Locker: l, registry: r, fp: fp}, nil
+}
+
+// Lock acquires the lock unless a failure is injected
+func (l *faultyLocker) Lock(ctx context.Context) error {
+	if err := l.registry.FailMaybeContext(ctx, l.fp); err != nil {
+		return errors.Wrap(err, "injected lock failure")
+	}
+	return l.Locker.Lock(ctx)
+}
+
+// FaultySession is a Session which may expire due to injected failures
+type FaultySession struct {
+	Session
+	registry *failuregen.Registry
+	fp       failuregen.FailurePoint
+	done     chan struct{}
+	expire   sync.Once
+	closed   chan struct{}
+	closeErr error
+	close    sync.Once
+}
+
+// NewSession wraps s such that the SessionExpiry failure-point under prefix
+// in r is consulted every checkInterval, an injected failure expires the
+// session (its Done channel is closed). The underlying session is left
+// intact, as if the client lost it.
+func NewSession(
+	s Session,
+	r *failuregen.Registry,
+	prefix failuregen.FailurePoint,
+	checkInterval time.Duration,
+) (*FaultySession, error) {
+	fp, err := register(r, prefix, SessionExpiry)
+	if err != nil {
+		return nil, err
+	}
+	fs := &FaultySession{
+		Session:  s,
+		registry: r,
+		fp:       fp,
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go fs.run(checkInterval)
+	return fs, nil
+}
+
+func (fs *FaultySession) run(checkInterval time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fs.closed:
+			return
+		case <-fs.Session.Done():
+			fs.Expire()
+			return
+		case <-ticker.C:
+			if fs.registry.FailMaybe(fs.fp) != nil {
+				fs.Expire()
+				return
+			}
+		}
+	}
+}
+
+// Expire expires the session immediately
+func (fs *FaultySession) Expire() {
+	fs.expire.Do(func() { close(fs.done) })
+}
+
+// Done is closed when the session expires, either genuinely or due to an
+// injected failure
+func (fs *FaultySession) Done() <-chan struct{} {
+	return fs.done
+}
+
+// Close closes the underlying session
+func (fs *FaultySession) Close() error {
+	fs.close.Do(func() {
+		close(fs.closed)
+		fs.closeErr = fs.Session.Close()
+	})
+	return fs.closeErr
+}
+
+// Watch forwards events from a watch channel, dropping events for which the
+// WatchEvent failure-point under prefix in r injects a failure to simulate
+// lost watch notifications. The returned channel is closed when events is
+// closed or ctx is done.
+func Watch[T any](
+	ctx context.Context,
+	events <-chan T,
+	r *failuregen.Registry,
+	prefix failuregen.FailurePoint,
+) (<-chan T, error) {
+	fp, err := register(r, prefix, WatchEvent)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if r.FailMaybeContext(ctx, fp) != nil {
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Rubrik, Inc.
+
+package coordfail_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/coordfail"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+type testLocker struct {
+	sync.Mutex
+}
+
+func (l *testLocker) Lock(ctx context.Context) error {
+	l.Mutex.Lock()
+	return nil
+}
+
+func (l *testLocker) Unlock(ctx context.Context) error {
+	l.Mutex.Unlock()
+	return nil
+}
+
+type testSession struct {
+	done chan struct{}
+}
+
+func (s *testSession) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *testSession) Close() error {
+	close(s.done)
+	return nil
+}
+
+func TestLockerInjectsFailures(t *testing.T) {
+	ctx := context.Background()
+	r := failuregen.NewRegistry()
+	l, err := coordfail.NewLocker(&testLocker{}, r, coordfail.DefaultPrefix)
+	require.NoError(t, err)
+
+	require.NoError(t, l.Lock(ctx))
+	require.NoError(t, l.Unlock(ctx))
+
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	r.SetGenerator("coordfail.lock.grant", fg)
+	require.ErrorIs(t, l.Lock(ctx), failuregen.ErrInjectedFailure)
+}
+
+func TestSessionExpiresOnInjectedFailure(t *testing.T) {
+	r := failuregen.NewRegistry()
+	s, err := coordfail.NewSession(
+		&testSession{done: make(chan struct{})},
+		r,
+		"etcd",
+		time.Millisecond)
+	require.NoError(t, err)
+	defer s.Close()
+
+	select {
+	case <-s.Done():
+		t.Fatal("session expired without injected failure")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	r.SetGenerator("etcd.session.expiry", fg)
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session did not expire")
+	}
+}
+
+func TestWatchDropsEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := failuregen.NewRegistry()
+	fg := failuregen.NewFailureGenerator()
+	r.SetGenerator("coordfail.watch.event", fg)
+	events := make(chan int)
+	watched, err := coordfail.Watch[int](ctx, events, r, coordfail.DefaultPrefix)
+	require.NoError(t, err)
+
+	events <- 1
+	require.Equal(t, 1, <-watched)
+
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	events <- 2
+	require.NoError(t, fg.SetFailureProbability(0.0))
+	events <- 3
+	require.Equal(t, 3, <-watched)
+
+	close(events)
+	_, ok := <-watched
+	require.False(t, ok)
+}
+
+func TestFailurePointsAreRegistered(t *testing.T) {
+	r := failuregen.NewRegistry()
+	_, err := coordfail.NewLocker(&testLocker{}, r, coordfail.DefaultPrefix)
+	require.NoError(t, err)
+	s, err := coordfail.NewSession(
+		&testSession{done: make(chan struct{})},
+		r,
+		coordfail.DefaultPrefix,
+		time.Hour)
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = coordfail.Watch[int](
+		context.Background(),
+		make(chan int),
+		r,
+		coordfail.DefaultPrefix)
+	require.NoError(t, err)
+	// wrapping another client under the same prefix shares its
+	// failure-points
+	_, err = coordfail.NewLocker(&testLocker{}, r, coordfail.DefaultPrefix)
+	require.NoError(t, err)
+
+	var names []failuregen.FailurePoint
+	for _, info := range r.ListFailurePoints() {
+		require.NotEmpty(t, info.Description)
+		names = append(names, info.Name)
+	}
+	require.Equal(t, []failuregen.FailurePoint{
+		"coordfail.lock.grant",
+		"coordfail.session.expiry",
+		"coordfail.watch.event",
+	}, names)
+
+	_, err = coordfail.NewLocker(&testLocker{}, r, "bad:prefix")
+	require.Error(t, err)
+}
@@ -0,0 +1,283 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package dnsfail provides a DNS proxy injecting faults into the resolution
+// path of the system under test, in particular into the fallback from UDP to
+// TCP: UDP queries can be answered with truncated responses (TC bit set),
+// forcing resolvers to retry over TCP, and TCP queries can fail. Resolver
+// fallback logic is rarely exercised otherwise.
+package dnsfail
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"go.uber.org/atomic"
+)
+
+const (
+	headerLen = 12
+	// maxUDPMessage is the largest UDP message the proxy handles (EDNS0
+	// allows messages beyond the historical 512 bytes)
+	maxUDPMessage = 65535
+	// upstreamTimeout bounds exchanges with the upstream server
+	upstreamTimeout = 5 * time.Second
+	flagQR          = 0x80
+	flagTC          = 0x02
+)
+
+// Config configures the faults of a Proxy, nil generators inject no fault
+type Config struct {
+	// TruncateFg answers UDP queries with a truncated response (TC bit set,
+	// no records), which makes resolvers fall back to TCP
+	TruncateFg failuregen.FailureGenerator
+	// TCPFailFg closes TCP connections before answering, failing the TCP
+	// fallback
+	TCPFailFg failuregen.FailureGenerator
+}
+
+// Stats counts the faults injected by a Proxy
+type Stats struct {
+	// Truncated is the number of UDP queries answered with a truncated
+	// response
+	Truncated int64
+	// TCPFailures is the number of TCP connections failed
+	TCPFailures int64
+}
+
+// Proxy forwards DNS queries to an upstream server over the transport (UDP
+// or TCP) they were received on, injecting faults as configured
+type Proxy struct {
+	ctx         context.Context
+	upstream    string
+	cfg         Config
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	quit        chan struct{}
+	wg          sync.WaitGroup
+	truncated   atomic.Int64
+	tcpFailures atomic.Int64
+}
+
+// NewProxy starts a proxy listening on UDP and TCP at listenHostPort (port 0
+// picks a port free on both transports) and forwarding to upstreamHostPort
+func NewProxy(
+	ctx context.Context,
+	listenHostPort string,
+	upstreamHostPort string,
+	cfg Config,
+) (*Proxy, error) {
+	p := &Proxy{
+		ctx:      ctx,
+		upstream: upstreamHostPort,
+		cfg:      cfg,
+		quit:     make(chan struct{}),
+	}
+	tcpListener, err := net.Listen("tcp", listenHostPort)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen tcp")
+	}
+	udpConn, err := net.ListenPacket("udp", tcpListener.Addr().String())
+	if err != nil {
+		tcpListener.Close()
+		return nil, errors.Wrap(err, "listen udp")
+	}
+	p.tcpListener, p.udpConn = tcpListener, udpConn
+	p.wg.Add(2)
+	go p.serveUDP()
+	go p.serveTCP()
+	log.Infof(ctx, "Started DNS proxy on %s -> %s", p.Addr(), upstreamHostPort)
+	return p, nil
+}
+
+// Addr returns the host:port the proxy listens on, for both UDP and TCP
+func (p *Proxy) Addr() string {
+	return p.tcpListener.Addr().String()
+}
+
+// Stats returns the faults injected so far
+func (p *Proxy) Stats() Stats {
+	return Stats{
+		Truncated:   p.truncated.Load(),
+		TCPFailures: p.tcpFailures.Load(),
+	}
+}
+
+// Stop stops the proxy
+func (p *Proxy) Stop() {
+	close(p.quit)
+	p.udpConn.Close()
+	p.tcpListener.Close()
+	p.wg.Wait()
+}
+
+func injects(fg failuregen.FailureGenerator) bool {
+	return fg != nil && fg.FailMaybe() != nil
+}
+
+func (p *Proxy) serveUDP() {
+	defer p.wg.Done()
+	buf := make([]byte, maxUDPMessage)
+	for {
+		n, client, err := p.udpConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-p.quit:
+				return
+			default:
+			}
+			log.Errorf(p.ctx, "DNS proxy UDP read error: %v", err)
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := p.handleUDP(query, client); err != nil {
+				log.Warningf(p.ctx, "DNS proxy UDP query failed: %v", err)
+			}
+		}()
+	}
+}
+
+func (p *Proxy) handleUDP(query []byte, client net.Addr) error {
+	if injects(p.cfg.TruncateFg) {
+		resp, err := truncatedResponse(query)
+		if err != nil {
+			return err
+		}
+		p.truncated.Inc()
+		_, err = p.udpConn.WriteTo(resp, client)
+		return errors.Wrap(err, "write truncated response")
+	}
+	conn, err := net.DialTimeout("udp", p.upstream, upstreamTimeout)
+	if err != nil {
+		return errors.Wrap(err, "dial upstream")
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(upstreamTimeout)); err != nil {
+		return errors.Wrap(err, "set upstream deadline")
+	}
+	if _, err := conn.Write(query); err != nil {
+		return errors.Wrap(err, "write upstream")
+	}
+	buf := make([]byte, maxUDPMessage)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return errors.Wrap(err, "read upstream")
+	}
+	_, err = p.udpConn.WriteTo(buf[:n], client)
+	return errors.Wrap(err, "write response")
+}
+
+func (p *Proxy) serveTCP() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.tcpListener.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+				return
+			default:
+			}
+			log.Errorf(p.ctx, "DNS proxy accept error: %v", err)
+			continue
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer conn.Close()
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			go func() {
+				select {
+				case <-p.quit:
+					conn.Close()
+				case <-stopCh:
+				}
+			}()
+			if injects(p.cfg.TCPFailFg) {
+				p.tcpFailures.Inc()
+				return
+			}
+			if err := p.handleTCP(conn); err != nil {
+				log.Warningf(p.ctx, "DNS proxy TCP query failed: %v", err)
+			}
+		}()
+	}
+}
+
+// handleTCP relays the (length-prefixed) messages of a TCP connection to
+// and from the upstream server
+func (p *Proxy) handleTCP(conn net.Conn) error {
+	upstream, err := net.DialTimeout("tcp", p.upstream, upstreamTimeout)
+	if err != nil {
+		return errors.Wrap(err, "dial upstream")
+	}
+	defer upstream.Close()
+	doneCh := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		if tcpConn, ok := upstream.(*net.TCPConn); ok {
+			_ = tcpConn.CloseWrite()
+		}
+		close(doneCh)
+	}()
+	_, err = io.Copy(conn, upstream)
+	conn.Close()
+	<-doneCh
+	return errors.Wrap(err, "relay")
+}
+
+// truncatedResponse returns the response to query with the TC bit set and
+// no records beyond the question
+func truncatedResponse(query []byte) ([]byte, error) {
+	end, err := questionEnd(query)
+	if err != nil {
+		return nil, err
+	}
+	resp := append([]byte(nil), query[:end]...)
+	resp[2] |= flagQR | flagTC
+	// ANCOUNT, NSCOUNT and ARCOUNT
+	for i := 6; i < headerLen; i++ {
+		resp[i] = 0
+	}
+	return resp, nil
+}
+
+// questionEnd returns the offset following the question section of msg
+func questionEnd(msg []byte) (int, error) {
+	if len(msg) < headerLen {
+		return 0, errors.New("DNS message shorter than its header")
+	}
+	off := headerLen
+	for q := binary.BigEndian.Uint16(msg[4:6]); q > 0; q-- {
+		for {
+			if off >= len(msg) {
+				return 0, errors.New("Malformed DNS question")
+			}
+			l := int(msg[off])
+			if l == 0 {
+				off++
+				break
+			}
+			if l&0xc0 == 0xc0 {
+				off += 2
+				break
+			}
+			off += 1 + l
+		}
+		// QTYPE and QCLASS
+		off += 4
+	}
+	if off > len(msg) {
+		return 0, errors.New("Malformed DNS question")
+	}
+	return off, nil
+}
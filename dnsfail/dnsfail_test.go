@@ -0,0 +1,132 @@
+// Copyright 2024 Rubrik, Inc.
+
+package dnsfail_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/dnsfail"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// answer returns the response of a fake server to query: A queries resolve
+// to 192.0.2.1, other queries have no answer
+func answer(query []byte) []byte {
+	off := 12
+	for query[off] != 0 {
+		off += 1 + int(query[off])
+	}
+	off += 5
+	resp := append([]byte(nil), query[:off]...)
+	resp[2] |= 0x80
+	binary.BigEndian.PutUint16(resp[6:8], 0)
+	binary.BigEndian.PutUint16(resp[8:10], 0)
+	binary.BigEndian.PutUint16(resp[10:12], 0)
+	if binary.BigEndian.Uint16(query[off-4:off-2]) != 1 {
+		return resp
+	}
+	binary.BigEndian.PutUint16(resp[6:8], 1)
+	return append(resp,
+		0xc0, 12, // name pointer to the question
+		0, 1, // type A
+		0, 1, // class IN
+		0, 0, 0, 60, // TTL
+		0, 4, // rdlength
+		192, 0, 2, 1)
+}
+
+// startFakeServer starts a DNS server on UDP and TCP answering as per answer
+func startFakeServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(answer(buf[:n]), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var length [2]byte
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(length[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					resp := answer(query)
+					binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+					_, _ = conn.Write(append(length[:], resp...))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func resolverVia(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(
+			ctx context.Context,
+			network string,
+			_ string,
+		) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+func TestTruncationForcesTCPFallback(t *testing.T) {
+	upstream := startFakeServer(t)
+	truncateFg := failuregen.NewFailureGenerator()
+	tcpFailFg := failuregen.NewFailureGenerator()
+	p, err := dnsfail.NewProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		upstream,
+		dnsfail.Config{TruncateFg: truncateFg, TCPFailFg: tcpFailFg})
+	require.NoError(t, err)
+	defer p.Stop()
+	resolver := resolverVia(p.Addr())
+
+	addrs, err := resolver.LookupHost(context.Background(), "svc.test.")
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1"}, addrs)
+	require.Equal(t, dnsfail.Stats{}, p.Stats())
+
+	require.NoError(t, truncateFg.SetFailureProbability(1.0))
+	addrs, err = resolver.LookupHost(context.Background(), "svc.test.")
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1"}, addrs)
+	require.Positive(t, p.Stats().Truncated)
+
+	require.NoError(t, tcpFailFg.SetFailureProbability(1.0))
+	_, err = resolver.LookupHost(context.Background(), "svc.test.")
+	require.Error(t, err)
+	require.Positive(t, p.Stats().TCPFailures)
+}
@@ -0,0 +1,329 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package failpointgen instruments Go sources with failure-points. A
+// failure-point is declared by an annotation comment on its own line inside
+// a function returning an error:
+//
+//	func (s *Store) Commit(tx *Tx) (int, error) {
+//		//failpoint:before-commit
+//		...
+//	}
+//
+// Enable inserts, right after the annotation, a call to
+// failuregen.DefaultRegistry.FailMaybe("store.Store.Commit.before-commit")
+// returning the injected error. Disable strips the inserted code, which
+// must be done for production builds. The inserted code is delimited by
+// marker comments, enabling and disabling are idempotent.
+package failpointgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	failuregenPath = "github.com/rubrikinc/failure-test-utils/failuregen"
+	beginMarker    = "// failpoint-generated-begin"
+	endMarker      = "// failpoint-generated-end"
+	lineMarker     = "// failpoint-generated"
+)
+
+var annotation = regexp.MustCompile(`^//failpoint:([\w.-]+)$`)
+
+// Disable strips the code inserted by Enable from src
+func Disable(src []byte) []byte {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	out := make([]byte, 0, len(src))
+	inBlock, skipBlank := false, false
+	for _, line := range lines {
+		trimmed := string(bytes.TrimSpace(line))
+		switch {
+		case trimmed == beginMarker:
+			inBlock = true
+		case trimmed == endMarker:
+			inBlock = false
+		case inBlock:
+		case strings.HasSuffix(trimmed, lineMarker):
+			// the import declaration is separated from the next one by a
+			// blank line
+			skipBlank = true
+			continue
+		case skipBlank && trimmed == "":
+		default:
+			out = append(out, line...)
+		}
+		skipBlank = false
+	}
+	return out
+}
+
+// funcScope is a function (declaration or literal) that may hold
+// failure-points
+type funcScope struct {
+	name    string
+	typ     *ast.FuncType
+	pos     token.Pos
+	end     token.Pos
+	hasBody bool
+}
+
+// insertion is code to insert at a byte offset of the source
+type insertion struct {
+	offset int
+	code   string
+}
+
+// Enable instruments the failure-point annotations of src, the source of
+// filename. It returns src formatted, and unchanged otherwise, if it holds no
+// annotation.
+func Enable(filename string, src []byte) ([]byte, error) {
+	src = Disable(src)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", filename)
+	}
+	scopes := funcScopes(file)
+	alias, imported := failuregenAlias(file)
+
+	var insertions []insertion
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			m := annotation.FindStringSubmatch(c.Text)
+			if m == nil {
+				continue
+			}
+			code, err := instrument(
+				fset,
+				src,
+				scopes,
+				c.Pos(),
+				alias,
+				file.Name.Name,
+				m[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s", fset.Position(c.Pos()))
+			}
+			insertions = append(insertions, insertion{
+				offset: lineEnd(src, fset.Position(c.Pos()).Offset),
+				code:   code,
+			})
+		}
+	}
+	if len(insertions) == 0 {
+		return src, nil
+	}
+	if !imported {
+		insertions = append(insertions, insertion{
+			offset: lineEnd(src, fset.Position(file.Name.End()).Offset),
+			code: fmt.Sprintf(
+				"import %s %q %s\n",
+				alias,
+				failuregenPath,
+				lineMarker),
+		})
+	}
+	sort.Slice(insertions, func(i, j int) bool {
+		return insertions[i].offset > insertions[j].offset
+	})
+	out := append([]byte(nil), src...)
+	for _, ins := range insertions {
+		tail := append([]byte(ins.code), out[ins.offset:]...)
+		out = append(out[:ins.offset], tail...)
+	}
+	formatted, err := format.Source(out)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to format %s", filename)
+	}
+	return formatted, nil
+}
+
+// instrument returns the code to insert after the annotation at commentPos
+func instrument(
+	fset *token.FileSet,
+	src []byte,
+	scopes []funcScope,
+	commentPos token.Pos,
+	alias string,
+	pkg string,
+	label string,
+) (string, error) {
+	pos := fset.Position(commentPos)
+	lineStart := bytes.LastIndexByte(src[:pos.Offset], '\n') + 1
+	indent := src[lineStart:pos.Offset]
+	if len(bytes.TrimSpace(indent)) != 0 {
+		return "", errors.New("failpoint annotation must be on its own line")
+	}
+	scope, ok := innermostScope(scopes, commentPos)
+	if !ok {
+		return "", errors.New("failpoint annotation outside of a function")
+	}
+	zeros, err := zeroResults(fset, src, scope.typ)
+	if err != nil {
+		return "", err
+	}
+	name := pkg + "." + scope.name + "." + label
+	ind := string(indent)
+	return fmt.Sprintf(
+		"%s%s\n"+
+			"%sif err := %s.DefaultRegistry.FailMaybe(%q); err != nil {\n"+
+			"%s\treturn %s\n"+
+			"%s}\n"+
+			"%s%s\n",
+		ind, beginMarker,
+		ind, alias, name,
+		ind, strings.Join(append(zeros, "err"), ", "),
+		ind,
+		ind, endMarker), nil
+}
+
+// funcScopes returns the functions of file
+func funcScopes(file *ast.File) []funcScope {
+	var scopes []funcScope
+	var outer string
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			outer = fn.Name.Name
+			if fn.Recv != nil && len(fn.Recv.List) > 0 {
+				outer = receiverName(fn.Recv.List[0].Type) + "." + outer
+			}
+			scopes = append(scopes, funcScope{
+				name:    outer,
+				typ:     fn.Type,
+				pos:     fn.Pos(),
+				end:     fn.End(),
+				hasBody: fn.Body != nil,
+			})
+		case *ast.FuncLit:
+			scopes = append(scopes, funcScope{
+				name:    outer,
+				typ:     fn.Type,
+				pos:     fn.Pos(),
+				end:     fn.End(),
+				hasBody: true,
+			})
+		}
+		return true
+	})
+	return scopes
+}
+
+// innermostScope returns the innermost function enclosing pos
+func innermostScope(scopes []funcScope, pos token.Pos) (funcScope, bool) {
+	var inner funcScope
+	found := false
+	for _, s := range scopes {
+		if s.hasBody && s.pos <= pos && pos < s.end &&
+			(!found || s.pos >= inner.pos) {
+			inner, found = s, true
+		}
+	}
+	return inner, found
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "_"
+}
+
+// zeroResults returns the zero values of the results of fn but the last,
+// which must be an error
+func zeroResults(
+	fset *token.FileSet,
+	src []byte,
+	fn *ast.FuncType,
+) ([]string, error) {
+	var types []ast.Expr
+	if fn.Results != nil {
+		for _, field := range fn.Results.List {
+			for n := 0; n < len(field.Names) || n == 0; n++ {
+				types = append(types, field.Type)
+			}
+		}
+	}
+	if len(types) == 0 {
+		return nil, errors.New("failpoint in function not returning an error")
+	}
+	last, ok := types[len(types)-1].(*ast.Ident)
+	if !ok || last.Name != "error" {
+		return nil, errors.New("failpoint in function not returning an error")
+	}
+	zeros := make([]string, 0, len(types)-1)
+	for _, typ := range types[:len(types)-1] {
+		zeros = append(zeros, zeroValue(fset, src, typ))
+	}
+	return zeros, nil
+}
+
+// zeroValue returns an expression of the zero value of typ
+func zeroValue(fset *token.FileSet, src []byte, typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType,
+		*ast.InterfaceType:
+		return "nil"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "nil"
+		}
+	case *ast.Ident:
+		switch t.Name {
+		case "error", "any":
+			return "nil"
+		case "string":
+			return `""`
+		case "bool":
+			return "false"
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128",
+			"byte", "rune":
+			return "0"
+		}
+	}
+	from, to := fset.Position(typ.Pos()).Offset, fset.Position(typ.End()).Offset
+	return "*new(" + string(src[from:to]) + ")"
+}
+
+// failuregenAlias returns the name failuregen is (or is to be) imported as
+// and whether it is imported already
+func failuregenAlias(file *ast.File) (string, bool) {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != failuregenPath {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name, true
+		}
+		return "failuregen", true
+	}
+	return "failuregen", false
+}
+
+// lineEnd returns the offset following the end of the line holding offset
+func lineEnd(src []byte, offset int) int {
+	if i := bytes.IndexByte(src[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(src)
+}
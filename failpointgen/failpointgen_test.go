@@ -0,0 +1,96 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failpointgen_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failpointgen"
+)
+
+const annotated = `package store
+
+import "fmt"
+
+type Store struct{}
+
+type Result struct{ n int }
+
+func (s *Store) Commit(key string) (Result, []byte, int, error) {
+	//failpoint:before-commit
+	fmt.Println(key)
+	return Result{}, nil, 0, nil
+}
+
+func Flush() error {
+	return func() error {
+		//failpoint:flush
+		return nil
+	}()
+}
+`
+
+const instrumented = `package store
+
+import failuregen "github.com/rubrikinc/failure-test-utils/failuregen" // failpoint-generated
+
+import "fmt"
+
+type Store struct{}
+
+type Result struct{ n int }
+
+func (s *Store) Commit(key string) (Result, []byte, int, error) {
+	//failpoint:before-commit
+	// failpoint-generated-begin
+	if err := failuregen.DefaultRegistry.FailMaybe("store.Store.Commit.before-commit"); err != nil {
+		return *new(Result), nil, 0, err
+	}
+	// failpoint-generated-end
+	fmt.Println(key)
+	return Result{}, nil, 0, nil
+}
+
+func Flush() error {
+	return func() error {
+		//failpoint:flush
+		// failpoint-generated-begin
+		if err := failuregen.DefaultRegistry.FailMaybe("store.Flush.flush"); err != nil {
+			return err
+		}
+		// failpoint-generated-end
+		return nil
+	}()
+}
+`
+
+func TestEnableAndDisable(t *testing.T) {
+	out, err := failpointgen.Enable("store.go", []byte(annotated))
+	require.NoError(t, err)
+	require.Equal(t, instrumented, string(out))
+
+	again, err := failpointgen.Enable("store.go", out)
+	require.NoError(t, err)
+	require.Equal(t, instrumented, string(again))
+
+	require.Equal(t, annotated, string(failpointgen.Disable(out)))
+}
+
+func TestEnableRejectsInvalidAnnotations(t *testing.T) {
+	_, err := failpointgen.Enable("store.go", []byte(`package store
+
+func Get() int {
+	//failpoint:get
+	return 0
+}
+`))
+	require.Error(t, err)
+
+	_, err = failpointgen.Enable("store.go", []byte(`package store
+
+//failpoint:top-level
+`))
+	require.Error(t, err)
+}
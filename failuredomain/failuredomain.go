@@ -0,0 +1,200 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package failuredomain groups the failure generators and proxies standing
+// for one node (or rack, or zone) of the system under test, so that tests
+// inject faults in terms of blast radius: fail everything in one domain,
+// degrade another.
+package failuredomain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+)
+
+// Health is the state a domain was put in
+type Health string
+
+const (
+	// Healthy domains inject the faults their members are configured with
+	Healthy Health = "healthy"
+	// Degraded domains fail a fraction of the calls of their members
+	Degraded Health = "degraded"
+	// Failed domains fail all the calls of their members
+	Failed Health = "failed"
+)
+
+// configured is implemented by generators which can report their config
+type configured interface {
+	Config() failuregen.GeneratorConfig
+}
+
+// FailureDomain is a group of generators and proxies failing together.
+// Domain-level operations apply to the members of the domain at the time of
+// the operation, members added to a faulted domain join its faults on the
+// next operation.
+type FailureDomain struct {
+	name    string
+	mu      sync.Mutex
+	gens    map[string]failuregen.FailureGenerator
+	proxies map[string]tcpproxy.Reconfigurer
+	health  Health
+	// savedGens and savedProxies are the configs of the members before the
+	// domain was faulted, restored by Restore
+	savedGens    map[string]failuregen.GeneratorConfig
+	savedProxies map[string]tcpproxy.ProxyConfig
+}
+
+// New creates an empty, healthy, domain
+func New(name string) *FailureDomain {
+	return &FailureDomain{
+		name:    name,
+		gens:    make(map[string]failuregen.FailureGenerator),
+		proxies: make(map[string]tcpproxy.Reconfigurer),
+		health:  Healthy,
+	}
+}
+
+// Name returns the name of the domain
+func (d *FailureDomain) Name() string {
+	return d.name
+}
+
+// Health returns the state the domain was put in
+func (d *FailureDomain) Health() Health {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.health
+}
+
+// AddGenerator makes fg a member of the domain under name
+func (d *FailureDomain) AddGenerator(
+	name string,
+	fg failuregen.FailureGenerator,
+) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.gens[name] = fg
+}
+
+// AddProxy makes proxy a member of the domain under name
+func (d *FailureDomain) AddProxy(name string, proxy tcpproxy.Reconfigurer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.proxies[name] = proxy
+}
+
+// saveLocked saves the configs of the members, unless the domain is already
+// faulted (in which case the saved configs are those of the healthy domain)
+func (d *FailureDomain) saveLocked() {
+	if d.health != Healthy {
+		return
+	}
+	d.savedGens = make(map[string]failuregen.GeneratorConfig, len(d.gens))
+	for name, fg := range d.gens {
+		if c, ok := fg.(configured); ok {
+			d.savedGens[name] = c.Config()
+		} else {
+			d.savedGens[name] = failuregen.GeneratorConfig{}
+		}
+	}
+	d.savedProxies = make(map[string]tcpproxy.ProxyConfig, len(d.proxies))
+	for name, proxy := range d.proxies {
+		d.savedProxies[name] = proxy.Config()
+	}
+}
+
+// faultLocked makes all members fail with probability p: generators are
+// set to p, proxies get recv and accept generators failing with p (and drop
+// their connections if the domain fails)
+func (d *FailureDomain) faultLocked(p float32, health Health) error {
+	if p < 0 || p > 1 {
+		return errors.Wrapf(
+			failuregen.ErrInvalidProbability,
+			"%f not in [0.0, 1.0]",
+			p)
+	}
+	d.saveLocked()
+	for name, fg := range d.gens {
+		if err := fg.SetFailureProbability(p); err != nil {
+			return errors.Wrapf(err, "Failed to fault generator %s", name)
+		}
+	}
+	for name, proxy := range d.proxies {
+		cfg := proxy.Config()
+		cfg.RecvFg = failuregen.NewFailureGenerator()
+		cfg.AcceptFg = failuregen.NewFailureGenerator()
+		cfg.DropExistingConns = health == Failed
+		if err := cfg.RecvFg.SetFailureProbability(p); err != nil {
+			return err
+		}
+		if err := cfg.AcceptFg.SetFailureProbability(p); err != nil {
+			return err
+		}
+		if err := proxy.Reconfigure(cfg); err != nil {
+			return errors.Wrapf(err, "Failed to fault proxy %s", name)
+		}
+	}
+	d.health = health
+	log.Infof(
+		context.Background(),
+		"Failure domain %s is %s (failure probability %v)",
+		d.name,
+		health,
+		p)
+	return nil
+}
+
+// Fail makes every member of the domain fail: generators fail all calls and
+// proxies drop all connections, as when a node goes down
+func (d *FailureDomain) Fail() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.faultLocked(1, Failed)
+}
+
+// Degrade makes every member of the domain fail with probability p (e.g. 0.5
+// to fail half the calls and connections), as when a node is overloaded
+func (d *FailureDomain) Degrade(p float32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.faultLocked(p, Degraded)
+}
+
+// Restore restores the members of the domain to the configs they had before
+// the domain was faulted
+func (d *FailureDomain) Restore() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.health == Healthy {
+		return nil
+	}
+	for name, cfg := range d.savedGens {
+		fg, ok := d.gens[name]
+		if !ok {
+			continue
+		}
+		if err := fg.SetDelayConfig(cfg.Delay); err != nil {
+			return errors.Wrapf(err, "Failed to restore generator %s", name)
+		}
+		if err := fg.SetFailureProbability(cfg.FailureProbability); err != nil {
+			return errors.Wrapf(err, "Failed to restore generator %s", name)
+		}
+	}
+	for name, cfg := range d.savedProxies {
+		proxy, ok := d.proxies[name]
+		if !ok {
+			continue
+		}
+		if err := proxy.Reconfigure(cfg); err != nil {
+			return errors.Wrapf(err, "Failed to restore proxy %s", name)
+		}
+	}
+	d.health = Healthy
+	log.Infof(context.Background(), "Failure domain %s is healthy", d.name)
+	return nil
+}
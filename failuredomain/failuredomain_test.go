@@ -0,0 +1,96 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuredomain_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuredomain"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"github.com/stretchr/testify/require"
+)
+
+func startProxy(t *testing.T) *tcpproxy.Proxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		l.Addr().String(),
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+	return p
+}
+
+func echo(p *tcpproxy.Proxy) error {
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	_, err = io.ReadFull(conn, make([]byte, 4))
+	return err
+}
+
+func TestFailureDomain(t *testing.T) {
+	disk := failuregen.NewFailureGenerator()
+	require.NoError(t, disk.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   10,
+		DelayProbability: 0.1,
+	}))
+	proxy := startProxy(t)
+	other := failuregen.NewFailureGenerator()
+
+	node := failuredomain.New("node-1")
+	node.AddGenerator("disk", disk)
+	node.AddProxy("rpc", proxy)
+	require.Equal(t, failuredomain.Healthy, node.Health())
+	require.NoError(t, echo(proxy))
+
+	require.NoError(t, node.Fail())
+	require.Equal(t, failuredomain.Failed, node.Health())
+	require.Error(t, disk.FailMaybe())
+	require.Error(t, echo(proxy))
+	require.NoError(t, other.FailMaybe())
+
+	require.NoError(t, node.Degrade(0.5))
+	require.Equal(t, failuredomain.Degraded, node.Health())
+	require.Equal(
+		t,
+		float32(0.5),
+		disk.(*failuregen.FailureGeneratorImpl).Config().FailureProbability)
+	require.Error(t, node.Degrade(2))
+
+	// the configs of the healthy domain are restored
+	require.NoError(t, node.Restore())
+	require.Equal(t, failuredomain.Healthy, node.Health())
+	require.Equal(t, failuregen.GeneratorConfig{
+		Delay: failuregen.DelayConfig{
+			MaxDelayMicros:   10,
+			DelayProbability: 0.1,
+		},
+	}, disk.(*failuregen.FailureGeneratorImpl).Config())
+	require.NoError(t, echo(proxy))
+}
@@ -0,0 +1,301 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package adminhttp provides an embeddable HTTP server to inspect and tune
+// failure generators while the process under test runs, so that an external
+// driver (e.g. a soak framework) can change injection rates mid-test.
+//
+//	GET /generators              lists the registered generators
+//	GET /generators/{name}       returns the config and stats of a generator
+//	PUT /generators/{name}       updates the config of a generator
+//	GET /plans                   lists the registered assured-failure-plans
+//	GET /plans/{name}            returns the failure-points of a plan
+//	PATCH /plans/{name}          adds or removes failure-points of a plan
+//
+// PUT bodies are partial, fields that are absent keep their value:
+//
+//	{"failureProbability": 0.05, "maxDelayMicros": 2000}
+//
+// PATCH bodies list the failure-points to add and to remove, the edit is
+// atomic with respect to in-flight FailMaybe calls of the plan (see
+// failuregen.AssuredFailurePlanImpl.EditPlan):
+//
+//	{"add": ["BeforeMetadataMigration"], "remove": ["SChTargetStateP1"]}
+package adminhttp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+const generatorsPath = "/generators"
+
+// GeneratorStats are the stats of a generator
+type GeneratorStats struct {
+	Calls            int64 `json:"calls"`
+	Failures         int64 `json:"failures"`
+	Delays           int64 `json:"delays"`
+	TotalDelayMicros int64 `json:"totalDelayMicros"`
+}
+
+// Generator is the representation of a registered generator
+type Generator struct {
+	Name               string  `json:"name"`
+	FailureProbability float32 `json:"failureProbability"`
+	MaxDelayMicros     int32   `json:"maxDelayMicros"`
+	DelayProbability   float32 `json:"delayProbability"`
+	// Stats is only reported for generators keeping stats
+	Stats *GeneratorStats `json:"stats,omitempty"`
+}
+
+// GeneratorUpdate is the body of PUT, nil fields are left unchanged
+type GeneratorUpdate struct {
+	FailureProbability *float32 `json:"failureProbability,omitempty"`
+	MaxDelayMicros     *int32   `json:"maxDelayMicros,omitempty"`
+	DelayProbability   *float32 `json:"delayProbability,omitempty"`
+}
+
+// configured is implemented by generators which can report their config
+type configured interface {
+	Config() failuregen.GeneratorConfig
+}
+
+// withStats is implemented by generators which keep stats
+type withStats interface {
+	Stats() failuregen.GeneratorStats
+}
+
+// Server serves the admin API for the generators registered with it
+type Server struct {
+	mu   sync.Mutex
+	gens map[string]failuregen.FailureGenerator
+	// configs tracks the last config set through the API, for generators
+	// which can't report theirs
+	configs  map[string]failuregen.GeneratorConfig
+	plans    map[string]*failuregen.AssuredFailurePlanImpl
+	listener net.Listener
+	srv      *http.Server
+}
+
+// NewServer creates a server without generators, it can be mounted in an
+// existing mux as an http.Handler or served on its own with Start
+func NewServer() *Server {
+	return &Server{
+		gens:    make(map[string]failuregen.FailureGenerator),
+		configs: make(map[string]failuregen.GeneratorConfig),
+	}
+}
+
+// Register exposes fg under name, replacing the generator registered under
+// that name if any
+func (s *Server) Register(name string, fg failuregen.FailureGenerator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gens[name] = fg
+	delete(s.configs, name)
+}
+
+// Unregister stops exposing the generator registered under name
+func (s *Server) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.gens, name)
+	delete(s.configs, name)
+}
+
+// Start serves the admin API on addr (e.g. "127.0.0.1:0") in the
+// background and returns the address it listens on
+func (s *Server) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to listen on %s", addr)
+	}
+	s.mu.Lock()
+	if s.srv != nil {
+		s.mu.Unlock()
+		listener.Close()
+		return "", errors.New("Admin server already started")
+	}
+	s.listener = listener
+	s.srv = &http.Server{Handler: s}
+	srv := s.srv
+	s.mu.Unlock()
+	go srv.Serve(listener)
+	return listener.Addr().String(), nil
+}
+
+// Close stops serving the admin API started by Start
+func (s *Server) Close() error {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv, s.listener = nil, nil
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return errors.Wrap(srv.Close(), "Failed to close admin server")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// ServeHTTP serves the admin API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == generatorsPath:
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed,
+				errors.Errorf("Method %s not allowed", r.Method))
+			return
+		}
+		writeJSON(w, http.StatusOK, s.list())
+	case strings.HasPrefix(path, generatorsPath+"/"):
+		name := strings.TrimPrefix(path, generatorsPath+"/")
+		switch r.Method {
+		case http.MethodGet:
+			gen, ok := s.get(name)
+			if !ok {
+				writeError(w, http.StatusNotFound,
+					errors.Errorf("Unknown generator %s", name))
+				return
+			}
+			writeJSON(w, http.StatusOK, gen)
+		case http.MethodPut:
+			var update GeneratorUpdate
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				writeError(w, http.StatusBadRequest,
+					errors.Wrap(err, "Malformed generator update"))
+				return
+			}
+			gen, status, err := s.update(name, update)
+			if err != nil {
+				writeError(w, status, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, gen)
+		default:
+			writeError(w, http.StatusMethodNotAllowed,
+				errors.Errorf("Method %s not allowed", r.Method))
+		}
+	case path == plansPath || strings.HasPrefix(path, plansPath+"/"):
+		s.servePlans(w, r, path)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// configLocked returns the config of the generator registered under name
+func (s *Server) configLocked(
+	name string,
+	fg failuregen.FailureGenerator,
+) failuregen.GeneratorConfig {
+	if c, ok := fg.(configured); ok {
+		return c.Config()
+	}
+	return s.configs[name]
+}
+
+func (s *Server) generatorLocked(
+	name string,
+	fg failuregen.FailureGenerator,
+) Generator {
+	config := s.configLocked(name, fg)
+	gen := Generator{
+		Name:               name,
+		FailureProbability: config.FailureProbability,
+		MaxDelayMicros:     config.Delay.MaxDelayMicros,
+		DelayProbability:   config.Delay.DelayProbability,
+	}
+	if ws, ok := fg.(withStats); ok {
+		stats := ws.Stats()
+		gen.Stats = &GeneratorStats{
+			Calls:            stats.Calls,
+			Failures:         stats.Failures,
+			Delays:           stats.Delays,
+			TotalDelayMicros: stats.TotalDelay.Microseconds(),
+		}
+	}
+	return gen
+}
+
+func (s *Server) list() []Generator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gens := make([]Generator, 0, len(s.gens))
+	for name, fg := range s.gens {
+		gens = append(gens, s.generatorLocked(name, fg))
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].Name < gens[j].Name })
+	return gens
+}
+
+func (s *Server) get(name string) (Generator, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fg, ok := s.gens[name]
+	if !ok {
+		return Generator{}, false
+	}
+	return s.generatorLocked(name, fg), true
+}
+
+func validProbability(p *float32) bool {
+	return p == nil || (*p >= 0 && *p <= 1)
+}
+
+// update applies update to the generator registered under name, it returns
+// the HTTP status to report on failure
+func (s *Server) update(
+	name string,
+	update GeneratorUpdate,
+) (Generator, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fg, ok := s.gens[name]
+	if !ok {
+		return Generator{}, http.StatusNotFound,
+			errors.Errorf("Unknown generator %s", name)
+	}
+	if !validProbability(update.FailureProbability) ||
+		!validProbability(update.DelayProbability) {
+		return Generator{}, http.StatusBadRequest,
+			errors.New("Probabilities must be in [0.0, 1.0]")
+	}
+	if update.MaxDelayMicros != nil && *update.MaxDelayMicros < 0 {
+		return Generator{}, http.StatusBadRequest,
+			errors.New("maxDelayMicros must not be negative")
+	}
+
+	config := s.configLocked(name, fg)
+	if update.FailureProbability != nil {
+		config.FailureProbability = *update.FailureProbability
+	}
+	if update.MaxDelayMicros != nil {
+		config.Delay.MaxDelayMicros = *update.MaxDelayMicros
+	}
+	if update.DelayProbability != nil {
+		config.Delay.DelayProbability = *update.DelayProbability
+	}
+	if err := fg.SetDelayConfig(config.Delay); err != nil {
+		return Generator{}, http.StatusBadRequest, err
+	}
+	if err := fg.SetFailureProbability(config.FailureProbability); err != nil {
+		return Generator{}, http.StatusBadRequest, err
+	}
+	s.configs[name] = config
+	return s.generatorLocked(name, fg), 0, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Rubrik, Inc.
+
+package adminhttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/failuregen/adminhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func do(
+	t *testing.T,
+	method, url, body string,
+	status int,
+	result interface{},
+) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, status, resp.StatusCode)
+	if result != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := adminhttp.NewServer()
+	addr, err := srv.Start("127.0.0.1:0")
+	require.NoError(t, err)
+	defer srv.Close()
+	base := "http://" + addr + "/generators"
+
+	recv := failuregen.NewFailureGenerator()
+	srv.Register("recv", recv)
+	srv.Register("accept", failuregen.NewFailureGenerator())
+
+	var gens []adminhttp.Generator
+	do(t, http.MethodGet, base, "", http.StatusOK, &gens)
+	require.Len(t, gens, 2)
+	require.Equal(t, "accept", gens[0].Name)
+	require.Equal(t, "recv", gens[1].Name)
+
+	var gen adminhttp.Generator
+	do(t, http.MethodPut, base+"/recv",
+		`{"failureProbability": 1, "maxDelayMicros": 10}`, http.StatusOK, &gen)
+	require.Equal(t, float32(1), gen.FailureProbability)
+	require.Equal(t, int32(10), gen.MaxDelayMicros)
+	require.Error(t, recv.FailMaybe())
+
+	// partial updates keep the other fields
+	do(t, http.MethodPut, base+"/recv",
+		`{"delayProbability": 0.5}`, http.StatusOK, &gen)
+	do(t, http.MethodGet, base+"/recv", "", http.StatusOK, &gen)
+	require.Equal(t, float32(1), gen.FailureProbability)
+	require.Equal(t, int32(10), gen.MaxDelayMicros)
+	require.Equal(t, float32(0.5), gen.DelayProbability)
+	require.NotNil(t, gen.Stats)
+	require.Equal(t, int64(1), gen.Stats.Failures)
+
+	do(t, http.MethodPut, base+"/recv",
+		`{"failureProbability": 2}`, http.StatusBadRequest, nil)
+	do(t, http.MethodPut, base+"/recv", `{`, http.StatusBadRequest, nil)
+	do(t, http.MethodGet, base+"/nope", "", http.StatusNotFound, nil)
+	do(t, http.MethodPost, base, "", http.StatusMethodNotAllowed, nil)
+
+	srv.Unregister("accept")
+	do(t, http.MethodGet, base+"/accept", "", http.StatusNotFound, nil)
+}
+
+func TestServerPlans(t *testing.T) {
+	srv := adminhttp.NewServer()
+	addr, err := srv.Start("127.0.0.1:0")
+	require.NoError(t, err)
+	defer srv.Close()
+	base := "http://" + addr + "/plans"
+
+	afp := failuregen.NewAssuredFailurePlanWithStore(&failuregen.FilePlanStore{
+		Path: filepath.Join(t.TempDir(), "plan.json"),
+	}).(*failuregen.AssuredFailurePlanImpl)
+	srv.RegisterPlan("upgrade", afp)
+
+	var plans []adminhttp.Plan
+	do(t, http.MethodGet, base, "", http.StatusOK, &plans)
+	require.Len(t, plans, 1)
+	require.Empty(t, plans[0].FailurePoints)
+
+	var plan adminhttp.Plan
+	do(t, http.MethodPatch, base+"/upgrade",
+		`{"add": ["a", "b"]}`, http.StatusOK, &plan)
+	require.Equal(t, []failuregen.FailurePoint{"a", "b"}, plan.FailurePoints)
+	require.Error(t, afp.FailMaybe("a"))
+
+	do(t, http.MethodPatch, base+"/upgrade",
+		`{"add": ["c"], "remove": ["b"]}`, http.StatusOK, &plan)
+	require.Equal(t, []failuregen.FailurePoint{"a", "c"}, plan.FailurePoints)
+	require.Equal(t, []failuregen.FailurePoint{"c"}, plan.Pending)
+	require.NoError(t, afp.FailMaybe("b"))
+
+	do(t, http.MethodGet, base+"/unknown", "", http.StatusNotFound, nil)
+	do(t, http.MethodPatch, base+"/upgrade", "{", http.StatusBadRequest, nil)
+	do(t, http.MethodPost, base+"/upgrade", "", http.StatusMethodNotAllowed, nil)
+}
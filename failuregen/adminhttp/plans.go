@@ -0,0 +1,149 @@
+// Copyright 2024 Rubrik, Inc.
+
+package adminhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+const plansPath = "/plans"
+
+// Plan is the representation of a registered assured-failure-plan
+type Plan struct {
+	Name          string                    `json:"name"`
+	FailurePoints []failuregen.FailurePoint `json:"failurePoints"`
+	// Pending are the failure-points of the plan that didn't fire yet
+	Pending []failuregen.FailurePoint `json:"pending"`
+}
+
+// PlanEdit is the body of PATCH, the failure-points in Remove are removed
+// from the plan and those in Add are appended to it, in a single edit
+type PlanEdit struct {
+	Add    []failuregen.FailurePoint `json:"add,omitempty"`
+	Remove []failuregen.FailurePoint `json:"remove,omitempty"`
+}
+
+// RegisterPlan exposes afp under name, replacing the plan registered under
+// that name if any
+func (s *Server) RegisterPlan(
+	name string,
+	afp *failuregen.AssuredFailurePlanImpl,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plans == nil {
+		s.plans = make(map[string]*failuregen.AssuredFailurePlanImpl)
+	}
+	s.plans[name] = afp
+}
+
+// UnregisterPlan stops exposing the plan registered under name
+func (s *Server) UnregisterPlan(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.plans, name)
+}
+
+func (s *Server) plan(name string) (*failuregen.AssuredFailurePlanImpl, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	afp, ok := s.plans[name]
+	return afp, ok
+}
+
+func planOf(name string, afp *failuregen.AssuredFailurePlanImpl) (
+	Plan,
+	error,
+) {
+	points, err := afp.Plan()
+	if err != nil {
+		return Plan{}, err
+	}
+	pending, err := afp.PendingFailurePoints()
+	if err != nil {
+		return Plan{}, err
+	}
+	return Plan{Name: name, FailurePoints: points, Pending: pending}, nil
+}
+
+func (s *Server) listPlans() ([]Plan, error) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.plans))
+	for name := range s.plans {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	plans := make([]Plan, 0, len(names))
+	for _, name := range names {
+		afp, ok := s.plan(name)
+		if !ok {
+			continue
+		}
+		plan, err := planOf(name, afp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to load plan %s", name)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// servePlans serves the requests under plansPath
+func (s *Server) servePlans(
+	w http.ResponseWriter,
+	r *http.Request,
+	path string,
+) {
+	if path == plansPath {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed,
+				errors.Errorf("Method %s not allowed", r.Method))
+			return
+		}
+		plans, err := s.listPlans()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, plans)
+		return
+	}
+	name := strings.TrimPrefix(path, plansPath+"/")
+	afp, ok := s.plan(name)
+	if !ok {
+		writeError(w, http.StatusNotFound,
+			errors.Errorf("Unknown plan %s", name))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var edit PlanEdit
+		if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+			writeError(w, http.StatusBadRequest,
+				errors.Wrap(err, "Malformed plan edit"))
+			return
+		}
+		if _, err := afp.EditPlan(edit.Add, edit.Remove); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed,
+			errors.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+	plan, err := planOf(name, afp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
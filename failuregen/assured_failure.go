@@ -3,10 +3,15 @@
 package failuregen
 
 import (
-	"encoding/json"
-	"os"
+	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+	"go.uber.org/atomic"
 )
 
 // FailurePoint is a named stage in workflow that is of interest wrt
@@ -47,8 +52,28 @@ const (
 	SChTargetStateNU0 = "SChTargetStateNU0"
 )
 
+// upgradeFailurePoints are the failure-points declared above
+var upgradeFailurePoints = []FailurePoint{
+	SChTargetStateP1,
+	BeforeAdditiveSchemaChange,
+	AfterAdditiveSchemaChange,
+	SChTargetStateUR2,
+	SChTargetStateUR2Q,
+	SChTargetStateMT3,
+	SChTargetStateEM4,
+	BeforeMetadataMigration,
+	AfterMetadataMigration,
+	SChTargetStateRR5,
+	SChTargetStateC6,
+	BeforeDestructiveSchemaChange,
+	AfterDestructiveSchemaChange,
+	SChTargetStateNU0,
+}
+
 const (
-	assuredFailureFile = "/var/lib/rubrik/flags/callisto.assured_failure.json"
+	// DefaultPlanPath is the well-known location of the plan file, used
+	// when PlanPathEnv is not set
+	DefaultPlanPath = "/var/lib/rubrik/flags/callisto.assured_failure.json"
 )
 
 // AssuredFailurePlan is a plan for assured failures
@@ -62,6 +87,144 @@ type AssuredFailurePlan interface {
 type AssuredFailurePlanImpl struct {
 	// PlanFilePath is exposed for testing, should not be used in production
 	PlanFilePath string
+	// Store, when set, is used as the source of the plan instead of
+	// PlanFilePath
+	Store PlanStore
+	// StatePath, when set, is the file the progress of the plan is persisted
+	// to. Failure-points that fired (in this or a previous incarnation of the
+	// process) are not injected again.
+	StatePath string
+	// Journal, when set, records the failure-points fired by this and other
+	// processes, for plans to sequence failures across processes (see
+	// PlanBuilder.AfterIn)
+	Journal Journal
+	// Process names the process in sequenced plans, ProcessName is used
+	// when empty
+	Process string
+	// Registry is the registry patterns in the plan (see ExpandPlan) are
+	// expanded against, DefaultRegistry is used when nil
+	Registry *Registry
+
+	injectionTracker
+	// editMu serializes plan edits with the FailMaybe calls reading the plan
+	editMu      sync.RWMutex
+	injectedCtr atomic.Int64
+	fired       map[FailurePoint]struct{}
+	// consumed are the one-shot failure-points consumed through this
+	// instance, guarded by firedMu
+	consumed map[FailurePoint]struct{}
+	// hits counts the hits of failure-points failing on some hits only,
+	// guarded by firedMu
+	hits        map[FailurePoint]int64
+	firedMu     sync.Mutex
+	stateLoaded bool
+	hooks       map[FailurePoint]*failureHooks
+	hooksMu     sync.Mutex
+	// crashes are guarded by hooksMu
+	crashes map[FailurePoint]CrashOutcome
+	// randGen draws the hits of sampled failure-points, guarded by firedMu
+	randGen *randutil.LockedRandGen
+}
+
+// failureHooks are the callbacks run around the injection of a failure
+type failureHooks struct {
+	before []func()
+	after  []func(err error)
+}
+
+// BeforeFailure registers hook to run just before a failure is injected at
+// fp (e.g. to snapshot on-disk state right before an injected crash)
+func (afp *AssuredFailurePlanImpl) BeforeFailure(
+	fp FailurePoint,
+	hook func(),
+) {
+	afp.hooksMu.Lock()
+	defer afp.hooksMu.Unlock()
+	h := afp.hooksOfLocked(fp)
+	h.before = append(h.before, hook)
+}
+
+// AfterFailure registers hook to run just after a failure is injected at fp,
+// before the injected error is returned to the caller of FailMaybe
+func (afp *AssuredFailurePlanImpl) AfterFailure(
+	fp FailurePoint,
+	hook func(err error),
+) {
+	afp.hooksMu.Lock()
+	defer afp.hooksMu.Unlock()
+	h := afp.hooksOfLocked(fp)
+	h.after = append(h.after, hook)
+}
+
+func (afp *AssuredFailurePlanImpl) hooksOfLocked(
+	fp FailurePoint,
+) *failureHooks {
+	if afp.hooks == nil {
+		afp.hooks = make(map[FailurePoint]*failureHooks)
+	}
+	h, ok := afp.hooks[fp]
+	if !ok {
+		h = &failureHooks{}
+		afp.hooks[fp] = h
+	}
+	return h
+}
+
+// hooksOf returns the hooks of fp, hooks run without holding hooksMu so that
+// they can register further hooks
+func (afp *AssuredFailurePlanImpl) hooksOf(fp FailurePoint) failureHooks {
+	afp.hooksMu.Lock()
+	defer afp.hooksMu.Unlock()
+	if h, ok := afp.hooks[fp]; ok {
+		return failureHooks{
+			before: append([]func(){}, h.before...),
+			after:  append([]func(error){}, h.after...),
+		}
+	}
+	return failureHooks{}
+}
+
+// loadPlan loads the plan and expands its patterns. It returns the
+// failure-points slated for failure, and how each of them fails (see Once and
+// Counted).
+func (afp *AssuredFailurePlanImpl) loadPlan(store PlanStore) (
+	[]FailurePoint,
+	map[FailurePoint]entryRule,
+	error,
+) {
+	failurePoints, err := store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	registry := afp.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	expanded, err := ExpandPlan(failurePoints, registry.Points())
+	if err != nil {
+		return nil, nil, errors.Wrapf(
+			err,
+			"Failed to expand assured-failure-plan: %s",
+			store)
+	}
+	own, err := afp.ownEntries(expanded)
+	if err != nil {
+		return nil, nil, errors.WithStack(
+			newErrMalformedPlan(store.String(), err))
+	}
+	failurePoints, rules, err := resolvePlan(own)
+	if err != nil {
+		return nil, nil, errors.WithStack(
+			newErrMalformedPlan(store.String(), err))
+	}
+	return failurePoints, rules, nil
+}
+
+func (afp *AssuredFailurePlanImpl) store() PlanStore {
+	if afp.Store != nil {
+		return afp.Store
+	}
+	return &FilePlanStore{Path: afp.PlanFilePath}
 }
 
 // FailMaybe injects a failure if the current failure-point is slated for
@@ -69,35 +232,210 @@ type AssuredFailurePlanImpl struct {
 // of the system (such as processing of every query in a batch or every row in a
 // projection) because the implementation is slow and inefficient. This is
 // primarily meant for failing / breaking large workflows (such as upgrade).
-// Absence of plan-file implies no error.
+// Absence of plan-file implies no error. Prefer FailMaybeContext.
 func (afp *AssuredFailurePlanImpl) FailMaybe(currentPoint FailurePoint) error {
-	bytes, err := os.ReadFile(afp.PlanFilePath)
-	if err != nil && !os.IsNotExist(err) {
-		return errors.Wrapf(
-			err,
-			"Failed to read assured-failure-plan: %s",
-			afp.PlanFilePath)
+	return afp.failMaybe(context.Background(), currentPoint)
+}
+
+// failMaybe implements FailMaybe and FailMaybeContext
+func (afp *AssuredFailurePlanImpl) failMaybe(
+	ctx context.Context,
+	currentPoint FailurePoint,
+) error {
+	store := afp.store()
+	failurePoints, rule, seq, fire, err := afp.claimFailure(
+		store,
+		currentPoint)
+	if err != nil || !fire {
+		return err
 	}
-	if len(bytes) == 0 {
-		return nil
+	hooks := afp.hooksOf(currentPoint)
+	for _, hook := range hooks.before {
+		hook()
 	}
-	var failurePoints []FailurePoint
-	err = json.Unmarshal(bytes, &failurePoints)
+	afp.recordInjection()
+	info := InjectionInfo{
+		InjectionID:  newInjectionID(),
+		Time:         time.Now(),
+		FailurePoint: currentPoint,
+		GeneratorID:  store.String(),
+		Sequence:     seq,
+		Plan:         failurePoints,
+	}
+	if rule.action.Kind == ActionDelay {
+		err := afp.injectDelay(ctx, info, rule.action.Delay)
+		for _, hook := range hooks.after {
+			hook(err)
+		}
+		return err
+	}
+	injErr := &InjectedFailureError{
+		msg: fmt.Sprintf(
+			"Injecting failure %s (governed by %s)",
+			currentPoint,
+			store),
+		InjectionInfo: info,
+	}
+	if rule.action.Kind == ActionError {
+		injErr.msg = rule.action.Message
+	}
+	// assured failures are rare, always log them
+	logInjection(ctx, injErr.InjectionInfo, injErr.msg)
+	afp.emitInjection(failureEvent(injErr.InjectionInfo))
+	err = errors.WithStack(injErr)
+	for _, hook := range hooks.after {
+		hook(err)
+	}
+	if outcome, ok := rule.action.crashOutcome(); ok {
+		return crash(outcome, err)
+	}
+	if outcome, ok := afp.crashOutcome(currentPoint); ok {
+		return crash(outcome, err)
+	}
+	return err
+}
+
+// injectDelay injects the delay of a delay action, it returns the error of
+// ctx if ctx is done before the delay elapses
+func (afp *AssuredFailurePlanImpl) injectDelay(
+	ctx context.Context,
+	info InjectionInfo,
+	delay time.Duration,
+) error {
+	log.Infof(
+		WithInjectionID(ctx, info.InjectionID),
+		"Injecting delay of %v at %s (governed by %s)",
+		delay,
+		info.FailurePoint,
+		info.GeneratorID)
+	afp.emitInjection(InjectionEvent{
+		Time:         info.Time,
+		Kind:         InjectionKindDelay,
+		GeneratorID:  info.GeneratorID,
+		InjectionID:  info.InjectionID,
+		FailurePoint: info.FailurePoint,
+		Sequence:     info.Sequence,
+		Delay:        delay,
+	})
+	return sleepContext(ctx, nil, delay)
+}
+
+// claimFailure loads the plan and, if fp is slated for failure, marks it
+// fired. It returns the plan, the rule of fp, the sequence number of the
+// injection and whether a failure must be injected. Plan edits (see
+// EditPlan) wait for it, so that a failure-point removed from the plan no
+// longer fires once the edit returns.
+func (afp *AssuredFailurePlanImpl) claimFailure(
+	store PlanStore,
+	fp FailurePoint,
+) ([]FailurePoint, entryRule, int64, bool, error) {
+	afp.editMu.RLock()
+	defer afp.editMu.RUnlock()
+	failurePoints, rules, err := afp.loadPlan(store)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to parse assured-failure-plan")
+		return nil, entryRule{}, 0, false, err
 	}
 	for _, failurePoint := range failurePoints {
-		if failurePoint == currentPoint {
-			return errors.Errorf(
-				"Injecting failure %s (governed by %s)",
-				currentPoint,
-				afp.PlanFilePath)
+		if failurePoint == fp {
+			seq, fire, err := afp.claim(store, fp, rules[fp])
+			return failurePoints, rules[fp], seq, fire, err
 		}
 	}
-	return nil
+	return failurePoints, entryRule{}, 0, false, nil
 }
 
-// NewAssuredFailurePlan creates a new assured-failure-plan
+// claim records a hit of fp, which the plan slates for failure as per rule,
+// and returns the sequence number of the injection. It returns false if the
+// hit must not fail: fp waits for another failure-point to fire, passes the
+// draw of a sampled rule, is skipped or done failing as per rule, is
+// one-shot and was consumed, or already fired and the plan's progress is
+// persisted.
+func (afp *AssuredFailurePlanImpl) claim(
+	store PlanStore,
+	fp FailurePoint,
+	rule entryRule,
+) (int64, bool, error) {
+	afp.firedMu.Lock()
+	defer afp.firedMu.Unlock()
+	if err := afp.loadStateLocked(); err != nil {
+		return 0, false, err
+	}
+	if rule.after != "" {
+		if ok, err := afp.afterFiredLocked(rule); err != nil || !ok {
+			return 0, false, err
+		}
+	}
+	if rule.sampled && !afp.drawLocked(rule) {
+		return 0, false, nil
+	}
+	if rule.counted() && !afp.countHitLocked(fp, rule) {
+		return 0, false, afp.saveStateLocked()
+	}
+	if rule.once {
+		return afp.consumeLocked(store, fp)
+	}
+	if _, ok := afp.fired[fp]; ok && afp.StatePath != "" && !rule.counted() {
+		return 0, false, nil
+	}
+	return afp.fireLocked(fp)
+}
+
+// fireLocked records that fp fired and returns the sequence number of the
+// injection, firedMu must be held
+func (afp *AssuredFailurePlanImpl) fireLocked(fp FailurePoint) (
+	int64,
+	bool,
+	error,
+) {
+	if afp.fired == nil {
+		afp.fired = make(map[FailurePoint]struct{})
+	}
+	afp.fired[fp] = struct{}{}
+	seq := afp.injectedCtr.Inc()
+	// the state must be persisted before the failure is injected, as the
+	// failure may crash the process
+	if err := afp.saveStateLocked(); err != nil {
+		return seq, true, err
+	}
+	return seq, true, afp.journalLocked(fp)
+}
+
+// PendingFailurePoints returns the failure-points in the plan that have not
+// injected a failure through this instance yet
+func (afp *AssuredFailurePlanImpl) PendingFailurePoints() (
+	[]FailurePoint,
+	error,
+) {
+	failurePoints, _, err := afp.loadPlan(afp.store())
+	if err != nil {
+		return nil, err
+	}
+	afp.firedMu.Lock()
+	defer afp.firedMu.Unlock()
+	if err := afp.loadStateLocked(); err != nil {
+		return nil, err
+	}
+	var pending []FailurePoint
+	for _, fp := range failurePoints {
+		if _, ok := afp.fired[fp]; !ok {
+			pending = append(pending, fp)
+		}
+	}
+	return pending, nil
+}
+
+// NewAssuredFailurePlan creates a new assured-failure-plan reading the plan
+// file discovered by PlanPath, and recording fired failure-points in the
+// journal file named by JournalPathEnv if set
 func NewAssuredFailurePlan() AssuredFailurePlan {
-	return &AssuredFailurePlanImpl{assuredFailureFile}
+	return &AssuredFailurePlanImpl{
+		PlanFilePath: PlanPath(),
+		Journal:      journal(),
+	}
+}
+
+// NewAssuredFailurePlanWithStore creates a new assured-failure-plan which
+// reads the plan from the given store
+func NewAssuredFailurePlanWithStore(store PlanStore) AssuredFailurePlan {
+	return &AssuredFailurePlanImpl{Store: store}
 }
@@ -3,7 +3,6 @@
 package failuregen_test
 
 import (
-	"encoding/json"
 	"os"
 	"testing"
 
@@ -88,6 +87,33 @@ func TestAssuredFailureGeneratorFailsForMalformedPlan(t *testing.T) {
 	require.Error(t, afp.FailMaybe("no such failure-point"))
 }
 
+func TestAssuredFailureHooks(t *testing.T) {
+	afp := AssureFailuresAt(t, failuregen.BeforeMetadataMigration)
+	impl := afp.(*failuregen.AssuredFailurePlanImpl)
+
+	var events []string
+	var afterErr error
+	impl.BeforeFailure(failuregen.BeforeMetadataMigration, func() {
+		events = append(events, "before")
+	})
+	impl.AfterFailure(failuregen.BeforeMetadataMigration, func(err error) {
+		events = append(events, "after")
+		afterErr = err
+	})
+	impl.BeforeFailure(failuregen.AfterMetadataMigration, func() {
+		events = append(events, "unexpected")
+	})
+
+	require.NoError(t, afp.FailMaybe(failuregen.AfterMetadataMigration))
+	require.Empty(t, events)
+
+	err := afp.FailMaybe(failuregen.BeforeMetadataMigration)
+	require.Error(t, err)
+	require.Equal(t, []string{"before", "after"}, events)
+	require.Equal(t, err, afterErr)
+	require.ErrorIs(t, afterErr, failuregen.ErrInjectedFailure)
+}
+
 // AssureFailuresAt creates an assured failure plan with given failure points
 func AssureFailuresAt(
 	t *testing.T,
@@ -95,12 +121,13 @@ func AssureFailuresAt(
 ) failuregen.AssuredFailurePlan {
 	f, err := os.CreateTemp("", "callisto.assured_failure.json.*")
 	require.NoError(t, err)
-	defer f.Close()
-	bytes, err := json.Marshal(fp)
-	require.NoError(t, err)
-	_, err = f.Write(bytes)
-	require.NoError(t, err)
+	require.NoError(t, f.Close())
 	path := f.Name()
+	builder := failuregen.NewPlanBuilder()
+	for _, p := range fp {
+		builder.Fail(p)
+	}
+	require.NoError(t, builder.Write(path))
 	t.Cleanup(func() {
 		err := os.Remove(path)
 		if !os.IsNotExist(err) {
@@ -0,0 +1,98 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ItemOutcome is the fate of an item of a batch, see FailBatch
+type ItemOutcome struct {
+	// Err is the injected failure of the item, nil if the item succeeds
+	Err error
+	// Delay is the delay to inject before processing the item, 0 if none
+	Delay time.Duration
+}
+
+// BatchOutcome holds the fate of every item of a batch, see FailBatch
+type BatchOutcome struct {
+	Items []ItemOutcome
+}
+
+// Failed returns the indices of the failing items, in increasing order
+func (b BatchOutcome) Failed() []int {
+	var failed []int
+	for i, item := range b.Items {
+		if item.Err != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// Delayed returns the indices of the items with a non-zero delay, in
+// increasing order
+func (b BatchOutcome) Delayed() []int {
+	var delayed []int
+	for i, item := range b.Items {
+		if item.Delay > 0 {
+			delayed = append(delayed, i)
+		}
+	}
+	return delayed
+}
+
+// Err returns the injected failure of the i-th item, nil if it succeeds
+func (b BatchOutcome) Err(i int) error {
+	return b.Items[i].Err
+}
+
+// FailBatch decides the fate of each of the size items of a batch as per the
+// failure and delay configs of the generator, so that batch processing code
+// can be tested for its handling of partially failed batches (e.g. it must
+// retry the failed items only). Each item counts as a FailMaybe call, in the
+// stats, count schedule, failure budget and decision log of the generator,
+// but items are decided independently of each other: bursts and shared
+// triggers, which correlate successive calls, don't apply. Delays are not
+// injected but returned, for the code under test (or its fake backend) to
+// apply them per item.
+func (fg *FailureGeneratorImpl) FailBatch(size int) BatchOutcome {
+	outcome := BatchOutcome{Items: make([]ItemOutcome, size)}
+	for i := range outcome.Items {
+		outcome.Items[i] = fg.failItem(context.Background())
+	}
+	return outcome
+}
+
+// failItem decides the fate of an item of a batch
+func (fg *FailureGeneratorImpl) failItem(ctx context.Context) ItemOutcome {
+	callCount := fg.callCtr.Inc() - 1
+	var delayed, failed bool
+	var delay time.Duration
+	if replay := fg.replay.Load(); replay != nil {
+		d := replay.decisions[callCount]
+		delayed, delay, failed = d.Delayed, d.Delay, d.Failed
+	} else {
+		delayed = fg.randGen.Int31n(OneMillion) < fg.delayPpm.Load()
+		if delayed {
+			delay = fg.injectedDelay()
+		}
+		n := fg.randGen.Int31n(OneMillion)
+		failed = (fg.scheduledFailure(callCount) ||
+			n < fg.currentFailurePpm(callCount)) &&
+			fg.takeFailureBudget()
+		fg.recordDecision(callCount, delayed, delay, failed)
+	}
+	var item ItemOutcome
+	if delayed {
+		fg.noteDelay(delay)
+		item.Delay = delay
+	}
+	if failed {
+		item.Err = errors.WithStack(fg.injectFailure(ctx))
+	}
+	return item
+}
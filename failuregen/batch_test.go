@@ -0,0 +1,53 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailBatch(t *testing.T) {
+	fg := failuregen.NewFailureGeneratorWithSeed(
+		7).(*failuregen.FailureGeneratorImpl)
+	fg.DelayFn = func(time.Duration) { t.Fatal("Batch delays are slept") }
+	require.NoError(t, fg.SetCountSchedule(failuregen.CountSchedule{Every: 3}))
+	outcome := fg.FailBatch(10)
+	require.Len(t, outcome.Items, 10)
+	require.Equal(t, []int{2, 5, 8}, outcome.Failed())
+	require.Empty(t, outcome.Delayed())
+	require.True(t, failuregen.IsInjected(outcome.Err(2)))
+	require.NoError(t, outcome.Err(0))
+	require.Equal(
+		t,
+		failuregen.GeneratorStats{Calls: 10, Failures: 3},
+		fg.Stats())
+
+	require.NoError(t, fg.SetCountSchedule(failuregen.CountSchedule{}))
+	require.NoError(t, fg.SetFailureProbability(0.5))
+	require.NoError(t, fg.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   1000,
+		DelayProbability: 0.5,
+	}))
+	outcome = fg.FailBatch(1000)
+	require.InDelta(t, 500, len(outcome.Failed()), 100)
+	require.InDelta(t, 500, len(outcome.Delayed()), 100)
+	for _, i := range outcome.Delayed() {
+		require.Less(t, outcome.Items[i].Delay, time.Millisecond)
+	}
+	stats := fg.Stats()
+	require.Equal(t, int64(1010), stats.Calls)
+	require.GreaterOrEqual(t, stats.Delays, int64(len(outcome.Delayed())))
+
+	// the outcome is determined by the seed
+	batch := func() []int {
+		fg := failuregen.NewFailureGeneratorWithSeed(
+			11).(*failuregen.FailureGeneratorImpl)
+		require.NoError(t, fg.SetFailureProbability(0.5))
+		return fg.FailBatch(100).Failed()
+	}
+	require.Equal(t, batch(), batch())
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BurstMode makes failures come in bursts: every failure injected by the
+// generator (other than those of a burst) triggers a burst of failures, as
+// real outages are correlated in time rather than independent per call. Zero
+// fields are disabled, a burst lasts as long as either field holds.
+type BurstMode struct {
+	// Calls fails the Calls calls following the triggering failure
+	Calls int64
+	// Duration fails all calls for Duration after the triggering failure
+	Duration time.Duration
+}
+
+// burst is the burst configuration of a generator and the state of its
+// ongoing burst, if any
+type burst struct {
+	cfg BurstMode
+	mu  sync.Mutex
+	// remaining is the number of calls the ongoing burst still fails
+	remaining int64
+	// until is the end of the ongoing burst
+	until time.Time
+}
+
+// SetBurstMode makes the generator inject failures in bursts as per c, a
+// zero c disables bursts. An ongoing burst is ended.
+func (fg *FailureGeneratorImpl) SetBurstMode(c BurstMode) error {
+	if c.Calls < 0 || c.Duration < 0 {
+		return errors.Errorf("Invalid burst mode %+v", c)
+	}
+	if c == (BurstMode{}) {
+		fg.burst.Store(nil)
+		return nil
+	}
+	fg.burst.Store(&burst{cfg: c})
+	return nil
+}
+
+// BurstMode returns the burst mode of the generator
+func (fg *FailureGeneratorImpl) BurstMode() BurstMode {
+	if b := fg.burst.Load(); b != nil {
+		return b.cfg
+	}
+	return BurstMode{}
+}
+
+// inBurst tells if the current call is failed by an ongoing burst, the call
+// is then accounted to the burst
+func (fg *FailureGeneratorImpl) inBurst() bool {
+	b := fg.burst.Load()
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining > 0 {
+		b.remaining--
+		return true
+	}
+	return time.Now().Before(b.until)
+}
+
+// startBurst starts a burst following a triggering failure
+func (fg *FailureGeneratorImpl) startBurst() {
+	b := fg.burst.Load()
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining = b.cfg.Calls
+	b.until = time.Now().Add(b.cfg.Duration)
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBurstOfCalls(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetCountSchedule(failuregen.CountSchedule{
+		OnCall: 3,
+	}))
+	require.NoError(t, fg.SetBurstMode(failuregen.BurstMode{Calls: 4}))
+	var failed []int
+	for call := 1; call <= 10; call++ {
+		if fg.FailMaybe() != nil {
+			failed = append(failed, call)
+		}
+	}
+	require.Equal(t, []int{3, 4, 5, 6, 7}, failed)
+	require.Equal(
+		t,
+		failuregen.BurstMode{Calls: 4},
+		fg.DeepCopy().(*failuregen.FailureGeneratorImpl).BurstMode())
+
+	require.NoError(t, fg.SetBurstMode(failuregen.BurstMode{}))
+	require.Error(t, fg.SetBurstMode(failuregen.BurstMode{Calls: -1}))
+}
+
+func TestBurstOfDuration(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetCountSchedule(failuregen.CountSchedule{
+		OnCall: 1,
+	}))
+	require.NoError(t, fg.SetBurstMode(failuregen.BurstMode{
+		Duration: 50 * time.Millisecond,
+	}))
+	require.Error(t, fg.FailMaybe())
+	require.Error(t, fg.FailMaybe())
+	require.Error(t, fg.FailMaybe())
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, fg.FailMaybe())
+}
+
+func TestBurstRespectsFailureBudget(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetCountSchedule(failuregen.CountSchedule{
+		OnCall: 1,
+	}))
+	require.NoError(t, fg.SetBurstMode(failuregen.BurstMode{Calls: 5}))
+	fg.SetMaxFailures(2)
+	require.Error(t, fg.FailMaybe())
+	require.Error(t, fg.FailMaybe())
+	require.NoError(t, fg.FailMaybe())
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const calibrationSamples = 101
+
+// TimerCalibration describes how precisely the platform can deliver short
+// sleeps. Low-resolution timers (common on some ARM hosts) make configured
+// delays of a few microseconds much longer than requested.
+type TimerCalibration struct {
+	// Resolution is the smallest observed non-zero step of the monotonic clock
+	Resolution time.Duration
+	// SleepOverhead is the median time by which a 1µs sleep overshoots
+	SleepOverhead time.Duration
+}
+
+var (
+	calibrationOnce sync.Once
+	calibration     atomic.Pointer[TimerCalibration]
+)
+
+// Calibrate measures the timer calibration of this host, which takes a few
+// hundred short sleeps, on first call and returns it. Call it on startup for
+// SetDelayConfig to warn about delays shorter than the host can deliver.
+func Calibrate() TimerCalibration {
+	calibrationOnce.Do(func() {
+		cal := calibrate()
+		calibration.Store(&cal)
+	})
+	return *calibration.Load()
+}
+
+// Calibration returns the timer calibration of this host, ok is false if it
+// wasn't measured yet (see Calibrate)
+func Calibration() (TimerCalibration, bool) {
+	if cal := calibration.Load(); cal != nil {
+		return *cal, true
+	}
+	return TimerCalibration{}, false
+}
+
+func calibrate() TimerCalibration {
+	resolution := time.Duration(0)
+	for i := 0; i < calibrationSamples; i++ {
+		start := time.Now()
+		step := time.Since(start)
+		for step == 0 {
+			step = time.Since(start)
+		}
+		if resolution == 0 || step < resolution {
+			resolution = step
+		}
+	}
+
+	overheads := make([]time.Duration, calibrationSamples)
+	for i := range overheads {
+		start := time.Now()
+		time.Sleep(time.Microsecond)
+		overheads[i] = time.Since(start) - time.Microsecond
+	}
+	sort.Slice(overheads, func(i, j int) bool {
+		return overheads[i] < overheads[j]
+	})
+
+	return TimerCalibration{
+		Resolution:    resolution,
+		SleepOverhead: overheads[len(overheads)/2],
+	}
+}
+
+// CanDeliver reports whether a delay of the given magnitude is within what
+// the platform can deliver without being dominated by sleep overhead
+func (c TimerCalibration) CanDeliver(d time.Duration) bool {
+	return d >= c.Resolution && d >= c.SleepOverhead
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestCalibrationIsMeasuredOnce(t *testing.T) {
+	// configuring delays doesn't calibrate (unless calibrated already, by a
+	// previous run of the test)
+	if _, ok := failuregen.Calibration(); !ok {
+		fg := failuregen.NewFailureGenerator()
+		require.NoError(t, fg.SetDelayConfig(failuregen.DelayConfig{
+			MaxDelayMicros:   1,
+			DelayProbability: 1,
+		}))
+		_, ok = failuregen.Calibration()
+		require.False(t, ok)
+	}
+
+	cal := failuregen.Calibrate()
+	t.Logf("timer calibration: %+v", cal)
+	require.Greater(t, cal.Resolution, time.Duration(0))
+	require.GreaterOrEqual(t, cal.SleepOverhead, time.Duration(0))
+	require.Equal(t, cal, failuregen.Calibrate())
+	calibrated, ok := failuregen.Calibration()
+	require.True(t, ok)
+	require.Equal(t, cal, calibrated)
+}
+
+func TestTimerCalibrationCanDeliver(t *testing.T) {
+	cal := failuregen.TimerCalibration{
+		Resolution:    time.Microsecond,
+		SleepOverhead: 50 * time.Microsecond,
+	}
+	require.False(t, cal.CanDeliver(0))
+	require.False(t, cal.CanDeliver(10*time.Microsecond))
+	require.True(t, cal.CanDeliver(50*time.Microsecond))
+	require.True(t, cal.CanDeliver(time.Second))
+
+	cal.Resolution = time.Millisecond
+	require.False(t, cal.CanDeliver(500*time.Microsecond))
+}
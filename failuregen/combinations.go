@@ -0,0 +1,168 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// Fault is a type of fault which can be switched on and off (e.g. latency or
+// drops of a proxy)
+type Fault struct {
+	Name    string
+	Enable  func() error
+	Disable func() error
+}
+
+// Combination is a set of faults active together
+type Combination []Fault
+
+func (c Combination) String() string {
+	names := make([]string, len(c))
+	for i, f := range c {
+		names[i] = f.Name
+	}
+	return strings.Join(names, "+")
+}
+
+// Combinations returns the combinations of size faults among faults, in
+// lexicographic order of their positions in faults
+func Combinations(faults []Fault, size int) []Combination {
+	var combinations []Combination
+	var pick func(start int, picked []Fault)
+	pick = func(start int, picked []Fault) {
+		if len(picked) == size {
+			combinations = append(
+				combinations,
+				append(Combination(nil), picked...))
+			return
+		}
+		for i := start; i <= len(faults)-(size-len(picked)); i++ {
+			pick(i+1, append(picked, faults[i]))
+		}
+	}
+	if size > 0 && size <= len(faults) {
+		pick(0, nil)
+	}
+	return combinations
+}
+
+// CombinationDriver cycles through combinations of faults within a single
+// long run, each combination being active for a time slice, so that faults
+// are exercised together and not only one type at a time. The active
+// combination is logged as it changes.
+type CombinationDriver struct {
+	combinations []Combination
+	mu           sync.Mutex
+	// next is the index of the next combination to activate
+	next   int
+	active Combination
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewCombinationDriver creates a driver cycling through the combinations of
+// faults of the given sizes (e.g. 2 and 3 for pairs and triples). No fault
+// is enabled until Step or Start is called.
+func NewCombinationDriver(
+	faults []Fault,
+	sizes ...int,
+) (*CombinationDriver, error) {
+	d := &CombinationDriver{quit: make(chan struct{})}
+	for _, size := range sizes {
+		d.combinations = append(d.combinations, Combinations(faults, size)...)
+	}
+	if len(d.combinations) == 0 {
+		return nil, errors.Errorf(
+			"No combination of sizes %v among %d faults",
+			sizes,
+			len(faults))
+	}
+	return d, nil
+}
+
+// Combinations returns the combinations the driver cycles through
+func (d *CombinationDriver) Combinations() []Combination {
+	return d.combinations
+}
+
+// Active returns the active combination, nil if none is
+func (d *CombinationDriver) Active() Combination {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+// disableLocked disables the active combination
+func (d *CombinationDriver) disableLocked() error {
+	var firstErr error
+	for _, f := range d.active {
+		if err := f.Disable(); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "Failed to disable %s", f.Name)
+		}
+	}
+	d.active = nil
+	return firstErr
+}
+
+// Step disables the active combination and enables the next one, cycling
+// back to the first combination after the last
+func (d *CombinationDriver) Step() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.disableLocked(); err != nil {
+		return err
+	}
+	c := d.combinations[d.next]
+	d.next = (d.next + 1) % len(d.combinations)
+	for i, f := range c {
+		if err := f.Enable(); err != nil {
+			d.active = c[:i]
+			return errors.Wrapf(err, "Failed to enable %s", f.Name)
+		}
+	}
+	d.active = c
+	log.Infof(context.Background(), "Active fault combination: %v", c)
+	return nil
+}
+
+// Start activates a new combination every slice until Stop is called
+func (d *CombinationDriver) Start(slice time.Duration) {
+	if err := d.Step(); err != nil {
+		log.Errorf(context.Background(), "Fault combination failed: %v", err)
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(slice)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.quit:
+				return
+			case <-ticker.C:
+				if err := d.Step(); err != nil {
+					log.Errorf(
+						context.Background(),
+						"Fault combination failed: %v",
+						err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops cycling and disables the active combination
+func (d *CombinationDriver) Stop() error {
+	close(d.quit)
+	d.wg.Wait()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.disableLocked()
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombinationDriver(t *testing.T) {
+	enabled := make(map[string]bool)
+	fault := func(name string) failuregen.Fault {
+		return failuregen.Fault{
+			Name:    name,
+			Enable:  func() error { enabled[name] = true; return nil },
+			Disable: func() error { delete(enabled, name); return nil },
+		}
+	}
+	faults := []failuregen.Fault{
+		fault("latency"),
+		fault("drop"),
+		fault("corruption"),
+		fault("partition"),
+	}
+	require.Len(t, failuregen.Combinations(faults, 2), 6)
+	require.Len(t, failuregen.Combinations(faults, 3), 4)
+	require.Empty(t, failuregen.Combinations(faults, 5))
+
+	_, err := failuregen.NewCombinationDriver(faults, 5)
+	require.Error(t, err)
+	d, err := failuregen.NewCombinationDriver(faults, 2, 3)
+	require.NoError(t, err)
+	require.Len(t, d.Combinations(), 10)
+	require.Nil(t, d.Active())
+
+	var seen []string
+	for i := 0; i < 11; i++ {
+		require.NoError(t, d.Step())
+		require.Len(t, enabled, len(d.Active()))
+		for _, f := range d.Active() {
+			require.True(t, enabled[f.Name])
+		}
+		seen = append(seen, d.Active().String())
+	}
+	require.Equal(t, "latency+drop", seen[0])
+	require.Equal(t, "corruption+partition", seen[5])
+	require.Equal(t, "latency+drop+corruption", seen[6])
+	require.Equal(t, seen[0], seen[10])
+
+	require.NoError(t, d.Stop())
+	require.Empty(t, enabled)
+	require.Nil(t, d.Active())
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"github.com/pkg/errors"
+)
+
+// compositeOp is the way a compositeFailureGenerator combines generators
+type compositeOp int
+
+const (
+	// opAny fails if any generator fails, like a logical OR
+	opAny compositeOp = iota
+	// opAll fails if all generators fail, like a logical AND
+	opAll
+	// opSequence consults every generator and fails if any fails
+	opSequence
+)
+
+// compositeFailureGenerator combines generators with a logical operator. It
+// implements ConditionalFailureGenerator so that conditional children keep
+// their content matching when composed.
+type compositeFailureGenerator struct {
+	gens []FailureGenerator
+	op   compositeOp
+}
+
+// Any returns a generator failing if any of gens fails, like a logical OR
+func Any(gens ...FailureGenerator) ConditionalFailureGenerator {
+	return &compositeFailureGenerator{gens: gens, op: opAny}
+}
+
+// All returns a generator failing if all of gens fail, like a logical AND
+func All(gens ...FailureGenerator) ConditionalFailureGenerator {
+	return &compositeFailureGenerator{gens: gens, op: opAll}
+}
+
+// Sequence returns a generator running all of gens, failing if any fails
+func Sequence(gens ...FailureGenerator) ConditionalFailureGenerator {
+	return &compositeFailureGenerator{gens: gens, op: opSequence}
+}
+
+func (c *compositeFailureGenerator) eval(
+	fail func(g FailureGenerator) error,
+) error {
+	var err error
+	for _, g := range c.gens {
+		gErr := fail(g)
+		switch {
+		case c.op == opAll && gErr == nil:
+			return nil
+		case c.op == opAny && gErr != nil:
+			return gErr
+		case c.op == opSequence && err != nil:
+			continue
+		}
+		err = gErr
+	}
+	return err
+}
+
+// SetDelayConfig sets the delay configuration on every composed generator
+func (c *compositeFailureGenerator) SetDelayConfig(cfg DelayConfig) error {
+	for i, g := range c.gens {
+		if err := g.SetDelayConfig(cfg); err != nil {
+			return errors.Wrapf(
+				err,
+				"Couldn't set delay-config of generator %d",
+				i)
+		}
+	}
+	return nil
+}
+
+// SetFailureProbability sets the failure probability on every composed
+// generator. Note that with All the effective probability is the product
+// of the probabilities of the composed generators.
+func (c *compositeFailureGenerator) SetFailureProbability(p float32) error {
+	for i, g := range c.gens {
+		if err := g.SetFailureProbability(p); err != nil {
+			return errors.Wrapf(
+				err,
+				"Couldn't set failure-probability of generator %d",
+				i)
+		}
+	}
+	return nil
+}
+
+// FailMaybe returns an artificial error as per the composed generators
+func (c *compositeFailureGenerator) FailMaybe() error {
+	return c.eval(func(g FailureGenerator) error {
+		return g.FailMaybe()
+	})
+}
+
+// FailOnCondition returns an artificial error as per the composed
+// generators, conditional generators among them are evaluated against buf
+func (c *compositeFailureGenerator) FailOnCondition(buf []byte) error {
+	return c.eval(func(g FailureGenerator) error {
+		if cg, ok := g.(ConditionalFailureGenerator); ok {
+			return cg.FailOnCondition(buf)
+		}
+		return g.FailMaybe()
+	})
+}
+
+// DeepCopy returns a deep copy of the original object
+func (c *compositeFailureGenerator) DeepCopy() FailureGenerator {
+	gens := make([]FailureGenerator, len(c.gens))
+	for i, g := range c.gens {
+		gens[i] = g.DeepCopy()
+	}
+	return &compositeFailureGenerator{gens: gens, op: c.op}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func generatorWithProbability(
+	t *testing.T,
+	p float32,
+) failuregen.FailureGenerator {
+	g := failuregen.NewFailureGenerator()
+	require.NoError(t, g.SetFailureProbability(p))
+	return g
+}
+
+func TestAnyFailsIfAnyGeneratorFails(t *testing.T) {
+	never := generatorWithProbability(t, 0)
+	always := generatorWithProbability(t, 1)
+
+	require.NoError(t, failuregen.Any(never, never).FailMaybe())
+	require.Error(t, failuregen.Any(never, always).FailMaybe())
+	require.Error(t, failuregen.Any(always, never).FailMaybe())
+	require.NoError(t, failuregen.Any().FailMaybe())
+}
+
+func TestAllFailsOnlyIfAllGeneratorsFail(t *testing.T) {
+	never := generatorWithProbability(t, 0)
+	always := generatorWithProbability(t, 1)
+
+	require.Error(t, failuregen.All(always, always).FailMaybe())
+	require.NoError(t, failuregen.All(never, always).FailMaybe())
+	require.NoError(t, failuregen.All(always, never).FailMaybe())
+}
+
+func TestAllWithConditionMatchesContent(t *testing.T) {
+	matching := &failuregen.ConditionalFailureGeneratorImpl{
+		Fg: generatorWithProbability(t, 1),
+		Condition: func(buf []byte) bool {
+			return bytes.Contains(buf, []byte("COMMIT"))
+		},
+	}
+	g := failuregen.All(generatorWithProbability(t, 1), matching)
+
+	require.Error(t, g.FailOnCondition([]byte("COMMIT;")))
+	require.NoError(t, g.FailOnCondition([]byte("SELECT 1;")))
+
+	// probability applies to all composed generators
+	require.NoError(t, g.SetFailureProbability(0))
+	require.NoError(t, g.FailOnCondition([]byte("COMMIT;")))
+
+	copied := g.DeepCopy().(failuregen.ConditionalFailureGenerator)
+	require.NoError(t, copied.SetFailureProbability(1))
+	require.Error(t, copied.FailOnCondition([]byte("COMMIT;")))
+	require.NoError(t, g.FailOnCondition([]byte("COMMIT;")))
+}
+
+func TestSequenceConsultsAllGenerators(t *testing.T) {
+	always := generatorWithProbability(t, 1)
+	delayed := failuregen.NewFailureGenerator()
+	require.NoError(t, delayed.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   10,
+		DelayProbability: 1,
+	}))
+	matching := &failuregen.ConditionalFailureGeneratorImpl{
+		Fg: generatorWithProbability(t, 1),
+		Condition: func(buf []byte) bool {
+			return bytes.Contains(buf, []byte("COMMIT"))
+		},
+	}
+
+	g := failuregen.Sequence(delayed, matching)
+	require.Error(t, g.FailOnCondition([]byte("COMMIT;")))
+	require.NoError(t, g.FailOnCondition([]byte("SELECT 1;")))
+	require.Equal(
+		t,
+		int64(2),
+		delayed.(*failuregen.FailureGeneratorImpl).Stats().Delays)
+
+	// generators after a failure still run
+	err := failuregen.Sequence(always, delayed).FailMaybe()
+	require.ErrorIs(t, err, failuregen.ErrInjectedFailure)
+	require.Equal(
+		t,
+		int64(3),
+		delayed.(*failuregen.FailureGeneratorImpl).Stats().Delays)
+	require.NoError(t, failuregen.Sequence().FailMaybe())
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidProbability is returned (wrapped) for probabilities outside
+	// [0.0, 1.0]
+	ErrInvalidProbability = errors.New("Invalid probability")
+	// ErrInvalidDelay is returned (wrapped) for negative delays
+	ErrInvalidDelay = errors.New("Invalid delay")
+)
+
+// ErrMalformedPlan is returned when an assured-failure-plan can't be parsed
+type ErrMalformedPlan struct {
+	// Path of the plan
+	Path string
+	// Pos is the byte offset in the plan at which parsing failed, -1 if
+	// unknown
+	Pos int64
+	// Err is the underlying parse error
+	Err error
+}
+
+func (e *ErrMalformedPlan) Error() string {
+	return fmt.Sprintf(
+		"Malformed assured-failure-plan %s at offset %d: %v",
+		e.Path,
+		e.Pos,
+		e.Err)
+}
+
+// Unwrap returns the underlying parse error
+func (e *ErrMalformedPlan) Unwrap() error {
+	return e.Err
+}
+
+// newErrMalformedPlan creates an ErrMalformedPlan, extracting the position
+// of the error from JSON errors
+func newErrMalformedPlan(path string, err error) *ErrMalformedPlan {
+	pos := int64(-1)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		pos = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		pos = typeErr.Offset
+	}
+	return &ErrMalformedPlan{Path: path, Pos: pos, Err: err}
+}
+
+// ErrUnknownFailurePoint is returned when a plan refers to a failure-point
+// that is not known
+type ErrUnknownFailurePoint struct {
+	// Name of the unknown failure-point
+	Name FailurePoint
+}
+
+func (e *ErrUnknownFailurePoint) Error() string {
+	return fmt.Sprintf("Unknown failure-point %s", e.Name)
+}
+
+// ValidatePlan checks that every failure-point in the plan is known,
+// returning an ErrUnknownFailurePoint for the first one that is not, or an
+// ErrMalformedPlan for the first entry with invalid suffixes
+func ValidatePlan(plan []FailurePoint, known []FailurePoint) error {
+	knownSet := make(map[FailurePoint]struct{}, len(known))
+	for _, fp := range known {
+		knownSet[fp] = struct{}{}
+	}
+	for _, entry := range plan {
+		fp, suffix := splitEntry(entry)
+		if _, err := parseRule(suffix); err != nil {
+			return errors.WithStack(newErrMalformedPlan(
+				"",
+				errors.Wrapf(err, "Invalid entry %s", entry)))
+		}
+		if _, ok := knownSet[fp]; !ok {
+			return errors.WithStack(&ErrUnknownFailurePoint{Name: fp})
+		}
+	}
+	return nil
+}
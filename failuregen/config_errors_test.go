@@ -0,0 +1,65 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestConfigErrorsAreTyped(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	require.ErrorIs(
+		t,
+		g.SetFailureProbability(1.5),
+		failuregen.ErrInvalidProbability)
+	require.ErrorIs(
+		t,
+		g.SetDelayConfig(failuregen.DelayConfig{
+			MaxDelayMicros:   10,
+			DelayProbability: -1,
+		}),
+		failuregen.ErrInvalidProbability)
+	require.ErrorIs(
+		t,
+		g.SetDelayConfig(failuregen.DelayConfig{
+			MaxDelayMicros:   -10,
+			DelayProbability: 0.5,
+		}),
+		failuregen.ErrInvalidDelay)
+}
+
+func TestMalformedPlanErrorHasPosition(t *testing.T) {
+	afp := AssureFailuresAt(t)
+	path := afp.(*failuregen.AssuredFailurePlanImpl).PlanFilePath
+	require.NoError(t, os.WriteFile(path, []byte(`["SChTargetStateP1",]`), 0644))
+
+	err := afp.FailMaybe(failuregen.SChTargetStateP1)
+	var malformed *failuregen.ErrMalformedPlan
+	require.True(t, errors.As(err, &malformed))
+	require.Equal(t, path, malformed.Path)
+	require.Equal(t, int64(21), malformed.Pos)
+}
+
+func TestValidatePlanRejectsUnknownFailurePoints(t *testing.T) {
+	require.NoError(t, failuregen.ValidatePlan(knownFailures[:2], knownFailures))
+
+	err := failuregen.ValidatePlan(
+		[]failuregen.FailurePoint{failuregen.SChTargetStateP1, "SChTargetStateP2"},
+		knownFailures)
+	var unknown *failuregen.ErrUnknownFailurePoint
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, failuregen.FailurePoint("SChTargetStateP2"), unknown.Name)
+
+	// rule suffixes are not part of the name
+	err = failuregen.ValidatePlan(
+		[]failuregen.FailurePoint{"SChTargetStateP2:once:consumed"},
+		knownFailures)
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, failuregen.FailurePoint("SChTargetStateP2"), unknown.Name)
+}
@@ -0,0 +1,350 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// ConsulKV is a client of the key-value store of Consul, through its HTTP
+// API, for plans and stats to be shared by distributed test runners (see
+// ConsulPlanStore and ConsulStatsStore)
+type ConsulKV struct {
+	// Addr is the address of the Consul agent, e.g. "http://127.0.0.1:8500"
+	Addr string
+	// Token is the ACL token of the requests, if any
+	Token string
+	// Client sends the requests, http.DefaultClient is used when nil
+	Client *http.Client
+}
+
+// do sends a request for key to the KV API, query being the query string of
+// the request
+func (c *ConsulKV) do(
+	method string,
+	key string,
+	query string,
+	body []byte,
+) (*http.Response, error) {
+	url := strings.TrimSuffix(c.Addr, "/") + "/v1/kv/" +
+		strings.TrimPrefix(key, "/")
+	if query != "" {
+		url += "?" + query
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid Consul request %s %s", method, url)
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Consul request %s %s failed", method, url)
+	}
+	return resp, nil
+}
+
+// readConsul returns the body of resp, found is false if the key is missing
+func readConsul(resp *http.Response, key string) ([]byte, bool, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, errors.Errorf(
+			"Consul request for %s failed: %s: %s",
+			key,
+			resp.Status,
+			body)
+	case err != nil:
+		return nil, false, errors.Wrapf(err, "Failed to read Consul key %s", key)
+	}
+	return body, true, nil
+}
+
+// Get returns the value of key, found is false if the key is missing
+func (c *ConsulKV) Get(key string) ([]byte, bool, error) {
+	resp, err := c.do(http.MethodGet, key, "raw=true", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return readConsul(resp, key)
+}
+
+// Put sets the value of key
+func (c *ConsulKV) Put(key string, value []byte) error {
+	resp, err := c.do(http.MethodPut, key, "", value)
+	if err != nil {
+		return err
+	}
+	_, _, err = readConsul(resp, key)
+	return err
+}
+
+// GetWithIndex returns the value of key and its modify-index, for writes
+// conditional on the key not changing meanwhile (see PutCAS). The index of a
+// missing key is 0.
+func (c *ConsulKV) GetWithIndex(key string) ([]byte, uint64, error) {
+	resp, err := c.do(http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	body, found, err := readConsul(resp, key)
+	if err != nil || !found {
+		return nil, 0, err
+	}
+	var pairs []struct {
+		Value       []byte
+		ModifyIndex uint64
+	}
+	if err := json.Unmarshal(body, &pairs); err != nil || len(pairs) != 1 {
+		return nil, 0, errors.Errorf("Malformed Consul entry %s: %s", key, body)
+	}
+	return pairs[0].Value, pairs[0].ModifyIndex, nil
+}
+
+// PutCAS sets the value of key if its modify-index is still index (the key
+// must be missing if index is 0), swapped is false if it is not
+func (c *ConsulKV) PutCAS(
+	key string,
+	value []byte,
+	index uint64,
+) (bool, error) {
+	resp, err := c.do(
+		http.MethodPut,
+		key,
+		"cas="+strconv.FormatUint(index, 10),
+		value)
+	if err != nil {
+		return false, err
+	}
+	body, _, err := readConsul(resp, key)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(body)) == "true", nil
+}
+
+// List returns the values of the keys under prefix, by key
+func (c *ConsulKV) List(prefix string) (map[string][]byte, error) {
+	resp, err := c.do(http.MethodGet, prefix, "recurse=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	body, found, err := readConsul(resp, prefix)
+	if err != nil || !found {
+		return nil, err
+	}
+	var pairs []struct {
+		Key   string
+		Value []byte
+	}
+	if err := json.Unmarshal(body, &pairs); err != nil {
+		return nil, errors.Wrapf(err, "Malformed Consul listing of %s", prefix)
+	}
+	values := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		values[pair.Key] = pair.Value
+	}
+	return values, nil
+}
+
+// ConsulPlanStore is an ExpiringPlanStore keeping the plan in a Consul key,
+// in any of the formats of plan files (see FilePlanStore), so that
+// distributed test runners share a single live-updatable plan
+type ConsulPlanStore struct {
+	KV  *ConsulKV
+	Key string
+}
+
+// maxPlanCASAttempts bounds the attempts to write a plan to Consul while
+// other runners write it concurrently
+const maxPlanCASAttempts = 10
+
+// Load reads the plan from the key. A missing or empty key is an empty plan,
+// as is an expired one.
+func (s *ConsulPlanStore) Load() ([]FailurePoint, error) {
+	value, _, err := s.KV.Get(s.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read assured-failure-plan: %s", s)
+	}
+	failurePoints, expiresAt, err := s.parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if expired(expiresAt) {
+		if log.V(2) {
+			log.Infof(
+				context.Background(),
+				"Ignoring assured-failure-plan %s, expired at %v",
+				s,
+				expiresAt)
+		}
+		return nil, nil
+	}
+	return failurePoints, nil
+}
+
+// parse parses the plan held by the key and its expiry, be it expired or not
+func (s *ConsulPlanStore) parse(
+	value []byte,
+) ([]FailurePoint, time.Time, error) {
+	if len(value) == 0 {
+		return nil, time.Time{}, nil
+	}
+	failurePoints, expiresAt, err := parsePlan(value)
+	if err != nil {
+		return nil, time.Time{}, errors.WithStack(
+			newErrMalformedPlan(s.String(), err))
+	}
+	return failurePoints, expiresAt, nil
+}
+
+// write writes the plan returned by plan, given the value of the key, to the
+// key. The write is conditional on the key not changing meanwhile, plan being
+// called again with the new value if it did, so that concurrent writes by
+// other runners are not lost.
+func (s *ConsulPlanStore) write(
+	plan func(value []byte) ([]FailurePoint, time.Time, error),
+) error {
+	for attempt := 0; attempt < maxPlanCASAttempts; attempt++ {
+		value, index, err := s.KV.GetWithIndex(s.Key)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to read assured-failure-plan: %s",
+				s)
+		}
+		points, expiresAt, err := plan(value)
+		if err != nil {
+			return err
+		}
+		bytes, err := marshalPlan(points, expiresAt)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to serialize assured-failure-plan")
+		}
+		swapped, err := s.KV.PutCAS(s.Key, bytes, index)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"Failed to write assured-failure-plan: %s",
+				s)
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return errors.Errorf(
+		"Failed to write assured-failure-plan %s, modified concurrently %d times",
+		s,
+		maxPlanCASAttempts)
+}
+
+// Save writes the plan to the key, keeping the expiry of the plan it
+// replaces unless that one expired. It fails if the plan in the key can't be
+// read, rather than lose its expiry.
+func (s *ConsulPlanStore) Save(points []FailurePoint) error {
+	return s.write(func(value []byte) ([]FailurePoint, time.Time, error) {
+		_, expiresAt, err := s.parse(value)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if expired(expiresAt) {
+			expiresAt = time.Time{}
+		}
+		return points, expiresAt, nil
+	})
+}
+
+// SaveUntil writes the plan to the key, such that it expires at expiresAt
+// (never if zero)
+func (s *ConsulPlanStore) SaveUntil(
+	points []FailurePoint,
+	expiresAt time.Time,
+) error {
+	return s.write(func([]byte) ([]FailurePoint, time.Time, error) {
+		return points, expiresAt, nil
+	})
+}
+
+// Update updates the plan in the key as per update, retrying it if the key
+// is written concurrently
+func (s *ConsulPlanStore) Update(
+	update func(current []FailurePoint) ([]FailurePoint, error),
+) error {
+	return s.write(func(value []byte) ([]FailurePoint, time.Time, error) {
+		current, expiresAt, err := s.parse(value)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if expired(expiresAt) {
+			current, expiresAt = nil, time.Time{}
+		}
+		points, err := update(current)
+		return points, expiresAt, err
+	})
+}
+
+func (s *ConsulPlanStore) String() string {
+	return "consul:" + s.Key
+}
+
+// ConsulStatsStore is a StatsStore keeping the report of each runner in a
+// Consul key under Prefix
+type ConsulStatsStore struct {
+	KV     *ConsulKV
+	Prefix string
+}
+
+// Report writes the report to the key of its runner
+func (s *ConsulStatsStore) Report(report StatsReport) error {
+	if err := validRunner(report.Runner); err != nil {
+		return err
+	}
+	value, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize stats report")
+	}
+	return errors.Wrapf(
+		s.KV.Put(strings.TrimSuffix(s.Prefix, "/")+"/"+report.Runner, value),
+		"Failed to write stats report to %s",
+		s)
+}
+
+// Reports reads the reports under the prefix
+func (s *ConsulStatsStore) Reports() ([]StatsReport, error) {
+	values, err := s.KV.List(strings.TrimSuffix(s.Prefix, "/") + "/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list stats reports of %s", s)
+	}
+	reports := make([]StatsReport, 0, len(values))
+	for key, value := range values {
+		var report StatsReport
+		if err := json.Unmarshal(value, &report); err != nil {
+			return nil, errors.Wrapf(err, "Malformed stats report %s", key)
+		}
+		reports = append(reports, report)
+	}
+	sortReports(reports)
+	return reports, nil
+}
+
+func (s *ConsulStatsStore) String() string {
+	return "consul:" + s.Prefix
+}
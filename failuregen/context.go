@@ -0,0 +1,265 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ContextFailureGenerator is the context-first variant of FailureGenerator,
+// which integrates injected operations with the cancellation and logging of
+// the code under test. The bare methods of FailureGenerator are kept while
+// callers move over.
+type ContextFailureGenerator interface {
+	FailureGenerator
+	SetDelayConfigContext(ctx context.Context, c DelayConfig) error
+	SetFailureProbabilityContext(ctx context.Context, p float32) error
+	FailMaybeContext(ctx context.Context) error
+}
+
+// ContextAssuredFailurePlan is the context-first variant of
+// AssuredFailurePlan
+type ContextAssuredFailurePlan interface {
+	AssuredFailurePlan
+	FailMaybeContext(ctx context.Context, fp FailurePoint) error
+}
+
+const (
+	// LabelComponent is the profiler label key whose value is "failuregen"
+	// on the goroutines sleeping through delays injected by FailMaybeContext
+	LabelComponent = "failure-test-utils"
+	// LabelGenerator is the ID of the generator injecting the delay
+	LabelGenerator = "failuregen.generator"
+)
+
+// profileLabels returns the profiler labels of the delays injected by fg
+func (fg *FailureGeneratorImpl) profileLabels() pprof.LabelSet {
+	return pprof.Labels(LabelComponent, "failuregen", LabelGenerator, fg.id)
+}
+
+// sleepContext sleeps for delay, it returns early with the error of ctx if
+// ctx is done first. A non-nil sleep sleeps instead of a timer, it can't be
+// cut short and the error of ctx is returned if ctx is done once it returns.
+func sleepContext(
+	ctx context.Context,
+	sleep delayFn,
+	delay time.Duration,
+) error {
+	if sleep != nil {
+		sleep(delay)
+		return errors.WithStack(ctx.Err())
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// SetDelayConfigContext is SetDelayConfig, it returns the error of ctx if ctx
+// is done
+func (fg *FailureGeneratorImpl) SetDelayConfigContext(
+	ctx context.Context,
+	c DelayConfig,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return fg.SetDelayConfig(c)
+}
+
+// SetFailureProbabilityContext is SetFailureProbability, it returns the
+// error of ctx if ctx is done
+func (fg *FailureGeneratorImpl) SetFailureProbabilityContext(
+	ctx context.Context,
+	p float32,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return fg.SetFailureProbability(p)
+}
+
+// contextGenerator adapts a FailureGenerator to ContextFailureGenerator
+type contextGenerator struct {
+	FailureGenerator
+}
+
+// WithContext returns fg as a ContextFailureGenerator. Generators without
+// context-first methods are adapted: the error of ctx is returned if ctx is
+// done before or after the call, but injected delays are not cut short.
+// Either way, nothing is injected within a NoInject context.
+func WithContext(fg FailureGenerator) ContextFailureGenerator {
+	if cfg, ok := fg.(ContextFailureGenerator); ok {
+		return cfg
+	}
+	return contextGenerator{fg}
+}
+
+func (g contextGenerator) SetDelayConfigContext(
+	ctx context.Context,
+	c DelayConfig,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return g.SetDelayConfig(c)
+}
+
+func (g contextGenerator) SetFailureProbabilityContext(
+	ctx context.Context,
+	p float32,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return g.SetFailureProbability(p)
+}
+
+func (g contextGenerator) FailMaybeContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	err := g.FailMaybe()
+	if ctxErr := ctx.Err(); err == nil && ctxErr != nil {
+		return errors.WithStack(ctxErr)
+	}
+	return err
+}
+
+func (g contextGenerator) DeepCopy() FailureGenerator {
+	return contextGenerator{g.FailureGenerator.DeepCopy()}
+}
+
+// FailMaybeContext steps the chain and returns an artificial error as per
+// the config of the new state, see FailureGeneratorImpl.FailMaybeContext
+func (g *MarkovGenerator) FailMaybeContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	g.step()
+	return g.FailureGeneratorImpl.FailMaybeContext(ctx)
+}
+
+// SetDelayConfigContext sets the delay configuration on every composed
+// generator
+func (c *compositeFailureGenerator) SetDelayConfigContext(
+	ctx context.Context,
+	cfg DelayConfig,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.SetDelayConfig(cfg)
+}
+
+// SetFailureProbabilityContext sets the failure probability on every
+// composed generator
+func (c *compositeFailureGenerator) SetFailureProbabilityContext(
+	ctx context.Context,
+	p float32,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.SetFailureProbability(p)
+}
+
+// FailMaybeContext returns an artificial error as per the composed
+// generators, which are consulted with ctx
+func (c *compositeFailureGenerator) FailMaybeContext(
+	ctx context.Context,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	return c.eval(func(g FailureGenerator) error {
+		return WithContext(g).FailMaybeContext(ctx)
+	})
+}
+
+// SetDelayConfigContext sets configuration for injecting artificial delay
+func (cfg *ConditionalFailureGeneratorImpl) SetDelayConfigContext(
+	ctx context.Context,
+	c DelayConfig,
+) error {
+	return WithContext(cfg.Fg).SetDelayConfigContext(ctx, c)
+}
+
+// SetFailureProbabilityContext sets the desired artificial failure
+// probability
+func (cfg *ConditionalFailureGeneratorImpl) SetFailureProbabilityContext(
+	ctx context.Context,
+	p float32,
+) error {
+	return WithContext(cfg.Fg).SetFailureProbabilityContext(ctx, p)
+}
+
+// FailMaybeContext returns an artificial error with configured probability
+func (cfg *ConditionalFailureGeneratorImpl) FailMaybeContext(
+	ctx context.Context,
+) error {
+	return WithContext(cfg.Fg).FailMaybeContext(ctx)
+}
+
+// FailMaybeContext is FailMaybe, it returns the error of ctx if ctx is done
+func (ce *CredentialExpiry) FailMaybeContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	return ce.FailMaybe()
+}
+
+// FailMaybeContext is FailMaybe, it returns the error of ctx if ctx is done
+// and the injection is logged with the tags of ctx
+func (afp *AssuredFailurePlanImpl) FailMaybeContext(
+	ctx context.Context,
+	fp FailurePoint,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	return afp.failMaybe(ctx, fp)
+}
+
+// FailMaybeContext is FailMaybe, with the plan and the generator of fp
+// consulted with ctx
+func (r *Registry) FailMaybeContext(ctx context.Context, fp FailurePoint) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		r.Register(fp)
+		return nil
+	}
+	return r.failMaybe(fp, func(plan AssuredFailurePlan) error {
+		if cp, ok := plan.(ContextAssuredFailurePlan); ok {
+			return cp.FailMaybeContext(ctx, fp)
+		}
+		return plan.FailMaybe(fp)
+	}, func(fg FailureGenerator) error {
+		return WithContext(fg).FailMaybeContext(ctx)
+	})
+}
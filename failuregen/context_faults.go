@@ -0,0 +1,81 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"time"
+)
+
+// ContextFaults hands downstream code contexts that are broken in ways code
+// often fails to handle: already canceled, missing expected values, or
+// missing a deadline. Nil generators never inject their fault.
+type ContextFaults struct {
+	// CancelFg hands an already canceled context
+	CancelFg FailureGenerator
+	// DropValuesFg hands a context missing values, the ones keyed by
+	// DropKeys or all of them if DropKeys is empty. Cancellation and
+	// deadline are kept.
+	DropValuesFg FailureGenerator
+	DropKeys     []interface{}
+	// DropDeadlineFg hands a context without deadline (nor cancellation),
+	// values are kept
+	DropDeadlineFg FailureGenerator
+}
+
+// withoutValues hides values of the parent context
+type withoutValues struct {
+	context.Context
+	keys []interface{}
+}
+
+func (c withoutValues) Value(key interface{}) interface{} {
+	if len(c.keys) == 0 {
+		return nil
+	}
+	for _, k := range c.keys {
+		if k == key {
+			return nil
+		}
+	}
+	return c.Context.Value(key)
+}
+
+// withoutDeadline detaches the parent context's deadline and cancellation
+type withoutDeadline struct {
+	context.Context
+}
+
+func (withoutDeadline) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (withoutDeadline) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutDeadline) Err() error {
+	return nil
+}
+
+func injects(ctx context.Context, fg FailureGenerator) bool {
+	return fg != nil && FailMaybeContext(ctx, fg) != nil
+}
+
+// Context returns ctx with the faults the generators inject. Faults are
+// never injected in contexts returned by NoInject.
+func (cf ContextFaults) Context(ctx context.Context) context.Context {
+	faulty := ctx
+	if injects(ctx, cf.DropDeadlineFg) {
+		faulty = withoutDeadline{faulty}
+	}
+	if injects(ctx, cf.DropValuesFg) {
+		faulty = withoutValues{faulty, cf.DropKeys}
+	}
+	if injects(ctx, cf.CancelFg) {
+		var cancel context.CancelFunc
+		faulty, cancel = context.WithCancel(faulty)
+		cancel()
+	}
+	return faulty
+}
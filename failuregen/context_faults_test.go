@@ -0,0 +1,58 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey string
+
+func TestContextFaults(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx = context.WithValue(ctx, ctxKey("tenant"), "t1")
+	ctx = context.WithValue(ctx, ctxKey("request"), "r1")
+
+	never := failuregen.NewFailureGenerator()
+	always := failuregen.NewFailureGenerator()
+	require.NoError(t, always.SetFailureProbability(1))
+
+	cf := failuregen.ContextFaults{CancelFg: never, DropValuesFg: never}
+	require.Equal(t, ctx, cf.Context(ctx))
+
+	canceled := failuregen.ContextFaults{CancelFg: always}.Context(ctx)
+	require.ErrorIs(t, canceled.Err(), context.Canceled)
+	require.Equal(t, "t1", canceled.Value(ctxKey("tenant")))
+
+	noValues := failuregen.ContextFaults{DropValuesFg: always}.Context(ctx)
+	require.Nil(t, noValues.Value(ctxKey("tenant")))
+	require.Nil(t, noValues.Value(ctxKey("request")))
+	_, ok := noValues.Deadline()
+	require.True(t, ok)
+
+	noTenant := failuregen.ContextFaults{
+		DropValuesFg: always,
+		DropKeys:     []interface{}{ctxKey("tenant")},
+	}.Context(ctx)
+	require.Nil(t, noTenant.Value(ctxKey("tenant")))
+	require.Equal(t, "r1", noTenant.Value(ctxKey("request")))
+
+	noDeadline := failuregen.ContextFaults{DropDeadlineFg: always}.Context(ctx)
+	_, ok = noDeadline.Deadline()
+	require.False(t, ok)
+	require.Nil(t, noDeadline.Done())
+	require.Equal(t, "t1", noDeadline.Value(ctxKey("tenant")))
+
+	// scaffolding contexts are left alone
+	scaffold := failuregen.NoInject(ctx)
+	require.Equal(
+		t,
+		scaffold,
+		failuregen.ContextFaults{CancelFg: always}.Context(scaffold))
+}
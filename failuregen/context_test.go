@@ -0,0 +1,118 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestFailMaybeContext(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	ctx := context.Background()
+	require.NoError(t, fg.SetFailureProbabilityContext(ctx, 1))
+	require.True(t, failuregen.IsInjected(fg.FailMaybeContext(ctx)))
+
+	// a done context fails the call, which does not count
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, fg.FailMaybeContext(canceled), context.Canceled)
+	require.ErrorIs(
+		t,
+		fg.SetFailureProbabilityContext(canceled, 0),
+		context.Canceled)
+	require.ErrorIs(
+		t,
+		fg.SetDelayConfigContext(canceled, failuregen.DelayConfig{}),
+		context.Canceled)
+	require.Equal(t, int64(1), fg.State().Calls)
+}
+
+func TestFailMaybeContextCutsDelaysShort(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   1,
+		DelayProbability: 1,
+	}))
+	require.NoError(t, fg.SetFailureProbability(1))
+	// delays of 10s
+	require.NoError(t, fg.SetLatencyMultiplier(2))
+	fg.Record(10 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		errCh <- fg.FailMaybeContext(ctx)
+	}()
+
+	// the delay carries the labels of the generator
+	label := fmt.Sprintf("%q:%q", failuregen.LabelGenerator, fg.ID())
+	labeled := func() bool {
+		var profile strings.Builder
+		_ = pprof.Lookup("goroutine").WriteTo(&profile, 1)
+		return strings.Contains(profile.String(), label)
+	}
+	require.Eventually(t, labeled, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	err := <-errCh
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, failuregen.IsInjected(err))
+	require.Less(t, time.Since(start), 10*time.Second)
+	// nothing keeps sleeping through the delay
+	require.False(t, labeled())
+}
+
+// bareGenerator implements FailureGenerator only
+type bareGenerator struct {
+	failuregen.FailureGenerator
+}
+
+func TestWithContext(t *testing.T) {
+	fg := failuregen.NewFailureGenerator()
+	require.Equal(t, fg, failuregen.WithContext(fg))
+
+	bare := bareGenerator{failuregen.NewFailureGenerator()}
+	cfg := failuregen.WithContext(bare)
+	ctx := context.Background()
+	require.NoError(t, cfg.SetFailureProbabilityContext(ctx, 1))
+	require.True(t, failuregen.IsInjected(cfg.FailMaybeContext(ctx)))
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, cfg.FailMaybeContext(canceled), context.Canceled)
+
+	// composites consult their generators with the context
+	composite := failuregen.WithContext(failuregen.Any(bare, fg))
+	require.True(t, failuregen.IsInjected(composite.FailMaybeContext(ctx)))
+	require.ErrorIs(t, composite.FailMaybeContext(canceled), context.Canceled)
+}
+
+func TestAssuredFailurePlanFailMaybeContext(t *testing.T) {
+	plan := AssureFailuresAt(t, failuregen.SChTargetStateP1).(failuregen.
+		ContextAssuredFailurePlan)
+	ctx := context.Background()
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybeContext(ctx, failuregen.SChTargetStateP1)))
+	require.NoError(t, plan.FailMaybeContext(ctx, failuregen.SChTargetStateC6))
+
+	registry := failuregen.NewRegistry()
+	registry.SetPlan(plan)
+	require.True(t, failuregen.IsInjected(
+		registry.FailMaybeContext(ctx, failuregen.SChTargetStateP1)))
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(
+		t,
+		registry.FailMaybeContext(canceled, failuregen.SChTargetStateP1),
+		context.Canceled)
+}
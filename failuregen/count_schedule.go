@@ -0,0 +1,50 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"github.com/pkg/errors"
+)
+
+// CountSchedule fails calls deterministically, by their 1-based position in
+// the sequence of FailMaybe calls of a generator. Scheduled failures are
+// injected in addition to the probabilistic ones, set the failure
+// probability to 0 for purely deterministic injection. Zero fields are
+// disabled.
+type CountSchedule struct {
+	// OnCall fails exactly the OnCall-th call
+	OnCall int64
+	// Every fails every Every-th call
+	Every int64
+	// FirstN fails the first FirstN calls
+	FirstN int64
+}
+
+// fails tells if the call-th call is scheduled to fail
+func (s *CountSchedule) fails(call int64) bool {
+	return call == s.OnCall ||
+		(s.Every > 0 && call%s.Every == 0) ||
+		call <= s.FirstN
+}
+
+// SetCountSchedule makes the generator fail calls as per s, a zero s
+// disables scheduled failures. Calls are counted from the creation of the
+// generator, see State.
+func (fg *FailureGeneratorImpl) SetCountSchedule(s CountSchedule) error {
+	if s.OnCall < 0 || s.Every < 0 || s.FirstN < 0 {
+		return errors.Errorf("Invalid count schedule %+v", s)
+	}
+	if s == (CountSchedule{}) {
+		fg.countSchedule.Store(nil)
+		return nil
+	}
+	fg.countSchedule.Store(&s)
+	return nil
+}
+
+// scheduledFailure tells if the call with the given 0-based count is
+// scheduled to fail
+func (fg *FailureGeneratorImpl) scheduledFailure(callCount int64) bool {
+	s := fg.countSchedule.Load()
+	return s != nil && s.fails(callCount+1)
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountSchedule(t *testing.T) {
+	failedCalls := func(s failuregen.CountSchedule, p float32) []int {
+		fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+		require.NoError(t, fg.SetFailureProbability(p))
+		require.NoError(t, fg.SetCountSchedule(s))
+		var failed []int
+		for call := 1; call <= 10; call++ {
+			if fg.FailMaybe() != nil {
+				failed = append(failed, call)
+			}
+		}
+		return failed
+	}
+
+	require.Equal(t, []int{4}, failedCalls(failuregen.CountSchedule{OnCall: 4}, 0))
+	require.Equal(
+		t,
+		[]int{3, 6, 9},
+		failedCalls(failuregen.CountSchedule{Every: 3}, 0))
+	require.Equal(
+		t,
+		[]int{1, 2},
+		failedCalls(failuregen.CountSchedule{FirstN: 2}, 0))
+	require.Equal(
+		t,
+		[]int{1, 2, 5, 7, 10},
+		failedCalls(failuregen.CountSchedule{OnCall: 7, Every: 5, FirstN: 2}, 0))
+	require.Empty(t, failedCalls(failuregen.CountSchedule{}, 0))
+	// alongside the probability
+	require.Len(t, failedCalls(failuregen.CountSchedule{OnCall: 4}, 1), 10)
+
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.Error(t, fg.SetCountSchedule(failuregen.CountSchedule{Every: -1}))
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+// CoverageConfig configures a CoverageGuidedGenerator
+type CoverageConfig struct {
+	// FailureProbability is the baseline failure probability of a point
+	FailureProbability float32
+	// MaxBoost bounds the factor by which the probability of a point is
+	// raised (if under-exercised) or lowered (if over-exercised), must be >= 1
+	MaxBoost float32
+	// Window is the number of evaluations after which fired counts are
+	// halved, so that only recent coverage matters. 0 disables decay.
+	Window int64
+}
+
+// CoverageGuidedGenerator injects failures at named failure-points, biasing
+// the failure probability towards points which have fired less often than
+// average so that long soak runs exercise all points without manual tuning
+type CoverageGuidedGenerator struct {
+	injectionTracker
+	mu          sync.Mutex
+	cfg         CoverageConfig
+	fired       map[FailurePoint]float64
+	evaluations int64
+	injectedCtr int64
+	randGen     *randutil.LockedRandGen
+	id          string
+}
+
+// NewCoverageGuidedGenerator creates a new coverage-guided generator
+func NewCoverageGuidedGenerator(
+	cfg CoverageConfig,
+) (*CoverageGuidedGenerator, error) {
+	g := &CoverageGuidedGenerator{
+		fired:   make(map[FailurePoint]float64),
+		randGen: randutil.NewLockedRandGen(time.Now().UnixNano()),
+		id:      uuid.New().String(),
+	}
+	if err := g.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// SetConfig replaces the configuration of the generator
+func (g *CoverageGuidedGenerator) SetConfig(cfg CoverageConfig) error {
+	if _, err := ppm(cfg.FailureProbability); err != nil {
+		return errors.Wrapf(err, "Couldn't compute failure-ppm")
+	}
+	if cfg.MaxBoost < 1 {
+		return errors.Errorf("Invalid max-boost %f, must be >= 1", cfg.MaxBoost)
+	}
+	if cfg.Window < 0 {
+		return errors.Errorf("Invalid window %d", cfg.Window)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cfg = cfg
+	return nil
+}
+
+// probabilityLocked computes the biased probability of fp, mu must be held
+func (g *CoverageGuidedGenerator) probabilityLocked(fp FailurePoint) float32 {
+	if _, ok := g.fired[fp]; !ok {
+		g.fired[fp] = 0
+	}
+	total := float64(0)
+	for _, n := range g.fired {
+		total += n
+	}
+	mean := total / float64(len(g.fired))
+	boost := float32((mean + 1) / (g.fired[fp] + 1))
+	if boost > g.cfg.MaxBoost {
+		boost = g.cfg.MaxBoost
+	} else if boost < 1/g.cfg.MaxBoost {
+		boost = 1 / g.cfg.MaxBoost
+	}
+	p := g.cfg.FailureProbability * boost
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+// ProbabilityAt returns the current biased failure probability of fp
+func (g *CoverageGuidedGenerator) ProbabilityAt(fp FailurePoint) float32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.probabilityLocked(fp)
+}
+
+// FailMaybeAt returns an artificial error at fp with its biased probability
+func (g *CoverageGuidedGenerator) FailMaybeAt(fp FailurePoint) error {
+	err := g.failMaybeAt(fp)
+	if err == nil {
+		return nil
+	}
+	g.emitInjection(failureEvent(err.InjectionInfo))
+	return errors.WithStack(err)
+}
+
+// failMaybeAt decides whether to fail at fp, the OnInject hooks being left to
+// the caller so that they run without holding mu
+func (g *CoverageGuidedGenerator) failMaybeAt(
+	fp FailurePoint,
+) *InjectedFailureError {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.probabilityLocked(fp)
+
+	g.evaluations++
+	if g.cfg.Window > 0 && g.evaluations%g.cfg.Window == 0 {
+		for point := range g.fired {
+			g.fired[point] /= 2
+		}
+	}
+
+	if g.randGen.Int31n(OneMillion) >= int32(p*float32(OneMillion)) {
+		return nil
+	}
+	g.fired[fp]++
+	g.injectedCtr++
+	g.recordInjection()
+	return &InjectedFailureError{
+		msg: ErrInjectedFailure.Error(),
+		InjectionInfo: InjectionInfo{
+			InjectionID:  newInjectionID(),
+			Time:         time.Now(),
+			FailurePoint: fp,
+			GeneratorID:  g.id,
+			Sequence:     g.injectedCtr,
+			Config:       GeneratorConfig{FailureProbability: p},
+		},
+	}
+}
+
+// Coverage returns the (decayed) number of failures fired per failure-point
+func (g *CoverageGuidedGenerator) Coverage() map[FailurePoint]float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	coverage := make(map[FailurePoint]float64, len(g.fired))
+	for fp, n := range g.fired {
+		coverage[fp] = n
+	}
+	return coverage
+}
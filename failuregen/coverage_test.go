@@ -0,0 +1,72 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestCoverageGuidedGeneratorBoostsUnderExercisedPoints(t *testing.T) {
+	g, err := failuregen.NewCoverageGuidedGenerator(failuregen.CoverageConfig{
+		FailureProbability: 0.1,
+		MaxBoost:           4,
+	})
+	require.NoError(t, err)
+
+	hot := failuregen.SChTargetStateP1
+	cold := failuregen.FailurePoint(failuregen.SChTargetStateC6)
+	require.InDelta(t, 0.1, g.ProbabilityAt(hot), 1e-6)
+
+	for i := 0; i < 10000; i++ {
+		_ = g.FailMaybeAt(hot)
+	}
+	require.Greater(t, g.Coverage()[hot], float64(0))
+
+	// boost of the cold point is bounded by MaxBoost, the hot point fired
+	// about twice the mean
+	require.InDelta(t, 0.4, g.ProbabilityAt(cold), 1e-6)
+	require.InDelta(t, 0.05, g.ProbabilityAt(hot), 1e-3)
+
+	failures := 0
+	for i := 0; i < 10000; i++ {
+		if g.FailMaybeAt(cold) != nil {
+			failures++
+		}
+	}
+	require.Greater(t, failures, 1000)
+}
+
+func TestCoverageGuidedGeneratorRejectsInvalidConfig(t *testing.T) {
+	_, err := failuregen.NewCoverageGuidedGenerator(failuregen.CoverageConfig{
+		FailureProbability: 1.5,
+		MaxBoost:           2,
+	})
+	require.Error(t, err)
+	_, err = failuregen.NewCoverageGuidedGenerator(failuregen.CoverageConfig{
+		FailureProbability: 0.5,
+		MaxBoost:           0.5,
+	})
+	require.Error(t, err)
+}
+
+func TestCoverageGuidedGeneratorHookReentersGenerator(t *testing.T) {
+	g, err := failuregen.NewCoverageGuidedGenerator(failuregen.CoverageConfig{
+		FailureProbability: 1,
+		MaxBoost:           1,
+	})
+	require.NoError(t, err)
+	var probabilities []float32
+	g.OnInject(func(event failuregen.InjectionEvent) {
+		probabilities = append(probabilities, g.ProbabilityAt(event.FailurePoint))
+		if event.FailurePoint == failuregen.SChTargetStateP1 {
+			require.Error(t, g.FailMaybeAt(failuregen.SChTargetStateC6))
+		}
+	})
+	require.Error(t, g.FailMaybeAt(failuregen.SChTargetStateP1))
+	require.Equal(t, []float32{1, 1}, probabilities)
+	require.Len(t, g.Coverage(), 2)
+}
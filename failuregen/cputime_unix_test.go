@@ -0,0 +1,13 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build !windows
+
+package failuregen_test
+
+import "syscall"
+
+func cpuTimeNs() int64 {
+	usage := new(syscall.Rusage)
+	syscall.Getrusage(syscall.RUSAGE_SELF, usage)
+	return usage.Utime.Nano() + usage.Stime.Nano()
+}
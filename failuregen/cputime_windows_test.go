@@ -0,0 +1,24 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build windows
+
+package failuregen_test
+
+import "syscall"
+
+func cpuTimeNs() int64 {
+	var creation, exit, kernel, user syscall.Filetime
+	process, _ := syscall.GetCurrentProcess()
+	syscall.GetProcessTimes(
+		process,
+		&creation,
+		&exit,
+		&kernel,
+		&user)
+	// Filetime.Nanoseconds interprets the value as an absolute time since
+	// 1601, durations have to be converted from 100ns units directly
+	toNs := func(ft syscall.Filetime) int64 {
+		return (int64(ft.HighDateTime)<<32 + int64(ft.LowDateTime)) * 100
+	}
+	return toNs(kernel) + toNs(user)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rubrikinc/failure-test-utils/log"
+	"go.uber.org/atomic"
+)
+
+// CrashMode is how an injected crash kills the process
+type CrashMode int
+
+const (
+	// CrashExit exits the process with the exit code of the outcome,
+	// deferred functions don't run
+	CrashExit CrashMode = iota
+	// CrashPanic panics in the goroutine reaching the failure-point, the
+	// process dies unless the panic is recovered
+	CrashPanic
+)
+
+// CrashOutcome describes an injected crash
+type CrashOutcome struct {
+	Mode CrashMode
+	// ExitCode is the exit code of CrashExit
+	ExitCode int
+}
+
+// crashesAllowed guards injected crashes, they must be explicitly opted into
+var crashesAllowed atomic.Bool
+
+// AllowCrashes opts the process into injected crashes. Until it is called,
+// failure-points slated to crash return the injected error instead.
+func AllowCrashes(allowed bool) {
+	crashesAllowed.Store(allowed)
+}
+
+// crash kills the process as per outcome, err is the injected failure
+func crash(outcome CrashOutcome, err error) error {
+	if !crashesAllowed.Load() {
+		log.Warningf(
+			context.Background(),
+			"Crashes are not allowed, returning injected failure instead: %v",
+			err)
+		return err
+	}
+	info, _ := InfoFromError(err)
+	msg := fmt.Sprintf(
+		"Injected crash at %s (injection %s)",
+		info.FailurePoint,
+		info.InjectionID)
+	log.Errorf(context.Background(), "%s", msg)
+	if outcome.Mode == CrashPanic {
+		panic(msg)
+	}
+	os.Exit(outcome.ExitCode)
+	return err
+}
+
+// CrashAt makes fp crash the process as per outcome, instead of returning
+// the injected error, when the plan fires it. Pre and post failure hooks run
+// before the crash, and the progress of the plan is persisted (see
+// StatePath) so that the restarted process resumes the plan. Crashes must
+// be allowed with AllowCrashes.
+func (afp *AssuredFailurePlanImpl) CrashAt(
+	fp FailurePoint,
+	outcome CrashOutcome,
+) {
+	afp.hooksMu.Lock()
+	defer afp.hooksMu.Unlock()
+	if afp.crashes == nil {
+		afp.crashes = make(map[FailurePoint]CrashOutcome)
+	}
+	afp.crashes[fp] = outcome
+}
+
+func (afp *AssuredFailurePlanImpl) crashOutcome(
+	fp FailurePoint,
+) (CrashOutcome, bool) {
+	afp.hooksMu.Lock()
+	defer afp.hooksMu.Unlock()
+	outcome, ok := afp.crashes[fp]
+	return outcome, ok
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+const crashStateEnv = "FAILUREGEN_CRASH_TEST_STATE"
+
+func TestInjectedCrashExit(t *testing.T) {
+	if statePath := os.Getenv(crashStateEnv); statePath != "" {
+		// the crashing process
+		afp := failuregen.NewAssuredFailurePlanWithState(
+			&memPlanStore{points: []failuregen.FailurePoint{"step.2"}},
+			statePath).(*failuregen.AssuredFailurePlanImpl)
+		afp.CrashAt("step.2", failuregen.CrashOutcome{
+			Mode:     failuregen.CrashExit,
+			ExitCode: 3,
+		})
+		failuregen.AllowCrashes(true)
+		for _, fp := range []failuregen.FailurePoint{"step.1", "step.2"} {
+			if err := afp.FailMaybe(fp); err != nil {
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	run := func() error {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInjectedCrashExit$")
+		cmd.Env = append(os.Environ(), crashStateEnv+"="+statePath)
+		return cmd.Run()
+	}
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, run(), &exitErr)
+	require.Equal(t, 3, exitErr.ExitCode())
+	// the restarted process resumes the plan, past the crash
+	require.NoError(t, run())
+}
+
+func TestInjectedCrashPanic(t *testing.T) {
+	plan := AssureFailuresAt(t, failuregen.SChTargetStateC6)
+	afp := plan.(*failuregen.AssuredFailurePlanImpl)
+	afp.CrashAt(failuregen.SChTargetStateC6, failuregen.CrashOutcome{
+		Mode: failuregen.CrashPanic,
+	})
+
+	// crashes must be opted into
+	failuregen.AllowCrashes(false)
+	require.ErrorIs(
+		t,
+		afp.FailMaybe(failuregen.SChTargetStateC6),
+		failuregen.ErrInjectedFailure)
+
+	failuregen.AllowCrashes(true)
+	defer failuregen.AllowCrashes(false)
+	require.Panics(t, func() { afp.FailMaybe(failuregen.SChTargetStateC6) })
+	require.NoError(t, afp.FailMaybe(failuregen.SChTargetStateP1))
+}
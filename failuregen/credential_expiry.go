@@ -0,0 +1,78 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/clock"
+)
+
+// CredentialExpiry simulates credentials or tokens which expire after a TTL
+// measured on a clock.Clock. With a clock.ManualClock re-authentication
+// flows can be tested without waiting for real expiry.
+type CredentialExpiry struct {
+	mu          sync.Mutex
+	clk         clock.Clock
+	ttl         time.Duration
+	expiredErr  error
+	issuedAt    time.Time
+	id          string
+	injectedCtr int64
+}
+
+// NewCredentialExpiry creates a credential issued now which expires after
+// ttl, after which FailMaybe returns expiredErr (e.g. the auth error of the
+// client library under test)
+func NewCredentialExpiry(
+	clk clock.Clock,
+	ttl time.Duration,
+	expiredErr error,
+) *CredentialExpiry {
+	return &CredentialExpiry{
+		clk:        clk,
+		ttl:        ttl,
+		expiredErr: expiredErr,
+		issuedAt:   clk.Now(),
+		id:         uuid.New().String(),
+	}
+}
+
+// Refresh re-issues the credential, as re-authentication would
+func (ce *CredentialExpiry) Refresh() {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	ce.issuedAt = ce.clk.Now()
+}
+
+// ExpiresAt returns the expiry time of the current credential
+func (ce *CredentialExpiry) ExpiresAt() time.Time {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	return ce.issuedAt.Add(ce.ttl)
+}
+
+// FailMaybe returns the configured auth error if the credential has expired.
+// The error matches both the configured error and ErrInjectedFailure with
+// errors.Is.
+func (ce *CredentialExpiry) FailMaybe() error {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	if ce.clk.Now().Before(ce.issuedAt.Add(ce.ttl)) {
+		return nil
+	}
+	ce.injectedCtr++
+	return errors.WithStack(&InjectedFailureError{
+		msg:   ce.expiredErr.Error(),
+		cause: ce.expiredErr,
+		InjectionInfo: InjectionInfo{
+			InjectionID: newInjectionID(),
+			Time:        ce.clk.Now(),
+			GeneratorID: ce.id,
+			Sequence:    ce.injectedCtr,
+		},
+	})
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/clock"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+var errTokenExpired = errors.New("token expired")
+
+func TestCredentialExpiresAfterTTL(t *testing.T) {
+	clk := clock.NewManualClock(time.Now())
+	ce := failuregen.NewCredentialExpiry(clk, time.Hour, errTokenExpired)
+
+	require.NoError(t, ce.FailMaybe())
+	clk.Advance(59 * time.Minute)
+	require.NoError(t, ce.FailMaybe())
+
+	clk.Advance(time.Minute)
+	err := ce.FailMaybe()
+	require.ErrorIs(t, err, errTokenExpired)
+	require.ErrorIs(t, err, failuregen.ErrInjectedFailure)
+	info, ok := failuregen.InfoFromError(err)
+	require.True(t, ok)
+	require.Equal(t, int64(1), info.Sequence)
+
+	ce.Refresh()
+	require.NoError(t, ce.FailMaybe())
+	require.Equal(t, clk.Now().Add(time.Hour), ce.ExpiresAt())
+}
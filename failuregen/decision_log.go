@@ -0,0 +1,160 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Decision is the decision a generator took for a FailMaybe call. Recorded
+// decisions can be replayed in a later run of the same test to reproduce the
+// exact same sequence of injections.
+type Decision struct {
+	// Seed of the generator at the time of the call
+	Seed int64
+	// Call is the 0-based count of the call, as per State
+	Call int64
+	// Delayed is set if a delay of Delay was injected
+	Delayed bool          `json:",omitempty"`
+	Delay   time.Duration `json:",omitempty"`
+	// Failed is set if a failure was injected
+	Failed bool `json:",omitempty"`
+}
+
+// decisionRecorder appends decisions to a file as JSON lines
+type decisionRecorder struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	enc  *json.Encoder
+	err  error
+}
+
+// decisionReplay holds the decisions being replayed, by call
+type decisionReplay struct {
+	decisions map[int64]Decision
+}
+
+// RecordDecisions makes the generator append every decision it takes to the
+// file at path, as JSON lines, till StopRecording is called. The file is
+// truncated. Each decision is written as it is taken, so that the decisions
+// survive a crash of the process.
+func (fg *FailureGeneratorImpl) RecordDecisions(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create decision log %s", path)
+	}
+	r := &decisionRecorder{path: path, f: f, enc: json.NewEncoder(f)}
+	if old := fg.recorder.Swap(r); old != nil {
+		return old.close()
+	}
+	return nil
+}
+
+// StopRecording stops recording decisions, it returns the first error met
+// while recording
+func (fg *FailureGeneratorImpl) StopRecording() error {
+	if r := fg.recorder.Swap(nil); r != nil {
+		return r.close()
+	}
+	return nil
+}
+
+func (r *decisionRecorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return r.err
+	}
+	err := r.f.Close()
+	r.f = nil
+	if r.err != nil {
+		return r.err
+	}
+	return errors.Wrapf(err, "Failed to close decision log %s", r.path)
+}
+
+func (r *decisionRecorder) record(d Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil || r.err != nil {
+		return
+	}
+	if err := r.enc.Encode(d); err != nil {
+		r.err = errors.Wrapf(err, "Failed to record decision to %s", r.path)
+	}
+}
+
+// recordDecision records the decision taken for a call, if recording
+func (fg *FailureGeneratorImpl) recordDecision(
+	callCount int64,
+	delayed bool,
+	delay time.Duration,
+	failed bool,
+) {
+	if r := fg.recorder.Load(); r != nil {
+		r.record(Decision{
+			Seed:    fg.seed.Load(),
+			Call:    callCount,
+			Delayed: delayed,
+			Delay:   delay,
+			Failed:  failed,
+		})
+	}
+}
+
+// ReadDecisions loads the decisions recorded to path by RecordDecisions
+func ReadDecisions(path string) ([]Decision, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open decision log %s", path)
+	}
+	defer f.Close()
+	var decisions []Decision
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var d Decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Malformed decision at %s:%d",
+				path,
+				line)
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, errors.Wrapf(
+		scanner.Err(),
+		"Failed to read decision log %s",
+		path)
+}
+
+// ReplayDecisions makes the generator apply the given decisions, matched by
+// call count, instead of drawing them, so that the injections of a recorded
+// run are reproduced exactly. The calls of the generator must be counted
+// from the same origin in both runs (e.g. from the creation of the
+// generator). Calls without a decision are neither delayed nor failed. The
+// seed of the generator is reset to the recorded one.
+func (fg *FailureGeneratorImpl) ReplayDecisions(decisions []Decision) {
+	replay := &decisionReplay{
+		decisions: make(map[int64]Decision, len(decisions)),
+	}
+	for _, d := range decisions {
+		replay.decisions[d.Call] = d
+	}
+	if len(decisions) > 0 {
+		fg.SetSeed(decisions[0].Seed)
+	}
+	fg.replay.Store(replay)
+}
+
+// StopReplay makes the generator draw its decisions again
+func (fg *FailureGeneratorImpl) StopReplay() {
+	fg.replay.Store(nil)
+}
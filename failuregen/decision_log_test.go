@@ -0,0 +1,57 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplayDecisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	newGenerator := func() *failuregen.FailureGeneratorImpl {
+		fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+		fg.DelayFn = func(time.Duration) {}
+		return fg
+	}
+	run := func(fg *failuregen.FailureGeneratorImpl) []bool {
+		var failed []bool
+		for i := 0; i < 100; i++ {
+			failed = append(failed, fg.FailMaybe() != nil)
+		}
+		return failed
+	}
+
+	recorded := newGenerator()
+	require.NoError(t, recorded.SetFailureProbability(0.3))
+	require.NoError(t, recorded.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   100,
+		DelayProbability: 0.5,
+	}))
+	require.NoError(t, recorded.RecordDecisions(path))
+	failed := run(recorded)
+	require.NoError(t, recorded.StopRecording())
+
+	decisions, err := failuregen.ReadDecisions(path)
+	require.NoError(t, err)
+	require.Len(t, decisions, 100)
+	require.Equal(t, recorded.Seed(), decisions[0].Seed)
+	require.Equal(t, int64(99), decisions[99].Call)
+
+	// the replaying generator is configured differently, it still makes the
+	// recorded decisions
+	replayed := newGenerator()
+	replayed.ReplayDecisions(decisions)
+	require.Equal(t, failed, run(replayed))
+	require.Equal(t, recorded.Stats(), replayed.Stats())
+
+	// calls beyond the recording are not faulted
+	require.NoError(t, replayed.FailMaybe())
+	replayed.StopReplay()
+	require.NoError(t, replayed.SetFailureProbability(1))
+	require.Error(t, replayed.FailMaybe())
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"go.uber.org/atomic"
+)
+
+// maxAdjustmentFactor bounds how much a single adjustment can change the
+// failure probability, to avoid oscillations
+const maxAdjustmentFactor = 2.0
+
+// ErrorBudgetController adjusts the failure probability of generators so
+// that injected errors make up a target fraction of the operations of the
+// system under test (e.g. 0.5%). Static probabilities over-inject when few
+// operations consult the generators and under-inject at peak, the
+// controller compensates for that.
+type ErrorBudgetController struct {
+	target       float64
+	gens         []*FailureGeneratorImpl
+	opsCtr       atomic.Int64
+	mu           sync.Mutex
+	lastInjected int64
+	quit         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewErrorBudgetController creates a controller holding the injected error
+// rate of the given generators at target. The generators start with target
+// as their failure probability.
+func NewErrorBudgetController(
+	target float32,
+	gens ...*FailureGeneratorImpl,
+) (*ErrorBudgetController, error) {
+	c := &ErrorBudgetController{
+		target: float64(target),
+		gens:   gens,
+		quit:   make(chan struct{}),
+	}
+	for _, g := range gens {
+		if err := g.SetFailureProbability(target); err != nil {
+			return nil, errors.Wrapf(err, "Invalid target error rate")
+		}
+	}
+	c.lastInjected = c.injected()
+	return c, nil
+}
+
+// RecordOperation counts an operation of the system under test
+func (c *ErrorBudgetController) RecordOperation() {
+	c.opsCtr.Inc()
+}
+
+func (c *ErrorBudgetController) injected() int64 {
+	total := int64(0)
+	for _, g := range c.gens {
+		total += g.injectedCtr.Load()
+	}
+	return total
+}
+
+// Adjust compares the error rate observed since the previous adjustment with
+// the target and scales the failure probability of the generators
+// accordingly. It returns the observed rate, or -1 if no operations were
+// recorded.
+func (c *ErrorBudgetController) Adjust() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ops := c.opsCtr.Swap(0)
+	injected := c.injected()
+	newInjections := injected - c.lastInjected
+	c.lastInjected = injected
+	if ops == 0 {
+		return -1
+	}
+	observed := float64(newInjections) / float64(ops)
+
+	factor := maxAdjustmentFactor
+	if observed > 0 {
+		factor = c.target / observed
+	}
+	if factor > maxAdjustmentFactor {
+		factor = maxAdjustmentFactor
+	} else if factor < 1/maxAdjustmentFactor {
+		factor = 1 / maxAdjustmentFactor
+	}
+	for _, g := range c.gens {
+		p := float64(g.failurePpm.Load()) / float64(OneMillion) * factor
+		if p == 0 {
+			p = c.target
+		} else if p > 1 {
+			p = 1
+		}
+		g.failurePpm.Store(int32(p * float64(OneMillion)))
+	}
+	if log.V(3) {
+		log.Infof(
+			context.Background(),
+			"Observed error rate %f (target %f), scaled probability by %f",
+			observed,
+			c.target,
+			factor)
+	}
+	return observed
+}
+
+// Start adjusts the probabilities every interval until Stop is called
+func (c *ErrorBudgetController) Start(interval time.Duration) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.quit:
+				return
+			case <-ticker.C:
+				c.Adjust()
+			}
+		}
+	}()
+}
+
+// Stop stops periodic adjustments
+func (c *ErrorBudgetController) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
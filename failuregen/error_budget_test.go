@@ -0,0 +1,39 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestErrorBudgetControllerHoldsTargetRate(t *testing.T) {
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	c, err := failuregen.NewErrorBudgetController(0.05, g)
+	require.NoError(t, err)
+	require.Equal(t, float64(-1), c.Adjust())
+
+	// only every 4th operation consults the generator, so the observed rate
+	// is a quarter of the probability until the controller compensates
+	runOps := func() (failures int) {
+		for i := 0; i < 100000; i++ {
+			c.RecordOperation()
+			if i%4 == 0 && g.FailMaybe() != nil {
+				failures++
+			}
+		}
+		return failures
+	}
+
+	observed := float64(runOps()) / 100000
+	require.InDelta(t, 0.0125, observed, 0.003)
+	require.InDelta(t, observed, c.Adjust(), 1e-9)
+	for i := 0; i < 5; i++ {
+		runOps()
+		c.Adjust()
+	}
+	require.InDelta(t, 0.05, float64(runOps())/100000, 0.005)
+}
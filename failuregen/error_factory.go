@@ -0,0 +1,41 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+// ErrorFactory returns the domain-specific error to inject (e.g.
+// context.DeadlineExceeded, a net.Error timeout or a gRPC status error) for
+// an injection
+type ErrorFactory func(info InjectionInfo) error
+
+// SetErrorFactory makes the generator inject the errors returned by factory.
+// Injected errors match both the domain-specific error (with errors.Is /
+// errors.As) and ErrInjectedFailure. A nil factory, or a factory returning
+// nil, restores the default error.
+func (fg *FailureGeneratorImpl) SetErrorFactory(factory ErrorFactory) {
+	if factory == nil {
+		fg.errorFactory.Store(nil)
+		return
+	}
+	fg.errorFactory.Store(&factory)
+}
+
+// SetErrors makes the generator inject one of errs, picked uniformly at
+// random, as per SetErrorFactory. No errs restores the default error.
+func (fg *FailureGeneratorImpl) SetErrors(errs ...error) {
+	if len(errs) == 0 {
+		fg.SetErrorFactory(nil)
+		return
+	}
+	errs = append([]error(nil), errs...)
+	fg.SetErrorFactory(func(InjectionInfo) error {
+		return errs[fg.randGen.Intn(len(errs))]
+	})
+}
+
+// domainError returns the error the factory (if any) produces for info
+func (fg *FailureGeneratorImpl) domainError(info InjectionInfo) error {
+	if factory := fg.errorFactory.Load(); factory != nil {
+		return (*factory)(info)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestErrorFactory(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetFailureProbability(1))
+
+	var seqs []int64
+	fg.SetErrorFactory(func(info failuregen.InjectionInfo) error {
+		seqs = append(seqs, info.Sequence)
+		return context.DeadlineExceeded
+	})
+	err := fg.FailMaybe()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, failuregen.ErrInjectedFailure)
+	require.Equal(t, context.DeadlineExceeded.Error(), err.Error())
+	require.Equal(t, []int64{1}, seqs)
+
+	// the factory survives deep copies
+	err = fg.DeepCopy().FailMaybe()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	fg.SetErrors(timeoutErr{}, context.Canceled)
+	sawTimeout, sawCanceled := false, false
+	for i := 0; i < 100; i++ {
+		err := fg.FailMaybe()
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			require.True(t, netErr.Timeout())
+			sawTimeout = true
+		} else {
+			require.ErrorIs(t, err, context.Canceled)
+			sawCanceled = true
+		}
+		_, ok := failuregen.InfoFromError(err)
+		require.True(t, ok)
+	}
+	require.True(t, sawTimeout)
+	require.True(t, sawCanceled)
+
+	fg.SetErrors()
+	err = fg.FailMaybe()
+	require.ErrorIs(t, err, failuregen.ErrInjectedFailure)
+	require.NotErrorIs(t, err, context.Canceled)
+	require.Equal(t, failuregen.ErrInjectedFailure.Error(), err.Error())
+}
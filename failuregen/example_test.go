@@ -0,0 +1,82 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// An operation guarded by a FailureGenerator is retried until it succeeds.
+func ExampleFailureGenerator() {
+	g := failuregen.NewFailureGenerator()
+	if err := g.SetFailureProbability(1.0); err != nil {
+		panic(err)
+	}
+
+	upload := func() error {
+		if err := g.FailMaybe(); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := upload()
+		if err == nil {
+			fmt.Printf("attempt %d succeeded\n", attempt)
+			break
+		}
+		fmt.Printf(
+			"attempt %d failed, injected: %v\n",
+			attempt,
+			errors.Is(err, failuregen.ErrInjectedFailure))
+		if attempt == 2 {
+			// the fault goes away, e.g. a test ramps injection down
+			_ = g.SetFailureProbability(0.0)
+		}
+	}
+	// Output:
+	// attempt 1 failed, injected: true
+	// attempt 2 failed, injected: true
+	// attempt 3 succeeded
+}
+
+// A workflow step fails at the failure-points listed in the plan.
+func ExampleAssuredFailurePlan() {
+	dir, err := os.MkdirTemp("", "assured-failure-plan")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &failuregen.FilePlanStore{Path: filepath.Join(dir, "plan.json")}
+	err = store.Save([]failuregen.FailurePoint{
+		failuregen.BeforeMetadataMigration,
+	})
+	if err != nil {
+		panic(err)
+	}
+	afp := failuregen.NewAssuredFailurePlanWithStore(store)
+
+	for _, fp := range []failuregen.FailurePoint{
+		failuregen.BeforeAdditiveSchemaChange,
+		failuregen.BeforeMetadataMigration,
+		failuregen.AfterMetadataMigration,
+	} {
+		if err := afp.FailMaybe(fp); err != nil {
+			info, _ := failuregen.InfoFromError(err)
+			fmt.Printf("%s: injected failure #%d\n", fp, info.Sequence)
+			continue
+		}
+		fmt.Printf("%s: ok\n", fp)
+	}
+	// Output:
+	// BeforeAdditiveSchemaChange: ok
+	// BeforeMetadataMigration: injected failure #1
+	// AfterMetadataMigration: ok
+}
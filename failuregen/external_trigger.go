@@ -0,0 +1,122 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// BurstConfig is a pre-configured failure burst
+type BurstConfig struct {
+	// FailureProbability applied to the generators during the burst
+	FailureProbability float32
+	// Duration of the burst
+	Duration time.Duration
+	// BaselineProbability applied to the generators once the burst is over
+	BaselineProbability float32
+}
+
+// ExternalTrigger arms a failure burst on a set of generators when fired
+// from outside the process, by a signal (SIGUSR2) or by the appearance of a
+// trigger file. This lets operators running manual chaos experiments fire
+// faults on demand without an admin API.
+type ExternalTrigger struct {
+	gens []FailureGenerator
+	cfg  BurstConfig
+	quit chan struct{}
+	wg   sync.WaitGroup
+	// burstMu serializes bursts, a burst fired during another extends it
+	burstMu    sync.Mutex
+	burstTimer *time.Timer
+}
+
+// NewExternalTrigger creates a trigger for a burst on the given generators
+func NewExternalTrigger(
+	cfg BurstConfig,
+	gens ...FailureGenerator,
+) (*ExternalTrigger, error) {
+	if _, err := ppm(cfg.FailureProbability); err != nil {
+		return nil, errors.Wrapf(err, "Couldn't compute burst failure-ppm")
+	}
+	if _, err := ppm(cfg.BaselineProbability); err != nil {
+		return nil, errors.Wrapf(err, "Couldn't compute baseline failure-ppm")
+	}
+	return &ExternalTrigger{
+		gens: gens,
+		cfg:  cfg,
+		quit: make(chan struct{}),
+	}, nil
+}
+
+func (et *ExternalTrigger) setProbability(p float32) {
+	for _, g := range et.gens {
+		if err := g.SetFailureProbability(p); err != nil {
+			log.Errorf(
+				context.Background(),
+				"Couldn't set failure probability: %v",
+				err)
+		}
+	}
+}
+
+// Fire starts the burst immediately
+func (et *ExternalTrigger) Fire() {
+	et.burstMu.Lock()
+	defer et.burstMu.Unlock()
+	log.Warningf(
+		context.Background(),
+		"Firing failure burst (probability %f for %v)",
+		et.cfg.FailureProbability,
+		et.cfg.Duration)
+	et.setProbability(et.cfg.FailureProbability)
+	if et.burstTimer != nil {
+		et.burstTimer.Stop()
+	}
+	et.burstTimer = time.AfterFunc(et.cfg.Duration, func() {
+		et.burstMu.Lock()
+		defer et.burstMu.Unlock()
+		log.Infof(context.Background(), "Failure burst over")
+		et.setProbability(et.cfg.BaselineProbability)
+	})
+}
+
+// WatchFile fires the burst whenever a file appears at path, checking every
+// pollInterval. The file is removed once the burst is fired.
+func (et *ExternalTrigger) WatchFile(path string, pollInterval time.Duration) {
+	et.wg.Add(1)
+	go func() {
+		defer et.wg.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-et.quit:
+				return
+			case <-ticker.C:
+				if _, err := os.Stat(path); err != nil {
+					continue
+				}
+				if err := os.Remove(path); err != nil {
+					log.Errorf(
+						context.Background(),
+						"Couldn't remove trigger file %s: %v",
+						path,
+						err)
+				}
+				et.Fire()
+			}
+		}
+	}()
+}
+
+// Stop stops watching for triggers. A burst in progress runs to completion.
+func (et *ExternalTrigger) Stop() {
+	close(et.quit)
+	et.wg.Wait()
+}
@@ -0,0 +1,14 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build !unix
+
+package failuregen
+
+import (
+	"github.com/pkg/errors"
+)
+
+// WatchSignal is not supported on this platform, use WatchFile instead
+func (et *ExternalTrigger) WatchSignal() error {
+	return errors.New("SIGUSR2 triggers are not supported on this platform")
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func newBurstTrigger(
+	t *testing.T,
+	g failuregen.FailureGenerator,
+) *failuregen.ExternalTrigger {
+	trigger, err := failuregen.NewExternalTrigger(
+		failuregen.BurstConfig{
+			FailureProbability:  1.0,
+			Duration:            100 * time.Millisecond,
+			BaselineProbability: 0.0,
+		},
+		g)
+	require.NoError(t, err)
+	t.Cleanup(trigger.Stop)
+	return trigger
+}
+
+func TestExternalTriggerFiresBurst(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	trigger := newBurstTrigger(t, g)
+
+	require.NoError(t, g.FailMaybe())
+	trigger.Fire()
+	require.Error(t, g.FailMaybe())
+	require.Eventually(
+		t,
+		func() bool { return g.FailMaybe() == nil },
+		time.Second,
+		10*time.Millisecond)
+}
+
+func TestExternalTriggerWatchesFile(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	trigger := newBurstTrigger(t, g)
+	path := filepath.Join(t.TempDir(), "fire")
+	trigger.WatchFile(path, 5*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	require.Eventually(
+		t,
+		func() bool { return g.FailMaybe() != nil },
+		time.Second,
+		5*time.Millisecond)
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExternalTriggerRejectsInvalidConfig(t *testing.T) {
+	_, err := failuregen.NewExternalTrigger(
+		failuregen.BurstConfig{FailureProbability: 2})
+	require.ErrorIs(t, err, failuregen.ErrInvalidProbability)
+}
@@ -0,0 +1,31 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build unix
+
+package failuregen
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchSignal fires the burst whenever the process receives SIGUSR2
+func (et *ExternalTrigger) WatchSignal() error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR2)
+	et.wg.Add(1)
+	go func() {
+		defer et.wg.Done()
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-et.quit:
+				return
+			case <-sigCh:
+				et.Fire()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build unix
+
+package failuregen_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestExternalTriggerWatchesSignal(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	trigger := newBurstTrigger(t, g)
+	require.NoError(t, trigger.WatchSignal())
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR2))
+	require.Eventually(
+		t,
+		func() bool { return g.FailMaybe() != nil },
+		time.Second,
+		5*time.Millisecond)
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failtest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// Event is a named event recorded by an EventLog
+type Event struct {
+	Name string
+	Time time.Time
+}
+
+// InjectionSource is implemented by the generators and plans of failuregen,
+// whose injections can be recorded by an EventLog
+type InjectionSource interface {
+	OnInject(fn func(event failuregen.InjectionEvent))
+}
+
+// EventLog records the events of a scenario (e.g. "partition-start",
+// "client-retry", "partition-heal"), in the order in which they happened,
+// for tests to check causal sequences with ExpectOrder rather than counts.
+// Events are recorded by the test and the system under test with Record, or
+// from injections with Observe. It is safe for concurrent use.
+type EventLog struct {
+	mu     sync.Mutex
+	events []Event
+	// lastInjection is the time of the latest injection observed
+	lastInjection time.Time
+}
+
+// NewEventLog creates an empty event log
+func NewEventLog() *EventLog {
+	return &EventLog{}
+}
+
+// Record records the event name
+func (l *EventLog) Record(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, Event{Name: name, Time: time.Now()})
+}
+
+// Observe records the injections of src, named by name. Injections named ""
+// are not recorded. A nil name names failures by their failure-point (or
+// kind if not injected at a failure-point) and delays by their kind.
+func (l *EventLog) Observe(
+	src InjectionSource,
+	name func(event failuregen.InjectionEvent) string,
+) {
+	if name == nil {
+		name = injectionName
+	}
+	src.OnInject(func(event failuregen.InjectionEvent) {
+		l.mu.Lock()
+		l.lastInjection = time.Now()
+		l.mu.Unlock()
+		if n := name(event); n != "" {
+			l.Record(n)
+		}
+	})
+}
+
+// LastInjection returns the time of the latest injection of the observed
+// sources, named or not, zero if none was observed
+func (l *EventLog) LastInjection() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastInjection
+}
+
+// AwaitNoInjectionsForContext blocks until none of the observed sources
+// have injected for the given duration, or until ctx is done, in which case
+// it returns an error (see failuregen.AwaitNoInjections)
+func (l *EventLog) AwaitNoInjectionsForContext(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	return failuregen.AwaitNoInjections(ctx, d, l.LastInjection)
+}
+
+// injectionName is the default name of injections, see Observe
+func injectionName(event failuregen.InjectionEvent) string {
+	if event.Kind == failuregen.InjectionKindFailure &&
+		event.FailurePoint != "" {
+		return string(event.FailurePoint)
+	}
+	return string(event.Kind)
+}
+
+// Events returns the recorded events, in order
+func (l *EventLog) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Event(nil), l.events...)
+}
+
+// Names returns the names of the recorded events, in order
+func (l *EventLog) Names() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, len(l.events))
+	for i, event := range l.events {
+		names[i] = event.Name
+	}
+	return names
+}
+
+// InOrder tells if names were recorded in this order, other events may have
+// been recorded before, in between and after them
+func (l *EventLog) InOrder(names ...string) bool {
+	_, ok := l.matchOrder(names)
+	return ok
+}
+
+// matchOrder matches names in order against the recorded events, it returns
+// the number of names matched
+func (l *EventLog) matchOrder(names []string) (int, bool) {
+	matched := 0
+	for _, recorded := range l.Names() {
+		if matched == len(names) {
+			break
+		}
+		if recorded == names[matched] {
+			matched++
+		}
+	}
+	return matched, matched == len(names)
+}
+
+// ExpectOrder fails the test if names were not recorded by log in this order,
+// e.g. ExpectOrder(t, log, "partition-start", "client-retry",
+// "partition-heal") checks that the client retried during the partition.
+// Other events may have been recorded before, in between and after them.
+func ExpectOrder(t TestingT, log *EventLog, names ...string) bool {
+	t.Helper()
+	matched, ok := log.matchOrder(names)
+	if ok {
+		return true
+	}
+	t.Errorf(
+		"Events %s not recorded in order, %q missing after %s, recorded "+
+			"events are %s",
+		formatNames(names),
+		names[matched],
+		formatNames(names[:matched]),
+		formatNames(log.Names()))
+	t.FailNow()
+	return false
+}
+
+func formatNames(names []string) string {
+	return "[" + strings.Join(names, ", ") + "]"
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failtest_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/failuregen/failtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectOrder(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetCountSchedule(failuregen.CountSchedule{FirstN: 1}))
+
+	events := failtest.NewEventLog()
+	events.Observe(fg, nil)
+	events.Record("partition-start")
+	require.Error(t, fg.FailMaybe())
+	events.Record("client-retry")
+	require.NoError(t, fg.FailMaybe())
+	events.Record("partition-heal")
+	require.Equal(
+		t,
+		[]string{"partition-start", "failure", "client-retry", "partition-heal"},
+		events.Names())
+
+	require.True(t, failtest.ExpectOrder(
+		t,
+		events,
+		"partition-start",
+		"client-retry",
+		"partition-heal"))
+	require.True(t, events.InOrder("failure", "partition-heal"))
+	require.True(t, events.InOrder())
+
+	ft := &fakeT{}
+	require.False(t, failtest.ExpectOrder(
+		ft,
+		events,
+		"partition-start",
+		"partition-heal",
+		"client-retry"))
+	require.True(t, ft.failed)
+	require.Contains(t, ft.msg, `"client-retry" missing after `+
+		`[partition-start, partition-heal]`)
+}
+
+func TestEventLogObserveNames(t *testing.T) {
+	store := &failuregen.FilePlanStore{
+		Path: filepath.Join(t.TempDir(), "plan.json")}
+	require.NoError(t, store.Save([]failuregen.FailurePoint{"a", "b"}))
+	afp := failuregen.NewAssuredFailurePlanWithStore(
+		store).(*failuregen.AssuredFailurePlanImpl)
+
+	events := failtest.NewEventLog()
+	events.Observe(afp, nil)
+	events.Observe(afp, func(event failuregen.InjectionEvent) string {
+		if event.FailurePoint == "b" {
+			return "b-observed"
+		}
+		return ""
+	})
+	require.Error(t, afp.FailMaybe("b"))
+	require.Error(t, afp.FailMaybe("a"))
+	failtest.ExpectOrder(t, events, "b", "b-observed", "a")
+	require.Len(t, events.Events(), 3)
+}
+
+func TestEventLogAwaitNoInjections(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	events := failtest.NewEventLog()
+	events.Observe(fg, func(failuregen.InjectionEvent) string { return "" })
+	require.True(t, events.LastInjection().IsZero())
+
+	require.NoError(t, fg.SetFailureProbability(1))
+	require.Error(t, fg.FailMaybe())
+	require.Empty(t, events.Events())
+	require.WithinDuration(t, fg.LastInjection(), events.LastInjection(), time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, events.AwaitNoInjectionsForContext(
+		ctx,
+		50*time.Millisecond))
+	require.ErrorIs(t, events.AwaitNoInjectionsForContext(ctx, time.Hour),
+		context.DeadlineExceeded)
+}
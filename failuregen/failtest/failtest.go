@@ -0,0 +1,164 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package failtest provides assertions for resilience tests, which run an
+// operation while failures are injected and check that it copes with them.
+package failtest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// TestingT is the subset of testing.TB used by the assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+// Options bound the attempts of EventuallySucceedsUnderInjection, zero
+// values select defaults
+type Options struct {
+	// MaxAttempts is the maximum number of attempts, 10 by default
+	MaxAttempts int
+	// Timeout bounds the time taken by all attempts, 10s by default
+	Timeout time.Duration
+	// Backoff is the pause between attempts, 10ms by default
+	Backoff time.Duration
+	// MinInjected is the minimum number of failures the generator must have
+	// injected across the attempts, so that the test can't pass without
+	// exercising the failure handling of the operation
+	MinInjected int64
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 10 * time.Millisecond
+	}
+	return o
+}
+
+// Attempt describes an attempt of the operation
+type Attempt struct {
+	// N is the 1-based number of the attempt
+	N        int
+	Err      error
+	Duration time.Duration
+	// Stats are what the generator injected during the attempt, they are
+	// only available for generators keeping stats (see
+	// failuregen.FailureGeneratorImpl.Stats)
+	Stats failuregen.GeneratorStats
+	// Injection describes the injected failure Err is caused by, if any
+	Injection *failuregen.InjectionInfo
+}
+
+func (a Attempt) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "attempt %d (%v, injected %v): ", a.N, a.Duration, a.Stats)
+	if a.Err == nil {
+		b.WriteString("succeeded")
+	} else {
+		fmt.Fprintf(&b, "%v", a.Err)
+	}
+	if a.Injection != nil {
+		fmt.Fprintf(&b, " [injection %s]", a.Injection.InjectionID)
+	}
+	return b.String()
+}
+
+// statsOf returns the stats of fg, zero if it keeps none
+func statsOf(fg failuregen.FailureGenerator) failuregen.GeneratorStats {
+	if impl, ok := fg.(*failuregen.FailureGeneratorImpl); ok {
+		return impl.Stats()
+	}
+	return failuregen.GeneratorStats{}
+}
+
+// RunUnderInjection attempts op, which is subject to the failures injected
+// by fg, until it succeeds or the bounds of opts are reached. It returns the
+// attempts, and an error if op did not succeed within bounds or fg injected
+// less failures than required.
+func RunUnderInjection(
+	op func() error,
+	fg failuregen.FailureGenerator,
+	opts Options,
+) ([]Attempt, error) {
+	opts = opts.withDefaults()
+	deadline := time.Now().Add(opts.Timeout)
+	var attempts []Attempt
+	var injected int64
+	for n := 1; n <= opts.MaxAttempts; n++ {
+		before := statsOf(fg)
+		start := time.Now()
+		err := op()
+		after := statsOf(fg)
+		attempt := Attempt{
+			N:        n,
+			Err:      err,
+			Duration: time.Since(start),
+			Stats: failuregen.GeneratorStats{
+				Calls:      after.Calls - before.Calls,
+				Failures:   after.Failures - before.Failures,
+				Delays:     after.Delays - before.Delays,
+				TotalDelay: after.TotalDelay - before.TotalDelay,
+			},
+		}
+		if info, ok := failuregen.InfoFromError(err); ok {
+			attempt.Injection = &info
+		}
+		attempts = append(attempts, attempt)
+		injected += attempt.Stats.Failures
+		if err == nil {
+			if injected < opts.MinInjected {
+				return attempts, errors.Errorf(
+					"Succeeded with %d injected failures, expected %d or more",
+					injected,
+					opts.MinInjected)
+			}
+			return attempts, nil
+		}
+		if time.Now().Add(opts.Backoff).After(deadline) {
+			return attempts, errors.Errorf(
+				"Did not succeed within %v (%d attempts)",
+				opts.Timeout,
+				n)
+		}
+		time.Sleep(opts.Backoff)
+	}
+	return attempts, errors.Errorf(
+		"Did not succeed within %d attempts",
+		opts.MaxAttempts)
+}
+
+// EventuallySucceedsUnderInjection asserts that op, which is subject to the
+// failures injected by fg, succeeds within the bounds of opts. On failure
+// the test fails with the diagnostics of each attempt. The attempts are
+// returned for further assertions.
+func EventuallySucceedsUnderInjection(
+	t TestingT,
+	op func() error,
+	fg failuregen.FailureGenerator,
+	opts Options,
+) []Attempt {
+	t.Helper()
+	attempts, err := RunUnderInjection(op, fg, opts)
+	if err != nil {
+		lines := make([]string, len(attempts))
+		for i, a := range attempts {
+			lines[i] = "  " + a.String()
+		}
+		t.Errorf("%v:\n%s", err, strings.Join(lines, "\n"))
+		t.FailNow()
+	}
+	return attempts
+}
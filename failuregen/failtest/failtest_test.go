@@ -0,0 +1,64 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failtest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/failuregen/failtest"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeT struct {
+	failed bool
+	msg    string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.msg = fmt.Sprintf(format, args...)
+}
+
+func (f *fakeT) FailNow() {
+	f.failed = true
+}
+
+func TestEventuallySucceedsUnderInjection(t *testing.T) {
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.(*failuregen.FailureGeneratorImpl).SetCountSchedule(
+		failuregen.CountSchedule{FirstN: 2}))
+	attempts := failtest.EventuallySucceedsUnderInjection(
+		t,
+		fg.FailMaybe,
+		fg,
+		failtest.Options{MinInjected: 2})
+	require.Len(t, attempts, 3)
+	require.NotNil(t, attempts[0].Injection)
+	require.Equal(t, int64(1), attempts[1].Stats.Failures)
+	require.NoError(t, attempts[2].Err)
+
+	// never succeeds
+	always := failuregen.NewFailureGenerator()
+	require.NoError(t, always.SetFailureProbability(1))
+	ft := &fakeT{}
+	attempts = failtest.EventuallySucceedsUnderInjection(
+		ft,
+		always.FailMaybe,
+		always,
+		failtest.Options{MaxAttempts: 3})
+	require.True(t, ft.failed)
+	require.Len(t, attempts, 3)
+	require.Contains(t, ft.msg, "within 3 attempts")
+	require.Contains(t, ft.msg, "attempt 3")
+
+	// succeeds without exercising failures
+	never := failuregen.NewFailureGenerator()
+	_, err := failtest.RunUnderInjection(
+		never.FailMaybe,
+		never,
+		failtest.Options{MinInjected: 1})
+	require.Error(t, err)
+}
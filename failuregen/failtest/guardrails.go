@@ -0,0 +1,51 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failtest
+
+import (
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// CleanupT is the subset of testing.TB used by RequireCalled
+type CleanupT interface {
+	TestingT
+	Cleanup(func())
+}
+
+// armed tells if fg is configured to inject failures or delays
+func armed(fg *failuregen.FailureGeneratorImpl) bool {
+	cfg := fg.Config()
+	return cfg.FailureProbability > 0 || cfg.Delay.DelayProbability > 0
+}
+
+// RequireCalled fails the test, once it ends, if one of gens was configured
+// with a non-zero failure or delay probability (when RequireCalled is called
+// or when the test ends) but FailMaybe was never called on it in between.
+// This catches miswired tests, whose generators are not plugged into the
+// system under test and which thus silently test nothing.
+func RequireCalled(t CleanupT, gens ...*failuregen.FailureGeneratorImpl) {
+	t.Helper()
+	type baseline struct {
+		calls int64
+		armed bool
+	}
+	baselines := make([]baseline, len(gens))
+	for i, fg := range gens {
+		baselines[i] = baseline{calls: fg.State().Calls, armed: armed(fg)}
+	}
+	t.Cleanup(func() {
+		t.Helper()
+		for i, fg := range gens {
+			if !baselines[i].armed && !armed(fg) {
+				continue
+			}
+			if fg.State().Calls == baselines[i].calls {
+				t.Errorf(
+					"Generator %s is configured to inject faults (%+v) but "+
+						"was never called, is it wired to the system under test?",
+					fg.ID(),
+					fg.Config())
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failtest_test
+
+import (
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/failuregen/failtest"
+	"github.com/stretchr/testify/require"
+)
+
+type cleanupT struct {
+	fakeT
+	cleanups []func()
+}
+
+func (c *cleanupT) Cleanup(fn func()) {
+	c.cleanups = append(c.cleanups, fn)
+}
+
+func (c *cleanupT) end() {
+	for i := len(c.cleanups) - 1; i >= 0; i-- {
+		c.cleanups[i]()
+	}
+}
+
+func TestRequireCalled(t *testing.T) {
+	called := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, called.SetFailureProbability(0.5))
+	idle := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+
+	ct := &cleanupT{}
+	failtest.RequireCalled(ct, called, idle)
+	_ = called.FailMaybe()
+	ct.end()
+	require.Empty(t, ct.msg)
+
+	miswired := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, miswired.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   10,
+		DelayProbability: 0.1,
+	}))
+	ct = &cleanupT{}
+	failtest.RequireCalled(ct, miswired)
+	ct.end()
+	require.Contains(t, ct.msg, miswired.ID())
+}
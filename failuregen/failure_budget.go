@@ -0,0 +1,48 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"go.uber.org/atomic"
+)
+
+// failureBudget bounds the number of failures a generator injects
+type failureBudget struct {
+	max  int64
+	used atomic.Int64
+}
+
+// SetMaxFailures makes the generator stop injecting failures once it has
+// injected n of them (counted from this call), whatever the call sites, so
+// that the chaos is bounded and the workload eventually makes progress.
+// Delays are not affected. A negative n removes the cap.
+func (fg *FailureGeneratorImpl) SetMaxFailures(n int64) {
+	if n < 0 {
+		fg.failureBudget.Store(nil)
+		return
+	}
+	fg.failureBudget.Store(&failureBudget{max: n})
+}
+
+// RemainingFailures returns the number of failures the generator may still
+// inject as per SetMaxFailures, ok is false if failures are not capped
+func (fg *FailureGeneratorImpl) RemainingFailures() (
+	remaining int64,
+	ok bool,
+) {
+	b := fg.failureBudget.Load()
+	if b == nil {
+		return 0, false
+	}
+	if used := b.used.Load(); used < b.max {
+		return b.max - used, true
+	}
+	return 0, true
+}
+
+// takeFailureBudget consumes a failure of the budget, it returns false if
+// the budget is exhausted
+func (fg *FailureGeneratorImpl) takeFailureBudget() bool {
+	b := fg.failureBudget.Load()
+	return b == nil || b.used.Inc() <= b.max
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMaxFailures(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetFailureProbability(1))
+	_, capped := fg.RemainingFailures()
+	require.False(t, capped)
+
+	fg.SetMaxFailures(10)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if fg.FailMaybe() != nil {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 10, failures)
+	remaining, capped := fg.RemainingFailures()
+	require.True(t, capped)
+	require.Zero(t, remaining)
+
+	// copies get a fresh budget
+	copied := fg.DeepCopy()
+	require.Error(t, copied.FailMaybe())
+
+	fg.SetMaxFailures(1)
+	require.Error(t, fg.FailMaybe())
+	require.NoError(t, fg.FailMaybe())
+	fg.SetMaxFailures(-1)
+	require.Error(t, fg.FailMaybe())
+}
@@ -3,12 +3,15 @@
 package failuregen
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
+	"runtime/pprof"
 	"time"
 
+	"github.com/rubrikinc/failure-test-utils/log"
 	"github.com/rubrikinc/failure-test-utils/randutil"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 )
@@ -38,46 +41,172 @@ type FailureGenerator interface {
 
 type delayFn func(time.Duration)
 
+// ProbabilityFunc computes the failure probability of a FailMaybe call from
+// the number of calls that preceded it and the current time. Values outside
+// [0.0, 1.0] are clamped.
+type ProbabilityFunc func(callCount int64, now time.Time) float32
+
 type FailureGeneratorImpl struct {
+	injectionTracker
 	failurePpm     atomic.Int32
 	delayPpm       atomic.Int32
 	maxDelayMicros atomic.Int32
-	DelayFn        delayFn
-	randGen        *randutil.LockedRandGen
+	// DelayFn, when set, sleeps through injected delays in place of a timer
+	// (e.g. to fake time in tests). It can't be cut short by the context of
+	// FailMaybeContext.
+	DelayFn       delayFn
+	randGen       *randutil.LockedRandGen
+	seed          atomic.Int64
+	copyCtr       atomic.Int64
+	id            string
+	injectedCtr   atomic.Int64
+	callCtr       atomic.Int64
+	delayCtr      atomic.Int64
+	delayTotal    atomic.Duration
+	statsBaseline atomic.Pointer[GeneratorStats]
+	probabilityFn atomic.Pointer[ProbabilityFunc]
+	logInjections atomic.Bool
+	// latencyMultiplier and observedLatency drive latency-relative delays
+	latencyMultiplier atomic.Float64
+	observedLatency   atomic.Duration
+	goroutineJitter   atomic.Pointer[GoroutineJitter]
+	errorFactory      atomic.Pointer[ErrorFactory]
+	countSchedule     atomic.Pointer[CountSchedule]
+	failureBudget     atomic.Pointer[failureBudget]
+	burst             atomic.Pointer[burst]
+	sharedTrigger     atomic.Pointer[SharedTrigger]
+	recorder          atomic.Pointer[decisionRecorder]
+	replay            atomic.Pointer[decisionReplay]
 }
 
 // NewFailureGenerator creates a new failure-generator
 func NewFailureGenerator() FailureGenerator {
-	return &FailureGeneratorImpl{
-		DelayFn: time.Sleep,
-		randGen: randutil.NewLockedRandGen(time.Now().Unix()),
+	return NewFailureGeneratorWithSeed(time.Now().UnixNano())
+}
+
+// NewFailureGeneratorWithSeed creates a new failure-generator whose
+// decisions are determined by seed, so that a run can be reproduced exactly
+// (given the same sequence of calls)
+func NewFailureGeneratorWithSeed(seed int64) FailureGenerator {
+	fg := &FailureGeneratorImpl{
+		randGen: randutil.NewLockedRandGen(seed),
+		id:      uuid.New().String(),
+	}
+	fg.seed.Store(seed)
+	return fg
+}
+
+// SetSeed resets the random source of the generator to seed, the decisions
+// that follow are reproducible
+func (fg *FailureGeneratorImpl) SetSeed(seed int64) {
+	fg.seed.Store(seed)
+	fg.randGen.Seed(seed)
+}
+
+// Seed returns the seed of the generator, log it to reproduce a failing run
+// with NewFailureGeneratorWithSeed or SetSeed
+func (fg *FailureGeneratorImpl) Seed() int64 {
+	return fg.seed.Load()
+}
+
+// ID returns the unique identifier of the generator, which is reported in
+// the InjectionInfo of the failures it injects
+func (fg *FailureGeneratorImpl) ID() string {
+	return fg.id
+}
+
+// Config returns the current failure probability and delay configuration of
+// the generator
+func (fg *FailureGeneratorImpl) Config() GeneratorConfig {
+	return fg.config()
+}
+
+func (fg *FailureGeneratorImpl) config() GeneratorConfig {
+	return GeneratorConfig{
+		FailureProbability: float32(fg.failurePpm.Load()) / float32(OneMillion),
+		Delay: DelayConfig{
+			MaxDelayMicros:   fg.maxDelayMicros.Load(),
+			DelayProbability: float32(fg.delayPpm.Load()) / float32(OneMillion),
+		},
 	}
 }
 
+// SetLogInjections enables logging a line, carrying the injection ID, for
+// every injected failure
+func (fg *FailureGeneratorImpl) SetLogInjections(enabled bool) {
+	fg.logInjections.Store(enabled)
+}
+
+func (fg *FailureGeneratorImpl) injectedFailure(
+	ctx context.Context,
+) *InjectedFailureError {
+	err := &InjectedFailureError{
+		msg: ErrInjectedFailure.Error(),
+		InjectionInfo: InjectionInfo{
+			InjectionID: newInjectionID(),
+			Time:        time.Now(),
+			GeneratorID: fg.id,
+			Sequence:    fg.injectedCtr.Inc(),
+			Config:      fg.config(),
+		},
+	}
+	if cause := fg.domainError(err.InjectionInfo); cause != nil {
+		err.msg = cause.Error()
+		err.cause = cause
+	}
+	if fg.logInjections.Load() {
+		logInjection(ctx, err.InjectionInfo, err.msg)
+	}
+	return err
+}
+
 // ppm => parts per million
 // ppm:10^6 :: percent:100 :: probability:1
 func ppm(p float32) (int32, error) {
 	if p < 0 || p > 1.0 {
-		return 0, errors.Errorf("Invalid probability %f not in [0.0, 1.0]", p)
+		return 0, errors.Wrapf(
+			ErrInvalidProbability,
+			"%f not in [0.0, 1.0]",
+			p)
 	}
 	return int32(p * float32(OneMillion)), nil
 }
 
-// SetDelayConfig sets configuration for injecting artificial delay
+// SetDelayConfig sets configuration for injecting artificial delay, prefer
+// SetDelayConfigContext. Once the host is calibrated (see Calibrate), it
+// warns of delays shorter than the host can deliver.
 func (fg *FailureGeneratorImpl) SetDelayConfig(c DelayConfig) error {
 	delayPpm, err := ppm(c.DelayProbability)
 	if err != nil {
 		return errors.Wrapf(err, "Couldn't compute delay-ppm")
 	}
 	if c.MaxDelayMicros < 0 {
-		return errors.Errorf("Invalid delay of %d microseconds", c.MaxDelayMicros)
+		return errors.Wrapf(
+			ErrInvalidDelay,
+			"%d microseconds",
+			c.MaxDelayMicros)
+	}
+	if delayPpm > 0 {
+		// mean of the uniformly distributed delay
+		meanDelay := time.Duration(c.MaxDelayMicros) * time.Microsecond / 2
+		if cal, ok := Calibration(); ok && !cal.CanDeliver(meanDelay) {
+			log.Warningf(
+				context.Background(),
+				"Mean injected delay of %v is below what this host can "+
+					"deliver (timer resolution %v, sleep overhead %v), "+
+					"observed delays will be longer than configured",
+				meanDelay,
+				cal.Resolution,
+				cal.SleepOverhead)
+		}
 	}
 	fg.delayPpm.Store(delayPpm)
 	fg.maxDelayMicros.Store(c.MaxDelayMicros)
 	return nil
 }
 
-// SetFailureProbability sets the desired artificial failure probability
+// SetFailureProbability sets the desired artificial failure probability,
+// prefer SetFailureProbabilityContext
 func (fg *FailureGeneratorImpl) SetFailureProbability(p float32) error {
 	failurePpm, err := ppm(p)
 	if err != nil {
@@ -87,30 +216,185 @@ func (fg *FailureGeneratorImpl) SetFailureProbability(p float32) error {
 	return nil
 }
 
-// FailMaybe returns an artificial error with configured probability
+// SetProbabilityFunc makes the generator compute the failure probability of
+// every call with fn (e.g. for sinusoidal or workload-synchronized failure
+// patterns), overriding the probability set by SetFailureProbability. A nil
+// fn restores the fixed probability.
+func (fg *FailureGeneratorImpl) SetProbabilityFunc(fn ProbabilityFunc) {
+	if fn == nil {
+		fg.probabilityFn.Store(nil)
+		return
+	}
+	fg.probabilityFn.Store(&fn)
+}
+
+// currentFailurePpm returns the failure-ppm applicable to the given call
+func (fg *FailureGeneratorImpl) currentFailurePpm(callCount int64) int32 {
+	fn := fg.probabilityFn.Load()
+	if fn == nil {
+		return fg.failurePpm.Load()
+	}
+	p := (*fn)(callCount, time.Now())
+	if p < 0 {
+		p = 0
+	} else if p > 1 {
+		p = 1
+	}
+	return int32(p * float32(OneMillion))
+}
+
+// FailMaybe returns an artificial error with configured probability, prefer
+// FailMaybeContext
 func (fg *FailureGeneratorImpl) FailMaybe() error {
-	if fg.randGen.Int31n(OneMillion) < fg.delayPpm.Load() {
-		fg.DelayFn(
-			time.Duration(rand.Int31n(fg.maxDelayMicros.Load())) * time.Microsecond)
+	return fg.failMaybe(context.Background(), false)
+}
+
+// FailMaybeContext is FailMaybe for an operation running in ctx. An injected
+// delay is cut short when ctx is done (e.g. at its deadline), in which case
+// the error of ctx is returned, as it is if ctx is done already. Nothing is
+// injected within a NoInject context. Injections
+// are logged with the tags of ctx, and injected delays carry the profiler
+// labels of ctx along with those of the generator (see LabelGenerator).
+func (fg *FailureGeneratorImpl) FailMaybeContext(ctx context.Context) error {
+	return fg.failMaybe(ctx, true)
+}
+
+// failMaybe implements FailMaybe and FailMaybeContext, labeled tells if ctx
+// holds the profiler labels of the calling goroutine
+func (fg *FailureGeneratorImpl) failMaybe(
+	ctx context.Context,
+	labeled bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	callCount := fg.callCtr.Inc() - 1
+	if replay := fg.replay.Load(); replay != nil {
+		d := replay.decisions[callCount]
+		if d.Delayed {
+			if err := fg.injectDelay(ctx, labeled, d.Delay); err != nil {
+				return err
+			}
+		}
+		if !d.Failed {
+			return nil
+		}
+		return errors.WithStack(fg.injectFailure(ctx))
+	}
+	delayed := fg.randGen.Int31n(OneMillion) < fg.delayPpm.Load()
+	var delay time.Duration
+	if delayed {
+		delay = fg.injectedDelay()
+		if err := fg.injectDelay(ctx, labeled, delay); err != nil {
+			fg.recordDecision(callCount, delayed, delay, false)
+			return err
+		}
 	}
 	n := fg.randGen.Int31n(OneMillion)
-	if n < fg.failurePpm.Load() {
-		return errors.WithStack(ErrInjectedFailure)
+	bursting := fg.inBurst()
+	triggered := fg.triggered()
+	failed := (bursting ||
+		triggered ||
+		fg.scheduledFailure(callCount) ||
+		n < fg.currentFailurePpm(callCount)) &&
+		fg.takeFailureBudget()
+	fg.recordDecision(callCount, delayed, delay, failed)
+	if failed {
+		if !bursting && !triggered {
+			fg.startBurst()
+			fg.fireTrigger()
+		}
+		return errors.WithStack(fg.injectFailure(ctx))
 	}
 	return nil
 }
 
+// injectDelay injects delay, it returns the error of ctx if ctx is done
+// before the delay elapses
+func (fg *FailureGeneratorImpl) injectDelay(
+	ctx context.Context,
+	labeled bool,
+	delay time.Duration,
+) error {
+	fg.noteDelay(delay)
+	if !labeled {
+		if fg.DelayFn == nil {
+			time.Sleep(delay)
+		} else {
+			fg.DelayFn(delay)
+		}
+		return nil
+	}
+	var err error
+	pprof.Do(ctx, fg.profileLabels(), func(ctx context.Context) {
+		err = sleepContext(ctx, fg.DelayFn, delay)
+	})
+	return err
+}
+
+// noteDelay accounts for an injected delay in the stats and injection events
+// of the generator
+func (fg *FailureGeneratorImpl) noteDelay(delay time.Duration) {
+	fg.recordInjection()
+	fg.delayCtr.Inc()
+	fg.delayTotal.Add(delay)
+	fg.emitInjection(InjectionEvent{
+		Kind:        InjectionKindDelay,
+		GeneratorID: fg.id,
+		Delay:       delay,
+	})
+}
+
+// injectFailure returns an injected failure
+func (fg *FailureGeneratorImpl) injectFailure(
+	ctx context.Context,
+) *InjectedFailureError {
+	fg.recordInjection()
+	err := fg.injectedFailure(ctx)
+	fg.emitInjection(failureEvent(err.InjectionInfo))
+	return err
+}
+
 // DeepCopy returns a deep copy of the original object
 func (fg *FailureGeneratorImpl) DeepCopy() FailureGenerator {
 	newFg := &FailureGeneratorImpl{}
 	newFg.failurePpm.Store(fg.failurePpm.Load())
 	newFg.delayPpm.Store(fg.delayPpm.Load())
 	newFg.maxDelayMicros.Store(fg.maxDelayMicros.Load())
+	newFg.latencyMultiplier.Store(fg.latencyMultiplier.Load())
+	newFg.goroutineJitter.Store(fg.goroutineJitter.Load())
 	newFg.DelayFn = fg.DelayFn
-	newFg.randGen = randutil.NewLockedRandGen(time.Now().Unix())
+	newFg.probabilityFn.Store(fg.probabilityFn.Load())
+	newFg.logInjections.Store(fg.logInjections.Load())
+	newFg.errorFactory.Store(fg.errorFactory.Load())
+	newFg.countSchedule.Store(fg.countSchedule.Load())
+	if b := fg.failureBudget.Load(); b != nil {
+		newFg.failureBudget.Store(&failureBudget{max: b.max})
+	}
+	if b := fg.burst.Load(); b != nil {
+		newFg.burst.Store(&burst{cfg: b.cfg})
+	}
+	// copies draw decisions independent of the original and of each other,
+	// yet reproducible from the seed of the original
+	seed := copySeed(fg.seed.Load(), fg.copyCtr.Inc())
+	newFg.randGen = randutil.NewLockedRandGen(seed)
+	newFg.seed.Store(seed)
+	newFg.id = uuid.New().String()
 	return newFg
 }
 
+// copySeed derives the seed of the n-th copy of a generator seeded with seed,
+// mixing both (as per SplitMix64) so that copies of copies don't collide
+func copySeed(seed int64, n int64) int64 {
+	z := uint64(seed) + uint64(n)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
 // ConditionalFailureGenerator generates artificial failures
 // TODO(CDM-362117)(Ambar) Move to tcp-proxy code
 type ConditionalFailureGenerator interface {
@@ -149,7 +433,11 @@ func (cfg *ConditionalFailureGeneratorImpl) FailMaybe() error {
 	return cfg.Fg.FailMaybe()
 }
 
-// DeepCopy is not implemented
+// DeepCopy returns a deep copy of the original object, the condition is
+// shared with the copy
 func (cfg *ConditionalFailureGeneratorImpl) DeepCopy() FailureGenerator {
-	panic("implement me")
+	return &ConditionalFailureGeneratorImpl{
+		Fg:        cfg.Fg.DeepCopy(),
+		Condition: cfg.Condition,
+	}
 }
@@ -7,7 +7,6 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
-	"syscall"
 	"testing"
 	"time"
 
@@ -31,12 +30,6 @@ func TestFailureGeneratorFailsRandomly(t *testing.T) {
 	assert.InDelta(t, failuregen.OneMillion/5, failCount, 5000)
 }
 
-func cpuTimeNs() int64 {
-	usage := new(syscall.Rusage)
-	syscall.Getrusage(syscall.RUSAGE_SELF, usage)
-	return usage.Utime.Nano() + usage.Stime.Nano()
-}
-
 func wallAndCPUTime(
 	t *testing.T,
 	proc func(int32),
@@ -155,3 +148,53 @@ func TestInjectedFailureErrStackTraceShowsOnlyRelevantStack(t *testing.T) {
 	), "Stack trace:\n\n%s\n\n"+
 		"should contain: %s", stackTrace, methodName)
 }
+
+func TestFailureGeneratorSeed(t *testing.T) {
+	decisions := func(fg failuregen.FailureGenerator) []bool {
+		require.NoError(t, fg.SetFailureProbability(0.5))
+		var d []bool
+		for i := 0; i < 100; i++ {
+			d = append(d, fg.FailMaybe() != nil)
+		}
+		return d
+	}
+	fg := failuregen.NewFailureGeneratorWithSeed(42)
+	first := decisions(fg)
+	require.Equal(t, first, decisions(failuregen.NewFailureGeneratorWithSeed(42)))
+	require.NotEqual(t, first, decisions(failuregen.NewFailureGeneratorWithSeed(43)))
+	// copies are independent of the original and of each other, but
+	// reproducible from its seed
+	copied := fg.DeepCopy()
+	sibling := fg.DeepCopy()
+	require.NotEqual(t, first, decisions(copied))
+	require.NotEqual(t, decisions(copied), decisions(sibling))
+	require.NotEqual(t, decisions(copied), decisions(copied.DeepCopy()))
+	copySeed := copied.(*failuregen.FailureGeneratorImpl).Seed()
+	require.Equal(
+		t,
+		decisions(failuregen.NewFailureGeneratorWithSeed(copySeed)),
+		decisions(failuregen.NewFailureGeneratorWithSeed(42).DeepCopy()))
+
+	impl := fg.(*failuregen.FailureGeneratorImpl)
+	impl.SetSeed(42)
+	require.Equal(t, int64(42), impl.Seed())
+	require.Equal(t, first, decisions(fg))
+
+	// delays are drawn from the seeded source too
+	delays := func(seed int64) []time.Duration {
+		fg := failuregen.NewFailureGeneratorWithSeed(seed)
+		var d []time.Duration
+		fg.(*failuregen.FailureGeneratorImpl).DelayFn = func(delay time.Duration) {
+			d = append(d, delay)
+		}
+		require.NoError(t, fg.SetDelayConfig(failuregen.DelayConfig{
+			MaxDelayMicros:   1000,
+			DelayProbability: 1,
+		}))
+		for i := 0; i < 10; i++ {
+			fg.FailMaybe()
+		}
+		return d
+	}
+	require.Equal(t, delays(7), delays(7))
+}
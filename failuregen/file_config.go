@@ -0,0 +1,188 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratorFileConfig is the configuration of a FileConfiguredGenerator, as
+// JSON, or as YAML for files with a .yaml or .yml extension
+type GeneratorFileConfig struct {
+	FailureProbability float32 `json:"failureProbability" yaml:"failureProbability"`
+	MaxDelayMicros     int32   `json:"maxDelayMicros" yaml:"maxDelayMicros"`
+	DelayProbability   float32 `json:"delayProbability" yaml:"delayProbability"`
+	// Error is the error to inject: one of deadline-exceeded, canceled,
+	// timeout, conn-reset and unexpected-eof, or any other message. Empty
+	// injects ErrInjectedFailure.
+	Error string `json:"error" yaml:"error"`
+}
+
+// timeoutError is a net.Error timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// namedErrors are the errors GeneratorFileConfig.Error can name
+var namedErrors = map[string]error{
+	"deadline-exceeded": context.DeadlineExceeded,
+	"canceled":          context.Canceled,
+	"timeout":           timeoutError{},
+	"conn-reset":        syscall.ECONNRESET,
+	"unexpected-eof":    io.ErrUnexpectedEOF,
+}
+
+// readGeneratorFileConfig reads the config at path, ok is false if there is
+// no config file
+func readGeneratorFileConfig(path string) (GeneratorFileConfig, bool, error) {
+	var cfg GeneratorFileConfig
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, false, nil
+	} else if err != nil {
+		return cfg, false, errors.Wrapf(err, "Failed to read %s", path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bytes, &cfg)
+	default:
+		err = json.Unmarshal(bytes, &cfg)
+	}
+	return cfg, true, errors.Wrapf(err, "Malformed generator config %s", path)
+}
+
+// FileConfiguredGenerator is a FailureGenerator configured by a file, which
+// is watched so that failures can be ramped up or down while the process
+// under test runs
+type FileConfiguredGenerator struct {
+	*FailureGeneratorImpl
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewFileConfiguredGenerator creates a generator configured by the file at
+// path, checking it for changes every pollInterval. A missing file leaves
+// the generator disabled until the file appears, a malformed one is an
+// error (later, malformed changes are logged and ignored).
+func NewFileConfiguredGenerator(
+	path string,
+	pollInterval time.Duration,
+) (*FileConfiguredGenerator, error) {
+	g := &FileConfiguredGenerator{
+		FailureGeneratorImpl: NewFailureGenerator().(*FailureGeneratorImpl),
+		path:                 path,
+		quit:                 make(chan struct{}),
+	}
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+	g.wg.Add(1)
+	go g.watch(pollInterval)
+	return g, nil
+}
+
+// apply configures the generator as per cfg, it is validated as a whole
+// first
+func (g *FileConfiguredGenerator) apply(cfg GeneratorFileConfig) error {
+	if _, err := ppm(cfg.FailureProbability); err != nil {
+		return err
+	}
+	delay := DelayConfig{
+		MaxDelayMicros:   cfg.MaxDelayMicros,
+		DelayProbability: cfg.DelayProbability,
+	}
+	if err := g.SetDelayConfig(delay); err != nil {
+		return err
+	}
+	if err := g.SetFailureProbability(cfg.FailureProbability); err != nil {
+		return err
+	}
+	switch {
+	case cfg.Error == "":
+		g.SetErrors()
+	case namedErrors[cfg.Error] != nil:
+		g.SetErrors(namedErrors[cfg.Error])
+	default:
+		g.SetErrors(errors.New(cfg.Error))
+	}
+	return nil
+}
+
+// Reload applies the config file
+func (g *FileConfiguredGenerator) Reload() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if info, err := os.Stat(g.path); err == nil {
+		g.modTime, g.size = info.ModTime(), info.Size()
+	}
+	cfg, ok, err := readGeneratorFileConfig(g.path)
+	if err != nil || !ok {
+		return err
+	}
+	if err := g.apply(cfg); err != nil {
+		return errors.Wrapf(err, "Invalid generator config %s", g.path)
+	}
+	log.Infof(
+		context.Background(),
+		"Applied generator config %s: %+v",
+		g.path,
+		cfg)
+	return nil
+}
+
+// changed tells if the config file changed since it was last loaded
+func (g *FileConfiguredGenerator) changed() bool {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !info.ModTime().Equal(g.modTime) || info.Size() != g.size
+}
+
+func (g *FileConfiguredGenerator) watch(pollInterval time.Duration) {
+	defer g.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.quit:
+			return
+		case <-ticker.C:
+			if !g.changed() {
+				continue
+			}
+			if err := g.Reload(); err != nil {
+				log.Errorf(
+					context.Background(),
+					"Ignoring generator config change: %v",
+					err)
+			}
+		}
+	}
+}
+
+// Stop stops watching the config file, the generator keeps its config
+func (g *FileConfiguredGenerator) Stop() {
+	close(g.quit)
+	g.wg.Wait()
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileConfiguredGenerator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generator.yaml")
+	g, err := failuregen.NewFileConfiguredGenerator(path, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer g.Stop()
+	require.NoError(t, g.FailMaybe())
+
+	require.NoError(t, os.WriteFile(
+		path,
+		[]byte("failureProbability: 1\nerror: deadline-exceeded\n"),
+		0644))
+	require.Eventually(t, func() bool {
+		return g.FailMaybe() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	err = g.FailMaybe()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, failuregen.ErrInjectedFailure)
+
+	// invalid changes keep the last good config
+	require.NoError(t, os.WriteFile(path, []byte("failureProbability: 2\n"), 0644))
+	require.Error(t, g.Reload())
+	require.Error(t, g.FailMaybe())
+
+	require.NoError(t, os.WriteFile(path, []byte("failureProbability: 0\n"), 0644))
+	require.NoError(t, g.Reload())
+	require.NoError(t, g.FailMaybe())
+
+	jsonPath := filepath.Join(t.TempDir(), "generator.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte("{malformed"), 0644))
+	_, err = failuregen.NewFileConfiguredGenerator(jsonPath, time.Second)
+	require.Error(t, err)
+}
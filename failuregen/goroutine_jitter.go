@@ -0,0 +1,91 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GoroutineJitter assigns each goroutine a stable pseudo-random phase
+// offset, derived from the run seed and the site that created the
+// goroutine. Added to injected delays, it makes interleavings more diverse
+// across goroutines while keeping them reproducible across runs using the
+// same seed. Goroutines created at the same site share their phase.
+type GoroutineJitter struct {
+	seed     int64
+	maxPhase time.Duration
+}
+
+// NewGoroutineJitter creates a jitter with phases in [0, maxPhase)
+func NewGoroutineJitter(
+	seed int64,
+	maxPhase time.Duration,
+) (*GoroutineJitter, error) {
+	if maxPhase <= 0 {
+		return nil, errors.Wrapf(ErrInvalidDelay, "max phase %v", maxPhase)
+	}
+	return &GoroutineJitter{seed: seed, maxPhase: maxPhase}, nil
+}
+
+// Phase returns the phase offset of the calling goroutine
+func (j *GoroutineJitter) Phase() time.Duration {
+	return j.PhaseOf(creationSite())
+}
+
+// PhaseOf returns the phase offset of goroutines created at site
+func (j *GoroutineJitter) PhaseOf(site string) time.Duration {
+	h := fnv.New64a()
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(j.seed))
+	_, _ = h.Write(seed[:])
+	_, _ = h.Write([]byte(site))
+	return time.Duration(h.Sum64() % uint64(j.maxPhase))
+}
+
+// creationSite returns the function and location that created the calling
+// goroutine, e.g. "pkg.(*T).start /src/pkg/t.go:42", or "main" for the main
+// goroutine. Goroutine identity is not exposed by the runtime, the stack
+// trace is the only stable handle on it.
+func creationSite() string {
+	buf := make([]byte, 4096)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	idx := bytes.LastIndex(buf, []byte("\ncreated by "))
+	if idx < 0 {
+		return "main"
+	}
+	lines := bytes.SplitN(buf[idx+len("\ncreated by "):], []byte("\n"), 3)
+	fn := lines[0]
+	// strip the creating goroutine, it differs from run to run
+	if i := bytes.Index(fn, []byte(" in goroutine ")); i >= 0 {
+		fn = fn[:i]
+	}
+	site := string(fn)
+	if len(lines) > 1 {
+		loc := bytes.TrimSpace(lines[1])
+		// strip the pc offset
+		if i := bytes.LastIndex(loc, []byte(" +0x")); i >= 0 {
+			loc = loc[:i]
+		}
+		site += " " + string(loc)
+	}
+	return site
+}
+
+// SetGoroutineJitter makes the generator add the phase of the calling
+// goroutine to the delays it injects, a nil jitter disables phases
+func (fg *FailureGeneratorImpl) SetGoroutineJitter(j *GoroutineJitter) {
+	fg.goroutineJitter.Store(j)
+}
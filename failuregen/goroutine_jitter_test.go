@@ -0,0 +1,72 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// phasesBySite returns the phases of goroutines started at two sites
+func phasesBySite(
+	j *failuregen.GoroutineJitter,
+) (time.Duration, time.Duration) {
+	var a, b time.Duration
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		a = j.Phase()
+	}()
+	go func() {
+		defer wg.Done()
+		b = j.Phase()
+	}()
+	wg.Wait()
+	return a, b
+}
+
+func TestGoroutineJitterIsStablePerSite(t *testing.T) {
+	_, err := failuregen.NewGoroutineJitter(1, 0)
+	require.Error(t, err)
+
+	j, err := failuregen.NewGoroutineJitter(1, time.Hour)
+	require.NoError(t, err)
+	a, b := phasesBySite(j)
+	require.NotEqual(t, a, b)
+	require.Less(t, a, time.Hour)
+
+	// same seed, same phases
+	again, err := failuregen.NewGoroutineJitter(1, time.Hour)
+	require.NoError(t, err)
+	a2, b2 := phasesBySite(again)
+	require.Equal(t, a, a2)
+	require.Equal(t, b, b2)
+
+	// another seed, other phases
+	other, err := failuregen.NewGoroutineJitter(2, time.Hour)
+	require.NoError(t, err)
+	a3, _ := phasesBySite(other)
+	require.NotEqual(t, a, a3)
+}
+
+func TestGeneratorAddsGoroutinePhaseToDelays(t *testing.T) {
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	var delays []time.Duration
+	g.DelayFn = func(d time.Duration) { delays = append(delays, d) }
+	require.NoError(t, g.SetDelayConfig(failuregen.DelayConfig{
+		DelayProbability: 1.0,
+	}))
+	j, err := failuregen.NewGoroutineJitter(7, time.Second)
+	require.NoError(t, err)
+	g.SetGoroutineJitter(j)
+
+	require.NoError(t, g.FailMaybe())
+	require.NoError(t, g.FailMaybe())
+	require.Equal(t, []time.Duration{j.Phase(), j.Phase()}, delays)
+}
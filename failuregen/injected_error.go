@@ -0,0 +1,130 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+type injectionIDKey struct{}
+
+// injectionLogTag is the log tag carrying injection IDs
+const injectionLogTag = "injection"
+
+// GeneratorConfig is a snapshot of the configuration of a FailureGenerator
+type GeneratorConfig struct {
+	// FailureProbability is the probability of failure
+	FailureProbability float32
+	// Delay is the delay configuration
+	Delay DelayConfig
+}
+
+// InjectionInfo describes an injected failure
+type InjectionInfo struct {
+	// InjectionID uniquely identifies the injection, it is also logged by
+	// generators with injection logging enabled so that errors observed by
+	// the system under test can be matched to the injection that caused them
+	InjectionID string
+	// FailurePoint at which the failure was injected, empty for failures not
+	// injected at a named failure-point
+	FailurePoint FailurePoint
+	// GeneratorID identifies the generator or plan that injected the failure
+	GeneratorID string
+	// Sequence is the 1-based count of failures injected by the generator or
+	// plan, including this one
+	Sequence int64
+	// Time at which the failure was injected
+	Time time.Time
+	// Config is the configuration of the generator at the time of injection
+	Config GeneratorConfig
+	// Plan is the assured-failure-plan at the time of injection, empty for
+	// failures injected by a FailureGenerator
+	Plan []FailurePoint
+}
+
+// InjectedFailureError is the error returned for injected failures, it
+// carries the metadata of the injection and can be retrieved with errors.As.
+// It matches ErrInjectedFailure with errors.Is, and wraps cause (if any) such
+// that domain-specific injected errors can be matched too.
+type InjectedFailureError struct {
+	InjectionInfo
+	msg   string
+	cause error
+}
+
+func (e *InjectedFailureError) Error() string {
+	return e.msg
+}
+
+// Is makes injected failures match ErrInjectedFailure
+func (e *InjectedFailureError) Is(target error) bool {
+	return target == ErrInjectedFailure
+}
+
+// Unwrap returns the injected domain-specific error, if any
+func (e *InjectedFailureError) Unwrap() error {
+	return e.cause
+}
+
+// newInjectionID returns a unique injection ID
+func newInjectionID() string {
+	return uuid.New().String()
+}
+
+// logInjection logs the injection of a failure, this is the log line
+// injection IDs are correlated with
+func logInjection(ctx context.Context, info InjectionInfo, msg string) {
+	log.Infof(
+		WithInjectionID(ctx, info.InjectionID),
+		"Injected failure %s (generator %s, sequence %d, failure-point %q): %s",
+		info.InjectionID,
+		info.GeneratorID,
+		info.Sequence,
+		info.FailurePoint,
+		msg)
+}
+
+// WithInjectionID returns a context carrying the injection ID as a context
+// value and a log tag
+func WithInjectionID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, injectionIDKey{}, id)
+	return log.WithLogTag(ctx, injectionLogTag, id)
+}
+
+// WithInjection returns a context carrying the ID of the injected failure
+// in err's chain, ctx is returned as is if err is not an injected failure.
+// The system under test can use it to propagate the injection ID to the
+// logs of the work affected by the failure.
+func WithInjection(ctx context.Context, err error) context.Context {
+	info, ok := InfoFromError(err)
+	if !ok {
+		return ctx
+	}
+	return WithInjectionID(ctx, info.InjectionID)
+}
+
+// InjectionIDFromContext returns the injection ID carried by ctx
+func InjectionIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(injectionIDKey{}).(string)
+	return id, ok
+}
+
+// InfoFromError returns the metadata of the injected failure in err's chain.
+// The second return value is false if err is not an injected failure.
+func InfoFromError(err error) (InjectionInfo, bool) {
+	var injected *InjectedFailureError
+	if !errors.As(err, &injected) {
+		return InjectionInfo{}, false
+	}
+	return injected.InjectionInfo, true
+}
+
+// IsInjected tells if err is, or wraps, an injected failure
+func IsInjected(err error) bool {
+	return errors.Is(err, ErrInjectedFailure)
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestInfoFromErrorForFailureGenerator(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	require.NoError(t, g.SetFailureProbability(1.0))
+	require.NoError(t, g.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   10,
+		DelayProbability: 0.5,
+	}))
+
+	for seq := int64(1); seq <= 3; seq++ {
+		err := errors.Wrap(g.FailMaybe(), "operation failed")
+		require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+
+		info, ok := failuregen.InfoFromError(err)
+		require.True(t, ok)
+		require.Equal(t, seq, info.Sequence)
+		require.Equal(
+			t,
+			g.(*failuregen.FailureGeneratorImpl).ID(),
+			info.GeneratorID)
+		require.Equal(t, failuregen.GeneratorConfig{
+			FailureProbability: 1.0,
+			Delay: failuregen.DelayConfig{
+				MaxDelayMicros:   10,
+				DelayProbability: 0.5,
+			},
+		}, info.Config)
+		require.Empty(t, info.FailurePoint)
+	}
+
+	_, ok := failuregen.InfoFromError(errors.New("organic failure"))
+	require.False(t, ok)
+	_, ok = failuregen.InfoFromError(nil)
+	require.False(t, ok)
+}
+
+func TestInfoFromErrorForAssuredFailurePlan(t *testing.T) {
+	afp := AssureFailuresAt(t, failuregen.SChTargetStateP1)
+
+	err := afp.FailMaybe(failuregen.SChTargetStateP1)
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+
+	info, ok := failuregen.InfoFromError(err)
+	require.True(t, ok)
+	require.Equal(t, failuregen.SChTargetStateP1, info.FailurePoint)
+	require.Equal(
+		t,
+		afp.(*failuregen.AssuredFailurePlanImpl).PlanFilePath,
+		info.GeneratorID)
+	require.Equal(t, int64(1), info.Sequence)
+	require.Equal(
+		t,
+		[]failuregen.FailurePoint{failuregen.SChTargetStateP1},
+		info.Plan)
+}
+
+func TestInjectionIDPropagation(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	require.NoError(t, g.SetFailureProbability(1.0))
+	g.(*failuregen.FailureGeneratorImpl).SetLogInjections(true)
+
+	first, ok := failuregen.InfoFromError(g.FailMaybe())
+	require.True(t, ok)
+	require.NotEmpty(t, first.InjectionID)
+	second, ok := failuregen.InfoFromError(g.FailMaybe())
+	require.True(t, ok)
+	require.NotEqual(t, first.InjectionID, second.InjectionID)
+
+	err := errors.Wrap(g.FailMaybe(), "operation failed")
+	info, _ := failuregen.InfoFromError(err)
+	ctx := failuregen.WithInjection(context.Background(), err)
+	id, ok := failuregen.InjectionIDFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, info.InjectionID, id)
+
+	ctx = failuregen.WithInjection(context.Background(), errors.New("organic"))
+	_, ok = failuregen.InjectionIDFromContext(ctx)
+	require.False(t, ok)
+}
+
+func TestInjectedFailureErrorAs(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	require.NoError(t, g.SetFailureProbability(1.0))
+	err := errors.Wrap(g.FailMaybe(), "operation failed")
+	require.True(t, failuregen.IsInjected(err))
+	require.False(t, failuregen.IsInjected(errors.New("organic")))
+	require.False(t, failuregen.IsInjected(nil))
+
+	var injected *failuregen.InjectedFailureError
+	require.ErrorAs(t, err, &injected)
+	require.Equal(t, int64(1), injected.Sequence)
+	require.Equal(
+		t,
+		g.(*failuregen.FailureGeneratorImpl).ID(),
+		injected.GeneratorID)
+	require.False(t, injected.Time.IsZero())
+}
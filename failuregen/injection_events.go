@@ -0,0 +1,103 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// InjectionKind is the kind of an injected fault
+type InjectionKind string
+
+const (
+	// InjectionKindFailure is an injected failure
+	InjectionKindFailure InjectionKind = "failure"
+	// InjectionKindDelay is an injected delay
+	InjectionKindDelay InjectionKind = "delay"
+)
+
+// InjectionEvent describes a fault when it fires, see OnInject
+type InjectionEvent struct {
+	Time time.Time
+	Kind InjectionKind
+	// GeneratorID identifies the generator or plan that injected the fault
+	GeneratorID string
+	// InjectionID, FailurePoint and Sequence are as per InjectionInfo, for
+	// failures
+	InjectionID  string
+	FailurePoint FailurePoint
+	Sequence     int64
+	// Delay is the injected delay, for delays
+	Delay time.Duration
+	// CallSite is the file:line from which the fault was requested, i.e. the
+	// first caller outside this package
+	CallSite string
+}
+
+// failureEvent returns the event of the failure described by info
+func failureEvent(info InjectionInfo) InjectionEvent {
+	return InjectionEvent{
+		Kind:         InjectionKindFailure,
+		GeneratorID:  info.GeneratorID,
+		InjectionID:  info.InjectionID,
+		FailurePoint: info.FailurePoint,
+		Sequence:     info.Sequence,
+	}
+}
+
+// packagePrefix prefixes the functions of this package in stack traces
+var packagePrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	pkg := strings.LastIndex(name, "/") + 1
+	return name[:pkg+strings.Index(name[pkg:], ".")+1]
+}()
+
+// callSite returns the file:line of the first caller outside this package
+func callSite() string {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePrefix) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// OnInject registers fn to be called, synchronously, whenever a fault fires,
+// so that tests can record when and where faults fired and correlate them
+// with the logs of the system under test
+func (it *injectionTracker) OnInject(fn func(event InjectionEvent)) {
+	for {
+		old := it.injectHooks.Load()
+		var hooks []func(InjectionEvent)
+		if old != nil {
+			hooks = append(hooks, *old...)
+		}
+		hooks = append(hooks, fn)
+		if it.injectHooks.CompareAndSwap(old, &hooks) {
+			return
+		}
+	}
+}
+
+// emitInjection calls the OnInject hooks with event, completed with the time
+// and call site
+func (it *injectionTracker) emitInjection(event InjectionEvent) {
+	hooks := it.injectHooks.Load()
+	if hooks == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.CallSite = callSite()
+	for _, fn := range *hooks {
+		fn(event)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnInjectReportsFailuresAndDelays(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	var events []failuregen.InjectionEvent
+	fg.OnInject(func(event failuregen.InjectionEvent) {
+		events = append(events, event)
+	})
+	require.NoError(t, fg.SetFailureProbability(1))
+	err := fg.FailMaybe()
+	require.Error(t, err)
+	info, ok := failuregen.InfoFromError(err)
+	require.True(t, ok)
+
+	require.Len(t, events, 1)
+	require.Equal(t, failuregen.InjectionKindFailure, events[0].Kind)
+	require.Equal(t, info.InjectionID, events[0].InjectionID)
+	require.Equal(t, info.GeneratorID, events[0].GeneratorID)
+	require.False(t, events[0].Time.IsZero())
+	require.True(
+		t,
+		strings.Contains(events[0].CallSite, "injection_events_test.go:"),
+		events[0].CallSite)
+
+	require.NoError(t, fg.SetFailureProbability(0))
+	fg.DelayFn = func(time.Duration) {}
+	require.NoError(t, fg.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   1000,
+		DelayProbability: 1,
+	}))
+	require.NoError(t, fg.FailMaybe())
+	require.Len(t, events, 2)
+	require.Equal(t, failuregen.InjectionKindDelay, events[1].Kind)
+}
+
+func TestOnInjectReportsPlanFailurePoints(t *testing.T) {
+	plan := failuregen.NewAssuredFailurePlanWithStore(
+		&memPlanStore{points: []failuregen.FailurePoint{"a"}},
+	).(*failuregen.AssuredFailurePlanImpl)
+	var events []failuregen.InjectionEvent
+	plan.OnInject(func(event failuregen.InjectionEvent) {
+		events = append(events, event)
+	})
+	require.Error(t, plan.FailMaybe("a"))
+	require.Len(t, events, 1)
+	require.Equal(t, failuregen.FailurePoint("a"), events[0].FailurePoint)
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// latencySmoothing is the weight of a new sample in the moving average of
+// observed latency (as for the smoothed RTT of TCP)
+const latencySmoothing = 0.125
+
+// SetLatencyMultiplier makes delayed operations take multiplier times their
+// recent observed latency (as reported to Record), i.e. the injected delay is
+// (multiplier - 1) times the observed latency, so that "make this 10x slower"
+// holds for fast and slow operations alike. Until a latency is recorded,
+// delays are drawn as per DelayConfig.MaxDelayMicros. The delay probability
+// still comes from DelayConfig. A multiplier of 0 restores absolute delays.
+func (fg *FailureGeneratorImpl) SetLatencyMultiplier(multiplier float64) error {
+	if multiplier != 0 && multiplier < 1 {
+		return errors.Wrapf(
+			ErrInvalidDelay,
+			"latency multiplier %f below 1",
+			multiplier)
+	}
+	fg.latencyMultiplier.Store(multiplier)
+	return nil
+}
+
+// Record reports the latency of an operation governed by the generator. The
+// generator tracks a moving average of the recorded latencies, which is the
+// basis of injected delays when a latency multiplier is set.
+func (fg *FailureGeneratorImpl) Record(latency time.Duration) {
+	for {
+		old := fg.observedLatency.Load()
+		avg := latency
+		if old > 0 {
+			avg = old + time.Duration(
+				latencySmoothing*float64(latency-old))
+		}
+		if fg.observedLatency.CompareAndSwap(old, avg) {
+			return
+		}
+	}
+}
+
+// ObservedLatency returns the moving average of the latencies reported to
+// Record, 0 if none was reported
+func (fg *FailureGeneratorImpl) ObservedLatency() time.Duration {
+	return fg.observedLatency.Load()
+}
+
+// injectedDelay returns the delay to inject, including the phase of the
+// calling goroutine
+func (fg *FailureGeneratorImpl) injectedDelay() time.Duration {
+	delay := fg.baseDelay()
+	if j := fg.goroutineJitter.Load(); j != nil {
+		delay += j.Phase()
+	}
+	return delay
+}
+
+// baseDelay returns the delay to inject, as per the delay config
+func (fg *FailureGeneratorImpl) baseDelay() time.Duration {
+	if m := fg.latencyMultiplier.Load(); m > 0 {
+		if observed := fg.observedLatency.Load(); observed > 0 {
+			return time.Duration(float64(observed) * (m - 1))
+		}
+	}
+	maxDelayMicros := fg.maxDelayMicros.Load()
+	if maxDelayMicros <= 0 {
+		return 0
+	}
+	return time.Duration(fg.randGen.Int31n(maxDelayMicros)) * time.Microsecond
+}
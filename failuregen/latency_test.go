@@ -0,0 +1,45 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestLatencyMultiplierDelays(t *testing.T) {
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	var delays []time.Duration
+	g.DelayFn = func(d time.Duration) { delays = append(delays, d) }
+
+	err := g.SetLatencyMultiplier(0.5)
+	require.True(t, errors.Is(err, failuregen.ErrInvalidDelay))
+
+	require.NoError(t, g.SetLatencyMultiplier(10))
+	require.NoError(t, g.SetDelayConfig(failuregen.DelayConfig{
+		DelayProbability: 1.0,
+	}))
+	// nothing recorded yet, and no max delay to fall back on
+	require.NoError(t, g.FailMaybe())
+	require.Equal(t, []time.Duration{0}, delays)
+
+	g.Record(time.Millisecond)
+	require.Equal(t, time.Millisecond, g.ObservedLatency())
+	require.NoError(t, g.FailMaybe())
+	require.Equal(t, 9*time.Millisecond, delays[1])
+
+	// the observed latency follows slower operations
+	for i := 0; i < 100; i++ {
+		g.Record(10 * time.Millisecond)
+	}
+	require.InDelta(t, 10*time.Millisecond, g.ObservedLatency(),
+		float64(100*time.Microsecond))
+	require.NoError(t, g.FailMaybe())
+	require.InDelta(t, 90*time.Millisecond, delays[2],
+		float64(time.Millisecond))
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+// MarkovState is a state of a MarkovGenerator
+type MarkovState string
+
+// States of the usual healthy -> degraded -> down -> recovering cycle, any
+// other state may be used
+const (
+	StateHealthy    MarkovState = "healthy"
+	StateDegraded   MarkovState = "degraded"
+	StateDown       MarkovState = "down"
+	StateRecovering MarkovState = "recovering"
+)
+
+// MarkovChain describes the states of a MarkovGenerator and the transitions
+// between them
+type MarkovChain struct {
+	// Initial is the initial state, StateHealthy if empty
+	Initial MarkovState
+	// Transitions[from][to] is the probability of moving from state from to
+	// state to at each call. The probabilities out of a state must not add
+	// up to more than 1, the remainder is the probability of staying.
+	Transitions map[MarkovState]map[MarkovState]float64
+	// Configs are the failure and delay configs of each state
+	Configs map[MarkovState]GeneratorConfig
+}
+
+func (c MarkovChain) initial() MarkovState {
+	if c.Initial == "" {
+		return StateHealthy
+	}
+	return c.Initial
+}
+
+func (c MarkovChain) validate() error {
+	if _, ok := c.Configs[c.initial()]; !ok {
+		return errors.Errorf("No config for initial state %s", c.initial())
+	}
+	for state, cfg := range c.Configs {
+		if _, err := ppm(cfg.FailureProbability); err != nil {
+			return errors.Wrapf(err, "Invalid config of state %s", state)
+		}
+		if _, err := ppm(cfg.Delay.DelayProbability); err != nil {
+			return errors.Wrapf(err, "Invalid config of state %s", state)
+		}
+	}
+	for from, to := range c.Transitions {
+		total := 0.0
+		for state, p := range to {
+			if _, ok := c.Configs[state]; !ok {
+				return errors.Errorf("No config for state %s", state)
+			}
+			if p < 0 || p > 1 {
+				return errors.Errorf(
+					"Invalid probability %f of transition %s -> %s",
+					p,
+					from,
+					state)
+			}
+			total += p
+		}
+		if total > 1 {
+			return errors.Errorf(
+				"Probabilities of transitions out of %s add up to %f",
+				from,
+				total)
+		}
+	}
+	return nil
+}
+
+// MarkovGenerator is a generator whose failure and delay configs follow a
+// Markov chain of states (e.g. healthy -> degraded -> down -> recovering),
+// which models flapping dependencies better than a single probability. The
+// chain takes a step at each FailMaybe call, before the call is decided as
+// per the config of the new state. Configs set through SetFailureProbability
+// and SetDelayConfig last until the next transition.
+type MarkovGenerator struct {
+	*FailureGeneratorImpl
+	chain       MarkovChain
+	randGen     *randutil.LockedRandGen
+	seed        int64
+	mu          sync.Mutex
+	state       MarkovState
+	transitions int64
+}
+
+// NewMarkovGenerator creates a generator following chain, from its initial
+// state. Its transitions, like its decisions, are determined by seed.
+func NewMarkovGenerator(
+	chain MarkovChain,
+	seed int64,
+) (*MarkovGenerator, error) {
+	if err := chain.validate(); err != nil {
+		return nil, errors.Wrap(err, "Invalid Markov chain")
+	}
+	g := &MarkovGenerator{
+		FailureGeneratorImpl: NewFailureGeneratorWithSeed(
+			seed).(*FailureGeneratorImpl),
+		chain:   chain,
+		randGen: randutil.NewLockedRandGen(seed),
+		seed:    seed,
+		state:   chain.initial(),
+	}
+	if err := g.apply(g.state); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// apply configures the generator as per state
+func (g *MarkovGenerator) apply(state MarkovState) error {
+	cfg := g.chain.Configs[state]
+	if err := g.FailureGeneratorImpl.SetDelayConfig(cfg.Delay); err != nil {
+		return err
+	}
+	return g.FailureGeneratorImpl.SetFailureProbability(
+		cfg.FailureProbability)
+}
+
+// State returns the current state of the generator
+func (g *MarkovGenerator) State() MarkovState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.state
+}
+
+// Transitions returns the number of transitions the generator went through
+func (g *MarkovGenerator) Transitions() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.transitions
+}
+
+// step moves the chain to its next state
+func (g *MarkovGenerator) step() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	to := g.chain.Transitions[g.state]
+	if len(to) == 0 {
+		return
+	}
+	// states are ordered for the transitions to be reproducible
+	states := make([]MarkovState, 0, len(to))
+	for state := range to {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	r := float64(g.randGen.Int63n(1<<53)) / (1 << 53)
+	for _, state := range states {
+		if r -= to[state]; r < 0 {
+			if state == g.state {
+				return
+			}
+			log.Infof(
+				context.Background(),
+				"Generator %s moves from %s to %s",
+				g.ID(),
+				g.state,
+				state)
+			g.state = state
+			g.transitions++
+			// configs were validated on creation
+			_ = g.apply(state)
+			return
+		}
+	}
+}
+
+// FailMaybe steps the chain and returns an artificial error as per the
+// config of the new state
+func (g *MarkovGenerator) FailMaybe() error {
+	g.step()
+	return g.FailureGeneratorImpl.FailMaybe()
+}
+
+// DeepCopy returns a generator following the same chain from its initial
+// state, with the same seed
+func (g *MarkovGenerator) DeepCopy() FailureGenerator {
+	c, _ := NewMarkovGenerator(g.chain, g.seed)
+	c.FailureGeneratorImpl.DelayFn = g.FailureGeneratorImpl.DelayFn
+	return c
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func flappingChain() failuregen.MarkovChain {
+	return failuregen.MarkovChain{
+		Transitions: map[failuregen.MarkovState]map[failuregen.MarkovState]float64{
+			failuregen.StateHealthy: {failuregen.StateDegraded: 0.1},
+			failuregen.StateDegraded: {
+				failuregen.StateDown:    0.2,
+				failuregen.StateHealthy: 0.1,
+			},
+			failuregen.StateDown:       {failuregen.StateRecovering: 0.2},
+			failuregen.StateRecovering: {failuregen.StateHealthy: 0.3},
+		},
+		Configs: map[failuregen.MarkovState]failuregen.GeneratorConfig{
+			failuregen.StateHealthy:    {},
+			failuregen.StateDegraded:   {FailureProbability: 0.3},
+			failuregen.StateDown:       {FailureProbability: 1},
+			failuregen.StateRecovering: {FailureProbability: 0.1},
+		},
+	}
+}
+
+func TestMarkovGenerator(t *testing.T) {
+	g, err := failuregen.NewMarkovGenerator(flappingChain(), 42)
+	require.NoError(t, err)
+	require.Equal(t, failuregen.StateHealthy, g.State())
+
+	visited := make(map[failuregen.MarkovState]bool)
+	var outcomes []bool
+	for i := 0; i < 2000; i++ {
+		err := g.FailMaybe()
+		state := g.State()
+		visited[state] = true
+		if state == failuregen.StateHealthy {
+			require.NoError(t, err)
+		} else if state == failuregen.StateDown {
+			require.Error(t, err)
+		}
+		outcomes = append(outcomes, err != nil)
+	}
+	require.Len(t, visited, 4)
+	require.Positive(t, g.Transitions())
+
+	// copies replay the same chain
+	c := g.DeepCopy()
+	for i, failed := range outcomes {
+		require.Equal(t, failed, c.FailMaybe() != nil, "call %d", i)
+	}
+}
+
+func TestMarkovChainValidation(t *testing.T) {
+	chain := flappingChain()
+	chain.Transitions[failuregen.StateHealthy][failuregen.StateDown] = 0.95
+	_, err := failuregen.NewMarkovGenerator(chain, 0)
+	require.Error(t, err)
+
+	chain = flappingChain()
+	delete(chain.Configs, failuregen.StateDown)
+	_, err = failuregen.NewMarkovGenerator(chain, 0)
+	require.Error(t, err)
+
+	chain = flappingChain()
+	chain.Configs[failuregen.StateDown] = failuregen.GeneratorConfig{
+		FailureProbability: 2,
+	}
+	_, err = failuregen.NewMarkovGenerator(chain, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// MetricFunc returns the current value of a metric of the system under test
+// (e.g. a queue depth or the number of errors served)
+type MetricFunc func() float64
+
+// Metrics are sampled metric values, by name
+type Metrics map[string]float64
+
+// MetricCondition is a predicate over sampled metrics
+type MetricCondition func(m Metrics) bool
+
+// Above is true while the named metric exceeds threshold
+func Above(name string, threshold float64) MetricCondition {
+	return func(m Metrics) bool { return m[name] > threshold }
+}
+
+// Below is true while the named metric is under threshold
+func Below(name string, threshold float64) MetricCondition {
+	return func(m Metrics) bool { return m[name] < threshold }
+}
+
+// MetricsControllerConfig configures a MetricsController
+type MetricsControllerConfig struct {
+	// Probability is the failure probability of the generators while
+	// injection is enabled
+	Probability float32
+	// Metrics are the metrics sampled on every evaluation
+	Metrics map[string]MetricFunc
+	// InjectWhen enables injection while it holds, nil always holds
+	InjectWhen MetricCondition
+	// StopWhen, once it holds, disables injection for good (e.g. when the
+	// error budget of the experiment is exhausted), nil never holds
+	StopWhen MetricCondition
+}
+
+// MetricsController enables and disables failure injection of generators
+// based on metrics of the system under test, for feedback-driven chaos
+// experiments. Generators are disabled until the first evaluation enables
+// them.
+type MetricsController struct {
+	cfg     MetricsControllerConfig
+	gens    []*FailureGeneratorImpl
+	mu      sync.Mutex
+	enabled bool
+	stopped bool
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewMetricsController creates a controller driving the given generators
+func NewMetricsController(
+	cfg MetricsControllerConfig,
+	gens ...*FailureGeneratorImpl,
+) (*MetricsController, error) {
+	if _, err := ppm(cfg.Probability); err != nil {
+		return nil, errors.Wrapf(err, "Invalid probability")
+	}
+	c := &MetricsController{cfg: cfg, gens: gens, quit: make(chan struct{})}
+	c.setEnabledLocked(false)
+	return c, nil
+}
+
+func (c *MetricsController) setEnabledLocked(enabled bool) {
+	p := float32(0)
+	if enabled {
+		p = c.cfg.Probability
+	}
+	for _, g := range c.gens {
+		// the probability was validated by the constructor
+		_ = g.SetFailureProbability(p)
+	}
+	c.enabled = enabled
+}
+
+// Sample returns the current values of the metrics
+func (c *MetricsController) Sample() Metrics {
+	m := make(Metrics, len(c.cfg.Metrics))
+	for name, fn := range c.cfg.Metrics {
+		m[name] = fn()
+	}
+	return m
+}
+
+// Evaluate samples the metrics and enables or disables injection
+// accordingly. It returns whether injection is enabled.
+func (c *MetricsController) Evaluate() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return false
+	}
+	m := c.Sample()
+	enabled := true
+	if c.cfg.StopWhen != nil && c.cfg.StopWhen(m) {
+		c.stopped = true
+		enabled = false
+		log.Infof(context.Background(), "Stopped injection, metrics: %v", m)
+	} else if c.cfg.InjectWhen != nil {
+		enabled = c.cfg.InjectWhen(m)
+	}
+	if enabled != c.enabled {
+		c.setEnabledLocked(enabled)
+		if log.V(3) {
+			log.Infof(
+				context.Background(),
+				"Injection enabled: %v, metrics: %v",
+				enabled,
+				m)
+		}
+	}
+	return enabled
+}
+
+// Stopped tells if StopWhen held, disabling injection for good
+func (c *MetricsController) Stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopped
+}
+
+// Start evaluates the metrics every interval until Stop is called
+func (c *MetricsController) Start(interval time.Duration) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.quit:
+				return
+			case <-ticker.C:
+				c.Evaluate()
+			}
+		}
+	}()
+}
+
+// Stop stops periodic evaluations, the generators are left as they are
+func (c *MetricsController) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
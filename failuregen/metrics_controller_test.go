@@ -0,0 +1,54 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsController(t *testing.T) {
+	_, err := failuregen.NewMetricsController(
+		failuregen.MetricsControllerConfig{Probability: 2})
+	require.Error(t, err)
+
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, fg.SetFailureProbability(1))
+	queueDepth, errorsServed := 0.0, 0.0
+	c, err := failuregen.NewMetricsController(
+		failuregen.MetricsControllerConfig{
+			Probability: 1,
+			Metrics: map[string]failuregen.MetricFunc{
+				"queueDepth": func() float64 { return queueDepth },
+				"errors":     func() float64 { return errorsServed },
+			},
+			InjectWhen: failuregen.Above("queueDepth", 10),
+			StopWhen:   failuregen.Above("errors", 5),
+		},
+		fg)
+	require.NoError(t, err)
+
+	// disabled until the metrics enable injection
+	require.NoError(t, fg.FailMaybe())
+	require.False(t, c.Evaluate())
+	require.NoError(t, fg.FailMaybe())
+
+	queueDepth = 20
+	require.True(t, c.Evaluate())
+	require.Error(t, fg.FailMaybe())
+
+	queueDepth = 5
+	require.False(t, c.Evaluate())
+	require.NoError(t, fg.FailMaybe())
+
+	// the error budget is exhausted, injection stops for good
+	queueDepth, errorsServed = 20, 6
+	require.False(t, c.Evaluate())
+	require.True(t, c.Stopped())
+	errorsServed = 0
+	require.False(t, c.Evaluate())
+	require.NoError(t, fg.FailMaybe())
+	require.Equal(t, failuregen.Metrics{"queueDepth": 20, "errors": 0}, c.Sample())
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+)
+
+type noInjectKey struct{}
+
+// NoInject returns a context within which no failure (nor delay) is
+// injected by FailMaybeContext and FailMaybeAtContext, nor by the
+// FailMaybeContext methods of generators, plans and registries. Use it for
+// test setup and cleanup paths that share production code, so that injected
+// faults don't corrupt the test scaffolding.
+func NoInject(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noInjectKey{}, true)
+}
+
+// InjectionSuppressed reports whether injections are suppressed within ctx
+func InjectionSuppressed(ctx context.Context) bool {
+	suppressed, _ := ctx.Value(noInjectKey{}).(bool)
+	return suppressed
+}
+
+// FailMaybeContext calls fg.FailMaybeContext if fg is a
+// ContextFailureGenerator, and fg.FailMaybe otherwise, unless injections are
+// suppressed within ctx
+func FailMaybeContext(ctx context.Context, fg FailureGenerator) error {
+	if cfg, ok := fg.(ContextFailureGenerator); ok {
+		return cfg.FailMaybeContext(ctx)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	return fg.FailMaybe()
+}
+
+// FailMaybeAtContext calls plan.FailMaybeContext for the failure-point if
+// plan is a ContextAssuredFailurePlan, and plan.FailMaybe otherwise, unless
+// injections are suppressed within ctx
+func FailMaybeAtContext(
+	ctx context.Context,
+	plan AssuredFailurePlan,
+	fp FailurePoint,
+) error {
+	if cp, ok := plan.(ContextAssuredFailurePlan); ok {
+		return cp.FailMaybeContext(ctx, fp)
+	}
+	if InjectionSuppressed(ctx) {
+		return nil
+	}
+	return plan.FailMaybe(fp)
+}
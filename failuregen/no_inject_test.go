@@ -0,0 +1,93 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/clock"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestNoInjectSuppressesInjections(t *testing.T) {
+	g := failuregen.NewFailureGenerator()
+	require.NoError(t, g.SetFailureProbability(1.0))
+	plan := failuregen.NewAssuredFailurePlanWithStore(&memPlanStore{
+		points: []failuregen.FailurePoint{failuregen.SChTargetStateP1},
+	})
+
+	ctx := context.Background()
+	require.False(t, failuregen.InjectionSuppressed(ctx))
+	require.Error(t, failuregen.FailMaybeContext(ctx, g))
+	require.Error(t, failuregen.FailMaybeAtContext(
+		ctx,
+		plan,
+		failuregen.SChTargetStateP1))
+
+	setupCtx, cancel := context.WithCancel(failuregen.NoInject(ctx))
+	defer cancel()
+	require.True(t, failuregen.InjectionSuppressed(setupCtx))
+	require.NoError(t, failuregen.FailMaybeContext(setupCtx, g))
+	require.NoError(t, failuregen.FailMaybeAtContext(
+		setupCtx,
+		plan,
+		failuregen.SChTargetStateP1))
+}
+
+func TestNoInjectSuppressesContextMethods(t *testing.T) {
+	failing := func() *failuregen.FailureGeneratorImpl {
+		g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+		require.NoError(t, g.SetFailureProbability(1))
+		require.NoError(t, g.SetDelayConfig(failuregen.DelayConfig{
+			MaxDelayMicros:   1000,
+			DelayProbability: 1,
+		}))
+		g.DelayFn = func(time.Duration) {}
+		return g
+	}
+	markov, err := failuregen.NewMarkovGenerator(failuregen.MarkovChain{
+		Configs: map[failuregen.MarkovState]failuregen.GeneratorConfig{
+			failuregen.StateHealthy: {FailureProbability: 1},
+		},
+	}, 42)
+	require.NoError(t, err)
+	clk := clock.NewManualClock(time.Now())
+	expiry := failuregen.NewCredentialExpiry(clk, time.Minute, errTokenExpired)
+	clk.Advance(time.Hour)
+	gens := map[string]failuregen.ContextFailureGenerator{
+		"generator":   failing(),
+		"adapter":     failuregen.WithContext(bareGenerator{failing()}),
+		"markov":      markov,
+		"composite":   failuregen.WithContext(failuregen.Any(failing())),
+		"conditional": &failuregen.ConditionalFailureGeneratorImpl{Fg: failing()},
+	}
+	plan := failuregen.NewAssuredFailurePlanWithStore(&memPlanStore{
+		points: []failuregen.FailurePoint{failuregen.SChTargetStateP1},
+	}).(failuregen.ContextAssuredFailurePlan)
+	registry := failuregen.NewRegistry()
+	registry.SetPlan(plan)
+	registry.SetGenerator(failuregen.SChTargetStateC6, failing())
+
+	ctx := failuregen.NoInject(context.Background())
+	for name, g := range gens {
+		require.NoError(t, g.FailMaybeContext(ctx), name)
+		require.NoError(t, failuregen.FailMaybeContext(ctx, g), name)
+		require.Error(t, g.FailMaybeContext(context.Background()), name)
+	}
+	require.NoError(t, expiry.FailMaybeContext(ctx))
+	require.Error(t, expiry.FailMaybeContext(context.Background()))
+	require.NoError(t, plan.FailMaybeContext(ctx, failuregen.SChTargetStateP1))
+	require.NoError(t, registry.FailMaybeContext(
+		ctx,
+		failuregen.SChTargetStateP1))
+	require.NoError(t, registry.FailMaybeContext(
+		ctx,
+		failuregen.SChTargetStateC6))
+	require.Error(t, registry.FailMaybeContext(
+		context.Background(),
+		failuregen.SChTargetStateP1))
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ActionKind is the kind of action of a failure-point of a plan
+type ActionKind string
+
+const (
+	// ActionFail returns the injected failure, the default action
+	ActionFail ActionKind = ""
+	// ActionError returns an injected failure with the message of the
+	// action
+	ActionError ActionKind = "error"
+	// ActionDelay sleeps for the delay of the action and returns no error
+	ActionDelay ActionKind = "delay"
+	// ActionPanic panics, see CrashPanic
+	ActionPanic ActionKind = "panic"
+	// ActionExit exits with the exit code of the action, see CrashExit
+	ActionExit ActionKind = "exit"
+)
+
+// Action is what a failure-point of a plan does when it fires, so that a
+// single plan can cover failure, latency and crash testing. In a plan file
+// the action is written as a suffix of the entry: ":error=MESSAGE" (with the
+// message escaped as by url.QueryEscape), ":delay=DURATION" (as parsed by
+// time.ParseDuration), ":panic" or ":exit=CODE", e.g.
+// "SChTargetStateP1:delay=250ms". Crashes must be allowed with AllowCrashes,
+// and take precedence over CrashAt.
+type Action struct {
+	Kind ActionKind
+	// Message is the error message of ActionError
+	Message string
+	// Delay is the delay of ActionDelay
+	Delay time.Duration
+	// ExitCode is the exit code of ActionExit
+	ExitCode int
+}
+
+// WithAction makes a plan entry (a failure-point or a pattern) take action
+// when it fires
+func WithAction(entry FailurePoint, action Action) FailurePoint {
+	switch action.Kind {
+	case ActionError:
+		return entry + ":error=" + FailurePoint(url.QueryEscape(action.Message))
+	case ActionDelay:
+		return entry + ":delay=" + FailurePoint(action.Delay.String())
+	case ActionPanic:
+		return entry + ":panic"
+	case ActionExit:
+		return entry + FailurePoint(fmt.Sprintf(":exit=%d", action.ExitCode))
+	}
+	return entry
+}
+
+// maxExitCode is the largest exit code of ActionExit
+const maxExitCode = 255
+
+// parseAction parses the action suffix s of an entry (without its colon),
+// ok is false if s is not an action
+func parseAction(s string) (Action, bool, error) {
+	name, value, _ := strings.Cut(s, "=")
+	switch ActionKind(name) {
+	case ActionError:
+		msg, err := url.QueryUnescape(value)
+		if err != nil {
+			return Action{}, true, errors.Wrapf(
+				err,
+				"Invalid error message %q",
+				value)
+		}
+		return Action{Kind: ActionError, Message: msg}, true, nil
+	case ActionDelay:
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			return Action{}, true, errors.Wrapf(err, "Invalid delay %q", value)
+		}
+		return Action{Kind: ActionDelay, Delay: delay}, true, nil
+	case ActionPanic:
+		return Action{Kind: ActionPanic}, true, nil
+	case ActionExit:
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 0 || code > maxExitCode {
+			return Action{}, true, errors.Errorf("Invalid exit code %q", value)
+		}
+		return Action{Kind: ActionExit, ExitCode: code}, true, nil
+	}
+	return Action{}, false, nil
+}
+
+// crashOutcome returns the crash of a panic or exit action
+func (a Action) crashOutcome() (CrashOutcome, bool) {
+	switch a.Kind {
+	case ActionPanic:
+		return CrashOutcome{Mode: CrashPanic}, true
+	case ActionExit:
+		return CrashOutcome{Mode: CrashExit, ExitCode: a.ExitCode}, true
+	}
+	return CrashOutcome{}, false
+}
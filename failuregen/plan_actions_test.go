@@ -0,0 +1,121 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+const actionChildEnv = "FAILUREGEN_ACTION_CHILD"
+
+func TestPlanActions(t *testing.T) {
+	store := &memPlanStore{}
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).Error("disk full: no space left").
+		Fail(failuregen.SChTargetStateC6).Delay(50*time.Millisecond).
+		Fail(failuregen.SChTargetStateNU0).
+		Save(store))
+	require.Equal(t, []failuregen.FailurePoint{
+		"SChTargetStateP1:error=disk+full%3A+no+space+left",
+		"SChTargetStateC6:delay=50ms",
+		"SChTargetStateNU0",
+	}, store.points)
+	plan := failuregen.NewAssuredFailurePlanWithStore(store)
+
+	err := plan.FailMaybe(failuregen.SChTargetStateP1)
+	require.True(t, failuregen.IsInjected(err))
+	require.EqualError(t, err, "disk full: no space left")
+
+	var events []failuregen.InjectionEvent
+	plan.(*failuregen.AssuredFailurePlanImpl).OnInject(
+		func(e failuregen.InjectionEvent) { events = append(events, e) })
+	start := time.Now()
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateC6))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Len(t, events, 1)
+	require.Equal(t, failuregen.InjectionKindDelay, events[0].Kind)
+	require.Equal(t, 50*time.Millisecond, events[0].Delay)
+
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateNU0)))
+
+	_, err = failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).Exit(256).
+		Build()
+	require.Error(t, err)
+}
+
+func TestPlanActionPanic(t *testing.T) {
+	plan := failuregen.NewAssuredFailurePlanWithStore(&memPlanStore{
+		points: []failuregen.FailurePoint{failuregen.WithAction(
+			failuregen.SChTargetStateP1,
+			failuregen.Action{Kind: failuregen.ActionPanic})},
+	})
+	failuregen.AllowCrashes(false)
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateP1)))
+
+	failuregen.AllowCrashes(true)
+	defer failuregen.AllowCrashes(false)
+	require.Panics(t, func() {
+		_ = plan.FailMaybe(failuregen.SChTargetStateP1)
+	})
+}
+
+func TestPlanActionExit(t *testing.T) {
+	if os.Getenv(actionChildEnv) != "" {
+		failuregen.AllowCrashes(true)
+		_ = failuregen.NewAssuredFailurePlan().FailMaybe(
+			failuregen.SChTargetStateP1)
+		os.Exit(0)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPlanActionExit$")
+	cmd.Env = append(os.Environ(), actionChildEnv+"=1")
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).Exit(7).
+		Install(cmd, filepath.Join(t.TempDir(), "plan.json")))
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, cmd.Run(), &exitErr)
+	require.Equal(t, 7, exitErr.ExitCode())
+}
+
+func TestMalformedEntrySuffixes(t *testing.T) {
+	for _, entry := range []failuregen.FailurePoint{
+		"SChTargetStateP1:delay=1zz",
+		"SChTargetStateP1:exit=999",
+		"SChTargetStateP1:p=1e-",
+		"SChTargetStateP1:p=2",
+		"SChTargetStateP1:error=%zz",
+	} {
+		var malformed *failuregen.ErrMalformedPlan
+		err := failuregen.ValidatePlan(
+			[]failuregen.FailurePoint{entry},
+			[]failuregen.FailurePoint{failuregen.SChTargetStateP1})
+		require.True(t, errors.As(err, &malformed), entry)
+
+		path := filepath.Join(t.TempDir(), "plan.json")
+		require.NoError(t, os.WriteFile(
+			path,
+			[]byte(`["`+entry+`"]`),
+			0644))
+		_, err = (&failuregen.FilePlanStore{Path: path}).Load()
+		require.True(t, errors.As(err, &malformed), entry)
+
+		// rather than fire a fault other than the one planned
+		plan := failuregen.NewAssuredFailurePlanWithStore(
+			&memPlanStore{points: []failuregen.FailurePoint{entry}})
+		err = plan.FailMaybe(failuregen.SChTargetStateP1)
+		require.False(t, failuregen.IsInjected(err), entry)
+		require.True(t, errors.As(err, &malformed), entry)
+	}
+}
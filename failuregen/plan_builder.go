@@ -0,0 +1,264 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// planEntry is an entry of a plan under construction
+type planEntry struct {
+	entry FailurePoint
+	once  bool
+	skip  int64
+	fail  int64
+	after FailurePoint
+	// afterProcess is the process in which after must fire
+	afterProcess string
+	// in is the process the entry is restricted to
+	in     string
+	action Action
+	// probability is that of failing hits, if sampled
+	probability float32
+	sampled     bool
+}
+
+func (e planEntry) build() FailurePoint {
+	entry := e.entry
+	if e.once {
+		entry = Once(entry)
+	}
+	entry = Counted(entry, e.skip, e.fail)
+	if e.after != "" {
+		entry += ":after=" + e.after
+		if e.afterProcess != "" {
+			entry += "@" + FailurePoint(e.afterProcess)
+		}
+	}
+	if e.in != "" {
+		entry += ":in=" + FailurePoint(e.in)
+	}
+	if e.sampled {
+		entry = Sampled(entry, e.probability)
+	}
+	return WithAction(entry, e.action)
+}
+
+// PlanBuilder constructs assured-failure-plans through a typed API, e.g.
+//
+//	NewPlanBuilder().
+//		Fail(BeforeMetadataMigration).
+//		Fail(AfterMetadataMigration).Once().After(BeforeMetadataMigration).
+//		Write(path)
+//
+// Fail adds an entry to the plan, ExpiresAt and TTL qualify the plan, the
+// other methods qualify the entry added last.
+type PlanBuilder struct {
+	entries   []planEntry
+	expiresAt time.Time
+	ttl       time.Duration
+	err       error
+}
+
+// NewPlanBuilder creates a builder of an empty plan
+func NewPlanBuilder() *PlanBuilder {
+	return &PlanBuilder{}
+}
+
+// Fail adds an entry failing every hit of the failure-point (or of the
+// failure-points matched by the pattern, see ExpandPlan)
+func (b *PlanBuilder) Fail(entry FailurePoint) *PlanBuilder {
+	b.entries = append(b.entries, planEntry{entry: entry})
+	return b
+}
+
+// last returns the entry added last, method names the qualifier for errors
+func (b *PlanBuilder) last(method string) *planEntry {
+	if len(b.entries) == 0 {
+		if b.err == nil {
+			b.err = errors.Errorf("%s must follow Fail", method)
+		}
+		return &planEntry{}
+	}
+	return &b.entries[len(b.entries)-1]
+}
+
+// Once makes the entry one-shot, see Once
+func (b *PlanBuilder) Once() *PlanBuilder {
+	b.last("Once").once = true
+	return b
+}
+
+// Skip makes the entry pass the first n hits of the failure-point, see
+// Counted
+func (b *PlanBuilder) Skip(n int64) *PlanBuilder {
+	b.last("Skip").skip = n
+	return b
+}
+
+// Times makes the entry fail only n hits (after those skipped), see Counted
+func (b *PlanBuilder) Times(n int64) *PlanBuilder {
+	b.last("Times").fail = n
+	return b
+}
+
+// After makes the entry pass the hits of the failure-point until fp fired
+// through the plan (in this or, with a StatePath, a previous incarnation of
+// the process). Skip and Times count the hits after fp fired.
+func (b *PlanBuilder) After(fp FailurePoint) *PlanBuilder {
+	b.last("After").after = fp
+	return b
+}
+
+// AfterIn makes the entry pass the hits of the failure-point until fp fired
+// in the process named process, as recorded in the Journal of the plans of
+// the processes. This sequences failures across processes, e.g.
+//
+//	NewPlanBuilder().
+//		Fail(BeforeMetadataMigration).In("node-b").
+//		Fail(AfterMetadataMigration).In("node-a").
+//		AfterIn(BeforeMetadataMigration, "node-b")
+//
+// fails AfterMetadataMigration in node-a only once BeforeMetadataMigration
+// failed in node-b.
+func (b *PlanBuilder) AfterIn(fp FailurePoint, process string) *PlanBuilder {
+	e := b.last("AfterIn")
+	e.after = fp
+	e.afterProcess = process
+	return b
+}
+
+// In restricts the entry to the process named process (see ProcessName),
+// other processes sharing the plan ignore it
+func (b *PlanBuilder) In(process string) *PlanBuilder {
+	b.last("In").in = process
+	return b
+}
+
+// Probability makes the entry fail hits with probability p only, see Sampled
+func (b *PlanBuilder) Probability(p float32) *PlanBuilder {
+	e := b.last("Probability")
+	e.probability, e.sampled = p, true
+	return b
+}
+
+// Error makes the entry return an injected failure with message msg, see
+// Action
+func (b *PlanBuilder) Error(msg string) *PlanBuilder {
+	b.last("Error").action = Action{Kind: ActionError, Message: msg}
+	return b
+}
+
+// Delay makes the entry sleep for delay rather than fail, see Action
+func (b *PlanBuilder) Delay(delay time.Duration) *PlanBuilder {
+	b.last("Delay").action = Action{Kind: ActionDelay, Delay: delay}
+	return b
+}
+
+// Panic makes the entry panic rather than fail, see Action
+func (b *PlanBuilder) Panic() *PlanBuilder {
+	b.last("Panic").action = Action{Kind: ActionPanic}
+	return b
+}
+
+// Exit makes the entry exit the process with code rather than fail, see
+// Action
+func (b *PlanBuilder) Exit(code int) *PlanBuilder {
+	b.last("Exit").action = Action{Kind: ActionExit, ExitCode: code}
+	return b
+}
+
+// ExpiresAt makes the plan expire at t, see ExpiringPlan
+func (b *PlanBuilder) ExpiresAt(t time.Time) *PlanBuilder {
+	b.expiresAt, b.ttl = t, 0
+	return b
+}
+
+// TTL makes the plan expire ttl after it is saved, see ExpiringPlan
+func (b *PlanBuilder) TTL(ttl time.Duration) *PlanBuilder {
+	if ttl <= 0 && b.err == nil {
+		b.err = errors.Errorf("Invalid plan TTL %v", ttl)
+	}
+	b.expiresAt, b.ttl = time.Time{}, ttl
+	return b
+}
+
+// expiry returns the expiry of the plan saved now, zero if it doesn't expire
+func (b *PlanBuilder) expiry() time.Time {
+	if b.ttl > 0 {
+		return time.Now().Add(b.ttl)
+	}
+	return b.expiresAt
+}
+
+// Build returns the plan, without its expiry
+func (b *PlanBuilder) Build() ([]FailurePoint, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	plan := make([]FailurePoint, 0, len(b.entries))
+	for _, e := range b.entries {
+		if e.skip < 0 || e.fail < 0 {
+			return nil, errors.Errorf(
+				"Negative hit count for %s",
+				e.entry)
+		}
+		if e.action.Delay < 0 ||
+			e.action.ExitCode < 0 || e.action.ExitCode > 255 {
+			return nil, errors.Errorf(
+				"Invalid action for %s: %+v",
+				e.entry,
+				e.action)
+		}
+		if _, err := ppm(e.probability); err != nil {
+			return nil, errors.Wrapf(err, "Invalid probability for %s", e.entry)
+		}
+		for _, process := range []string{e.afterProcess, e.in} {
+			if strings.ContainsAny(process, ":@") {
+				return nil, errors.Errorf(
+					"Invalid process name for %s: %q",
+					e.entry,
+					process)
+			}
+		}
+		plan = append(plan, e.build())
+	}
+	return plan, nil
+}
+
+// Save replaces the plan in store with the plan built. Stores of plans that
+// expire must implement ExpiringPlanStore.
+func (b *PlanBuilder) Save(store PlanStore) error {
+	plan, err := b.Build()
+	if err != nil {
+		return err
+	}
+	expiresAt := b.expiry()
+	if expiresAt.IsZero() {
+		return store.Save(plan)
+	}
+	expiring, ok := store.(ExpiringPlanStore)
+	if !ok {
+		return errors.Errorf("Plan store %s doesn't support expiry", store)
+	}
+	return expiring.SaveUntil(plan, expiresAt)
+}
+
+// Write writes the plan built to the plan file at path
+func (b *PlanBuilder) Write(path string) error {
+	return b.Save(&FilePlanStore{Path: path})
+}
+
+// Install installs the plan built for the child process run by cmd, see
+// InstallPlan
+func (b *PlanBuilder) Install(cmd *exec.Cmd, path string) error {
+	if err := b.Write(path); err != nil {
+		return err
+	}
+	setPlanPath(cmd, path)
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestPlanBuilder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.BeforeMetadataMigration).Once().
+		Fail(failuregen.AfterMetadataMigration).
+		After(failuregen.BeforeMetadataMigration).Skip(1).Times(1).
+		Write(path))
+	bytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(
+		t,
+		`["BeforeMetadataMigration:once",`+
+			`"AfterMetadataMigration:skip=1:fail=1:after=BeforeMetadataMigration"]`,
+		string(bytes))
+
+	plan := &failuregen.AssuredFailurePlanImpl{PlanFilePath: path}
+	// AfterMetadataMigration waits for BeforeMetadataMigration to fire
+	require.NoError(t, plan.FailMaybe(failuregen.AfterMetadataMigration))
+	require.NoError(t, plan.FailMaybe(failuregen.AfterMetadataMigration))
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.BeforeMetadataMigration)))
+	require.NoError(t, plan.FailMaybe(failuregen.BeforeMetadataMigration))
+
+	// then skips a hit and fails the next
+	require.NoError(t, plan.FailMaybe(failuregen.AfterMetadataMigration))
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.AfterMetadataMigration)))
+	require.NoError(t, plan.FailMaybe(failuregen.AfterMetadataMigration))
+}
+
+func TestPlanBuilderErrors(t *testing.T) {
+	_, err := failuregen.NewPlanBuilder().Once().Build()
+	require.Error(t, err)
+
+	_, err = failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).Skip(-1).
+		Build()
+	require.Error(t, err)
+
+	store := &memPlanStore{}
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).
+		Save(store))
+	require.Equal(
+		t,
+		[]failuregen.FailurePoint{failuregen.SChTargetStateP1},
+		store.points)
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import "fmt"
+
+// Counted makes a plan entry (a failure-point or a pattern) skip the first
+// skip hits of the failure-point, fail the next fail hits, and pass the hits
+// after those, whereas other entries fail every hit. A fail of 0 fails every
+// hit after those skipped. This lets tests step through workflows hitting a
+// failure-point repeatedly (e.g. the steps of a schema change) to fail at a
+// given step. In a plan file the entry is written with ":skip=N" and
+// ":fail=M" suffixes, e.g. "SChTargetStateP1:skip=2:fail=1".
+//
+// Hits are counted per failure-point, and persisted along with the progress
+// of the plan when it has a StatePath.
+func Counted(entry FailurePoint, skip int64, fail int64) FailurePoint {
+	if skip > 0 {
+		entry += FailurePoint(fmt.Sprintf(":skip=%d", skip))
+	}
+	if fail > 0 {
+		entry += FailurePoint(fmt.Sprintf(":fail=%d", fail))
+	}
+	return entry
+}
+
+// countHitLocked counts a hit of fp and tells if it must fail as per rule,
+// firedMu must be held
+func (afp *AssuredFailurePlanImpl) countHitLocked(
+	fp FailurePoint,
+	rule entryRule,
+) bool {
+	if afp.hits == nil {
+		afp.hits = make(map[FailurePoint]int64)
+	}
+	afp.hits[fp]++
+	hit := afp.hits[fp]
+	return hit > rule.skip && (rule.fail == 0 || hit <= rule.skip+rule.fail)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestCountedFailurePoints(t *testing.T) {
+	store := &memPlanStore{points: []failuregen.FailurePoint{
+		failuregen.Counted(failuregen.SChTargetStateP1, 2, 3),
+		failuregen.Counted(failuregen.BeforeMetadataMigration, 1, 0),
+	}}
+	require.Equal(
+		t,
+		failuregen.FailurePoint("SChTargetStateP1:skip=2:fail=3"),
+		store.points[0])
+	plan := failuregen.NewAssuredFailurePlanWithStore(store)
+
+	var failed []bool
+	for i := 0; i < 7; i++ {
+		failed = append(failed, failuregen.IsInjected(
+			plan.FailMaybe(failuregen.SChTargetStateP1)))
+	}
+	require.Equal(
+		t,
+		[]bool{false, false, true, true, true, false, false},
+		failed)
+
+	// without a fail count every hit after those skipped fails
+	require.NoError(t, plan.FailMaybe(failuregen.BeforeMetadataMigration))
+	for i := 0; i < 3; i++ {
+		require.True(t, failuregen.IsInjected(
+			plan.FailMaybe(failuregen.BeforeMetadataMigration)))
+	}
+}
+
+func TestCountedFailurePointsResumeAfterRestart(t *testing.T) {
+	store := &memPlanStore{points: []failuregen.FailurePoint{
+		failuregen.Counted(failuregen.Once(failuregen.SChTargetStateC6), 1, 0),
+		failuregen.Counted(failuregen.SChTargetStateP1, 1, 2),
+	}}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	plan := failuregen.NewAssuredFailurePlanWithState(store, statePath)
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateP1))
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateP1)))
+
+	// the hits are persisted, and a counted failure-point fails as many
+	// times as configured despite the state
+	plan = failuregen.NewAssuredFailurePlanWithState(store, statePath)
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateP1)))
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateP1))
+
+	// suffixes combine
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateC6))
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateC6)))
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateC6))
+}
+
+func TestCountedPatterns(t *testing.T) {
+	registry := failuregen.NewRegistry()
+	registry.Register("store.Commit.before")
+	registry.Register("store.Commit.after")
+	afp := &failuregen.AssuredFailurePlanImpl{
+		Store: &memPlanStore{points: []failuregen.FailurePoint{
+			failuregen.Counted("/^store\\.Commit\\./", 1, 1),
+		}},
+		Registry: registry,
+	}
+	// hits are counted per failure-point
+	for _, fp := range []failuregen.FailurePoint{
+		"store.Commit.before",
+		"store.Commit.after",
+	} {
+		require.NoError(t, afp.FailMaybe(fp))
+		require.True(t, failuregen.IsInjected(afp.FailMaybe(fp)))
+		require.NoError(t, afp.FailMaybe(fp))
+	}
+}
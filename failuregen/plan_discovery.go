@@ -0,0 +1,42 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"os"
+	"os/exec"
+)
+
+// PlanPathEnv is the environment variable naming the plan file of
+// assured-failure-plans created by NewAssuredFailurePlan
+const PlanPathEnv = "FAILURE_PLAN_PATH"
+
+// PlanPath returns the path of the plan file: the value of PlanPathEnv if
+// set, DefaultPlanPath otherwise
+func PlanPath() string {
+	if path := os.Getenv(PlanPathEnv); path != "" {
+		return path
+	}
+	return DefaultPlanPath
+}
+
+// InstallPlan writes plan to the plan file at path and points cmd at it
+// through PlanPathEnv, so that the assured-failure-plans of the child process
+// (created by NewAssuredFailurePlan) follow it. cmd must not be started yet,
+// and inherits the environment of the current process if its Env is nil.
+func InstallPlan(cmd *exec.Cmd, path string, plan []FailurePoint) error {
+	store := &FilePlanStore{Path: path}
+	if err := store.Save(plan); err != nil {
+		return err
+	}
+	setPlanPath(cmd, path)
+	return nil
+}
+
+// setPlanPath points cmd at the plan file at path through PlanPathEnv
+func setPlanPath(cmd *exec.Cmd, path string) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, PlanPathEnv+"="+path)
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+const planChildEnv = "FAILUREGEN_PLAN_CHILD"
+
+func TestPlanPath(t *testing.T) {
+	t.Setenv(failuregen.PlanPathEnv, "")
+	require.Equal(t, failuregen.DefaultPlanPath, failuregen.PlanPath())
+	t.Setenv(failuregen.PlanPathEnv, "/tmp/plan.json")
+	require.Equal(t, "/tmp/plan.json", failuregen.PlanPath())
+	require.Equal(
+		t,
+		"/tmp/plan.json",
+		failuregen.NewAssuredFailurePlan().(*failuregen.AssuredFailurePlanImpl).
+			PlanFilePath)
+}
+
+func TestInstallPlan(t *testing.T) {
+	if os.Getenv(planChildEnv) != "" {
+		// the child process discovers the plan
+		err := failuregen.NewAssuredFailurePlan().FailMaybe(
+			failuregen.SChTargetStateP1)
+		if failuregen.IsInjected(err) {
+			os.Exit(3)
+		}
+		os.Exit(0)
+	}
+
+	run := func(plan *failuregen.PlanBuilder) error {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInstallPlan$")
+		cmd.Env = append(os.Environ(), planChildEnv+"=1")
+		path := filepath.Join(t.TempDir(), "plan.json")
+		require.NoError(t, plan.Install(cmd, path))
+		return cmd.Run()
+	}
+	var exitErr *exec.ExitError
+	require.ErrorAs(
+		t,
+		run(failuregen.NewPlanBuilder().Fail(failuregen.SChTargetStateP1)),
+		&exitErr)
+	require.Equal(t, 3, exitErr.ExitCode())
+	require.NoError(t, run(failuregen.NewPlanBuilder()))
+}
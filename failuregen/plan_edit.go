@@ -0,0 +1,60 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+// Plan returns the failure-points of the plan, as stored (i.e. with its
+// patterns unexpanded)
+func (afp *AssuredFailurePlanImpl) Plan() ([]FailurePoint, error) {
+	afp.editMu.RLock()
+	defer afp.editMu.RUnlock()
+	return afp.store().Load()
+}
+
+// EditPlan removes the failure-points in remove from the plan and appends
+// those in add which it doesn't hold yet, and returns the edited plan, so
+// that orchestrators can adapt the plan of a running process based on the
+// progress they observe. The edit is atomic with respect to FailMaybe calls:
+// those that read the plan before the edit fire as per the former plan, and
+// those that read it after fire as per the edited plan. Concurrent edits
+// through other plans sharing the store are serialized only if it is an
+// UpdatablePlanStore.
+func (afp *AssuredFailurePlanImpl) EditPlan(
+	add []FailurePoint,
+	remove []FailurePoint,
+) ([]FailurePoint, error) {
+	afp.editMu.Lock()
+	defer afp.editMu.Unlock()
+	var edited []FailurePoint
+	edit := func(current []FailurePoint) ([]FailurePoint, error) {
+		edited = editPoints(current, add, remove)
+		return edited, nil
+	}
+	if err := updatePlan(afp.store(), edit); err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// editPoints returns current without the failure-points in remove, and with
+// those in add which it doesn't hold
+func editPoints(current, add, remove []FailurePoint) []FailurePoint {
+	removed := make(map[FailurePoint]struct{}, len(remove))
+	for _, fp := range remove {
+		removed[fp] = struct{}{}
+	}
+	edited := make([]FailurePoint, 0, len(current)+len(add))
+	present := make(map[FailurePoint]struct{}, len(current)+len(add))
+	for _, fp := range current {
+		if _, ok := removed[fp]; !ok {
+			present[fp] = struct{}{}
+			edited = append(edited, fp)
+		}
+	}
+	for _, fp := range add {
+		if _, ok := present[fp]; !ok {
+			present[fp] = struct{}{}
+			edited = append(edited, fp)
+		}
+	}
+	return edited
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditPlan(t *testing.T) {
+	store := &memPlanStore{points: []failuregen.FailurePoint{"a", "b"}}
+	afp := failuregen.NewAssuredFailurePlanWithStore(
+		store,
+	).(*failuregen.AssuredFailurePlanImpl)
+
+	plan, err := afp.EditPlan(
+		[]failuregen.FailurePoint{"b", "c"},
+		[]failuregen.FailurePoint{"a"})
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{"b", "c"}, plan)
+	plan, err = afp.Plan()
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{"b", "c"}, plan)
+	require.NoError(t, afp.FailMaybe("a"))
+	require.Error(t, afp.FailMaybe("c"))
+}
+
+func TestEditPlanIsAtomicWithFailMaybe(t *testing.T) {
+	afp := failuregen.NewAssuredFailurePlanWithStore(
+		&memPlanStore{},
+	).(*failuregen.AssuredFailurePlanImpl)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = afp.FailMaybe("a")
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := afp.EditPlan([]failuregen.FailurePoint{"a"}, nil)
+		require.NoError(t, err)
+		_, err = afp.EditPlan(nil, []failuregen.FailurePoint{"a"})
+		require.NoError(t, err)
+		// once removed, the failure-point must not fire
+		require.NoError(t, afp.FailMaybe("a"))
+	}
+	close(stop)
+	wg.Wait()
+}
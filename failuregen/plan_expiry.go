@@ -0,0 +1,120 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// ExpiringPlan is a plan file that expires, so that a plan left behind by a
+// crashed test can't make the tests that follow on the same host fail. An
+// expired plan is treated as empty (see FilePlanStore.DeleteExpired). In a
+// plan file it is written as a JSON object, e.g.
+// {"FailurePoints": ["A", "B"], "ExpiresAt": "2024-06-01T12:00:00Z"}. A
+// PlanSelection object may carry an ExpiresAt field too.
+type ExpiringPlan struct {
+	FailurePoints []FailurePoint
+	ExpiresAt     time.Time
+}
+
+// expired tells if a plan expiring at expiresAt expired, a zero expiresAt
+// never does
+func expired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+// ExpiringPlanStore is a PlanStore able to save plans that expire
+type ExpiringPlanStore interface {
+	PlanStore
+	// SaveUntil replaces the plan with the given failure-points, expiring
+	// at expiresAt (never if zero)
+	SaveUntil(points []FailurePoint, expiresAt time.Time) error
+}
+
+// marshalPlan serializes a plan file, as an array of failure-points unless it
+// expires
+func marshalPlan(points []FailurePoint, expiresAt time.Time) ([]byte, error) {
+	if expiresAt.IsZero() {
+		return json.Marshal(points)
+	}
+	if points == nil {
+		points = []FailurePoint{}
+	}
+	return json.Marshal(ExpiringPlan{
+		FailurePoints: points,
+		ExpiresAt:     expiresAt.UTC(),
+	})
+}
+
+// SaveUntil writes the plan to the file, replacing it atomically, such that
+// it expires at expiresAt (never if zero)
+func (s *FilePlanStore) SaveUntil(
+	points []FailurePoint,
+	expiresAt time.Time,
+) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.saveUntil(points, expiresAt)
+}
+
+// saveUntil implements SaveUntil, the file must be locked
+func (s *FilePlanStore) saveUntil(
+	points []FailurePoint,
+	expiresAt time.Time,
+) error {
+	bytes, err := marshalPlan(points, expiresAt)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize assured-failure-plan")
+	}
+	tmpPath := s.Path + ".tmp"
+	if err := os.WriteFile(tmpPath, bytes, 0644); err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to write assured-failure-plan: %s",
+			tmpPath)
+	}
+	return errors.Wrapf(
+		os.Rename(tmpPath, s.Path),
+		"Failed to install assured-failure-plan: %s",
+		s.Path)
+}
+
+// expire handles the expiry of the plan file, deleting it if DeleteExpired
+// is set
+func (s *FilePlanStore) expire(expiresAt time.Time) {
+	if !s.DeleteExpired {
+		if log.V(2) {
+			log.Infof(
+				context.Background(),
+				"Ignoring assured-failure-plan %s, expired at %v",
+				s.Path,
+				expiresAt)
+		}
+		return
+	}
+	err := os.Remove(s.Path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warningf(
+			context.Background(),
+			"Failed to delete expired assured-failure-plan %s: %v",
+			s.Path,
+			err)
+		return
+	}
+	if err == nil {
+		log.Infof(
+			context.Background(),
+			"Deleted assured-failure-plan %s, expired at %v",
+			s.Path,
+			expiresAt)
+	}
+}
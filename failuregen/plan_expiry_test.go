@@ -0,0 +1,103 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestExpiringPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	store := &failuregen.FilePlanStore{Path: path}
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).
+		TTL(time.Hour).
+		Write(path))
+	plan, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{failuregen.SChTargetStateP1}, plan)
+
+	// saving keeps the expiry
+	require.NoError(t, store.Save([]failuregen.FailurePoint{
+		failuregen.SChTargetStateC6,
+	}))
+	bytes, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(bytes), `"ExpiresAt"`)
+
+	// expired plans are empty, and deleted if asked to
+	require.NoError(t, store.SaveUntil(
+		[]failuregen.FailurePoint{failuregen.SChTargetStateC6},
+		time.Now().Add(-time.Second)))
+	afp := &failuregen.AssuredFailurePlanImpl{Store: store}
+	require.NoError(t, afp.FailMaybe(failuregen.SChTargetStateC6))
+	require.FileExists(t, path)
+	store.DeleteExpired = true
+	plan, err = store.Load()
+	require.NoError(t, err)
+	require.Empty(t, plan)
+	require.NoFileExists(t, path)
+
+	// an expired plan doesn't pass its expiry on
+	require.NoError(t, store.SaveUntil(nil, time.Now().Add(-time.Second)))
+	store.DeleteExpired = false
+	require.NoError(t, store.Save([]failuregen.FailurePoint{
+		failuregen.SChTargetStateC6,
+	}))
+	plan, err = store.Load()
+	require.NoError(t, err)
+	require.Len(t, plan, 1)
+}
+
+func TestExpiringPlanFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	store := &failuregen.FilePlanStore{Path: path}
+	load := func(content string) ([]failuregen.FailurePoint, error) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return store.Load()
+	}
+	plan, err := load(`{"FailurePoints": ["A"], ` +
+		`"ExpiresAt": "2999-01-01T00:00:00Z"}`)
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{"A"}, plan)
+	plan, err = load(`{"Candidates": ["A", "B"], "Count": 1, ` +
+		`"ExpiresAt": "2000-01-01T00:00:00Z"}`)
+	require.NoError(t, err)
+	require.Empty(t, plan)
+	_, err = load(`{"FailurePoints": ["A"], "Candidates": ["B"]}`)
+	var malformed *failuregen.ErrMalformedPlan
+	require.ErrorAs(t, err, &malformed)
+}
+
+func TestWatchedExpiringPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	store, err := failuregen.NewWatchedFilePlanStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Stop()
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).
+		ExpiresAt(time.Now().Add(50*time.Millisecond)).
+		Save(store))
+	plan, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, plan, 1)
+	require.Eventually(t, func() bool {
+		plan, err := store.Load()
+		return err == nil && len(plan) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestExpiringPlanUnsupported(t *testing.T) {
+	builder := failuregen.NewPlanBuilder().Fail(failuregen.SChTargetStateP1)
+	require.NoError(t, builder.Save(&memPlanStore{}))
+	require.Error(t, builder.TTL(time.Minute).Save(&memPlanStore{}))
+	_, err := failuregen.NewPlanBuilder().TTL(-time.Minute).Build()
+	require.Error(t, err)
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// JournalPathEnv is the environment variable naming the journal file of
+	// assured-failure-plans created by NewAssuredFailurePlan, see Journal
+	JournalPathEnv = "FAILURE_JOURNAL_PATH"
+	// ProcessNameEnv is the environment variable naming the process in
+	// sequenced plans, see ProcessName
+	ProcessNameEnv = "FAILURE_PROCESS_NAME"
+)
+
+// JournalEntry records that a failure-point fired in a process
+type JournalEntry struct {
+	Process      string
+	FailurePoint FailurePoint
+	Time         time.Time
+}
+
+// Journal records the failure-points fired by the assured-failure-plans of
+// several processes, so that a plan shared by the processes can sequence
+// failures across them, e.g. fail a failure-point in process A only after
+// another failure-point fired in process B (see PlanBuilder.In and
+// PlanBuilder.AfterIn). Implementations may be backed by a shared file (see
+// FileJournal) or a coordination service.
+type Journal interface {
+	// Append records entry
+	Append(entry JournalEntry) error
+	// Load returns the entries recorded, in order. Absence of a journal is
+	// not an error and must yield no entries.
+	Load() ([]JournalEntry, error)
+	// String describes the location of the journal (used in error messages)
+	String() string
+}
+
+// FileJournal is a Journal backed by a file of JSON entries, one per line.
+// Entries are appended with a single write to a file opened in append mode,
+// so that processes sharing the file on local disk don't interleave them.
+type FileJournal struct {
+	Path string
+}
+
+// Append appends entry to the file, creating it if missing
+func (j *FileJournal) Append(entry JournalEntry) error {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize journal entry")
+	}
+	f, err := os.OpenFile(
+		j.Path,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0644)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"Failed to open failure journal: %s",
+			j.Path)
+	}
+	if _, err := f.Write(append(bytes, '\n')); err != nil {
+		f.Close()
+		return errors.Wrapf(
+			err,
+			"Failed to write failure journal: %s",
+			j.Path)
+	}
+	return errors.Wrapf(
+		f.Close(),
+		"Failed to close failure journal: %s",
+		j.Path)
+}
+
+// Load reads the entries of the file, a missing file has no entries. A torn
+// last line, being written by another process, is ignored.
+func (j *FileJournal) Load() ([]JournalEntry, error) {
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"Failed to read failure journal: %s",
+			j.Path)
+	}
+	defer f.Close()
+	var entries []JournalEntry
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// the last line is complete only once its newline is written
+			break
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Malformed failure journal: %s",
+				j.Path)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (j *FileJournal) String() string {
+	return j.Path
+}
+
+// ProcessName returns the name of the current process in sequenced plans:
+// the value of ProcessNameEnv if set, the base name of the executable
+// otherwise
+func ProcessName() string {
+	if name := os.Getenv(ProcessNameEnv); name != "" {
+		return name
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// InstallJournal points cmd at the journal file at path through
+// JournalPathEnv and names its process through ProcessNameEnv, so that the
+// assured-failure-plans of the child process (created by
+// NewAssuredFailurePlan) are sequenced with those of other processes sharing
+// the journal. cmd must not be started yet, and inherits the environment of
+// the current process if its Env is nil.
+func InstallJournal(cmd *exec.Cmd, path string, process string) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(
+		cmd.Env,
+		JournalPathEnv+"="+path,
+		ProcessNameEnv+"="+process)
+}
+
+// journal returns the journal named by JournalPathEnv, nil if not set
+func journal() Journal {
+	if path := os.Getenv(JournalPathEnv); path != "" {
+		return &FileJournal{Path: path}
+	}
+	return nil
+}
+
+// splitProcess splits "FP@process", as in ":after=" suffixes, into the
+// failure-point and the process, which is empty if not specified
+func splitProcess(s string) (FailurePoint, string) {
+	if i := strings.LastIndex(s, "@"); i > 0 {
+		return FailurePoint(s[:i]), s[i+1:]
+	}
+	return FailurePoint(s), ""
+}
+
+// process returns the name of the process the plan runs in
+func (afp *AssuredFailurePlanImpl) process() string {
+	if afp.Process != "" {
+		return afp.Process
+	}
+	return ProcessName()
+}
+
+// ownEntries drops the entries of an expanded plan which are restricted to
+// other processes (see PlanBuilder.In)
+func (afp *AssuredFailurePlanImpl) ownEntries(
+	expanded []FailurePoint,
+) ([]FailurePoint, error) {
+	process := afp.process()
+	own := expanded[:0:0]
+	for _, entry := range expanded {
+		_, suffix := splitEntry(entry)
+		rule, err := parseRule(suffix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid entry %s", entry)
+		}
+		if rule.in == "" || rule.in == process {
+			own = append(own, entry)
+		}
+	}
+	return own, nil
+}
+
+// afterFiredLocked tells if the failure-point the hits of which rule waits
+// for fired, in the process named by rule if any. Failure-points fired by
+// other processes are known through the Journal. firedMu must be held.
+func (afp *AssuredFailurePlanImpl) afterFiredLocked(
+	rule entryRule,
+) (bool, error) {
+	if rule.afterProcess == "" || rule.afterProcess == afp.process() {
+		if _, ok := afp.fired[rule.after]; ok {
+			return true, nil
+		}
+	}
+	if afp.Journal == nil {
+		return false, nil
+	}
+	entries, err := afp.Journal.Load()
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.FailurePoint == rule.after &&
+			(rule.afterProcess == "" || entry.Process == rule.afterProcess) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// journalLocked records in the Journal, if any, that fp fired. firedMu must
+// be held.
+func (afp *AssuredFailurePlanImpl) journalLocked(fp FailurePoint) error {
+	if afp.Journal == nil {
+		return nil
+	}
+	return afp.Journal.Append(JournalEntry{
+		Process:      afp.process(),
+		FailurePoint: fp,
+		Time:         time.Now(),
+	})
+}
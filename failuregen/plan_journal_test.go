@@ -0,0 +1,121 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestSequencedPlan(t *testing.T) {
+	dir := t.TempDir()
+	store := &failuregen.FilePlanStore{Path: filepath.Join(dir, "plan.json")}
+	journal := &failuregen.FileJournal{Path: filepath.Join(dir, "journal")}
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.BeforeMetadataMigration).In("node-b").
+		Fail(failuregen.AfterMetadataMigration).In("node-a").
+		AfterIn(failuregen.BeforeMetadataMigration, "node-b").
+		Save(store))
+	node := func(name string) *failuregen.AssuredFailurePlanImpl {
+		return &failuregen.AssuredFailurePlanImpl{
+			Store:   store,
+			Journal: journal,
+			Process: name,
+		}
+	}
+	a, b, c := node("node-a"), node("node-b"), node("node-c")
+
+	// entries are restricted to their process
+	require.NoError(t, a.FailMaybe(failuregen.BeforeMetadataMigration))
+	require.NoError(t, c.FailMaybe(failuregen.BeforeMetadataMigration))
+	require.NoError(t, c.FailMaybe(failuregen.AfterMetadataMigration))
+	// node-a waits for node-b
+	require.NoError(t, a.FailMaybe(failuregen.AfterMetadataMigration))
+	require.Error(t, b.FailMaybe(failuregen.BeforeMetadataMigration))
+	require.Error(t, a.FailMaybe(failuregen.AfterMetadataMigration))
+
+	entries, err := journal.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "node-b", entries[0].Process)
+	require.Equal(
+		t,
+		failuregen.FailurePoint(failuregen.BeforeMetadataMigration),
+		entries[0].FailurePoint)
+	require.Equal(t, "node-a", entries[1].Process)
+}
+
+func TestSequencedPlanAnyProcess(t *testing.T) {
+	dir := t.TempDir()
+	store := &failuregen.FilePlanStore{Path: filepath.Join(dir, "plan.json")}
+	journal := &failuregen.FileJournal{Path: filepath.Join(dir, "journal")}
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).In("node-b").
+		Fail(failuregen.SChTargetStateEM4).After(failuregen.SChTargetStateP1).
+		Save(store))
+	a := &failuregen.AssuredFailurePlanImpl{
+		Store: store, Journal: journal, Process: "node-a"}
+	b := &failuregen.AssuredFailurePlanImpl{
+		Store: store, Journal: journal, Process: "node-b"}
+
+	require.NoError(t, a.FailMaybe(failuregen.SChTargetStateEM4))
+	require.Error(t, b.FailMaybe(failuregen.SChTargetStateP1))
+	// with a journal, After is satisfied by any process
+	require.Error(t, a.FailMaybe(failuregen.SChTargetStateEM4))
+}
+
+func TestSequencedPlanInvalidProcess(t *testing.T) {
+	_, err := failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).In("a:b").
+		Build()
+	require.Error(t, err)
+}
+
+func TestFileJournalTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	journal := &failuregen.FileJournal{Path: path}
+	entries, err := journal.Load()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, journal.Append(failuregen.JournalEntry{
+		Process:      "node-a",
+		FailurePoint: failuregen.SChTargetStateP1,
+	}))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"Process":"node-b"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	entries, err = journal.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestInstallJournal(t *testing.T) {
+	t.Setenv(failuregen.JournalPathEnv, "")
+	t.Setenv(failuregen.ProcessNameEnv, "")
+	afp := failuregen.NewAssuredFailurePlan()
+	require.Nil(t, afp.(*failuregen.AssuredFailurePlanImpl).Journal)
+	require.Equal(t, filepath.Base(os.Args[0]), failuregen.ProcessName())
+
+	cmd := exec.Command("true")
+	failuregen.InstallJournal(cmd, "/tmp/journal", "node-a")
+	require.Contains(t, cmd.Env, failuregen.JournalPathEnv+"=/tmp/journal")
+	require.Contains(t, cmd.Env, failuregen.ProcessNameEnv+"=node-a")
+
+	t.Setenv(failuregen.JournalPathEnv, "/tmp/journal")
+	t.Setenv(failuregen.ProcessNameEnv, "node-a")
+	require.Equal(t, "node-a", failuregen.ProcessName())
+	afp = failuregen.NewAssuredFailurePlan()
+	require.Equal(
+		t,
+		&failuregen.FileJournal{Path: "/tmp/journal"},
+		afp.(*failuregen.AssuredFailurePlanImpl).Journal)
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PlanMatrix returns the plans needed to systematically fail a workflow at
+// every step: one plan per failure-point followed by one plan per pair of
+// failure-points, in the order of points
+func PlanMatrix(points []FailurePoint) [][]FailurePoint {
+	plans := make([][]FailurePoint, 0, len(points)*(len(points)+1)/2)
+	for _, fp := range points {
+		plans = append(plans, []FailurePoint{fp})
+	}
+	for i := range points {
+		for j := i + 1; j < len(points); j++ {
+			plans = append(plans, []FailurePoint{points[i], points[j]})
+		}
+	}
+	return plans
+}
+
+// WritePlanMatrix writes every plan of PlanMatrix(points) to its own plan
+// file in dir, named after its index and failure-points, and returns the
+// paths of the files in matrix order
+func WritePlanMatrix(dir string, points []FailurePoint) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create plan directory %s", dir)
+	}
+	plans := PlanMatrix(points)
+	paths := make([]string, 0, len(plans))
+	for i, plan := range plans {
+		names := make([]string, len(plan))
+		for j, fp := range plan {
+			names[j] = string(fp)
+		}
+		path := filepath.Join(
+			dir,
+			fmt.Sprintf("%03d-%s.json", i, strings.Join(names, "+")))
+		if err := (&FilePlanStore{Path: path}).Save(plan); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
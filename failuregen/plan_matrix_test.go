@@ -0,0 +1,44 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestPlanMatrixHasSinglesAndPairs(t *testing.T) {
+	a := failuregen.FailurePoint("a")
+	b := failuregen.FailurePoint("b")
+	c := failuregen.FailurePoint("c")
+
+	require.Equal(
+		t,
+		[][]failuregen.FailurePoint{{a}, {b}, {c}, {a, b}, {a, c}, {b, c}},
+		failuregen.PlanMatrix([]failuregen.FailurePoint{a, b, c}))
+	require.Empty(t, failuregen.PlanMatrix(nil))
+}
+
+func TestWritePlanMatrix(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "plans")
+	paths, err := failuregen.WritePlanMatrix(dir, knownFailures)
+	require.NoError(t, err)
+	n := len(knownFailures)
+	require.Len(t, paths, n+n*(n-1)/2)
+	require.Equal(
+		t,
+		filepath.Join(dir, "000-SChTargetStateP1.json"),
+		paths[0])
+
+	// every written plan is usable as an assured-failure-plan
+	last := paths[len(paths)-1]
+	afp := failuregen.NewAssuredFailurePlanWithStore(
+		&failuregen.FilePlanStore{Path: last})
+	require.Error(t, afp.FailMaybe(knownFailures[n-2]))
+	require.Error(t, afp.FailMaybe(knownFailures[n-1]))
+	require.NoError(t, afp.FailMaybe(knownFailures[0]))
+}
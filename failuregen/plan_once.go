@@ -0,0 +1,211 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// onceSuffix marks a one-shot plan entry, see Once
+	onceSuffix FailurePoint = ":once"
+	// consumedSuffix marks a one-shot plan entry that fired
+	consumedSuffix FailurePoint = ":consumed"
+)
+
+// Once marks a plan entry (a failure-point or a pattern) as one-shot: the
+// failure-point fails the first time it is reached only, e.g. to inject
+// exactly one crash per failure-point in crash-recovery tests, whereas other
+// entries fail every time they are reached. In a plan file the entry is
+// written with a ":once" suffix, e.g. "SChTargetStateP1:once".
+//
+// A one-shot entry is consumed by appending a ":consumed" entry for the
+// failure-point to the plan in its store, before the failure is injected, so
+// that it doesn't fire again after a restart of the process (or in other
+// processes sharing the store, if it is an UpdatablePlanStore). Removing the
+// ":consumed" entry re-arms it.
+func Once(entry FailurePoint) FailurePoint {
+	return entry + onceSuffix
+}
+
+// entrySuffix matches the suffixes of a plan entry: ":once" (see Once),
+// ":consumed", ":skip=N" and ":fail=M" (see Counted), ":after=FP" and
+// ":after=FP@process" (see PlanBuilder.After and PlanBuilder.AfterIn),
+// ":in=process" (see PlanBuilder.In), ":p=P" (see Sampled) and actions (see
+// Action)
+var entrySuffix = regexp.MustCompile(
+	`(:(once|consumed|skip=[0-9]{1,18}|fail=[0-9]{1,18}|after=[^:]+|in=[^:]+|` +
+		`p=[0-9.e-]+|` +
+		`error=[^:]*|delay=[0-9][0-9.a-zµ]*|panic|exit=[0-9]{1,3}))+$`)
+
+// splitEntry splits a plan entry into the failure-point (or pattern) and its
+// suffixes, which are empty for entries failing every time
+func splitEntry(entry FailurePoint) (FailurePoint, FailurePoint) {
+	loc := entrySuffix.FindStringIndex(string(entry))
+	if loc == nil || loc[0] == 0 {
+		return entry, ""
+	}
+	return entry[:loc[0]], entry[loc[0]:]
+}
+
+// entryRule is how a failure-point of the plan fails, as per the suffixes of
+// its entry
+type entryRule struct {
+	once     bool
+	consumed bool
+	// skip is the number of hits passing before the failure-point fails
+	skip int64
+	// fail is the number of hits failing after those skipped, 0 meaning
+	// every hit fails
+	fail int64
+	// after is the failure-point which must fire before hits are counted
+	after FailurePoint
+	// afterProcess is the process in which after must fire, any process if
+	// empty
+	afterProcess string
+	// in is the process the entry is restricted to, any process if empty
+	in string
+	// sampled entries fail hits with a probability of failPPM per million
+	// only (see Sampled)
+	sampled bool
+	failPPM int32
+	// action is taken when the failure-point fires
+	action Action
+}
+
+// counted tells if the failure-point fails on some hits only
+func (r entryRule) counted() bool {
+	return r.skip > 0 || r.fail > 0
+}
+
+// parseRule parses the suffixes of a plan entry
+func parseRule(suffix FailurePoint) (entryRule, error) {
+	var rule entryRule
+	var err error
+	for _, s := range strings.Split(string(suffix), ":") {
+		switch {
+		case s == "once":
+			rule.once = true
+		case s == "consumed":
+			rule.consumed = true
+		case strings.HasPrefix(s, "skip="):
+			rule.skip, err = strconv.ParseInt(s[len("skip="):], 10, 64)
+		case strings.HasPrefix(s, "fail="):
+			rule.fail, err = strconv.ParseInt(s[len("fail="):], 10, 64)
+		case strings.HasPrefix(s, "after="):
+			rule.after, rule.afterProcess = splitProcess(s[len("after="):])
+		case strings.HasPrefix(s, "in="):
+			rule.in = s[len("in="):]
+		case strings.HasPrefix(s, "p="):
+			rule.failPPM, err = parseProbability(s[len("p="):])
+			rule.sampled = true
+		default:
+			var action Action
+			var ok bool
+			if action, ok, err = parseAction(s); ok {
+				rule.action = action
+			}
+		}
+		if err != nil {
+			return entryRule{}, errors.Wrapf(err, "Invalid suffix %q", s)
+		}
+	}
+	return rule, nil
+}
+
+// checkRules checks that the suffixes of the entries of a plan parse
+func checkRules(entries []FailurePoint) error {
+	for _, entry := range entries {
+		_, suffix := splitEntry(entry)
+		if _, err := parseRule(suffix); err != nil {
+			return errors.Wrapf(err, "Invalid entry %s", entry)
+		}
+	}
+	return nil
+}
+
+// resolvePlan returns the failure-points slated for failure by an expanded
+// plan, and how each of them fails. An entry failing every time takes
+// precedence over other entries of the failure-point, and a one-shot
+// failure-point is no longer slated for failure once consumed.
+func resolvePlan(expanded []FailurePoint) (
+	[]FailurePoint,
+	map[FailurePoint]entryRule,
+	error,
+) {
+	rules := make(map[FailurePoint]entryRule)
+	consumed := make(map[FailurePoint]bool)
+	var order []FailurePoint
+	for _, entry := range expanded {
+		fp, suffix := splitEntry(entry)
+		rule, err := parseRule(suffix)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Invalid entry %s", entry)
+		}
+		if rule.consumed {
+			consumed[fp] = true
+			continue
+		}
+		_, ok := rules[fp]
+		if !ok {
+			order = append(order, fp)
+		}
+		if !ok || rule == (entryRule{}) {
+			rules[fp] = rule
+		}
+	}
+	var failurePoints []FailurePoint
+	for _, fp := range order {
+		if rules[fp].once && consumed[fp] {
+			delete(rules, fp)
+			continue
+		}
+		failurePoints = append(failurePoints, fp)
+	}
+	return failurePoints, rules, nil
+}
+
+// errConsumed is returned by the update of a plan consuming a one-shot
+// failure-point consumed already
+var errConsumed = errors.New("Failure-point consumed already")
+
+// consumeLocked marks the one-shot failure-point fp consumed in the plan in
+// store and fired. It returns false if fp was consumed already (e.g. by a
+// concurrent call), in which case no failure must be injected. Processes
+// sharing the store consume fp once in all only if the store is an
+// UpdatablePlanStore. firedMu must be held.
+func (afp *AssuredFailurePlanImpl) consumeLocked(
+	store PlanStore,
+	fp FailurePoint,
+) (int64, bool, error) {
+	if _, ok := afp.consumed[fp]; ok {
+		return 0, false, nil
+	}
+	if afp.consumed == nil {
+		afp.consumed = make(map[FailurePoint]struct{})
+	}
+	// the plan must be saved before the failure is injected, as the failure
+	// may crash the process
+	consume := func(current []FailurePoint) ([]FailurePoint, error) {
+		for _, entry := range current {
+			if entry == fp+consumedSuffix {
+				return nil, errConsumed
+			}
+		}
+		return append(current, fp+consumedSuffix), nil
+	}
+	err := updatePlan(store, consume)
+	if errors.Is(err, errConsumed) {
+		afp.consumed[fp] = struct{}{}
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	afp.consumed[fp] = struct{}{}
+	return afp.fireLocked(fp)
+}
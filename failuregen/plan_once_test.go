@@ -0,0 +1,156 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestOnceFailurePoints(t *testing.T) {
+	store := &memPlanStore{points: []failuregen.FailurePoint{
+		failuregen.Once(failuregen.SChTargetStateP1),
+		failuregen.BeforeMetadataMigration,
+	}}
+
+	// a one-shot failure-point fails the first time only
+	plan := failuregen.NewAssuredFailurePlanWithStore(store)
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateP1)))
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateP1))
+
+	// other failure-points fail every time
+	for i := 0; i < 2; i++ {
+		require.True(t, failuregen.IsInjected(
+			plan.FailMaybe(failuregen.BeforeMetadataMigration)))
+	}
+
+	// the consumption is persisted to the plan, so it survives a restart
+	stored, err := store.Load()
+	require.NoError(t, err)
+	require.Contains(
+		t,
+		stored,
+		failuregen.FailurePoint("SChTargetStateP1:consumed"))
+	plan = failuregen.NewAssuredFailurePlanWithStore(store)
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateP1))
+	pending, err := plan.(*failuregen.AssuredFailurePlanImpl).
+		PendingFailurePoints()
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]failuregen.FailurePoint{failuregen.BeforeMetadataMigration},
+		pending)
+
+	// removing the consumed entry re-arms the failure-point
+	_, err = plan.(*failuregen.AssuredFailurePlanImpl).EditPlan(
+		nil,
+		[]failuregen.FailurePoint{"SChTargetStateP1:consumed"})
+	require.NoError(t, err)
+	require.True(t, failuregen.IsInjected(
+		plan.FailMaybe(failuregen.SChTargetStateP1)))
+}
+
+func TestOncePatterns(t *testing.T) {
+	registry := failuregen.NewRegistry()
+	registry.Register("store.Commit.before")
+	registry.Register("store.Commit.after")
+	store := &memPlanStore{points: []failuregen.FailurePoint{
+		failuregen.Once("store.Commit.*"),
+		"store.Commit.after",
+	}}
+	afp := &failuregen.AssuredFailurePlanImpl{
+		Store:    store,
+		Registry: registry,
+	}
+
+	// each failure-point matched by the pattern is consumed on its own, and
+	// an entry failing every time takes precedence
+	require.True(t, failuregen.IsInjected(afp.FailMaybe("store.Commit.before")))
+	require.NoError(t, afp.FailMaybe("store.Commit.before"))
+	for i := 0; i < 2; i++ {
+		require.True(t, failuregen.IsInjected(
+			afp.FailMaybe("store.Commit.after")))
+	}
+
+	require.NoError(t, failuregen.ValidatePlan(
+		[]failuregen.FailurePoint{failuregen.Once("store.Commit.after")},
+		registry.Points()))
+}
+
+// sharedPlanStores returns factories of stores sharing a single plan, each
+// store standing for another process
+func sharedPlanStores(t *testing.T) map[string]func() failuregen.UpdatablePlanStore {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	kv, _ := startFakeConsul(t)
+	return map[string]func() failuregen.UpdatablePlanStore{
+		"file": func() failuregen.UpdatablePlanStore {
+			return &failuregen.FilePlanStore{Path: path}
+		},
+		"consul": func() failuregen.UpdatablePlanStore {
+			return &failuregen.ConsulPlanStore{KV: kv, Key: "chaos/plan"}
+		},
+	}
+}
+
+func TestPlanStoreUpdatesAreNotLost(t *testing.T) {
+	for name, newStore := range sharedPlanStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					require.NoError(t, newStore().Update(
+						func(current []failuregen.FailurePoint) (
+							[]failuregen.FailurePoint,
+							error,
+						) {
+							fp := failuregen.FailurePoint(fmt.Sprint("fp.", i))
+							return append(current, fp), nil
+						}))
+				}(i)
+			}
+			wg.Wait()
+			points, err := newStore().Load()
+			require.NoError(t, err)
+			require.Len(t, points, 8)
+		})
+	}
+}
+
+func TestOnceFailurePointsAcrossProcesses(t *testing.T) {
+	for name, newStore := range sharedPlanStores(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, newStore().Save([]failuregen.FailurePoint{
+				failuregen.Once(failuregen.SChTargetStateP1),
+			}))
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			injected := 0
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					plan := failuregen.NewAssuredFailurePlanWithStore(newStore())
+					err := plan.FailMaybe(failuregen.SChTargetStateP1)
+					if failuregen.IsInjected(err) {
+						mu.Lock()
+						injected++
+						mu.Unlock()
+					} else {
+						require.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+			require.Equal(t, 1, injected)
+		})
+	}
+}
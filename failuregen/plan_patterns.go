@@ -0,0 +1,84 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// isPattern tells if a plan entry is a pattern rather than a failure-point.
+// Globs (e.g. "SChTargetState*") use the syntax of path.Match, regular
+// expressions are enclosed in slashes (e.g. "/^SChTargetState(P1|C6)$/").
+func isPattern(entry FailurePoint) bool {
+	return strings.ContainsAny(string(entry), "*?[") || isRegexp(entry)
+}
+
+func isRegexp(entry FailurePoint) bool {
+	return len(entry) > 2 && entry[0] == '/' && entry[len(entry)-1] == '/'
+}
+
+// matcher returns the match function of a pattern
+func matcher(pattern FailurePoint) (func(FailurePoint) bool, error) {
+	if isRegexp(pattern) {
+		re, err := regexp.Compile(string(pattern[1 : len(pattern)-1]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern %s", pattern)
+		}
+		return func(fp FailurePoint) bool {
+			return re.MatchString(string(fp))
+		}, nil
+	}
+	if _, err := path.Match(string(pattern), ""); err != nil {
+		return nil, errors.Wrapf(err, "Invalid pattern %s", pattern)
+	}
+	return func(fp FailurePoint) bool {
+		ok, _ := path.Match(string(pattern), string(fp))
+		return ok
+	}, nil
+}
+
+// ExpandPlan replaces the patterns in the plan with the known failure-points
+// they match. A pattern matching no failure-point yields an
+// ErrUnknownFailurePoint naming the pattern. Failure-points that are not
+// patterns are kept as is, and the expansion has no duplicates. The suffixes
+// of a pattern (see Once and Counted) are carried over to the failure-points
+// it expands to.
+func ExpandPlan(plan []FailurePoint, known []FailurePoint) (
+	[]FailurePoint,
+	error,
+) {
+	var expanded []FailurePoint
+	seen := make(map[FailurePoint]struct{})
+	add := func(fp FailurePoint) {
+		if _, ok := seen[fp]; !ok {
+			seen[fp] = struct{}{}
+			expanded = append(expanded, fp)
+		}
+	}
+	for _, entry := range plan {
+		pattern, suffix := splitEntry(entry)
+		if !isPattern(pattern) {
+			add(entry)
+			continue
+		}
+		match, err := matcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matched := false
+		for _, fp := range known {
+			if match(fp) {
+				matched = true
+				add(fp + suffix)
+			}
+		}
+		if !matched {
+			return nil, errors.WithStack(&ErrUnknownFailurePoint{Name: pattern})
+		}
+	}
+	return expanded, nil
+}
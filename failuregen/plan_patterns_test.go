@@ -0,0 +1,82 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandPlan(t *testing.T) {
+	known := []failuregen.FailurePoint{
+		"store.Commit.before",
+		"store.Commit.after",
+		"store.Flush.before",
+		"rpc.Send.before",
+	}
+
+	expanded, err := failuregen.ExpandPlan(
+		[]failuregen.FailurePoint{
+			"store.Commit.*",
+			"/^rpc\\./",
+			"store.Commit.before",
+			"not.registered.but.literal",
+		},
+		known)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]failuregen.FailurePoint{
+			"store.Commit.before",
+			"store.Commit.after",
+			"rpc.Send.before",
+			"not.registered.but.literal",
+		},
+		expanded)
+
+	_, err = failuregen.ExpandPlan(
+		[]failuregen.FailurePoint{"store.Compact.*"},
+		known)
+	var unknownErr *failuregen.ErrUnknownFailurePoint
+	require.True(t, errors.As(err, &unknownErr))
+	require.Equal(t, failuregen.FailurePoint("store.Compact.*"), unknownErr.Name)
+	_, err = failuregen.ExpandPlan(
+		[]failuregen.FailurePoint{"store.Compact.*:once"},
+		known)
+	require.True(t, errors.As(err, &unknownErr))
+	require.Equal(t, failuregen.FailurePoint("store.Compact.*"), unknownErr.Name)
+
+	_, err = failuregen.ExpandPlan([]failuregen.FailurePoint{"/(/"}, known)
+	require.Error(t, err)
+	_, err = failuregen.ExpandPlan([]failuregen.FailurePoint{"[a"}, known)
+	require.Error(t, err)
+}
+
+func TestAssuredFailurePlanPatterns(t *testing.T) {
+	afp := AssureFailuresAt(t, "SChTargetState*")
+	for _, fp := range knownFailures {
+		err := afp.FailMaybe(fp)
+		if len(fp) > 14 && fp[:14] == "SChTargetState" {
+			require.Error(t, err, fp)
+		} else {
+			require.NoError(t, err, fp)
+		}
+	}
+
+	registry := failuregen.NewRegistry()
+	registry.Register("store.Commit.before")
+	afp = AssureFailuresAt(t, "/Commit/", "store.Flush.*")
+	afp.(*failuregen.AssuredFailurePlanImpl).Registry = registry
+	var unknownErr *failuregen.ErrUnknownFailurePoint
+	require.True(
+		t,
+		errors.As(afp.FailMaybe("store.Commit.before"), &unknownErr))
+
+	registry.Register("store.Flush.sync")
+	require.Error(t, afp.FailMaybe("store.Commit.before"))
+	require.Error(t, afp.FailMaybe("store.Flush.sync"))
+	require.NoError(t, afp.FailMaybe("store.Flush.other"))
+}
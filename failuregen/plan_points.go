@@ -0,0 +1,107 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// planVersion2 is the version of structured plan files, see PlanPoint
+const planVersion2 = 2
+
+// PlanPoint is a failure-point of a structured plan file, which describes
+// how each failure-point fails rather than listing plan entries. It merges
+// the probabilistic and assured models: a failure-point can fail hits with a
+// probability, as a FailureGenerator would, for a number of hits, as an
+// assured entry would. In a plan file it is written in the Points of a
+// version 2 object, e.g.
+//
+//	{"Version": 2, "Points": [
+//		{"Name": "A", "Probability": 0.1, "MaxHits": 3},
+//		{"Name": "B", "Delay": "250ms"}]}
+//
+// Plan files with a .yaml or .yml extension may be written as YAML, e.g.
+//
+//	version: 2
+//	points:
+//	- name: A
+//	  probability: 0.1
+//	  maxHits: 3
+//
+// Version 2 objects may carry an ExpiresAt field too (see ExpiringPlan).
+type PlanPoint struct {
+	// Name is the failure-point, or a pattern (see ExpandPlan)
+	Name FailurePoint
+	// Probability is that of failing hits (see Sampled), every hit fails if
+	// unset
+	Probability *float32
+	// MaxHits is the number of hits failing at most, unlimited if 0 (see
+	// Counted)
+	MaxHits int64
+	// Delay, when set, makes hits sleep for it rather than fail, as parsed
+	// by time.ParseDuration (see Action)
+	Delay string
+}
+
+// entry returns the plan entry of the failure-point
+func (p PlanPoint) entry() (FailurePoint, error) {
+	if p.Name == "" {
+		return "", errors.New("Plan point has no name")
+	}
+	b := NewPlanBuilder().Fail(p.Name).Times(p.MaxHits)
+	if p.Probability != nil {
+		b.Probability(*p.Probability)
+	}
+	if p.Delay != "" {
+		delay, err := time.ParseDuration(p.Delay)
+		if err != nil {
+			return "", errors.Wrapf(err, "Invalid delay for %s", p.Name)
+		}
+		b.Delay(delay)
+	}
+	plan, err := b.Build()
+	if err != nil {
+		return "", err
+	}
+	return plan[0], nil
+}
+
+// pointEntries returns the plan entries of a structured plan
+func pointEntries(points []PlanPoint) ([]FailurePoint, error) {
+	entries := make([]FailurePoint, 0, len(points))
+	for _, p := range points {
+		entry, err := p.entry()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isYAMLPlan tells if the plan file at path is written as YAML
+func isYAMLPlan(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// yamlToJSON converts a plan file written as YAML to JSON, for parsePlan
+func yamlToJSON(bytes []byte) ([]byte, error) {
+	var plan interface{}
+	if err := yaml.Unmarshal(bytes, &plan); err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, nil
+	}
+	return json.Marshal(plan)
+}
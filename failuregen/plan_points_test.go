@@ -0,0 +1,117 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestPlanPoints(t *testing.T) {
+	dir := t.TempDir()
+	load := func(name string, content string) ([]failuregen.FailurePoint, error) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return (&failuregen.FilePlanStore{Path: path}).Load()
+	}
+	plan, err := load("plan.json", `{"Version": 2, "Points": [
+		{"Name": "A", "Probability": 0.5, "MaxHits": 3},
+		{"Name": "B", "Delay": "250ms"},
+		{"Name": "C"}]}`)
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{
+		"A:fail=3:p=0.5", "B:delay=250ms", "C",
+	}, plan)
+
+	plan, err = load("plan.yaml", `
+version: 2
+expiresAt: 2000-01-01T00:00:00Z
+points:
+- name: A
+`)
+	require.NoError(t, err)
+	require.Empty(t, plan)
+
+	// YAML plans need not be structured
+	plan, err = load("plan.yml", "- A\n- B:once\n")
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{"A", "B:once"}, plan)
+	plan, err = load("plan.yml", "")
+	require.NoError(t, err)
+	require.Empty(t, plan)
+
+	var malformed *failuregen.ErrMalformedPlan
+	for _, content := range []string{
+		`{"Version": 3, "Points": [{"Name": "A"}]}`,
+		`{"Points": [{"Name": "A"}]}`,
+		`{"Version": 2, "FailurePoints": ["A"]}`,
+		`{"Version": 2, "Points": [{"Probability": 0.5}]}`,
+		`{"Version": 2, "Points": [{"Name": "A", "Probability": 2}]}`,
+		`{"Version": 2, "Points": [{"Name": "A", "MaxHits": -1}]}`,
+		`{"Version": 2, "Points": [{"Name": "A", "Delay": "soon"}]}`,
+	} {
+		_, err = load("plan.json", content)
+		require.True(t, errors.As(err, &malformed), content)
+	}
+	_, err = load("plan.yaml", "version: [2")
+	require.True(t, errors.As(err, &malformed))
+}
+
+func TestPlanPointsFail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 2
+points:
+- name: Never
+  probability: 0
+- name: Always
+  probability: 1
+  maxHits: 2
+- name: Slow
+  delay: 1ms
+`), 0644))
+	plan := &failuregen.AssuredFailurePlanImpl{
+		Store: &failuregen.FilePlanStore{Path: path},
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, plan.FailMaybe("Never"))
+		require.NoError(t, plan.FailMaybe("Slow"))
+	}
+	require.Error(t, plan.FailMaybe("Always"))
+	require.Error(t, plan.FailMaybe("Always"))
+	require.NoError(t, plan.FailMaybe("Always"))
+}
+
+func TestSampledPlanEntry(t *testing.T) {
+	entries, err := failuregen.NewPlanBuilder().
+		Fail("A").Probability(0.25).Times(1).
+		Fail("B").Probability(0).
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{
+		"A:fail=1:p=0.25", "B:p=0",
+	}, entries)
+	_, err = failuregen.NewPlanBuilder().Fail("A").Probability(-1).Build()
+	require.Error(t, err)
+
+	store := &memPlanStore{}
+	require.NoError(t, store.Save([]failuregen.FailurePoint{
+		failuregen.Sampled("A", 0.5),
+	}))
+	plan := &failuregen.AssuredFailurePlanImpl{Store: store}
+	failed := 0
+	for i := 0; i < 1000; i++ {
+		if plan.FailMaybe("A") != nil {
+			failed++
+		}
+	}
+	require.InDelta(t, 500, failed, 100)
+	require.Equal(t, failuregen.FailurePoint("A:p=1e-05"),
+		failuregen.Sampled("A", 0.00001))
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+// Sampled makes a plan entry (a failure-point or a pattern) fail the hits of
+// the failure-point with probability p only, whereas other entries fail every
+// hit, so that a single plan can combine assured and probabilistic failures.
+// Hits passing the draw don't count as hits of the entry (see Counted), e.g.
+// Counted(Sampled(fp, 0.1), 0, 3) fails 3 hits at most, drawn with
+// probability 0.1. In a plan file the entry is written with a ":p=P" suffix,
+// e.g. "SChTargetStateP1:p=0.1".
+func Sampled(entry FailurePoint, p float32) FailurePoint {
+	return entry + ":p=" + FailurePoint(
+		strconv.FormatFloat(float64(p), 'g', -1, 32))
+}
+
+// parseProbability parses the value of a ":p=" suffix into the failure-ppm of
+// the entry
+func parseProbability(s string) (int32, error) {
+	p, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Invalid probability %q", s)
+	}
+	failPPM, err := ppm(float32(p))
+	return failPPM, errors.Wrapf(err, "Invalid probability %q", s)
+}
+
+// drawLocked tells if a hit of a sampled entry fails as per rule, firedMu
+// must be held
+func (afp *AssuredFailurePlanImpl) drawLocked(rule entryRule) bool {
+	if afp.randGen == nil {
+		afp.randGen = randutil.NewLockedRandGen(time.Now().UnixNano())
+	}
+	return afp.randGen.Int31n(OneMillion) < rule.failPPM
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PlanSelection is a plan that fails at exactly Count of the Candidates,
+// chosen seeded-randomly. It combines the determinism of assured plans (a
+// given seed always selects the same failure-points) with coverage variety
+// across runs using different seeds. In a plan file it is written as a JSON
+// object instead of an array of failure-points, e.g.
+// {"Candidates": ["A", "B", "C"], "Count": 2, "Seed": 42}
+type PlanSelection struct {
+	Candidates []FailurePoint
+	Count      int
+	Seed       int64
+}
+
+// Select returns the selected failure-points, in the order of Candidates
+func (s PlanSelection) Select() ([]FailurePoint, error) {
+	if s.Count < 0 || s.Count > len(s.Candidates) {
+		return nil, errors.Errorf(
+			"Can't select %d of %d candidate failure-points",
+			s.Count,
+			len(s.Candidates))
+	}
+	perm := rand.New(rand.NewSource(s.Seed)).Perm(len(s.Candidates))
+	chosen := make([]bool, len(s.Candidates))
+	for _, i := range perm[:s.Count] {
+		chosen[i] = true
+	}
+	selected := make([]FailurePoint, 0, s.Count)
+	for i, fp := range s.Candidates {
+		if chosen[i] {
+			selected = append(selected, fp)
+		}
+	}
+	return selected, nil
+}
+
+// planObject is the object form of a plan file, either an ExpiringPlan, a
+// PlanSelection or a version 2 plan (see PlanPoint)
+type planObject struct {
+	PlanSelection
+	FailurePoints []FailurePoint
+	ExpiresAt     time.Time
+	Version       int
+	Points        []PlanPoint
+}
+
+// parsePlan parses a plan file, which is either an array of failure-points,
+// an ExpiringPlan, a PlanSelection or a version 2 object. It returns the
+// failure-points and the expiry of the plan, zero if it doesn't expire.
+func parsePlan(bytes []byte) ([]FailurePoint, time.Time, error) {
+	failurePoints, expiresAt, err := decodePlan(bytes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if err := checkRules(failurePoints); err != nil {
+		return nil, time.Time{}, err
+	}
+	return failurePoints, expiresAt, nil
+}
+
+// decodePlan decodes the failure-points and the expiry of a plan file
+func decodePlan(bytes []byte) ([]FailurePoint, time.Time, error) {
+	var failurePoints []FailurePoint
+	err := json.Unmarshal(bytes, &failurePoints)
+	if err == nil {
+		return failurePoints, time.Time{}, nil
+	}
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Value != "object" {
+		return nil, time.Time{}, err
+	}
+	var object planObject
+	if err := json.Unmarshal(bytes, &object); err != nil {
+		return nil, time.Time{}, err
+	}
+	switch {
+	case object.Version == planVersion2:
+		if object.FailurePoints != nil || object.Candidates != nil {
+			return nil, time.Time{}, errors.New(
+				"Version 2 plan has failure-points or candidates")
+		}
+		entries, err := pointEntries(object.Points)
+		return entries, object.ExpiresAt, err
+	case object.Version != 0:
+		return nil, time.Time{}, errors.Errorf(
+			"Unsupported plan version %d",
+			object.Version)
+	case object.Points != nil:
+		return nil, time.Time{}, errors.New("Plan points require version 2")
+	}
+	if object.FailurePoints != nil {
+		if object.Candidates != nil {
+			return nil, time.Time{}, errors.New(
+				"Plan has both failure-points and candidates")
+		}
+		return object.FailurePoints, object.ExpiresAt, nil
+	}
+	selected, err := object.Select()
+	return selected, object.ExpiresAt, err
+}
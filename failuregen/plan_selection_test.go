@@ -0,0 +1,65 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestPlanSelectionIsSeeded(t *testing.T) {
+	candidates := []failuregen.FailurePoint{
+		failuregen.SChTargetStateP1,
+		failuregen.SChTargetStateUR2,
+		failuregen.SChTargetStateMT3,
+		failuregen.SChTargetStateEM4,
+		failuregen.SChTargetStateRR5,
+		failuregen.SChTargetStateC6,
+	}
+	seen := make(map[string]struct{})
+	for seed := int64(0); seed < 20; seed++ {
+		sel := failuregen.PlanSelection{
+			Candidates: candidates,
+			Count:      2,
+			Seed:       seed,
+		}
+		selected, err := sel.Select()
+		require.NoError(t, err)
+		require.Len(t, selected, 2)
+		again, err := sel.Select()
+		require.NoError(t, err)
+		require.Equal(t, selected, again)
+		seen[string(selected[0])+"+"+string(selected[1])] = struct{}{}
+	}
+	require.Greater(t, len(seen), 1)
+
+	_, err := failuregen.PlanSelection{Candidates: candidates, Count: 7}.Select()
+	require.Error(t, err)
+}
+
+func TestFilePlanStoreLoadsPlanSelection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"Candidates": ["A", "B", "C"], "Count": 2, "Seed": 42}`), 0644))
+
+	store := &failuregen.FilePlanStore{Path: path}
+	points, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+
+	plan := failuregen.NewAssuredFailurePlanWithStore(store)
+	err = plan.FailMaybe(points[0])
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"Candidates": ["A"], "Count": 2}`), 0644))
+	_, err = store.Load()
+	var malformed *failuregen.ErrMalformedPlan
+	require.True(t, errors.As(err, &malformed))
+}
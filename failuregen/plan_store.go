@@ -0,0 +1,188 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PlanStore abstracts the storage of an assured-failure-plan. The default
+// store is a file on local disk, but implementations backed by a shared
+// key-value store (such as ConsulPlanStore) let distributed test runners
+// share a single live-updatable plan. Their results are shared through a
+// StatsStore.
+type PlanStore interface {
+	// Load returns the failure-points slated for failure. Absence of a plan
+	// is not an error and must yield an empty plan.
+	Load() ([]FailurePoint, error)
+	// Save replaces the plan with the given failure-points
+	Save(points []FailurePoint) error
+	// String describes the location of the plan (used in error messages)
+	String() string
+}
+
+// UpdatablePlanStore is a PlanStore able to update its plan atomically, so
+// that updates by processes sharing the store are not lost (see
+// FilePlanStore and ConsulPlanStore)
+type UpdatablePlanStore interface {
+	PlanStore
+	// Update replaces the plan with the failure-points returned by update,
+	// given the current plan (empty if it expired), keeping its expiry. No
+	// other write of the plan happens in between, update may be called
+	// again if one was attempted. Nothing is written if update fails, its
+	// error is returned.
+	Update(update func(current []FailurePoint) ([]FailurePoint, error)) error
+}
+
+// updatePlan updates the plan in store as per update, atomically if store
+// is an UpdatablePlanStore
+func updatePlan(
+	store PlanStore,
+	update func(current []FailurePoint) ([]FailurePoint, error),
+) error {
+	if updatable, ok := store.(UpdatablePlanStore); ok {
+		return updatable.Update(update)
+	}
+	current, err := store.Load()
+	if err != nil {
+		return err
+	}
+	points, err := update(current)
+	if err != nil {
+		return err
+	}
+	return store.Save(points)
+}
+
+const (
+	// planLockPollInterval is the interval at which a locked plan file is
+	// checked for the lock to be released
+	planLockPollInterval = 5 * time.Millisecond
+	// planLockStaleAge is the age past which the lock of a plan file is
+	// deemed left behind by a crashed process, and broken
+	planLockStaleAge = 10 * time.Second
+)
+
+// FilePlanStore is a PlanStore backed by a JSON array of failure-points in a
+// file on local disk
+type FilePlanStore struct {
+	Path string
+	// DeleteExpired makes Load delete the plan file once it expired (see
+	// ExpiringPlan), rather than just ignore it
+	DeleteExpired bool
+}
+
+// Load reads the plan from the file. A missing or empty file is an empty
+// plan, as is an expired one. The file holds either an array of
+// failure-points, an ExpiringPlan, a PlanSelection or a version 2 plan (see
+// PlanPoint), as YAML if its extension is .yaml or .yml.
+func (s *FilePlanStore) Load() ([]FailurePoint, error) {
+	failurePoints, expiresAt, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if expired(expiresAt) {
+		s.expire(expiresAt)
+		return nil, nil
+	}
+	return failurePoints, nil
+}
+
+// load reads the plan and its expiry from the file, be it expired or not
+func (s *FilePlanStore) load() ([]FailurePoint, time.Time, error) {
+	bytes, err := os.ReadFile(s.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, time.Time{}, errors.Wrapf(
+			err,
+			"Failed to read assured-failure-plan: %s",
+			s.Path)
+	}
+	if len(bytes) != 0 && isYAMLPlan(s.Path) {
+		if bytes, err = yamlToJSON(bytes); err != nil {
+			return nil, time.Time{}, errors.WithStack(
+				newErrMalformedPlan(s.Path, err))
+		}
+	}
+	if len(bytes) == 0 {
+		return nil, time.Time{}, nil
+	}
+	failurePoints, expiresAt, err := parsePlan(bytes)
+	if err != nil {
+		return nil, time.Time{}, errors.WithStack(
+			newErrMalformedPlan(s.Path, err))
+	}
+	return failurePoints, expiresAt, nil
+}
+
+// lock locks the plan file against writes by other processes (and other
+// stores of the file), through a lock file next to it. It returns the
+// function unlocking it.
+func (s *FilePlanStore) lock() (func(), error) {
+	lockPath := s.Path + ".lock"
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrapf(
+				err,
+				"Failed to lock assured-failure-plan: %s",
+				s.Path)
+		}
+		info, err := os.Stat(lockPath)
+		if err == nil && time.Since(info.ModTime()) > planLockStaleAge {
+			os.Remove(lockPath)
+			continue
+		}
+		time.Sleep(planLockPollInterval)
+	}
+}
+
+// Save writes the plan to the file, replacing it atomically. The plan keeps
+// the expiry of the plan it replaces unless that one expired (see
+// SaveUntil).
+func (s *FilePlanStore) Save(points []FailurePoint) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, expiresAt, _ := s.load()
+	if expired(expiresAt) {
+		expiresAt = time.Time{}
+	}
+	return s.saveUntil(points, expiresAt)
+}
+
+// Update updates the plan in the file as per update, holding the lock of
+// the file meanwhile
+func (s *FilePlanStore) Update(
+	update func(current []FailurePoint) ([]FailurePoint, error),
+) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, expiresAt, err := s.load()
+	if err != nil {
+		return err
+	}
+	if expired(expiresAt) {
+		current, expiresAt = nil, time.Time{}
+	}
+	points, err := update(current)
+	if err != nil {
+		return err
+	}
+	return s.saveUntil(points, expiresAt)
+}
+
+func (s *FilePlanStore) String() string {
+	return s.Path
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+type memPlanStore struct {
+	sync.Mutex
+	points []failuregen.FailurePoint
+}
+
+func (s *memPlanStore) Load() ([]failuregen.FailurePoint, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.points, nil
+}
+
+func (s *memPlanStore) Save(points []failuregen.FailurePoint) error {
+	s.Lock()
+	defer s.Unlock()
+	s.points = points
+	return nil
+}
+
+func (s *memPlanStore) String() string {
+	return "memory"
+}
+
+func TestFilePlanStoreRoundTrip(t *testing.T) {
+	store := &failuregen.FilePlanStore{
+		Path: filepath.Join(t.TempDir(), "plan.json"),
+	}
+
+	points, err := store.Load()
+	require.NoError(t, err)
+	require.Empty(t, points)
+
+	planned := []failuregen.FailurePoint{
+		failuregen.SChTargetStateP1,
+		failuregen.AfterMetadataMigration,
+	}
+	require.NoError(t, store.Save(planned))
+	points, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, planned, points)
+}
+
+func TestAssuredFailurePlanUsesCustomStore(t *testing.T) {
+	store := &memPlanStore{}
+	afp := failuregen.NewAssuredFailurePlanWithStore(store)
+
+	require.NoError(t, afp.FailMaybe(failuregen.SChTargetStateC6))
+
+	// the plan is live-updatable through the store
+	require.NoError(t, store.Save(
+		[]failuregen.FailurePoint{failuregen.SChTargetStateC6}))
+	require.Error(t, afp.FailMaybe(failuregen.SChTargetStateC6))
+	require.NoError(t, afp.FailMaybe(failuregen.SChTargetStateP1))
+}
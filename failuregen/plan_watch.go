@@ -0,0 +1,168 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// WatchedFilePlanStore is a FilePlanStore which caches the plan, rather than
+// reading the file on every Load, and checks the file for changes
+// periodically, so that an external controller can add or remove
+// failure-points while a long test runs. A change is noticed when the file is
+// replaced (as by FilePlanStore.Save) or its size or modification time
+// changes.
+type WatchedFilePlanStore struct {
+	FilePlanStore
+	mu     sync.Mutex
+	points []FailurePoint
+	// expiresAt is the expiry of points, zero if they don't expire
+	expiresAt time.Time
+	// info describes the file last loaded, nil if there was none
+	info os.FileInfo
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewWatchedFilePlanStore creates a store of the plan file at path, checking
+// it for changes every pollInterval. A missing file is an empty plan, a
+// malformed one is an error (later, malformed changes are logged and
+// ignored).
+func NewWatchedFilePlanStore(
+	path string,
+	pollInterval time.Duration,
+) (*WatchedFilePlanStore, error) {
+	s := &WatchedFilePlanStore{
+		FilePlanStore: FilePlanStore{Path: path},
+		quit:          make(chan struct{}),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.watch(pollInterval)
+	return s, nil
+}
+
+// Load returns the plan as of the last change of the file picked up, an
+// empty plan once it expired
+func (s *WatchedFilePlanStore) Load() ([]FailurePoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expired(s.expiresAt) {
+		s.FilePlanStore.expire(s.expiresAt)
+		s.points, s.expiresAt = nil, time.Time{}
+		return nil, nil
+	}
+	return append([]FailurePoint(nil), s.points...), nil
+}
+
+// Save writes the plan to the file, it is picked up right away
+func (s *WatchedFilePlanStore) Save(points []FailurePoint) error {
+	if err := s.FilePlanStore.Save(points); err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+// SaveUntil writes the plan, expiring at expiresAt, to the file, it is
+// picked up right away
+func (s *WatchedFilePlanStore) SaveUntil(
+	points []FailurePoint,
+	expiresAt time.Time,
+) error {
+	if err := s.FilePlanStore.SaveUntil(points, expiresAt); err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+// Update updates the plan in the file as per update, it is picked up right
+// away
+func (s *WatchedFilePlanStore) Update(
+	update func(current []FailurePoint) ([]FailurePoint, error),
+) error {
+	if err := s.FilePlanStore.Update(update); err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+// Reload reads the plan file
+func (s *WatchedFilePlanStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info, _ = os.Stat(s.Path)
+	points, expiresAt, err := s.FilePlanStore.load()
+	if err != nil {
+		return err
+	}
+	s.points, s.expiresAt = points, expiresAt
+	return nil
+}
+
+// changed tells if the plan file changed since it was last loaded
+func (s *WatchedFilePlanStore) changed() bool {
+	info, _ := os.Stat(s.Path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info == nil || s.info == nil {
+		return info != s.info
+	}
+	return !os.SameFile(info, s.info) ||
+		!info.ModTime().Equal(s.info.ModTime()) ||
+		info.Size() != s.info.Size()
+}
+
+func (s *WatchedFilePlanStore) watch(pollInterval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				log.Errorf(
+					context.Background(),
+					"Ignoring assured-failure-plan change: %v",
+					err)
+				continue
+			}
+			log.Infof(
+				context.Background(),
+				"Reloaded assured-failure-plan %s",
+				s.Path)
+		}
+	}
+}
+
+// Stop stops watching the plan file, the store keeps the plan last loaded
+func (s *WatchedFilePlanStore) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// WatchPlanFile makes the plan cache the plan file at PlanFilePath and pick
+// up its changes every pollInterval (see WatchedFilePlanStore), rather than
+// read it on every FailMaybe call. It must be called before the plan is used,
+// and the returned store must be stopped once done with the plan.
+func (afp *AssuredFailurePlanImpl) WatchPlanFile(
+	pollInterval time.Duration,
+) (*WatchedFilePlanStore, error) {
+	store, err := NewWatchedFilePlanStore(afp.PlanFilePath, pollInterval)
+	if err != nil {
+		return nil, err
+	}
+	afp.Store = store
+	return store, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestWatchPlanFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).
+		Write(path))
+	afp := &failuregen.AssuredFailurePlanImpl{PlanFilePath: path}
+	store, err := afp.WatchPlanFile(10 * time.Millisecond)
+	require.NoError(t, err)
+	defer store.Stop()
+	require.True(t, failuregen.IsInjected(
+		afp.FailMaybe(failuregen.SChTargetStateP1)))
+
+	// an external controller edits the plan mid-run
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateC6).
+		Write(path))
+	require.Eventually(t, func() bool {
+		return failuregen.IsInjected(
+			afp.FailMaybe(failuregen.SChTargetStateC6))
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, afp.FailMaybe(failuregen.SChTargetStateP1))
+
+	// malformed changes are ignored
+	require.NoError(t, os.WriteFile(path, []byte("malformed"), 0644))
+	time.Sleep(50 * time.Millisecond)
+	require.True(t, failuregen.IsInjected(
+		afp.FailMaybe(failuregen.SChTargetStateC6)))
+
+	// the removal of the file empties the plan
+	require.NoError(t, os.Remove(path))
+	require.Eventually(t, func() bool {
+		return afp.FailMaybe(failuregen.SChTargetStateC6) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// edits through the plan are picked up right away
+	_, err = afp.EditPlan(
+		[]failuregen.FailurePoint{failuregen.SChTargetStateNU0},
+		nil)
+	require.NoError(t, err)
+	require.True(t, failuregen.IsInjected(
+		afp.FailMaybe(failuregen.SChTargetStateNU0)))
+}
+
+func TestWatchPlanFileMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, os.WriteFile(path, []byte("malformed"), 0644))
+	afp := &failuregen.AssuredFailurePlanImpl{PlanFilePath: path}
+	_, err := afp.WatchPlanFile(time.Second)
+	require.Error(t, err)
+}
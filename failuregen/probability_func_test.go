@@ -0,0 +1,41 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestProbabilityFuncOverridesFixedProbability(t *testing.T) {
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, g.SetFailureProbability(1.0))
+
+	// fail every other call
+	g.SetProbabilityFunc(func(callCount int64, _ time.Time) float32 {
+		if callCount%2 == 0 {
+			return 2 // clamped to 1
+		}
+		return -1 // clamped to 0
+	})
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			require.Error(t, g.FailMaybe())
+		} else {
+			require.NoError(t, g.FailMaybe())
+		}
+	}
+
+	copied := g.DeepCopy()
+	require.Error(t, copied.FailMaybe())
+	require.NoError(t, copied.FailMaybe())
+
+	g.SetProbabilityFunc(nil)
+	for i := 0; i < 10; i++ {
+		require.Error(t, g.FailMaybe())
+	}
+}
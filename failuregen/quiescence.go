@@ -0,0 +1,146 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+)
+
+// injectionTracker tracks the time of the latest injection (failure or
+// delay)
+type injectionTracker struct {
+	lastInjectionNanos atomic.Int64
+	injectHooks        atomic.Pointer[[]func(InjectionEvent)]
+}
+
+func (it *injectionTracker) recordInjection() {
+	it.lastInjectionNanos.Store(time.Now().UnixNano())
+}
+
+// LastInjection returns the time of the latest injected failure or delay,
+// zero if nothing was injected yet
+func (it *injectionTracker) LastInjection() time.Time {
+	nanos := it.lastInjectionNanos.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// AwaitNoInjectionsFor blocks until no failures or delays have been injected
+// for the given duration. This lets tests establish a clean baseline before
+// making final correctness assertions. It blocks for as long as injections
+// go on, see AwaitNoInjectionsForContext to bound the wait.
+func (it *injectionTracker) AwaitNoInjectionsFor(d time.Duration) {
+	_ = AwaitNoInjections(context.Background(), d, it.LastInjection)
+}
+
+// AwaitNoInjectionsForContext is AwaitNoInjectionsFor bounded by ctx, it
+// returns an error if ctx is done before injections stopped for d
+func (it *injectionTracker) AwaitNoInjectionsForContext(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	return AwaitNoInjections(ctx, d, it.LastInjection)
+}
+
+// AwaitNoInjections blocks until lastInjection, the time of the latest
+// injection of some source, is at least d ago. It returns an error wrapping
+// that of ctx if ctx is done first, so that tests fail fast rather than
+// wait for the timeout of go test when injections go on. It backs the
+// AwaitNoInjectionsFor methods of this package, and can back those of other
+// sources of injections.
+func AwaitNoInjections(
+	ctx context.Context,
+	d time.Duration,
+	lastInjection func() time.Time,
+) error {
+	for {
+		last := lastInjection()
+		quietFor := time.Since(last)
+		if quietFor >= d {
+			return nil
+		}
+		timer := time.NewTimer(d - quietFor)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(
+				ctx.Err(),
+				"Injections didn't stop for %v, latest at %v",
+				d,
+				last)
+		}
+	}
+}
+
+// LastInjection returns the time of the latest injection by any of the
+// composed generators which track their injections
+func (c *compositeFailureGenerator) LastInjection() time.Time {
+	var last time.Time
+	for _, g := range c.gens {
+		last = laterInjection(last, g)
+	}
+	return last
+}
+
+// laterInjection returns the latest of last and the latest injection of src,
+// if src tracks its injections
+func laterInjection(last time.Time, src interface{}) time.Time {
+	if tracked, ok := src.(interface{ LastInjection() time.Time }); ok {
+		if t := tracked.LastInjection(); t.After(last) {
+			return t
+		}
+	}
+	return last
+}
+
+// AwaitNoInjectionsFor blocks until none of the composed generators have
+// injected for the given duration
+func (c *compositeFailureGenerator) AwaitNoInjectionsFor(d time.Duration) {
+	_ = AwaitNoInjections(context.Background(), d, c.LastInjection)
+}
+
+// AwaitNoInjectionsForContext is AwaitNoInjectionsFor bounded by ctx
+func (c *compositeFailureGenerator) AwaitNoInjectionsForContext(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	return AwaitNoInjections(ctx, d, c.LastInjection)
+}
+
+// LastInjection returns the time of the latest injection by the generators
+// and the plan of the registry which track their injections. The injections
+// of generators since removed (e.g. by DisarmTag) are not accounted for.
+func (r *Registry) LastInjection() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	last := laterInjection(time.Time{}, r.plan)
+	for _, fg := range r.gens {
+		last = laterInjection(last, fg)
+	}
+	for _, tg := range r.tagGens {
+		last = laterInjection(last, tg.fg)
+	}
+	return last
+}
+
+// AwaitNoInjectionsFor blocks until neither the generators nor the plan of
+// the registry have injected for the given duration, see
+// AwaitNoInjectionsForContext to bound the wait
+func (r *Registry) AwaitNoInjectionsFor(d time.Duration) {
+	_ = AwaitNoInjections(context.Background(), d, r.LastInjection)
+}
+
+// AwaitNoInjectionsForContext is AwaitNoInjectionsFor bounded by ctx
+func (r *Registry) AwaitNoInjectionsForContext(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	return AwaitNoInjections(ctx, d, r.LastInjection)
+}
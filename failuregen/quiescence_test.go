@@ -0,0 +1,103 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestAwaitNoInjectionsFor(t *testing.T) {
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.True(t, g.LastInjection().IsZero())
+
+	// returns immediately when nothing was injected
+	start := time.Now()
+	g.AwaitNoInjectionsFor(time.Hour)
+	require.Less(t, time.Since(start), time.Second)
+
+	require.NoError(t, g.SetFailureProbability(1.0))
+	require.Error(t, g.FailMaybe())
+	require.NoError(t, g.SetFailureProbability(0.0))
+
+	start = time.Now()
+	g.AwaitNoInjectionsFor(100 * time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(g.LastInjection()), 100*time.Millisecond)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestAwaitNoInjectionsForComposite(t *testing.T) {
+	never := failuregen.NewFailureGenerator()
+	always := generatorWithProbability(t, 1)
+	g := failuregen.Any(never, always)
+
+	require.Error(t, g.FailMaybe())
+	composite := g.(interface {
+		LastInjection() time.Time
+		AwaitNoInjectionsFor(d time.Duration)
+	})
+	require.Equal(
+		t,
+		always.(*failuregen.FailureGeneratorImpl).LastInjection(),
+		composite.LastInjection())
+
+	composite.AwaitNoInjectionsFor(50 * time.Millisecond)
+	require.GreaterOrEqual(
+		t,
+		time.Since(composite.LastInjection()),
+		50*time.Millisecond)
+}
+
+func TestAwaitNoInjectionsForRegistry(t *testing.T) {
+	r := failuregen.NewRegistry()
+	always := generatorWithProbability(t, 1)
+	r.SetGenerator("A", failuregen.NewFailureGenerator())
+	r.SetGenerator("B", always)
+	require.True(t, r.LastInjection().IsZero())
+
+	require.Error(t, r.FailMaybe("B"))
+	require.Equal(
+		t,
+		always.(*failuregen.FailureGeneratorImpl).LastInjection(),
+		r.LastInjection())
+	r.AwaitNoInjectionsFor(50 * time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(r.LastInjection()), 50*time.Millisecond)
+}
+
+func TestAwaitNoInjectionsForContext(t *testing.T) {
+	r := failuregen.NewRegistry()
+	r.SetGenerator("A", generatorWithProbability(t, 1))
+
+	// a generator which keeps injecting fails the wait rather than hang it
+	require.Error(t, r.FailMaybe("A"))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				_ = r.FailMaybe("A")
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := r.AwaitNoInjectionsForContext(ctx, 100*time.Millisecond)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	close(stop)
+	<-done
+
+	require.NoError(t, r.AwaitNoInjectionsForContext(
+		context.Background(),
+		10*time.Millisecond))
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"go.uber.org/atomic"
+)
+
+// RateWatchdogConfig configures a RateWatchdog
+type RateWatchdogConfig struct {
+	// Window is the number of checks the rates are compared over
+	Window int
+	// Tolerance is the number of standard deviations the observed number of
+	// injections may deviate from the expected one
+	Tolerance float64
+	// MinCalls is the number of FailMaybe calls a generator with a non-zero
+	// probability is expected to see in a window, fewer calls means the
+	// instrumented code path is not exercised as assumed
+	MinCalls int64
+	// OnAnomaly, when set, is called for every anomaly (in addition to a
+	// warning being logged)
+	OnAnomaly func(RateAnomaly)
+}
+
+// RateAnomaly is a divergence between the configured and observed injection
+// rates of a generator over a window
+type RateAnomaly struct {
+	// GeneratorID identifies the generator
+	GeneratorID string
+	// Calls is the number of FailMaybe calls in the window
+	Calls int64
+	// Injected is the number of failures injected in the window
+	Injected int64
+	// Expected is the number of failures the configured probabilities
+	// should have injected in the window
+	Expected float64
+}
+
+func (a RateAnomaly) String() string {
+	if a.Calls == 0 {
+		return fmt.Sprintf("generator %s was not called", a.GeneratorID)
+	}
+	return fmt.Sprintf(
+		"generator %s injected %d failures in %d calls, expected %.1f",
+		a.GeneratorID,
+		a.Injected,
+		a.Calls,
+		a.Expected)
+}
+
+// rateSample is what a generator did between two checks
+type rateSample struct {
+	calls    int64
+	injected int64
+	expected float64
+	variance float64
+}
+
+type watchedGenerator struct {
+	fg           *FailureGeneratorImpl
+	lastCalls    int64
+	lastInjected int64
+	samples      []rateSample
+}
+
+// RateWatchdog compares the configured and observed injection rates of
+// generators over sliding windows and reports the generators for which they
+// diverge badly, which usually indicates that the instrumented code path
+// isn't exercised the way the test author assumed.
+type RateWatchdog struct {
+	cfg       RateWatchdogConfig
+	mu        sync.Mutex
+	gens      []*watchedGenerator
+	anomalies atomic.Int64
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewRateWatchdog creates a watchdog for the given generators
+func NewRateWatchdog(
+	cfg RateWatchdogConfig,
+	gens ...*FailureGeneratorImpl,
+) (*RateWatchdog, error) {
+	if cfg.Window <= 0 {
+		return nil, errors.Errorf("Invalid window %d", cfg.Window)
+	}
+	if cfg.Tolerance <= 0 {
+		return nil, errors.Errorf("Invalid tolerance %f", cfg.Tolerance)
+	}
+	w := &RateWatchdog{cfg: cfg, quit: make(chan struct{})}
+	for _, fg := range gens {
+		w.gens = append(w.gens, &watchedGenerator{
+			fg:           fg,
+			lastCalls:    fg.callCtr.Load(),
+			lastInjected: fg.injectedCtr.Load(),
+		})
+	}
+	return w, nil
+}
+
+// sample records what g did since the previous check, the expectation is
+// computed from the probability in effect now
+func (g *watchedGenerator) sample(window int) {
+	calls, injected := g.fg.callCtr.Load(), g.fg.injectedCtr.Load()
+	p := float64(g.fg.currentFailurePpm(calls)) / float64(OneMillion)
+	n := float64(calls - g.lastCalls)
+	g.samples = append(g.samples, rateSample{
+		calls:    calls - g.lastCalls,
+		injected: injected - g.lastInjected,
+		expected: n * p,
+		variance: n * p * (1 - p),
+	})
+	if len(g.samples) > window {
+		g.samples = g.samples[1:]
+	}
+	g.lastCalls, g.lastInjected = calls, injected
+}
+
+// anomaly returns the anomaly of the window of g, if any
+func (g *watchedGenerator) anomaly(
+	cfg RateWatchdogConfig,
+) (RateAnomaly, bool) {
+	a := RateAnomaly{GeneratorID: g.fg.id}
+	variance := 0.0
+	for _, s := range g.samples {
+		a.Calls += s.calls
+		a.Injected += s.injected
+		a.Expected += s.expected
+		variance += s.variance
+	}
+	if a.Calls < cfg.MinCalls {
+		// an idle generator that can't inject is not suspicious
+		return a, g.fg.failurePpm.Load() > 0 || g.fg.probabilityFn.Load() != nil
+	}
+	// the slack of 1 keeps tiny expectations from flagging single
+	// injections
+	allowed := cfg.Tolerance*math.Sqrt(variance) + 1
+	return a, math.Abs(float64(a.Injected)-a.Expected) > allowed
+}
+
+// Check samples the generators and reports the anomalies of the generators
+// whose window is complete
+func (w *RateWatchdog) Check() []RateAnomaly {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var anomalies []RateAnomaly
+	for _, g := range w.gens {
+		g.sample(w.cfg.Window)
+		if len(g.samples) < w.cfg.Window {
+			continue
+		}
+		if a, ok := g.anomaly(w.cfg); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	for _, a := range anomalies {
+		w.anomalies.Inc()
+		log.Warningf(context.Background(), "Injection rate anomaly: %s", a)
+		if w.cfg.OnAnomaly != nil {
+			w.cfg.OnAnomaly(a)
+		}
+	}
+	return anomalies
+}
+
+// Anomalies returns the number of anomalies reported so far
+func (w *RateWatchdog) Anomalies() int64 {
+	return w.anomalies.Load()
+}
+
+// Start checks the generators every interval until Stop is called
+func (w *RateWatchdog) Start(interval time.Duration) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.quit:
+				return
+			case <-ticker.C:
+				w.Check()
+			}
+		}
+	}()
+}
+
+// Stop stops periodic checks
+func (w *RateWatchdog) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
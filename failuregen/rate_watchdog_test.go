@@ -0,0 +1,66 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateWatchdog(t *testing.T) {
+	_, err := failuregen.NewRateWatchdog(failuregen.RateWatchdogConfig{})
+	require.Error(t, err)
+
+	busy := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, busy.SetFailureProbability(0.5))
+	idle := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, idle.SetFailureProbability(0.5))
+	disabled := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+
+	var reported []failuregen.RateAnomaly
+	w, err := failuregen.NewRateWatchdog(
+		failuregen.RateWatchdogConfig{
+			Window:    2,
+			Tolerance: 5,
+			MinCalls:  10,
+			OnAnomaly: func(a failuregen.RateAnomaly) {
+				reported = append(reported, a)
+			},
+		},
+		busy,
+		idle,
+		disabled)
+	require.NoError(t, err)
+
+	call := func(n int) {
+		for i := 0; i < n; i++ {
+			busy.FailMaybe()
+		}
+	}
+	// the window is not complete yet
+	call(1000)
+	require.Empty(t, w.Check())
+
+	// the idle generator is not exercised, the disabled one can't inject
+	call(1000)
+	anomalies := w.Check()
+	require.Len(t, anomalies, 1)
+	require.Equal(t, idle.ID(), anomalies[0].GeneratorID)
+	require.Equal(t, int64(0), anomalies[0].Calls)
+	require.Equal(t, anomalies, reported)
+	require.Equal(t, int64(1), w.Anomalies())
+
+	// injections that diverge from the configured rate are flagged
+	idle.SetFailureProbability(0)
+	require.NoError(t, busy.SetFailureProbability(0))
+	call(1000)
+	require.NoError(t, busy.SetFailureProbability(1))
+	anomalies = w.Check()
+	require.Len(t, anomalies, 1)
+	require.Equal(t, busy.ID(), anomalies[0].GeneratorID)
+	require.Equal(t, int64(2000), anomalies[0].Calls)
+	require.Less(t, float64(anomalies[0].Injected), anomalies[0].Expected)
+	require.Contains(t, anomalies[0].String(), "2000 calls")
+}
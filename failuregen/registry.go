@@ -0,0 +1,144 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry maps named failure-points to the generators governing them, and
+// optionally to an assured-failure-plan. Failure-points register themselves
+// the first time they are reached, or upfront through Register.
+type Registry struct {
+	mu     sync.RWMutex
+	points map[FailurePoint]struct{}
+	// gens are the generators set with SetGenerator
+	gens map[FailurePoint]FailureGenerator
+	plan AssuredFailurePlan
+	tags map[FailurePoint]map[Tag]struct{}
+	// armed are the generator factories of the armed tags, and tagGens the
+	// generators they armed, which take precedence over gens
+	armed   map[Tag]func(FailurePoint) FailureGenerator
+	tagGens map[FailurePoint]tagGenerator
+	// registrations are those of the failure-points registered through
+	// RegisterFailurePoint
+	registrations map[FailurePoint]registration
+}
+
+// DefaultRegistry is the registry used by instrumented code (see
+// cmd/failpointgen), it knows the upgrade failure-points of this package
+var DefaultRegistry = func() *Registry {
+	r := NewRegistry()
+	for _, fp := range upgradeFailurePoints {
+		_ = r.registerFailurePoint(
+			fp,
+			registration{
+				description: "Upgrade failure-point",
+				module:      strings.TrimSuffix(packagePrefix, "."),
+			})
+	}
+	return r
+}()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		points:        make(map[FailurePoint]struct{}),
+		gens:          make(map[FailurePoint]FailureGenerator),
+		tags:          make(map[FailurePoint]map[Tag]struct{}),
+		armed:         make(map[Tag]func(FailurePoint) FailureGenerator),
+		tagGens:       make(map[FailurePoint]tagGenerator),
+		registrations: make(map[FailurePoint]registration),
+	}
+}
+
+// Register declares failure-points, making them known before they are
+// reached
+func (r *Registry) Register(points ...FailurePoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fp := range points {
+		r.points[fp] = struct{}{}
+	}
+}
+
+// Points returns the known failure-points, sorted
+func (r *Registry) Points() []FailurePoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	points := make([]FailurePoint, 0, len(r.points))
+	for fp := range r.points {
+		points = append(points, fp)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+	return points
+}
+
+// SetGenerator makes fg govern failures at fp, a nil fg removes the
+// generator of fp. It overrides the generator armed at fp by a tag, if any
+// (see ArmTag).
+func (r *Registry) SetGenerator(fp FailurePoint, fg FailureGenerator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points[fp] = struct{}{}
+	delete(r.tagGens, fp)
+	if fg == nil {
+		delete(r.gens, fp)
+		return
+	}
+	r.gens[fp] = fg
+}
+
+// generatorLocked returns the generator governing fp, nil if none
+func (r *Registry) generatorLocked(fp FailurePoint) FailureGenerator {
+	if tg, ok := r.tagGens[fp]; ok {
+		return tg.fg
+	}
+	return r.gens[fp]
+}
+
+// SetPlan makes plan govern failures at all failure-points of the registry,
+// in addition to their generators. A nil plan removes the plan.
+func (r *Registry) SetPlan(plan AssuredFailurePlan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.plan = plan
+}
+
+// FailMaybe injects a failure at fp if the plan slates fp for failure, or if
+// the generator of fp injects one. Failure-points without plan nor generator
+// never fail. Prefer FailMaybeContext.
+func (r *Registry) FailMaybe(fp FailurePoint) error {
+	return r.failMaybe(fp, func(plan AssuredFailurePlan) error {
+		return plan.FailMaybe(fp)
+	}, func(fg FailureGenerator) error {
+		return fg.FailMaybe()
+	})
+}
+
+// failMaybe implements FailMaybe and FailMaybeContext, which consult the plan
+// and the generator of fp with planFail and fgFail
+func (r *Registry) failMaybe(
+	fp FailurePoint,
+	planFail func(AssuredFailurePlan) error,
+	fgFail func(FailureGenerator) error,
+) error {
+	r.mu.RLock()
+	_, known := r.points[fp]
+	fg, plan := r.generatorLocked(fp), r.plan
+	r.mu.RUnlock()
+	if !known {
+		r.Register(fp)
+	}
+	if plan != nil {
+		if err := planFail(plan); err != nil {
+			return err
+		}
+	}
+	if fg != nil {
+		return fgFail(fg)
+	}
+	return nil
+}
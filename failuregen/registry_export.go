@@ -0,0 +1,125 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExpectedError describes an error a failure-point is expected to inject
+type ExpectedError struct {
+	// Type is the Go type of the error, e.g. *fs.PathError
+	Type    string
+	Message string
+}
+
+func expectedErrors(errs []error) []ExpectedError {
+	if len(errs) == 0 {
+		return nil
+	}
+	expected := make([]ExpectedError, 0, len(errs))
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		expected = append(expected, ExpectedError{
+			Type:    fmt.Sprintf("%T", err),
+			Message: err.Error(),
+		})
+	}
+	return expected
+}
+
+// callerPackage returns the import path of the package of the first caller
+// outside this package, empty if unknown
+func callerPackage() string {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePrefix) {
+			name := frame.Function
+			pkg := strings.LastIndex(name, "/") + 1
+			if dot := strings.Index(name[pkg:], "."); dot >= 0 {
+				return name[:pkg+dot]
+			}
+			return ""
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// FailurePointMetadata describes a known failure-point in a catalog
+type FailurePointMetadata struct {
+	Name        FailurePoint
+	Description string `json:",omitempty"`
+	// Module is the import path of the package that registered the
+	// failure-point, empty for failure-points registered on being reached
+	Module string          `json:",omitempty"`
+	Errors []ExpectedError `json:",omitempty"`
+	Tags   []Tag           `json:",omitempty"`
+}
+
+// FailurePointCatalog lists the failure-points injectable in a binary, for
+// test-plan authors and tooling to browse them without reading its source
+type FailurePointCatalog struct {
+	// Binary is the name of the executable
+	Binary string
+	// Module is the main module of the binary, if built with module support
+	Module        string `json:",omitempty"`
+	FailurePoints []FailurePointMetadata
+}
+
+// Catalog returns the catalog of the known failure-points, sorted
+func (r *Registry) Catalog() FailurePointCatalog {
+	catalog := FailurePointCatalog{Binary: filepath.Base(os.Args[0])}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		catalog.Module = info.Main.Path
+	}
+	points := r.Points()
+	catalog.FailurePoints = make([]FailurePointMetadata, len(points))
+	for i, fp := range points {
+		tags := r.Tags(fp)
+		if len(tags) == 0 {
+			tags = nil
+		}
+		r.mu.RLock()
+		reg := r.registrations[fp]
+		r.mu.RUnlock()
+		catalog.FailurePoints[i] = FailurePointMetadata{
+			Name:        fp,
+			Description: reg.description,
+			Module:      reg.module,
+			Errors:      reg.errors,
+			Tags:        tags,
+		}
+	}
+	return catalog
+}
+
+// ExportFailurePoints writes the catalog of the known failure-points to w as
+// JSON (see Catalog)
+func (r *Registry) ExportFailurePoints(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(
+		encoder.Encode(r.Catalog()),
+		"Failed to export failure-points")
+}
+
+// ExportFailurePoints writes the catalog of the failure-points known to
+// DefaultRegistry to w, see Registry.ExportFailurePoints
+func ExportFailurePoints(w io.Writer) error {
+	return DefaultRegistry.ExportFailurePoints(w)
+}
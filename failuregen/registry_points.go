@@ -0,0 +1,138 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FailurePointInfo describes a registered failure-point
+type FailurePointInfo struct {
+	Name FailurePoint
+	// Description is what the failure-point is, empty for failure-points
+	// registered without description (e.g. on being reached)
+	Description string
+}
+
+// validName checks that fp can be referred to by plans: it must not be empty
+// nor be mistaken for a pattern or carry plan entry suffixes
+func validName(fp FailurePoint) error {
+	if fp == "" ||
+		isPattern(fp) ||
+		strings.ContainsAny(string(fp), ":@") {
+		return errors.Errorf("Invalid failure-point name %q", fp)
+	}
+	return nil
+}
+
+// registration is what is known of a failure-point registered through
+// RegisterFailurePoint
+type registration struct {
+	description string
+	// module is the import path of the package that registered it
+	module string
+	// errors are those it is expected to inject
+	errors []ExpectedError
+}
+
+// RegisterFailurePoint declares the failure-point fp, described by
+// description, so that tooling can list it (see ListFailurePoints), export it
+// (see ExportFailurePoints) and validate plans against it (see ValidatePlan).
+// errs are examples of the errors it injects, for test-plan authors to know
+// what to expect. Registering a failure-point again with the same
+// description is a no-op, whereas registering it with another description
+// fails, as it is likely defined by two services.
+func (r *Registry) RegisterFailurePoint(
+	fp FailurePoint,
+	description string,
+	errs ...error,
+) error {
+	return r.registerFailurePoint(fp, registration{
+		description: description,
+		module:      callerPackage(),
+		errors:      expectedErrors(errs),
+	})
+}
+
+func (r *Registry) registerFailurePoint(
+	fp FailurePoint,
+	reg registration,
+) error {
+	if err := validName(fp); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.registrations[fp]
+	if ok && existing.description != reg.description {
+		return errors.Errorf(
+			"Failure-point %s is already registered as %q",
+			fp,
+			existing.description)
+	}
+	r.points[fp] = struct{}{}
+	if !ok {
+		r.registrations[fp] = reg
+	}
+	return nil
+}
+
+// ListFailurePoints returns the known failure-points, sorted, along with the
+// descriptions they were registered with
+func (r *Registry) ListFailurePoints() []FailurePointInfo {
+	points := r.Points()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	infos := make([]FailurePointInfo, len(points))
+	for i, fp := range points {
+		infos[i] = FailurePointInfo{
+			Name:        fp,
+			Description: r.registrations[fp].description,
+		}
+	}
+	return infos
+}
+
+// ValidatePlan checks that the entries of plan refer to known failure-points,
+// patterns having to match at least one, returning an ErrUnknownFailurePoint
+// for the first one that does not (e.g. a misspelled failure-point)
+func (r *Registry) ValidatePlan(plan []FailurePoint) error {
+	points := r.Points()
+	expanded, err := ExpandPlan(plan, points)
+	if err != nil {
+		return err
+	}
+	return ValidatePlan(expanded, points)
+}
+
+// RegisterFailurePoint registers the failure-point name in DefaultRegistry
+// (see Registry.RegisterFailurePoint) and returns it. It is meant for
+// services to define their failure-points in package-level declarations,
+// e.g.
+//
+//	var BeforeCommit = failuregen.RegisterFailurePoint(
+//		"BeforeCommit",
+//		"Before the transaction is committed")
+//
+// and panics if name is invalid or already registered with another
+// description.
+func RegisterFailurePoint(
+	name string,
+	description string,
+	errs ...error,
+) FailurePoint {
+	fp := FailurePoint(name)
+	err := DefaultRegistry.RegisterFailurePoint(fp, description, errs...)
+	if err != nil {
+		panic(err)
+	}
+	return fp
+}
+
+// ListFailurePoints returns the failure-points known to DefaultRegistry, see
+// Registry.ListFailurePoints
+func ListFailurePoints() []FailurePointInfo {
+	return DefaultRegistry.ListFailurePoints()
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterFailurePoint(t *testing.T) {
+	r := failuregen.NewRegistry()
+	require.NoError(t, r.RegisterFailurePoint("BeforeCommit", "Before commit"))
+	require.NoError(t, r.RegisterFailurePoint("BeforeCommit", "Before commit"))
+	require.Error(t, r.RegisterFailurePoint("BeforeCommit", "Before flush"))
+	for _, name := range []failuregen.FailurePoint{
+		"", "Before*", "/Before/", "Before:once", "Before@node-a",
+	} {
+		require.Error(t, r.RegisterFailurePoint(name, ""), name)
+	}
+	require.NoError(t, r.RegisterFailurePoint("AfterCommit", "After commit"))
+	// reached failure-points are known too
+	require.NoError(t, r.FailMaybe("OnFlush"))
+	require.Equal(t, []failuregen.FailurePointInfo{
+		{Name: "AfterCommit", Description: "After commit"},
+		{Name: "BeforeCommit", Description: "Before commit"},
+		{Name: "OnFlush"},
+	}, r.ListFailurePoints())
+
+	require.NoError(t, r.ValidatePlan([]failuregen.FailurePoint{
+		"BeforeCommit:once", "*Commit", "OnFlush",
+	}))
+	err := r.ValidatePlan([]failuregen.FailurePoint{"BeforeComit"})
+	var unknown *failuregen.ErrUnknownFailurePoint
+	require.True(t, errors.As(err, &unknown))
+	require.Equal(t, failuregen.FailurePoint("BeforeComit"), unknown.Name)
+	require.Error(t, r.ValidatePlan([]failuregen.FailurePoint{"Flush*"}))
+}
+
+func TestRegisterFailurePointDefault(t *testing.T) {
+	fp := failuregen.RegisterFailurePoint(
+		"TestRegisterFailurePointDefault",
+		"Registered by a test")
+	points := failuregen.ListFailurePoints()
+	require.Contains(t, points, failuregen.FailurePointInfo{
+		Name:        fp,
+		Description: "Registered by a test",
+	})
+	require.Contains(t, points, failuregen.FailurePointInfo{
+		Name:        failuregen.SChTargetStateP1,
+		Description: "Upgrade failure-point",
+	})
+	require.Panics(t, func() {
+		failuregen.RegisterFailurePoint(string(fp), "Registered twice")
+	})
+}
+
+func TestExportFailurePoints(t *testing.T) {
+	r := failuregen.NewRegistry()
+	require.NoError(t, r.RegisterFailurePoint(
+		"BeforeCommit",
+		"Before commit",
+		os.ErrDeadlineExceeded,
+		errors.New("Commit aborted")))
+	r.Tag("BeforeCommit", failuregen.TagTransient)
+	require.NoError(t, r.FailMaybe("OnFlush"))
+
+	var buf bytes.Buffer
+	require.NoError(t, r.ExportFailurePoints(&buf))
+	var catalog failuregen.FailurePointCatalog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &catalog))
+	require.Equal(t, filepath.Base(os.Args[0]), catalog.Binary)
+	require.Equal(t, []failuregen.FailurePointMetadata{
+		{
+			Name:        "BeforeCommit",
+			Description: "Before commit",
+			Module:      "github.com/rubrikinc/failure-test-utils/failuregen_test",
+			Errors: []failuregen.ExpectedError{
+				{Type: "*poll.DeadlineExceededError", Message: "i/o timeout"},
+				{Type: "*errors.fundamental", Message: "Commit aborted"},
+			},
+			Tags: []failuregen.Tag{failuregen.TagTransient},
+		},
+		{Name: "OnFlush"},
+	}, catalog.FailurePoints)
+
+	catalog = failuregen.DefaultRegistry.Catalog()
+	require.Contains(t, catalog.FailurePoints, failuregen.FailurePointMetadata{
+		Name:        failuregen.SChTargetStateP1,
+		Description: "Upgrade failure-point",
+		Module:      "github.com/rubrikinc/failure-test-utils/failuregen",
+	})
+}
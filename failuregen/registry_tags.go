@@ -0,0 +1,129 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sort"
+)
+
+// Tag classifies failure-points (e.g. by the severity of the failures they
+// inject) so that they can be armed together
+type Tag string
+
+const (
+	// TagCrash marks failure-points simulating a crash of the process
+	TagCrash Tag = "crash"
+	// TagTransient marks failure-points injecting retriable errors
+	TagTransient Tag = "transient"
+	// TagLatency marks failure-points injecting delays
+	TagLatency Tag = "latency"
+)
+
+// tagGenerator is a generator armed by a tag
+type tagGenerator struct {
+	tag Tag
+	fg  FailureGenerator
+}
+
+// Tag tags fp (registering it if needed). If one of the tags is armed and fp
+// has no generator yet, fp gets armed too.
+func (r *Registry) Tag(fp FailurePoint, tags ...Tag) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points[fp] = struct{}{}
+	if r.tags[fp] == nil {
+		r.tags[fp] = make(map[Tag]struct{})
+	}
+	for _, tag := range tags {
+		r.tags[fp][tag] = struct{}{}
+		if newFg, ok := r.armed[tag]; ok && r.generatorLocked(fp) == nil {
+			r.tagGens[fp] = tagGenerator{tag: tag, fg: newFg(fp)}
+		}
+	}
+}
+
+// Tags returns the tags of fp, sorted
+func (r *Registry) Tags(fp FailurePoint) []Tag {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tagsLocked(fp)
+}
+
+func (r *Registry) tagsLocked(fp FailurePoint) []Tag {
+	tags := make([]Tag, 0, len(r.tags[fp]))
+	for tag := range r.tags[fp] {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+// PointsWithTag returns the failure-points tagged with tag, sorted
+func (r *Registry) PointsWithTag(tag Tag) []FailurePoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pointsWithTagLocked(tag)
+}
+
+func (r *Registry) pointsWithTagLocked(tag Tag) []FailurePoint {
+	var points []FailurePoint
+	for fp, tags := range r.tags {
+		if _, ok := tags[tag]; ok {
+			points = append(points, fp)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+	return points
+}
+
+// ArmTag makes every failure-point tagged with tag, including the ones
+// tagged later, fail with probability p (e.g. "all transient faults at
+// 1%"). Each failure-point gets a generator of its own, which overrides the
+// one it had until the tag is disarmed.
+func (r *Registry) ArmTag(tag Tag, p float32) error {
+	if _, err := ppm(p); err != nil {
+		return err
+	}
+	r.ArmTagWith(tag, func(FailurePoint) FailureGenerator {
+		fg := NewFailureGenerator()
+		// p was validated above
+		_ = fg.SetFailureProbability(p)
+		return fg
+	})
+	return nil
+}
+
+// ArmTagWith is ArmTag with generators created by newFg (e.g. generators
+// injecting delays for latency failure-points)
+func (r *Registry) ArmTagWith(
+	tag Tag,
+	newFg func(fp FailurePoint) FailureGenerator,
+) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.armed[tag] = newFg
+	for _, fp := range r.pointsWithTagLocked(tag) {
+		r.tagGens[fp] = tagGenerator{tag: tag, fg: newFg(fp)}
+	}
+}
+
+// DisarmTag removes the generators armed by tag. The failure-points they
+// were armed at get back the generator set with SetGenerator, if any, unless
+// another of their tags is armed, in which case they are armed by it.
+func (r *Registry) DisarmTag(tag Tag) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.armed, tag)
+	for _, fp := range r.pointsWithTagLocked(tag) {
+		if r.tagGens[fp].tag != tag {
+			continue
+		}
+		delete(r.tagGens, fp)
+		for _, other := range r.tagsLocked(fp) {
+			if newFg, ok := r.armed[other]; ok {
+				r.tagGens[fp] = tagGenerator{tag: other, fg: newFg(fp)}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestRegistryTags(t *testing.T) {
+	r := failuregen.NewRegistry()
+	r.Tag("db.Commit.before", failuregen.TagTransient)
+	r.Tag("db.Commit.after", failuregen.TagCrash, failuregen.TagTransient)
+	r.Register("db.Flush.before")
+
+	require.Equal(
+		t,
+		[]failuregen.Tag{failuregen.TagCrash, failuregen.TagTransient},
+		r.Tags("db.Commit.after"))
+	require.Equal(
+		t,
+		[]failuregen.FailurePoint{"db.Commit.after", "db.Commit.before"},
+		r.PointsWithTag(failuregen.TagTransient))
+	require.Len(t, r.Points(), 3)
+
+	require.Error(t, r.ArmTag(failuregen.TagTransient, 2))
+	require.NoError(t, r.ArmTag(failuregen.TagTransient, 1))
+	require.Error(t, r.FailMaybe("db.Commit.before"))
+	require.Error(t, r.FailMaybe("db.Commit.after"))
+	require.NoError(t, r.FailMaybe("db.Flush.before"))
+
+	// points tagged after arming are armed too
+	r.Tag("db.Flush.before", failuregen.TagTransient)
+	require.Error(t, r.FailMaybe("db.Flush.before"))
+
+	r.DisarmTag(failuregen.TagTransient)
+	for _, fp := range r.Points() {
+		require.NoError(t, r.FailMaybe(fp))
+	}
+}
+
+func TestRegistryDisarmTagRestoresGenerators(t *testing.T) {
+	r := failuregen.NewRegistry()
+	r.Tag("db.Commit.before", failuregen.TagTransient)
+	r.Tag("db.Commit.after", failuregen.TagCrash, failuregen.TagTransient)
+	r.SetGenerator("db.Commit.before", generatorWithProbability(t, 1))
+
+	// armed tags override the generators set by hand until disarmed
+	require.NoError(t, r.ArmTag(failuregen.TagCrash, 1))
+	require.NoError(t, r.ArmTag(failuregen.TagTransient, 0))
+	require.NoError(t, r.FailMaybe("db.Commit.before"))
+	require.NoError(t, r.FailMaybe("db.Commit.after"))
+
+	// disarming falls back to the other armed tags, then to the generators
+	// set by hand
+	r.DisarmTag(failuregen.TagTransient)
+	require.Error(t, r.FailMaybe("db.Commit.before"))
+	require.Error(t, r.FailMaybe("db.Commit.after"))
+
+	// generators set by hand override armed tags, and survive disarming
+	r.SetGenerator("db.Commit.after", failuregen.NewFailureGenerator())
+	require.NoError(t, r.FailMaybe("db.Commit.after"))
+	r.DisarmTag(failuregen.TagCrash)
+	require.NoError(t, r.FailMaybe("db.Commit.after"))
+	require.Error(t, r.FailMaybe("db.Commit.before"))
+}
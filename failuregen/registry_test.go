@@ -0,0 +1,39 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestRegistry(t *testing.T) {
+	r := failuregen.NewRegistry()
+	r.Register("db.Commit.before")
+	require.NoError(t, r.FailMaybe("db.Commit.after"))
+	require.Equal(
+		t,
+		[]failuregen.FailurePoint{"db.Commit.after", "db.Commit.before"},
+		r.Points())
+
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	r.SetGenerator("db.Commit.before", fg)
+	err := r.FailMaybe("db.Commit.before")
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+	require.NoError(t, r.FailMaybe("db.Commit.after"))
+
+	r.SetGenerator("db.Commit.before", nil)
+	require.NoError(t, r.FailMaybe("db.Commit.before"))
+
+	r.SetPlan(failuregen.NewAssuredFailurePlanWithStore(&memPlanStore{
+		points: []failuregen.FailurePoint{"db.Commit.after"},
+	}))
+	info, ok := failuregen.InfoFromError(r.FailMaybe("db.Commit.after"))
+	require.True(t, ok)
+	require.Equal(t, failuregen.FailurePoint("db.Commit.after"), info.FailurePoint)
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// GeneratorSummary describes the faults configured and fired by a generator
+// during a run
+type GeneratorSummary struct {
+	ID       string
+	Config   GeneratorConfig
+	Calls    int64
+	Injected int64
+}
+
+// RunSummary summarizes the faults of a run and the errors observed in the
+// system under test
+type RunSummary struct {
+	Generators []GeneratorSummary
+	// Injected is the number of faults fired across generators
+	Injected int64
+	// ObservedErrors is the number of errors reported to ChaosRun.Observe
+	ObservedErrors int64
+	// InjectedErrors is the number of observed errors caused by injected
+	// failures
+	InjectedErrors int64
+	// UnexpectedErrors counts the observed errors not caused by injected
+	// failures, by error class (the type of the root cause)
+	UnexpectedErrors map[string]int64
+}
+
+func (s RunSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(
+		&b,
+		"chaos summary: %d faults fired, %d errors observed "+
+			"(%d injected)\n",
+		s.Injected,
+		s.ObservedErrors,
+		s.InjectedErrors)
+	for _, g := range s.Generators {
+		fmt.Fprintf(
+			&b,
+			"  generator %s: %d of %d calls injected (%+v)\n",
+			g.ID,
+			g.Injected,
+			g.Calls,
+			g.Config)
+	}
+	classes := make([]string, 0, len(s.UnexpectedErrors))
+	for class := range s.UnexpectedErrors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(
+			&b,
+			"  unexpected %s: %d\n",
+			class,
+			s.UnexpectedErrors[class])
+	}
+	return b.String()
+}
+
+// VerdictHook judges a run from its summary, returning an error to fail it
+type VerdictHook func(RunSummary) error
+
+// NoUnexpectedErrors is a verdict failing runs in which the system under test
+// observed errors other than injected failures
+func NoUnexpectedErrors(s RunSummary) error {
+	if len(s.UnexpectedErrors) == 0 {
+		return nil
+	}
+	return errors.Errorf("Non-injected errors observed: %v", s.UnexpectedErrors)
+}
+
+// FaultsFired is a verdict failing runs in which no fault fired, as such
+// runs test nothing
+func FaultsFired(s RunSummary) error {
+	if s.Injected == 0 {
+		return errors.New("No fault fired during the run")
+	}
+	return nil
+}
+
+// TB is the subset of testing.TB needed to report a run
+type TB interface {
+	Helper()
+	Logf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// ChaosRun collects the faults fired by generators and the errors observed
+// by the system under test over a run, and passes a verdict on it at the end
+type ChaosRun struct {
+	mu         sync.Mutex
+	gens       []*FailureGeneratorImpl
+	verdicts   []VerdictHook
+	observed   int64
+	injected   int64
+	unexpected map[string]int64
+}
+
+// NewChaosRun creates a run tracking the given generators
+func NewChaosRun(gens ...*FailureGeneratorImpl) *ChaosRun {
+	return &ChaosRun{
+		gens:       gens,
+		unexpected: make(map[string]int64),
+	}
+}
+
+// Track adds generators to the run
+func (r *ChaosRun) Track(gens ...*FailureGeneratorImpl) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gens = append(r.gens, gens...)
+}
+
+// AddVerdict registers a verdict hook evaluated by Verdict
+func (r *ChaosRun) AddVerdict(hook VerdictHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.verdicts = append(r.verdicts, hook)
+}
+
+// Observe reports an error seen by the system under test, nil is ignored
+func (r *ChaosRun) Observe(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observed++
+	if IsInjected(err) {
+		r.injected++
+		return
+	}
+	r.unexpected[fmt.Sprintf("%T", errors.Cause(err))]++
+}
+
+// Summary returns the summary of the run so far
+func (r *ChaosRun) Summary() RunSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := RunSummary{
+		ObservedErrors:   r.observed,
+		InjectedErrors:   r.injected,
+		UnexpectedErrors: make(map[string]int64, len(r.unexpected)),
+	}
+	for class, n := range r.unexpected {
+		s.UnexpectedErrors[class] = n
+	}
+	for _, g := range r.gens {
+		state := g.State()
+		s.Generators = append(s.Generators, GeneratorSummary{
+			ID:       g.ID(),
+			Config:   g.config(),
+			Calls:    state.Calls,
+			Injected: state.Injected,
+		})
+		s.Injected += state.Injected
+	}
+	return s
+}
+
+// Verdict evaluates the verdict hooks against the summary of the run, it
+// returns the failures of all hooks
+func (r *ChaosRun) Verdict() error {
+	s := r.Summary()
+	r.mu.Lock()
+	verdicts := append([]VerdictHook(nil), r.verdicts...)
+	r.mu.Unlock()
+	var failures []string
+	for _, hook := range verdicts {
+		if err := hook(s); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return errors.Errorf("Chaos run failed: %s", strings.Join(failures, "; "))
+}
+
+// Report logs the summary of the run to tb and fails the test if a verdict
+// hook fails, typically from a t.Cleanup at the end of the test
+func (r *ChaosRun) Report(tb TB) {
+	tb.Helper()
+	tb.Logf("%s", r.Summary())
+	if err := r.Verdict(); err != nil {
+		tb.Errorf("%v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestChaosRunSummaryAndVerdicts(t *testing.T) {
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	run := failuregen.NewChaosRun(g)
+	run.AddVerdict(failuregen.FaultsFired)
+	run.AddVerdict(failuregen.NoUnexpectedErrors)
+
+	require.Error(t, run.Verdict())
+
+	require.NoError(t, g.SetFailureProbability(1.0))
+	for i := 0; i < 3; i++ {
+		run.Observe(errors.Wrap(g.FailMaybe(), "operation failed"))
+	}
+	run.Observe(nil)
+	require.NoError(t, run.Verdict())
+
+	_, err := os.Open("/does/not/exist")
+	run.Observe(errors.Wrap(err, "organic failure"))
+
+	s := run.Summary()
+	require.Equal(t, int64(3), s.Injected)
+	require.Equal(t, int64(4), s.ObservedErrors)
+	require.Equal(t, int64(3), s.InjectedErrors)
+	require.Equal(t, map[string]int64{"*fs.PathError": 1}, s.UnexpectedErrors)
+	require.Len(t, s.Generators, 1)
+	require.Equal(t, g.ID(), s.Generators[0].ID)
+	require.Contains(t, s.String(), "unexpected *fs.PathError: 1")
+
+	err = run.Verdict()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Non-injected errors observed")
+}
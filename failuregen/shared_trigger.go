@@ -0,0 +1,87 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"sync"
+	"time"
+)
+
+// SharedTrigger correlates the failures of several generators (e.g. the disk
+// and network generators of one node): when a subscribed generator injects a
+// failure, the other subscribed generators fail all their calls for the
+// window that follows. Failures injected because of the trigger don't fire
+// it again.
+type SharedTrigger struct {
+	window time.Duration
+	mu     sync.Mutex
+	// source is the generator whose failure fired the trigger, nil when
+	// fired by Fire
+	source *FailureGeneratorImpl
+	until  time.Time
+	fired  int64
+}
+
+// NewSharedTrigger creates a trigger failing the subscribed generators for
+// window after one of them fails
+func NewSharedTrigger(window time.Duration) *SharedTrigger {
+	return &SharedTrigger{window: window}
+}
+
+// Subscribe makes gens fire the trigger and fail when it fires. A generator
+// is subscribed to a single trigger at a time, subscribing it to another
+// trigger unsubscribes it from this one.
+func (st *SharedTrigger) Subscribe(gens ...*FailureGeneratorImpl) {
+	for _, fg := range gens {
+		fg.sharedTrigger.Store(st)
+	}
+}
+
+// Unsubscribe stops gens from firing and following the trigger
+func (st *SharedTrigger) Unsubscribe(gens ...*FailureGeneratorImpl) {
+	for _, fg := range gens {
+		fg.sharedTrigger.CompareAndSwap(st, nil)
+	}
+}
+
+// Fire fires the trigger from outside the generators, all subscribed
+// generators fail for the window
+func (st *SharedTrigger) Fire() {
+	st.fire(nil)
+}
+
+// Fired returns the number of times the trigger fired
+func (st *SharedTrigger) Fired() int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.fired
+}
+
+func (st *SharedTrigger) fire(source *FailureGeneratorImpl) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.source = source
+	st.until = time.Now().Add(st.window)
+	st.fired++
+}
+
+// follows tells if fg is to fail because the trigger fired
+func (st *SharedTrigger) follows(fg *FailureGeneratorImpl) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.source != fg && time.Now().Before(st.until)
+}
+
+// triggered tells if the current call is to fail because the trigger the
+// generator is subscribed to fired
+func (fg *FailureGeneratorImpl) triggered() bool {
+	st := fg.sharedTrigger.Load()
+	return st != nil && st.follows(fg)
+}
+
+// fireTrigger fires the trigger the generator is subscribed to, if any
+func (fg *FailureGeneratorImpl) fireTrigger() {
+	if st := fg.sharedTrigger.Load(); st != nil {
+		st.fire(fg)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedTrigger(t *testing.T) {
+	disk := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	net := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	other := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	st := failuregen.NewSharedTrigger(50 * time.Millisecond)
+	st.Subscribe(disk, net)
+
+	require.NoError(t, net.FailMaybe())
+	require.NoError(t, disk.SetCountSchedule(failuregen.CountSchedule{
+		OnCall: 1,
+	}))
+	require.Error(t, disk.FailMaybe())
+	require.Equal(t, int64(1), st.Fired())
+	// the generator that fired the trigger doesn't follow it
+	require.NoError(t, disk.FailMaybe())
+	require.Error(t, net.FailMaybe())
+	require.Error(t, net.FailMaybe())
+	require.NoError(t, other.FailMaybe())
+	// failures injected because of the trigger don't fire it again
+	require.Equal(t, int64(1), st.Fired())
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, net.FailMaybe())
+
+	st.Fire()
+	require.Error(t, disk.FailMaybe())
+	require.Error(t, net.FailMaybe())
+
+	st.Unsubscribe(net)
+	require.NoError(t, net.FailMaybe())
+}
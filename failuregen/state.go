@@ -0,0 +1,146 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// GeneratorState is the position of a FailureGeneratorImpl in its sequence of
+// calls, persisted so that a restarted process resumes where it left off
+type GeneratorState struct {
+	// Calls is the number of FailMaybe calls made
+	Calls int64
+	// Injected is the number of failures injected
+	Injected int64
+}
+
+// PlanState is the progress of an assured-failure-plan, persisted so that a
+// process that crashes due to an injected failure resumes the plan when
+// restarted
+type PlanState struct {
+	// Fired are the failure-points that injected a failure
+	Fired []FailurePoint
+	// Sequence is the number of failures injected
+	Sequence int64
+	// Hits counts the hits of the failure-points failing on some hits only
+	// (see Counted)
+	Hits map[FailurePoint]int64 `json:",omitempty"`
+}
+
+// readState reads the JSON state in path into state. A missing or empty file
+// leaves state untouched.
+func readState(path string, state interface{}) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to read failure state: %s", path)
+	}
+	if len(bytes) == 0 {
+		return nil
+	}
+	return errors.Wrapf(
+		json.Unmarshal(bytes, state),
+		"Malformed failure state: %s",
+		path)
+}
+
+// writeState writes state to path as JSON, replacing it atomically so that a
+// crash never leaves a torn state file behind
+func writeState(path string, state interface{}) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize failure state")
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, bytes, 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write failure state: %s", tmpPath)
+	}
+	return errors.Wrapf(
+		os.Rename(tmpPath, path),
+		"Failed to install failure state: %s",
+		path)
+}
+
+// State returns the current position of the generator
+func (fg *FailureGeneratorImpl) State() GeneratorState {
+	return GeneratorState{
+		Calls:    fg.callCtr.Load(),
+		Injected: fg.injectedCtr.Load(),
+	}
+}
+
+// RestoreState resumes the generator from a previously saved position, this
+// matters for probability functions, which depend on the call count, and for
+// the sequence numbers of injected failures
+func (fg *FailureGeneratorImpl) RestoreState(state GeneratorState) {
+	fg.callCtr.Store(state.Calls)
+	fg.injectedCtr.Store(state.Injected)
+}
+
+// SaveState writes the current position of the generator to the file at path
+func (fg *FailureGeneratorImpl) SaveState(path string) error {
+	return writeState(path, fg.State())
+}
+
+// LoadState restores the position of the generator from the file at path.
+// Absence of the file leaves the generator as is.
+func (fg *FailureGeneratorImpl) LoadState(path string) error {
+	var state GeneratorState
+	if err := readState(path, &state); err != nil {
+		return err
+	}
+	fg.RestoreState(state)
+	return nil
+}
+
+// loadStateLocked loads the persisted plan state once, firedMu must be held
+func (afp *AssuredFailurePlanImpl) loadStateLocked() error {
+	if afp.StatePath == "" || afp.stateLoaded {
+		return nil
+	}
+	var state PlanState
+	if err := readState(afp.StatePath, &state); err != nil {
+		return err
+	}
+	if afp.fired == nil {
+		afp.fired = make(map[FailurePoint]struct{})
+	}
+	for _, fp := range state.Fired {
+		afp.fired[fp] = struct{}{}
+	}
+	if len(state.Hits) > 0 {
+		afp.hits = state.Hits
+	}
+	afp.injectedCtr.Store(state.Sequence)
+	afp.stateLoaded = true
+	return nil
+}
+
+// saveStateLocked persists the plan state, firedMu must be held
+func (afp *AssuredFailurePlanImpl) saveStateLocked() error {
+	if afp.StatePath == "" {
+		return nil
+	}
+	state := PlanState{Sequence: afp.injectedCtr.Load(), Hits: afp.hits}
+	for fp := range afp.fired {
+		state.Fired = append(state.Fired, fp)
+	}
+	sort.Slice(state.Fired, func(i, j int) bool {
+		return state.Fired[i] < state.Fired[j]
+	})
+	return writeState(afp.StatePath, state)
+}
+
+// NewAssuredFailurePlanWithState creates a new assured-failure-plan which
+// reads the plan from the given store and persists its progress to the file
+// at statePath. Each failure-point fires once across restarts of the process.
+func NewAssuredFailurePlanWithState(
+	store PlanStore,
+	statePath string,
+) AssuredFailurePlan {
+	return &AssuredFailurePlanImpl{Store: store, StatePath: statePath}
+}
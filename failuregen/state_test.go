@@ -0,0 +1,68 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestAssuredFailurePlanResumesAfterRestart(t *testing.T) {
+	store := &memPlanStore{points: []failuregen.FailurePoint{
+		failuregen.SChTargetStateP1,
+		failuregen.BeforeMetadataMigration,
+		failuregen.SChTargetStateNU0,
+	}}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	// the first incarnation crashes on the first planned failure
+	plan := failuregen.NewAssuredFailurePlanWithState(store, statePath)
+	err := plan.FailMaybe(failuregen.SChTargetStateP1)
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+
+	// the restarted process moves past the failure-point that already fired
+	plan = failuregen.NewAssuredFailurePlanWithState(store, statePath)
+	require.NoError(t, plan.FailMaybe(failuregen.SChTargetStateP1))
+	pending, err := plan.(*failuregen.AssuredFailurePlanImpl).
+		PendingFailurePoints()
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{
+		failuregen.BeforeMetadataMigration,
+		failuregen.SChTargetStateNU0,
+	}, pending)
+
+	err = plan.FailMaybe(failuregen.BeforeMetadataMigration)
+	info, ok := failuregen.InfoFromError(err)
+	require.True(t, ok)
+	require.Equal(t, int64(2), info.Sequence)
+}
+
+func TestFailureGeneratorSaveAndLoadState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	g := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, g.LoadState(statePath))
+	require.Equal(t, failuregen.GeneratorState{}, g.State())
+
+	require.NoError(t, g.SetFailureProbability(1.0))
+	for i := 0; i < 3; i++ {
+		require.Error(t, g.FailMaybe())
+	}
+	require.NoError(t, g.SaveState(statePath))
+
+	restarted := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	require.NoError(t, restarted.SetFailureProbability(1.0))
+	require.NoError(t, restarted.LoadState(statePath))
+	require.Equal(
+		t,
+		failuregen.GeneratorState{Calls: 3, Injected: 3},
+		restarted.State())
+	info, ok := failuregen.InfoFromError(restarted.FailMaybe())
+	require.True(t, ok)
+	require.Equal(t, int64(4), info.Sequence)
+}
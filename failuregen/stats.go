@@ -0,0 +1,65 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"fmt"
+	"time"
+)
+
+// GeneratorStats counts what a FailureGeneratorImpl injected
+type GeneratorStats struct {
+	// Calls is the number of FailMaybe calls evaluated
+	Calls int64
+	// Failures is the number of failures injected
+	Failures int64
+	// Delays is the number of delays injected
+	Delays int64
+	// TotalDelay is the cumulative injected delay
+	TotalDelay time.Duration
+}
+
+func (s GeneratorStats) String() string {
+	return fmt.Sprintf(
+		"{calls: %d, failures: %d, delays: %d, totalDelay: %v}",
+		s.Calls,
+		s.Failures,
+		s.Delays,
+		s.TotalDelay)
+}
+
+func (s GeneratorStats) sub(o GeneratorStats) GeneratorStats {
+	return GeneratorStats{
+		Calls:      s.Calls - o.Calls,
+		Failures:   s.Failures - o.Failures,
+		Delays:     s.Delays - o.Delays,
+		TotalDelay: s.TotalDelay - o.TotalDelay,
+	}
+}
+
+func (fg *FailureGeneratorImpl) totalStats() GeneratorStats {
+	return GeneratorStats{
+		Calls:      fg.callCtr.Load(),
+		Failures:   fg.injectedCtr.Load(),
+		Delays:     fg.delayCtr.Load(),
+		TotalDelay: fg.delayTotal.Load(),
+	}
+}
+
+// Stats returns what the generator injected since it was created, or since
+// the latest ResetStats
+func (fg *FailureGeneratorImpl) Stats() GeneratorStats {
+	stats := fg.totalStats()
+	if baseline := fg.statsBaseline.Load(); baseline != nil {
+		stats = stats.sub(*baseline)
+	}
+	return stats
+}
+
+// ResetStats zeroes the stats (e.g. at the start of a test sharing the
+// generator with previous ones). The position of the generator, see State,
+// is not affected.
+func (fg *FailureGeneratorImpl) ResetStats() {
+	baseline := fg.totalStats()
+	fg.statsBaseline.Store(&baseline)
+}
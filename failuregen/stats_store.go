@@ -0,0 +1,128 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StatsReport is the summary of a run reported by a test runner to a
+// StatsStore
+type StatsReport struct {
+	// Runner names the test runner, reports of a runner replace its previous
+	// ones
+	Runner  string
+	Time    time.Time
+	Summary RunSummary
+}
+
+// StatsStore abstracts the storage of the results of runs, so that
+// distributed test runners can report them centrally (see ChaosRun.Publish).
+// FilePlanStore's counterpart is FileStatsStore, ConsulStatsStore shares
+// reports through Consul.
+type StatsStore interface {
+	// Report stores the report, replacing the previous report of its runner
+	Report(report StatsReport) error
+	// Reports returns the latest report of each runner, sorted by runner
+	Reports() ([]StatsReport, error)
+	// String describes the location of the reports (used in error messages)
+	String() string
+}
+
+// validRunner checks that runner can key a report
+func validRunner(runner string) error {
+	if runner == "" || strings.ContainsAny(runner, `/\`) {
+		return errors.Errorf("Invalid runner name %q", runner)
+	}
+	return nil
+}
+
+// sortReports sorts reports by runner
+func sortReports(reports []StatsReport) {
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Runner < reports[j].Runner
+	})
+}
+
+// FileStatsStore is a StatsStore keeping a JSON file per runner in a
+// directory, e.g. on a file system shared by the runners
+type FileStatsStore struct {
+	Dir string
+}
+
+// Report writes the report to the file of its runner, replacing it
+// atomically
+func (s *FileStatsStore) Report(report StatsReport) error {
+	if err := validRunner(report.Runner); err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize stats report")
+	}
+	path := filepath.Join(s.Dir, report.Runner+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, bytes, 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write stats report: %s", tmpPath)
+	}
+	return errors.Wrapf(
+		os.Rename(tmpPath, path),
+		"Failed to install stats report: %s",
+		path)
+}
+
+// Reports reads the reports of the directory, a missing directory holds no
+// report
+func (s *FileStatsStore) Reports() ([]StatsReport, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list stats reports: %s", s.Dir)
+	}
+	reports := make([]StatsReport, 0, len(paths))
+	for _, path := range paths {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Failed to read stats report: %s",
+				path)
+		}
+		var report StatsReport
+		if err := json.Unmarshal(bytes, &report); err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"Malformed stats report: %s",
+				path)
+		}
+		reports = append(reports, report)
+	}
+	sortReports(reports)
+	return reports, nil
+}
+
+func (s *FileStatsStore) String() string {
+	return s.Dir
+}
+
+// Publish reports the summary of the run so far to store, under runner
+// (ProcessName if empty)
+func (r *ChaosRun) Publish(store StatsStore, runner string) error {
+	if runner == "" {
+		runner = ProcessName()
+	}
+	return errors.Wrapf(
+		store.Report(StatsReport{
+			Runner:  runner,
+			Time:    time.Now(),
+			Summary: r.Summary(),
+		}),
+		"Failed to publish run stats to %s",
+		store)
+}
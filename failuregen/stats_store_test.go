@@ -0,0 +1,195 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// fakeConsul serves the subset of the KV API of Consul used by the stores
+type fakeConsul struct {
+	mu    sync.Mutex
+	kv    map[string]fakeConsulEntry
+	index uint64
+	// failGets makes GET requests fail while set
+	failGets bool
+}
+
+type fakeConsulEntry struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut:
+		if query.Has("cas") {
+			cas, err := strconv.ParseUint(query.Get("cas"), 10, 64)
+			if err != nil || cas != f.kv[key].ModifyIndex {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		value, _ := io.ReadAll(r.Body)
+		f.index++
+		f.kv[key] = fakeConsulEntry{key, value, f.index}
+		w.Write([]byte("true"))
+	case f.failGets:
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	case query.Has("recurse"):
+		var entries []fakeConsulEntry
+		for k, entry := range f.kv {
+			if strings.HasPrefix(k, key) {
+				entries = append(entries, entry)
+			}
+		}
+		if entries == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	default:
+		entry, ok := f.kv[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if query.Has("raw") {
+			w.Write(entry.Value)
+			return
+		}
+		json.NewEncoder(w).Encode([]fakeConsulEntry{entry})
+	}
+}
+
+func startFakeConsul(t *testing.T) (*failuregen.ConsulKV, *fakeConsul) {
+	consul := &fakeConsul{kv: make(map[string]fakeConsulEntry)}
+	srv := httptest.NewServer(consul)
+	t.Cleanup(srv.Close)
+	return &failuregen.ConsulKV{Addr: srv.URL}, consul
+}
+
+func TestConsulPlanStore(t *testing.T) {
+	kv, _ := startFakeConsul(t)
+	store := &failuregen.ConsulPlanStore{KV: kv, Key: "chaos/plan"}
+	points, err := store.Load()
+	require.NoError(t, err)
+	require.Empty(t, points)
+
+	// runners sharing the key share a live plan
+	runnerA := failuregen.NewAssuredFailurePlanWithStore(store)
+	runnerB := failuregen.NewAssuredFailurePlanWithStore(
+		&failuregen.ConsulPlanStore{KV: kv, Key: "chaos/plan"})
+	require.NoError(t, runnerB.FailMaybe(failuregen.SChTargetStateP1))
+	require.NoError(t, failuregen.NewPlanBuilder().
+		Fail(failuregen.SChTargetStateP1).
+		Save(store))
+	require.True(t, failuregen.IsInjected(
+		runnerA.FailMaybe(failuregen.SChTargetStateP1)))
+	require.True(t, failuregen.IsInjected(
+		runnerB.FailMaybe(failuregen.SChTargetStateP1)))
+
+	require.NoError(t, kv.Put("chaos/plan", []byte("[")))
+	_, err = store.Load()
+	var malformed *failuregen.ErrMalformedPlan
+	require.True(t, errors.As(err, &malformed))
+	_, err = (&failuregen.ConsulPlanStore{
+		KV:  &failuregen.ConsulKV{Addr: "http://127.0.0.1:1"},
+		Key: "chaos/plan",
+	}).Load()
+	require.Error(t, err)
+}
+
+func TestConsulPlanStoreWrites(t *testing.T) {
+	kv, consul := startFakeConsul(t)
+	_, index, err := kv.GetWithIndex("chaos/plan")
+	require.NoError(t, err)
+	require.Zero(t, index)
+	swapped, err := kv.PutCAS("chaos/plan", []byte("[]"), index)
+	require.NoError(t, err)
+	require.True(t, swapped)
+	// a write based on a stale index is rejected
+	swapped, err = kv.PutCAS("chaos/plan", []byte(`["A"]`), index)
+	require.NoError(t, err)
+	require.False(t, swapped)
+	value, index, err := kv.GetWithIndex("chaos/plan")
+	require.NoError(t, err)
+	require.Equal(t, "[]", string(value))
+	require.NotZero(t, index)
+
+	// Save keeps the expiry of the plan
+	store := &failuregen.ConsulPlanStore{KV: kv, Key: "chaos/plan"}
+	require.NoError(t, store.SaveUntil(
+		[]failuregen.FailurePoint{"A"},
+		time.Now().Add(time.Hour)))
+	require.NoError(t, store.Save([]failuregen.FailurePoint{"B"}))
+	value, _, err = kv.Get("chaos/plan")
+	require.NoError(t, err)
+	require.Contains(t, string(value), "ExpiresAt")
+
+	// rather than drop it if the plan can't be read
+	consul.mu.Lock()
+	consul.failGets = true
+	consul.mu.Unlock()
+	require.Error(t, store.Save([]failuregen.FailurePoint{"C"}))
+	consul.mu.Lock()
+	consul.failGets = false
+	consul.mu.Unlock()
+	points, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, []failuregen.FailurePoint{"B"}, points)
+}
+
+func TestStatsStores(t *testing.T) {
+	kv, _ := startFakeConsul(t)
+	stores := map[string]failuregen.StatsStore{
+		"file": &failuregen.FileStatsStore{Dir: t.TempDir()},
+		"consul": &failuregen.ConsulStatsStore{
+			KV:     kv,
+			Prefix: "chaos/stats",
+		},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			reports, err := store.Reports()
+			require.NoError(t, err)
+			require.Empty(t, reports)
+
+			fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+			require.NoError(t, fg.SetFailureProbability(1))
+			run := failuregen.NewChaosRun(fg)
+			run.Observe(fg.FailMaybe())
+			require.NoError(t, run.Publish(store, "runner-b"))
+			run.Observe(fg.FailMaybe())
+			require.NoError(t, run.Publish(store, "runner-b"))
+			require.NoError(t, run.Publish(store, "runner-a"))
+			require.Error(t, run.Publish(store, "runner/a"))
+
+			reports, err = store.Reports()
+			require.NoError(t, err)
+			require.Len(t, reports, 2)
+			require.Equal(t, "runner-a", reports[0].Runner)
+			require.Equal(t, "runner-b", reports[1].Runner)
+			require.Equal(t, int64(2), reports[1].Summary.Injected)
+			require.Equal(t, int64(2), reports[1].Summary.InjectedErrors)
+		})
+	}
+}
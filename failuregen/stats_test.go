@@ -0,0 +1,41 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratorStats(t *testing.T) {
+	fg := failuregen.NewFailureGenerator().(*failuregen.FailureGeneratorImpl)
+	var slept time.Duration
+	fg.DelayFn = func(d time.Duration) { slept += d }
+	require.NoError(t, fg.SetFailureProbability(1))
+	require.NoError(t, fg.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   1000,
+		DelayProbability: 1,
+	}))
+	for i := 0; i < 10; i++ {
+		require.Error(t, fg.FailMaybe())
+	}
+	stats := fg.Stats()
+	require.Equal(t, int64(10), stats.Calls)
+	require.Equal(t, int64(10), stats.Failures)
+	require.Equal(t, int64(10), stats.Delays)
+	require.Equal(t, slept, stats.TotalDelay)
+
+	fg.ResetStats()
+	require.Equal(t, failuregen.GeneratorStats{}, fg.Stats())
+	require.NoError(t, fg.SetFailureProbability(0))
+	require.NoError(t, fg.FailMaybe())
+	stats = fg.Stats()
+	require.Equal(t, int64(1), stats.Calls)
+	require.Equal(t, int64(0), stats.Failures)
+	require.Equal(t, int64(1), stats.Delays)
+	// the position of the generator is unaffected
+	require.Equal(t, int64(11), fg.State().Calls)
+}
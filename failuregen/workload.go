@@ -0,0 +1,104 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PlanProgress reports the failure-points of a plan which are yet to fire
+type PlanProgress interface {
+	PendingFailurePoints() ([]FailurePoint, error)
+}
+
+// WorkloadConfig configures DriveWorkload
+type WorkloadConfig struct {
+	// Plan whose failure-points are all expected to fire
+	Plan PlanProgress
+	// SuccessesAfterFaults is the number of successful invocations required
+	// once all planned failure-points have fired
+	SuccessesAfterFaults int
+	// MaxIterations bounds the number of invocations, 0 means unbounded
+	MaxIterations int
+	// Interval is the pause between invocations
+	Interval time.Duration
+	// OnAllFired, if set, is called once when all planned failure-points
+	// have fired (e.g. to clear the plan so the workload can succeed)
+	OnAllFired func() error
+}
+
+// WorkloadStats summarizes a DriveWorkload run
+type WorkloadStats struct {
+	// Iterations is the number of invocations of the operation
+	Iterations int
+	// Failures is the number of invocations which returned an error
+	Failures int
+	// LastErr is the error returned by the last failed invocation
+	LastErr error
+}
+
+// DriveWorkload repeatedly invokes op until all failure-points in the plan
+// have fired and op has subsequently succeeded SuccessesAfterFaults times.
+// Only invocations started after the last planned failure fired count as
+// successes. An error is returned if the context is done or MaxIterations
+// is exhausted first.
+func DriveWorkload(
+	ctx context.Context,
+	cfg WorkloadConfig,
+	op func(ctx context.Context) error,
+) (WorkloadStats, error) {
+	stats := WorkloadStats{}
+	allFired := false
+	successes := 0
+	for cfg.MaxIterations == 0 || stats.Iterations < cfg.MaxIterations {
+		if err := ctx.Err(); err != nil {
+			return stats, errors.Wrapf(
+				err,
+				"workload interrupted after %d iterations",
+				stats.Iterations)
+		}
+		if !allFired {
+			pending, err := cfg.Plan.PendingFailurePoints()
+			if err != nil {
+				return stats, errors.Wrap(err, "Couldn't load plan progress")
+			}
+			if len(pending) == 0 {
+				allFired = true
+				if cfg.OnAllFired != nil {
+					if err := cfg.OnAllFired(); err != nil {
+						return stats, errors.Wrap(err, "OnAllFired hook")
+					}
+				}
+			}
+		}
+
+		err := op(ctx)
+		stats.Iterations++
+		if err != nil {
+			stats.Failures++
+			stats.LastErr = err
+		} else if allFired {
+			successes++
+			if successes >= cfg.SuccessesAfterFaults {
+				return stats, nil
+			}
+		}
+
+		if cfg.Interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(cfg.Interval):
+			}
+		}
+	}
+	pending, _ := cfg.Plan.PendingFailurePoints()
+	return stats, errors.Errorf(
+		"workload did not converge in %d iterations "+
+			"(pending failure-points: %v, successes after faults: %d)",
+		stats.Iterations,
+		pending,
+		successes)
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Rubrik, Inc.
+
+package failuregen_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+func TestDriveWorkloadRunsTillPlanIsExhausted(t *testing.T) {
+	store := &memPlanStore{}
+	planned := []failuregen.FailurePoint{
+		failuregen.SChTargetStateP1,
+		failuregen.AfterMetadataMigration,
+	}
+	require.NoError(t, store.Save(planned))
+	afp := failuregen.NewAssuredFailurePlanWithStore(store)
+
+	// each iteration exercises the next failure-point in round-robin order
+	calls := 0
+	op := func(ctx context.Context) error {
+		fp := planned[calls%len(planned)]
+		calls++
+		return afp.FailMaybe(fp)
+	}
+
+	// with the plan never cleared the workload cannot converge
+	_, err := failuregen.DriveWorkload(
+		context.Background(),
+		failuregen.WorkloadConfig{
+			Plan:                 afp.(failuregen.PlanProgress),
+			SuccessesAfterFaults: 1,
+			MaxIterations:        10,
+		},
+		op)
+	require.Error(t, err)
+
+	calls = 0
+	afp = failuregen.NewAssuredFailurePlanWithStore(store)
+	stats, err := failuregen.DriveWorkload(
+		context.Background(),
+		failuregen.WorkloadConfig{
+			Plan:                 afp.(failuregen.PlanProgress),
+			SuccessesAfterFaults: 3,
+			MaxIterations:        10,
+			OnAllFired:           func() error { return store.Save(nil) },
+		},
+		op)
+	require.NoError(t, err)
+	require.Equal(t, 5, stats.Iterations)
+	require.Equal(t, 2, stats.Failures)
+	require.ErrorIs(t, stats.LastErr, failuregen.ErrInjectedFailure)
+}
+
+func TestDriveWorkloadStopsOnContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	afp := AssureFailuresAt(t, failuregen.SChTargetStateP1)
+
+	iterations := 0
+	_, err := failuregen.DriveWorkload(
+		ctx,
+		failuregen.WorkloadConfig{
+			Plan:                 afp.(failuregen.PlanProgress),
+			SuccessesAfterFaults: 1,
+		},
+		func(ctx context.Context) error {
+			iterations++
+			if iterations == 3 {
+				cancel()
+			}
+			return nil
+		})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 3, iterations)
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package faultydial provides a dialer which injects delays and failures in
+// the stages of connection establishment (name resolution, TCP connect and
+// TLS handshake), so that connection-establishment budgets and their
+// interaction with retry policies can be validated end to end.
+package faultydial
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// StageFault is the fault injected in one stage of connection establishment
+type StageFault struct {
+	// Delay is added before the stage runs
+	Delay time.Duration
+	// Fg, when non-nil, fails the stage as per the generator
+	Fg failuregen.FailureGenerator
+}
+
+// Plus returns a StageFault that delays by the sum of both delays and fails
+// if either of the generators injects a failure
+func (s StageFault) Plus(o StageFault) StageFault {
+	sum := StageFault{Delay: s.Delay + o.Delay, Fg: s.Fg}
+	if o.Fg != nil {
+		if sum.Fg == nil {
+			sum.Fg = o.Fg
+		} else {
+			sum.Fg = failuregen.Any(s.Fg, o.Fg)
+		}
+	}
+	return sum
+}
+
+// ConnectProfile is the fault profile of the connect path
+type ConnectProfile struct {
+	// Resolve applies to name resolution, it is skipped for addresses that
+	// are IP literals
+	Resolve StageFault
+	// Dial applies to the TCP connect
+	Dial StageFault
+	// TLS applies to the TLS handshake, it only matters for DialTLSContext
+	TLS StageFault
+}
+
+// Plus composes two profiles stage by stage (e.g. a slow resolver profile
+// with a slow network profile)
+func (p ConnectProfile) Plus(o ConnectProfile) ConnectProfile {
+	return ConnectProfile{
+		Resolve: p.Resolve.Plus(o.Resolve),
+		Dial:    p.Dial.Plus(o.Dial),
+		TLS:     p.TLS.Plus(o.TLS),
+	}
+}
+
+// TotalDelay is the delay the profile adds to establishing a TLS connection
+// to a host name
+func (p ConnectProfile) TotalDelay() time.Duration {
+	return p.Resolve.Delay + p.Dial.Delay + p.TLS.Delay
+}
+
+// Dialer dials connections through the faults of Profile. The delays honor the
+// deadline of the context, so a connect budget expressed as a context
+// deadline (or Dialer.Timeout) is enforced across all stages.
+type Dialer struct {
+	// Profile is the faults injected while connecting
+	Profile ConnectProfile
+	// Dialer dials the TCP connections, zero value is used when nil
+	Dialer *net.Dialer
+	// Resolver resolves host names, net.DefaultResolver is used when nil
+	Resolver *net.Resolver
+	// TLSConfig is used by DialTLSContext
+	TLSConfig *tls.Config
+}
+
+// stage waits out the delay of fault and then consults its generator
+func stage(ctx context.Context, name string, fault StageFault) error {
+	if fault.Delay > 0 {
+		timer := time.NewTimer(fault.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "%s delay", name)
+		}
+	}
+	if fault.Fg != nil {
+		if err := fault.Fg.FailMaybe(); err != nil {
+			return errors.Wrap(err, name)
+		}
+	}
+	return nil
+}
+
+func (d *Dialer) netDialer() *net.Dialer {
+	if d.Dialer != nil {
+		return d.Dialer
+	}
+	return &net.Dialer{}
+}
+
+func (d *Dialer) resolver() *net.Resolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+	return net.DefaultResolver
+}
+
+// DialContext connects to address on the named network, injecting the
+// resolve and dial faults of the profile
+func (d *Dialer) DialContext(
+	ctx context.Context,
+	network, address string,
+) (net.Conn, error) {
+	dialer := d.netDialer()
+	if dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialer.Timeout)
+		defer cancel()
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid address %s", address)
+	}
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		if err := stage(ctx, "resolve", d.Profile.Resolve); err != nil {
+			return nil, err
+		}
+		addrs, err = d.resolver().LookupHost(ctx, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolve %s", host)
+		}
+	}
+	if err := stage(ctx, "dial", d.Profile.Dial); err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, errors.Wrapf(err, "dial %s", address)
+}
+
+// DialTLSContext connects to address like DialContext and then performs the
+// TLS handshake, injecting the TLS faults of the profile
+func (d *Dialer) DialTLSContext(
+	ctx context.Context,
+	network, address string,
+) (net.Conn, error) {
+	if d.netDialer().Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.netDialer().Timeout)
+		defer cancel()
+	}
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := stage(ctx, "tls", d.Profile.TLS); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	config := &tls.Config{}
+	if d.TLSConfig != nil {
+		config = d.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "tls handshake with %s", address)
+	}
+	return tlsConn, nil
+}
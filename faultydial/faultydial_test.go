@@ -0,0 +1,92 @@
+// Copyright 2024 Rubrik, Inc.
+
+package faultydial_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/faultydial"
+	"github.com/stretchr/testify/require"
+)
+
+func alwaysFail(t *testing.T) failuregen.FailureGenerator {
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1))
+	return fg
+}
+
+func TestConnectProfilePlus(t *testing.T) {
+	slowDNS := faultydial.ConnectProfile{
+		Resolve: faultydial.StageFault{Delay: 100 * time.Millisecond},
+	}
+	slowNet := faultydial.ConnectProfile{
+		Dial: faultydial.StageFault{Delay: 50 * time.Millisecond},
+		TLS:  faultydial.StageFault{Delay: 20 * time.Millisecond},
+	}
+	profile := slowDNS.Plus(slowNet)
+	require.Equal(t, 170*time.Millisecond, profile.TotalDelay())
+
+	failing := faultydial.ConnectProfile{
+		Dial: faultydial.StageFault{Fg: alwaysFail(t)},
+	}
+	profile = profile.Plus(failing)
+	require.Error(t, profile.Dial.Fg.FailMaybe())
+	require.Nil(t, profile.Resolve.Fg)
+}
+
+func TestDialerStages(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	address := net.JoinHostPort("localhost", port)
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = "example.com"
+
+	ctx := context.Background()
+	d := &faultydial.Dialer{
+		Profile: faultydial.ConnectProfile{
+			Resolve: faultydial.StageFault{Delay: 30 * time.Millisecond},
+			Dial:    faultydial.StageFault{Delay: 30 * time.Millisecond},
+			TLS:     faultydial.StageFault{Delay: 30 * time.Millisecond},
+		},
+		TLSConfig: tlsConfig,
+	}
+	start := time.Now()
+	conn, err := d.DialTLSContext(ctx, "tcp", address)
+	require.NoError(t, err)
+	require.NoError(t, conn.(*tls.Conn).Handshake())
+	conn.Close()
+	require.GreaterOrEqual(t, time.Since(start), d.Profile.TotalDelay())
+
+	// the budget covers all stages
+	budgetCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = d.DialTLSContext(budgetCtx, "tcp", address)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	for _, failing := range []string{"resolve", "dial", "tls"} {
+		profile := faultydial.ConnectProfile{}
+		switch failing {
+		case "resolve":
+			profile.Resolve.Fg = alwaysFail(t)
+		case "dial":
+			profile.Dial.Fg = alwaysFail(t)
+		case "tls":
+			profile.TLS.Fg = alwaysFail(t)
+		}
+		d := &faultydial.Dialer{Profile: profile, TLSConfig: tlsConfig}
+		_, err = d.DialTLSContext(ctx, "tcp", address)
+		require.ErrorIs(t, err, failuregen.ErrInjectedFailure, failing)
+		require.Contains(t, err.Error(), failing)
+	}
+}
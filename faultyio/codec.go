@@ -0,0 +1,185 @@
+// Copyright 2024 Rubrik, Inc.
+
+package faultyio
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+type truncatingReader struct {
+	r         io.Reader
+	fg        failuregen.FailureGenerator
+	truncated bool
+}
+
+// TruncatingReader wraps r so that the stream ends early (with io.EOF) at
+// the first read for which fg injects a failure, as for a truncated
+// compressed frame
+func TruncatingReader(r io.Reader, fg failuregen.FailureGenerator) io.Reader {
+	return &truncatingReader{r: r, fg: fg}
+}
+
+func (tr *truncatingReader) Read(p []byte) (int, error) {
+	if !tr.truncated && tr.fg.FailMaybe() != nil {
+		tr.truncated = true
+	}
+	if tr.truncated {
+		return 0, io.EOF
+	}
+	return tr.r.Read(p)
+}
+
+type truncatingWriter struct {
+	w         io.Writer
+	fg        failuregen.FailureGenerator
+	truncated bool
+}
+
+// TruncatingWriter wraps w so that data is silently discarded from the first
+// write for which fg injects a failure, leaving a truncated stream behind (as
+// after a crash in the middle of writing a compressed frame)
+func TruncatingWriter(w io.Writer, fg failuregen.FailureGenerator) io.Writer {
+	return &truncatingWriter{w: w, fg: fg}
+}
+
+func (tw *truncatingWriter) Write(p []byte) (int, error) {
+	if !tw.truncated && tw.fg.FailMaybe() != nil {
+		tw.truncated = true
+	}
+	if tw.truncated {
+		return len(p), nil
+	}
+	return tw.w.Write(p)
+}
+
+type corruptingReader struct {
+	r       io.Reader
+	fg      failuregen.FailureGenerator
+	randGen *randutil.LockedRandGen
+}
+
+// CorruptingReader wraps r so that a random byte of every read for which fg
+// injects a failure has its bits flipped, which surfaces as checksum
+// mismatches (or decoding errors) in codecs reading the stream
+func CorruptingReader(r io.Reader, fg failuregen.FailureGenerator) io.Reader {
+	return &corruptingReader{
+		r:       r,
+		fg:      fg,
+		randGen: randutil.NewLockedRandGen(time.Now().UnixNano()),
+	}
+}
+
+func (cr *corruptingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 && cr.fg.FailMaybe() != nil {
+		p[cr.randGen.Intn(n)] ^= 0xff
+	}
+	return n, err
+}
+
+type corruptingWriter struct {
+	w       io.Writer
+	fg      failuregen.FailureGenerator
+	randGen *randutil.LockedRandGen
+	buf     []byte
+}
+
+// CorruptingWriter wraps w so that a random byte of every write for which fg
+// injects a failure has its bits flipped. The caller's buffer is not
+// modified.
+func CorruptingWriter(w io.Writer, fg failuregen.FailureGenerator) io.Writer {
+	return &corruptingWriter{
+		w:       w,
+		fg:      fg,
+		randGen: randutil.NewLockedRandGen(time.Now().UnixNano()),
+	}
+}
+
+func (cw *corruptingWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 || cw.fg.FailMaybe() == nil {
+		return cw.w.Write(p)
+	}
+	cw.buf = append(cw.buf[:0], p...)
+	cw.buf[cw.randGen.Intn(len(p))] ^= 0xff
+	return cw.w.Write(cw.buf)
+}
+
+// CodecFaults configures the faults injected around a compression codec,
+// nil generators inject no fault
+type CodecFaults struct {
+	// Truncate truncates the compressed stream
+	Truncate failuregen.FailureGenerator
+	// Corrupt corrupts bytes of the compressed stream
+	Corrupt failuregen.FailureGenerator
+	// Decompress fails reads of the decompressed stream with injected errors
+	Decompress failuregen.FailureGenerator
+}
+
+// compressed wraps a compressed stream with the truncation and corruption
+// faults
+func (f CodecFaults) compressed(r io.Reader) io.Reader {
+	if f.Truncate != nil {
+		r = TruncatingReader(r, f.Truncate)
+	}
+	if f.Corrupt != nil {
+		r = CorruptingReader(r, f.Corrupt)
+	}
+	return r
+}
+
+// DecompressingReader returns a reader decompressing compressed with the
+// codec reader created by newReader (e.g. a zstd or snappy reader), with
+// faults injected into the compressed stream and decompressed reads
+func DecompressingReader(
+	compressed io.Reader,
+	faults CodecFaults,
+	newReader func(io.Reader) (io.Reader, error),
+) (io.Reader, error) {
+	r, err := newReader(faults.compressed(compressed))
+	if err != nil {
+		return nil, err
+	}
+	if faults.Decompress != nil {
+		r = Reader(r, faults.Decompress)
+	}
+	return r, nil
+}
+
+// GzipReader is DecompressingReader for gzip
+func GzipReader(compressed io.Reader, faults CodecFaults) (io.Reader, error) {
+	return DecompressingReader(
+		compressed,
+		faults,
+		func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) })
+}
+
+// CompressingWriter returns a writer compressing into w with the codec
+// writer created by newWriter, with the truncation and corruption faults
+// injected into the compressed stream written to w. The Decompress
+// generator of faults is not used.
+func CompressingWriter(
+	w io.Writer,
+	faults CodecFaults,
+	newWriter func(io.Writer) io.WriteCloser,
+) io.WriteCloser {
+	if faults.Truncate != nil {
+		w = TruncatingWriter(w, faults.Truncate)
+	}
+	if faults.Corrupt != nil {
+		w = CorruptingWriter(w, faults.Corrupt)
+	}
+	return newWriter(w)
+}
+
+// GzipWriter is CompressingWriter for gzip
+func GzipWriter(w io.Writer, faults CodecFaults) io.WriteCloser {
+	return CompressingWriter(
+		w,
+		faults,
+		func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+}
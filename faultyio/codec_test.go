@@ -0,0 +1,83 @@
+// Copyright 2024 Rubrik, Inc.
+
+package faultyio_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/faultyio"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+func gzipped(t *testing.T, payload string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(payload))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestGzipReaderFaults(t *testing.T) {
+	// poorly compressible, so that the compressed stream spans many reads
+	payload := string(randutil.RandBytes(64 << 10))
+	compressed := gzipped(t, payload)
+
+	r, err := faultyio.GzipReader(
+		bytes.NewReader(compressed),
+		faultyio.CodecFaults{})
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, payload, string(data))
+
+	// the header is read whole, the truncation hits the compressed body
+	truncateFg := failuregen.NewFailureGenerator()
+	r, err = faultyio.DecompressingReader(
+		bytes.NewReader(compressed),
+		faultyio.CodecFaults{Truncate: truncateFg},
+		func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) })
+	require.NoError(t, err)
+	require.NoError(t, truncateFg.SetFailureProbability(1.0))
+	_, err = io.ReadAll(r)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	r, err = faultyio.GzipReader(
+		bytes.NewReader(compressed),
+		faultyio.CodecFaults{Corrupt: generatorWithProbability(t, 1.0)})
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	require.Error(t, err)
+
+	r, err = faultyio.GzipReader(
+		bytes.NewReader(compressed),
+		faultyio.CodecFaults{Decompress: generatorWithProbability(t, 1.0)})
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+}
+
+func TestGzipWriterTruncates(t *testing.T) {
+	var buf bytes.Buffer
+	truncateFg := failuregen.NewFailureGenerator()
+	w := faultyio.GzipWriter(&buf, faultyio.CodecFaults{Truncate: truncateFg})
+	_, err := w.Write(randutil.RandBytes(256 << 10))
+	require.NoError(t, err)
+	require.NoError(t, truncateFg.SetFailureProbability(1.0))
+	_, err = w.Write(randutil.RandBytes(256 << 10))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package faultyio wraps io.Reader and io.Writer implementations to inject
+// errors, short reads / writes and delays, as configured through failure
+// generators, so that stream-processing code (compression, encryption,
+// upload) can be tested under I/O faults. Serialized messages can likewise be
+// truncated, corrupted or substituted with wrong but valid messages around
+// (de)serialization, see PayloadFaults.
+package faultyio
+
+import (
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+type faultyReader struct {
+	r       io.Reader
+	fg      failuregen.FailureGenerator
+	shortFg failuregen.FailureGenerator
+	randGen *randutil.LockedRandGen
+}
+
+// Reader wraps r so that reads fail (and are delayed) as per fg. A read
+// that fails returns no data and the injected error.
+func Reader(r io.Reader, fg failuregen.FailureGenerator) io.Reader {
+	return &faultyReader{r: r, fg: fg}
+}
+
+// ShortReader wraps r so that reads are short as per fg: a read for which fg
+// injects a failure fills only a random prefix (at least 1 byte) of the
+// buffer. Short reads are legal, callers that assume full reads break.
+func ShortReader(r io.Reader, fg failuregen.FailureGenerator) io.Reader {
+	return &faultyReader{
+		r:       r,
+		shortFg: fg,
+		randGen: randutil.NewLockedRandGen(time.Now().UnixNano()),
+	}
+}
+
+func (fr *faultyReader) Read(p []byte) (int, error) {
+	if fr.fg != nil {
+		if err := fr.fg.FailMaybe(); err != nil {
+			return 0, errors.Wrap(err, "read")
+		}
+	}
+	if fr.shortFg != nil && len(p) > 1 && fr.shortFg.FailMaybe() != nil {
+		p = p[:1+fr.randGen.Intn(len(p)-1)]
+	}
+	return fr.r.Read(p)
+}
+
+type faultyWriter struct {
+	w       io.Writer
+	fg      failuregen.FailureGenerator
+	shortFg failuregen.FailureGenerator
+	randGen *randutil.LockedRandGen
+}
+
+// Writer wraps w so that writes fail (and are delayed) as per fg. A write
+// that fails writes nothing and returns the injected error.
+func Writer(w io.Writer, fg failuregen.FailureGenerator) io.Writer {
+	return &faultyWriter{w: w, fg: fg}
+}
+
+// ShortWriter wraps w so that writes are short as per fg: a write for which
+// fg injects a failure writes only a random prefix of the buffer and returns
+// the injected error, as required of short writes by io.Writer.
+func ShortWriter(w io.Writer, fg failuregen.FailureGenerator) io.Writer {
+	return &faultyWriter{
+		w:       w,
+		shortFg: fg,
+		randGen: randutil.NewLockedRandGen(time.Now().UnixNano()),
+	}
+}
+
+func (fw *faultyWriter) Write(p []byte) (int, error) {
+	if fw.fg != nil {
+		if err := fw.fg.FailMaybe(); err != nil {
+			return 0, errors.Wrap(err, "write")
+		}
+	}
+	if fw.shortFg != nil && len(p) > 0 {
+		if err := fw.shortFg.FailMaybe(); err != nil {
+			n, wErr := fw.w.Write(p[:fw.randGen.Intn(len(p))])
+			if wErr != nil {
+				return n, wErr
+			}
+			return n, errors.Wrap(err, "short write")
+		}
+	}
+	return fw.w.Write(p)
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Rubrik, Inc.
+
+package faultyio_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/faultyio"
+)
+
+func generatorWithProbability(
+	t *testing.T,
+	p float32,
+) failuregen.FailureGenerator {
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(p))
+	return fg
+}
+
+func TestReaderInjectsErrors(t *testing.T) {
+	r := faultyio.Reader(
+		strings.NewReader("payload"),
+		generatorWithProbability(t, 1.0))
+	_, err := io.ReadAll(r)
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+
+	r = faultyio.Reader(
+		strings.NewReader("payload"),
+		generatorWithProbability(t, 0.0))
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "payload", string(data))
+}
+
+func TestShortReaderPreservesData(t *testing.T) {
+	payload := strings.Repeat("0123456789", 100)
+	r := faultyio.ShortReader(
+		strings.NewReader(payload),
+		generatorWithProbability(t, 1.0))
+
+	buf := make([]byte, 64)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Less(t, n, len(buf))
+
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, payload, string(buf[:n])+string(rest))
+}
+
+func TestWriterInjectsErrors(t *testing.T) {
+	var sink bytes.Buffer
+	w := faultyio.Writer(&sink, generatorWithProbability(t, 1.0))
+	n, err := w.Write([]byte("payload"))
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+	require.Zero(t, n)
+	require.Zero(t, sink.Len())
+}
+
+func TestShortWriterWritesPrefix(t *testing.T) {
+	var sink bytes.Buffer
+	w := faultyio.ShortWriter(&sink, generatorWithProbability(t, 1.0))
+	n, err := w.Write([]byte("payload"))
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+	require.Less(t, n, len("payload"))
+	require.Equal(t, "payload"[:n], sink.String())
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Rubrik, Inc.
+
+package faultyio
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+// payloadRandGen picks the bytes damaged by PayloadFaults
+var payloadRandGen = randutil.NewLockedRandGen(time.Now().UnixNano())
+
+// PayloadFaults configures the faults injected into serialized messages (e.g.
+// protobuf or JSON payloads of an RPC layer), nil generators inject no fault.
+// The faults are silent: they damage the payload for the decoder to detect,
+// which tests the error handling of the layer independent of the network.
+// Substitutions go further, replacing the payload with a valid one the
+// decoder can't tell from the original.
+type PayloadFaults struct {
+	// Truncate cuts the payload at a random length
+	Truncate failuregen.FailureGenerator
+	// Corrupt flips the bits of a random byte of the payload
+	Corrupt failuregen.FailureGenerator
+	// Substitute replaces the payload with the one returned by Substitution
+	Substitute failuregen.FailureGenerator
+	// Substitution returns a wrong but valid payload to use in place of
+	// payload (e.g. a stale read, or an off-by-one sequence number), it must
+	// not modify payload
+	Substitution func(payload []byte) []byte
+}
+
+// Apply returns payload damaged as per the faults, substitution coming
+// first. The payload itself is not modified, and is returned as is if no
+// fault is injected.
+func (f PayloadFaults) Apply(payload []byte) []byte {
+	if len(payload) == 0 {
+		return payload
+	}
+	if f.Substitute != nil &&
+		f.Substitution != nil &&
+		f.Substitute.FailMaybe() != nil {
+		payload = f.Substitution(payload)
+		if len(payload) == 0 {
+			return payload
+		}
+	}
+	if f.Truncate != nil && f.Truncate.FailMaybe() != nil {
+		payload = payload[:payloadRandGen.Intn(len(payload))]
+	}
+	if len(payload) > 0 && f.Corrupt != nil && f.Corrupt.FailMaybe() != nil {
+		payload = append([]byte(nil), payload...)
+		payload[payloadRandGen.Intn(len(payload))] ^= 0xff
+	}
+	return payload
+}
+
+// Marshal wraps a serialization function (such as proto.Marshal) so that the
+// payloads it produces are damaged as per faults post-serialization
+func Marshal[T any](
+	marshal func(T) ([]byte, error),
+	faults PayloadFaults,
+) func(T) ([]byte, error) {
+	return func(msg T) ([]byte, error) {
+		payload, err := marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		return faults.Apply(payload), nil
+	}
+}
+
+// Unmarshal wraps a deserialization function (such as proto.Unmarshal) so
+// that the payloads it is given are damaged as per faults pre-deserialization
+func Unmarshal[T any](
+	unmarshal func([]byte, T) error,
+	faults PayloadFaults,
+) func([]byte, T) error {
+	return func(payload []byte, msg T) error {
+		return unmarshal(faults.Apply(payload), msg)
+	}
+}
+
+// JSONMarshal is Marshal for json.Marshal
+func JSONMarshal(faults PayloadFaults) func(interface{}) ([]byte, error) {
+	return Marshal(json.Marshal, faults)
+}
+
+// JSONUnmarshal is Unmarshal for json.Unmarshal
+func JSONUnmarshal(faults PayloadFaults) func([]byte, interface{}) error {
+	return Unmarshal(json.Unmarshal, faults)
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Rubrik, Inc.
+
+package faultyio_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/faultyio"
+)
+
+type message struct {
+	Name  string
+	Count int
+}
+
+func TestJSONPayloadFaults(t *testing.T) {
+	msg := message{Name: "upgrade", Count: 3}
+
+	marshal := faultyio.JSONMarshal(faultyio.PayloadFaults{})
+	payload, err := marshal(msg)
+	require.NoError(t, err)
+	var decoded message
+	unmarshal := faultyio.JSONUnmarshal(faultyio.PayloadFaults{
+		Truncate: generatorWithProbability(t, 0),
+	})
+	require.NoError(t, unmarshal(payload, &decoded))
+	require.Equal(t, msg, decoded)
+
+	// truncated post-serialization
+	marshal = faultyio.JSONMarshal(faultyio.PayloadFaults{
+		Truncate: generatorWithProbability(t, 1),
+	})
+	truncated, err := marshal(msg)
+	require.NoError(t, err)
+	require.Less(t, len(truncated), len(payload))
+	require.Equal(t, payload[:len(truncated)], truncated)
+	require.Error(t, faultyio.JSONUnmarshal(faultyio.PayloadFaults{})(
+		truncated,
+		&decoded))
+
+	// truncated pre-deserialization
+	unmarshal = faultyio.JSONUnmarshal(faultyio.PayloadFaults{
+		Truncate: generatorWithProbability(t, 1),
+	})
+	require.Error(t, unmarshal(payload, &decoded))
+}
+
+func TestPayloadCorruption(t *testing.T) {
+	payload := []byte("serialized message")
+	original := append([]byte(nil), payload...)
+	faults := faultyio.PayloadFaults{
+		Corrupt: generatorWithProbability(t, 1),
+	}
+	for i := 0; i < 10; i++ {
+		corrupted := faults.Apply(payload)
+		require.Equal(t, original, payload)
+		require.Len(t, corrupted, len(payload))
+		diff := 0
+		for j := range corrupted {
+			if corrupted[j] != payload[j] {
+				diff++
+				require.Equal(t, payload[j]^0xff, corrupted[j])
+			}
+		}
+		require.Equal(t, 1, diff)
+	}
+
+	// generic wrappers fit codecs with typed messages
+	marshal := faultyio.Marshal(
+		func(s string) ([]byte, error) { return []byte(s), nil },
+		faults)
+	corrupted, err := marshal("message")
+	require.NoError(t, err)
+	require.NotEqual(t, "message", string(corrupted))
+	require.Empty(t, faults.Apply(nil))
+}
+
+func TestPayloadSubstitution(t *testing.T) {
+	msg := message{Name: "upgrade", Count: 3}
+	stale, err := json.Marshal(message{Name: "upgrade", Count: 2})
+	require.NoError(t, err)
+	faults := faultyio.PayloadFaults{
+		Substitute: generatorWithProbability(t, 1),
+		Substitution: func([]byte) []byte {
+			return stale
+		},
+	}
+	payload, err := faultyio.JSONMarshal(faults)(msg)
+	require.NoError(t, err)
+	var decoded message
+	require.NoError(t, json.Unmarshal(payload, &decoded))
+	require.Equal(t, 2, decoded.Count)
+
+	faults.Substitute = generatorWithProbability(t, 0)
+	require.NoError(t, faultyio.JSONUnmarshal(faults)(payload, &decoded))
+	require.Equal(t, 2, decoded.Count)
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package faultysys wraps commonly wrapped syscalls (fsync, fallocate,
+// sendfile) with injection hooks, so that low-level error paths (EINTR, EIO,
+// ENOSPC...) which never occur in CI can be forced. Code under test calls
+// the syscalls through a Syscalls, which is a passthrough unless faults are
+// configured.
+package faultysys
+
+import (
+	"syscall"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// Fault fails a syscall with Errno (EIO by default) whenever Fg injects a
+// failure. The syscall is not performed when it fails. Injected errors are
+// bare errnos, as returned by the syscall package, so that code comparing
+// errnos directly sees them as genuine.
+type Fault struct {
+	Fg    failuregen.FailureGenerator
+	Errno syscall.Errno
+}
+
+// inject returns the error to fail the syscall with, nil if the syscall is
+// to be performed
+func (f Fault) inject() error {
+	if f.Fg == nil || f.Fg.FailMaybe() == nil {
+		return nil
+	}
+	if f.Errno == 0 {
+		return syscall.EIO
+	}
+	return f.Errno
+}
+
+// Syscalls performs syscalls subject to their faults, the zero value injects
+// no fault
+type Syscalls struct {
+	FsyncFault     Fault
+	FallocateFault Fault
+	SendfileFault  Fault
+}
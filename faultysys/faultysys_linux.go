@@ -0,0 +1,29 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build linux
+
+package faultysys
+
+import (
+	"syscall"
+)
+
+// Fallocate manipulates the allocated space of fd, see fallocate(2)
+func (s *Syscalls) Fallocate(fd int, mode uint32, off, size int64) error {
+	if err := s.FallocateFault.inject(); err != nil {
+		return err
+	}
+	return syscall.Fallocate(fd, mode, off, size)
+}
+
+// Sendfile copies count bytes from infd to outfd, see sendfile(2)
+func (s *Syscalls) Sendfile(
+	outfd, infd int,
+	offset *int64,
+	count int,
+) (int, error) {
+	if err := s.SendfileFault.inject(); err != nil {
+		return 0, err
+	}
+	return syscall.Sendfile(outfd, infd, offset, count)
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build linux
+
+package faultysys_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/faultysys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyscalls(t *testing.T) {
+	dir := t.TempDir()
+	in, err := os.Create(filepath.Join(dir, "in"))
+	require.NoError(t, err)
+	defer in.Close()
+	out, err := os.Create(filepath.Join(dir, "out"))
+	require.NoError(t, err)
+	defer out.Close()
+	_, err = in.WriteString("hello")
+	require.NoError(t, err)
+
+	fg := failuregen.NewFailureGenerator()
+	s := &faultysys.Syscalls{
+		FsyncFault:     faultysys.Fault{Fg: fg, Errno: syscall.EINTR},
+		FallocateFault: faultysys.Fault{Fg: fg},
+		SendfileFault:  faultysys.Fault{Fg: fg, Errno: syscall.ENOSPC},
+	}
+	require.NoError(t, s.Fsync(int(in.Fd())))
+	require.NoError(t, s.SyncFile(in))
+	require.NoError(t, s.Fallocate(int(out.Fd()), 0, 0, 4096))
+	offset := int64(0)
+	n, err := s.Sendfile(int(out.Fd()), int(in.Fd()), &offset, 5)
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+
+	require.NoError(t, fg.SetFailureProbability(1))
+	require.Equal(t, syscall.EINTR, s.Fsync(int(in.Fd())))
+	require.ErrorIs(t, s.SyncFile(in), syscall.EINTR)
+	require.Equal(t, syscall.EIO, s.Fallocate(int(out.Fd()), 0, 0, 4096))
+	_, err = s.Sendfile(int(out.Fd()), int(in.Fd()), &offset, 5)
+	require.Equal(t, syscall.ENOSPC, err)
+
+	var passthrough faultysys.Syscalls
+	require.NoError(t, passthrough.Fsync(int(in.Fd())))
+}
@@ -0,0 +1,27 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build unix
+
+package faultysys
+
+import (
+	"os"
+	"syscall"
+)
+
+// Fsync flushes fd to stable storage, see fsync(2)
+func (s *Syscalls) Fsync(fd int) error {
+	if err := s.FsyncFault.inject(); err != nil {
+		return err
+	}
+	return syscall.Fsync(fd)
+}
+
+// SyncFile flushes f to stable storage like os.File.Sync, subject to the
+// fsync fault. Errors are wrapped in an *os.PathError, as by os.File.Sync.
+func (s *Syscalls) SyncFile(f *os.File) error {
+	if err := s.FsyncFault.inject(); err != nil {
+		return &os.PathError{Op: "sync", Path: f.Name(), Err: err}
+	}
+	return f.Sync()
+}
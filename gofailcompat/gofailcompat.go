@@ -0,0 +1,150 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package gofailcompat exposes the failure-points of a failuregen.Registry
+// through the HTTP activation protocol of gofail, so that tooling and
+// scripts written for gofail drive failuregen generators unchanged:
+//
+//	curl -X PUT -d 'return' http://host:port/pkg.Func.step
+//	curl -X PUT -d '25%return' http://host:port/pkg.Func.step
+//	curl -X PUT -d 'sleep(100)' http://host:port/pkg.Func.step
+//	curl http://host:port/pkg.Func.step
+//	curl http://host:port/
+//	curl -X DELETE http://host:port/pkg.Func.step
+//
+// Supported terms are return (with an optional, ignored, value), p%return,
+// sleep(ms) / p%sleep(ms) and off. failuregen delays are uniformly
+// distributed, a sleep(ms) term delays by up to ms milliseconds.
+package gofailcompat
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+var termRegexp = regexp.MustCompile(
+	`^(?:(\d+(?:\.\d+)?)%)?(return|sleep)(?:\((.*)\))?$`)
+
+// Handler serves the gofail HTTP protocol for a registry
+type Handler struct {
+	registry *failuregen.Registry
+	mu       sync.Mutex
+	terms    map[failuregen.FailurePoint]string
+}
+
+// NewHandler creates a handler activating failure-points of registry
+func NewHandler(registry *failuregen.Registry) *Handler {
+	return &Handler{
+		registry: registry,
+		terms:    make(map[failuregen.FailurePoint]string),
+	}
+}
+
+// generatorForTerm returns the generator implementing a gofail term, nil for
+// off
+func generatorForTerm(term string) (failuregen.FailureGenerator, error) {
+	if term == "off" {
+		return nil, nil
+	}
+	m := termRegexp.FindStringSubmatch(term)
+	if m == nil {
+		return nil, errors.Errorf("Unsupported failpoint term %q", term)
+	}
+	p := float32(1.0)
+	if m[1] != "" {
+		percent, err := strconv.ParseFloat(m[1], 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid percentage in %q", term)
+		}
+		p = float32(percent / 100)
+	}
+	fg := failuregen.NewFailureGenerator()
+	switch m[2] {
+	case "return":
+		return fg, errors.Wrapf(
+			fg.SetFailureProbability(p),
+			"Invalid term %q",
+			term)
+	default:
+		ms, err := strconv.ParseInt(m[3], 10, 32)
+		if err != nil || ms <= 0 || ms > 1<<31/1000 {
+			return nil, errors.Errorf("Invalid sleep in %q", term)
+		}
+		return fg, errors.Wrapf(
+			fg.SetDelayConfig(failuregen.DelayConfig{
+				MaxDelayMicros:   int32(ms * 1000),
+				DelayProbability: p,
+			}),
+			"Invalid term %q",
+			term)
+	}
+}
+
+// ServeHTTP implements the gofail protocol
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fp := failuregen.FailurePoint(strings.TrimPrefix(r.URL.Path, "/"))
+	switch {
+	case r.Method == http.MethodGet && fp == "":
+		h.list(w)
+	case r.Method == http.MethodGet:
+		h.mu.Lock()
+		term, ok := h.terms[fp]
+		h.mu.Unlock()
+		if !ok {
+			http.Error(w, "failpoint is not active", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, term)
+	case r.Method == http.MethodPut && fp != "":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		term := strings.TrimSpace(string(body))
+		fg, err := generatorForTerm(term)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.set(fp, term, fg)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && fp != "":
+		h.set(fp, "off", nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported request", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) set(
+	fp failuregen.FailurePoint,
+	term string,
+	fg failuregen.FailureGenerator,
+) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registry.SetGenerator(fp, fg)
+	if fg == nil {
+		delete(h.terms, fp)
+		return
+	}
+	h.terms[fp] = term
+}
+
+// list writes the failure-points of the registry with their terms, as
+// name=term lines
+func (h *Handler) list(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fp := range h.registry.Points() {
+		fmt.Fprintf(w, "%s=%s\n", fp, h.terms[fp])
+	}
+}
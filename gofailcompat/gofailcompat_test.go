@@ -0,0 +1,72 @@
+// Copyright 2024 Rubrik, Inc.
+
+package gofailcompat_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/gofailcompat"
+)
+
+func request(
+	t *testing.T,
+	srv *httptest.Server,
+	method string,
+	path string,
+	body string,
+) (int, string) {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestGofailProtocol(t *testing.T) {
+	registry := failuregen.NewRegistry()
+	registry.Register("store.Flush.before")
+	srv := httptest.NewServer(gofailcompat.NewHandler(registry))
+	defer srv.Close()
+
+	code, _ := request(t, srv, http.MethodPut, "/store.Commit.before", "panic")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = request(t, srv, http.MethodPut, "/store.Commit.before",
+		`return("boom")`)
+	require.Equal(t, http.StatusNoContent, code)
+	err := registry.FailMaybe("store.Commit.before")
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+
+	code, body := request(t, srv, http.MethodGet, "/store.Commit.before", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "return(\"boom\")\n", body)
+
+	code, body = request(t, srv, http.MethodGet, "/", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(
+		t,
+		"store.Commit.before=return(\"boom\")\nstore.Flush.before=\n",
+		body)
+
+	code, _ = request(t, srv, http.MethodPut, "/store.Flush.before",
+		"0%return")
+	require.Equal(t, http.StatusNoContent, code)
+	require.NoError(t, registry.FailMaybe("store.Flush.before"))
+
+	code, _ = request(t, srv, http.MethodDelete, "/store.Commit.before", "")
+	require.Equal(t, http.StatusNoContent, code)
+	require.NoError(t, registry.FailMaybe("store.Commit.before"))
+	code, _ = request(t, srv, http.MethodGet, "/store.Commit.before", "")
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,343 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package manifest records what a chaos run was made of (seeds, generator
+// settings, assured-failure-plans and proxy settings) as a single JSON
+// artifact, from which the run can be re-instantiated exactly.
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+)
+
+// modulePath is the path of this module, whose version is recorded
+const modulePath = "github.com/rubrikinc/failure-test-utils"
+
+// GeneratorManifest records a failure generator
+type GeneratorManifest struct {
+	Seed   int64
+	Config failuregen.GeneratorConfig
+}
+
+// ProxyManifest records a proxy. Generators are referenced by their name in
+// the manifest, an empty name is a generator that never fails.
+type ProxyManifest struct {
+	Frontend             string
+	Backend              string
+	RecvGenerator        string
+	AcceptGenerator      string
+	PreDialGenerator     string `json:",omitempty"`
+	PartialReadGenerator string `json:",omitempty"`
+	// The other fields are as per tcpproxy.ProxyConfig. Connection
+	// targeting, accept hooks and substitutions are code and are not
+	// recorded.
+	MaxConnLifetime       time.Duration `json:",omitempty"`
+	ConnLifetimeJitter    time.Duration `json:",omitempty"`
+	MaxSegmentSize        int           `json:",omitempty"`
+	FragmentDelay         time.Duration `json:",omitempty"`
+	PartialReadStall      time.Duration `json:",omitempty"`
+	FrontendSocketOptions tcpproxy.SocketOptions
+	BackendSocketOptions  tcpproxy.SocketOptions
+	ByteRangeRules        []tcpproxy.ByteRangeRule `json:",omitempty"`
+	ConnLimits            tcpproxy.ConnLimits
+	BlockedDirections     []tcpproxy.Direction `json:",omitempty"`
+	TraceBufferSize       int                  `json:",omitempty"`
+	RecordCorruptions     bool                 `json:",omitempty"`
+	DecisionRetention     int                  `json:",omitempty"`
+	DecisionSpillPath     string               `json:",omitempty"`
+}
+
+// RunManifest records a chaos run
+type RunManifest struct {
+	// Version is the version of this module the run used, "(devel)" when
+	// built from a checkout
+	Version string
+	// Seed is the seed of the run itself (e.g. of the workload), if any
+	Seed int64
+	// Generators, Plans and Proxies are keyed by name
+	Generators map[string]GeneratorManifest
+	Plans      map[string][]failuregen.FailurePoint
+	Proxies    map[string]ProxyManifest
+}
+
+// moduleVersion returns the version of this module in the running binary
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// NewRunManifest creates an empty manifest for a run seeded with seed
+func NewRunManifest(seed int64) *RunManifest {
+	return &RunManifest{
+		Version:    moduleVersion(),
+		Seed:       seed,
+		Generators: make(map[string]GeneratorManifest),
+		Plans:      make(map[string][]failuregen.FailurePoint),
+		Proxies:    make(map[string]ProxyManifest),
+	}
+}
+
+// AddGenerator records the seed and settings of fg under name
+func (m *RunManifest) AddGenerator(
+	name string,
+	fg failuregen.FailureGenerator,
+) error {
+	impl, ok := fg.(*failuregen.FailureGeneratorImpl)
+	if !ok {
+		return errors.Errorf("Generator %s (%T) can't be recorded", name, fg)
+	}
+	m.Generators[name] = GeneratorManifest{
+		Seed:   impl.Seed(),
+		Config: impl.Config(),
+	}
+	return nil
+}
+
+// AddPlan records the assured-failure-plan currently in store under name
+func (m *RunManifest) AddPlan(name string, store failuregen.PlanStore) error {
+	points, err := store.Load()
+	if err != nil {
+		return err
+	}
+	m.Plans[name] = points
+	return nil
+}
+
+// generatorName returns the name of fg in fgs
+func generatorName(
+	fgs map[string]failuregen.FailureGenerator,
+	fg failuregen.FailureGenerator,
+) (string, error) {
+	if fg == nil {
+		return "", nil
+	}
+	for name, candidate := range fgs {
+		if candidate == fg {
+			return name, nil
+		}
+	}
+	return "", errors.New("Proxy uses an unnamed generator")
+}
+
+// AddProxy records the settings of proxy under name. fgs are the generators
+// added to the manifest, by name, the generators of the proxy must be among
+// them (unnamed generators can't be re-instantiated).
+func (m *RunManifest) AddProxy(
+	name string,
+	proxy tcpproxy.TCPProxy,
+	fgs map[string]failuregen.FailureGenerator,
+) error {
+	reconfigurer, ok := proxy.(tcpproxy.Reconfigurer)
+	if !ok {
+		return errors.Errorf("Proxy %s doesn't expose its config", name)
+	}
+	cfg := reconfigurer.Config()
+	pm := ProxyManifest{
+		Frontend:              proxy.FrontendHostPort(),
+		Backend:               proxy.BackendHostPort(),
+		MaxConnLifetime:       cfg.MaxConnLifetime,
+		ConnLifetimeJitter:    cfg.ConnLifetimeJitter,
+		MaxSegmentSize:        cfg.MaxSegmentSize,
+		FragmentDelay:         cfg.FragmentDelay,
+		PartialReadStall:      cfg.PartialReadStall,
+		FrontendSocketOptions: cfg.FrontendSocketOptions,
+		BackendSocketOptions:  cfg.BackendSocketOptions,
+		ByteRangeRules:        cfg.ByteRangeRules,
+		ConnLimits:            cfg.ConnLimits,
+		BlockedDirections:     cfg.BlockedDirections,
+		TraceBufferSize:       cfg.TraceBufferSize,
+		RecordCorruptions:     cfg.RecordCorruptions,
+		DecisionRetention:     cfg.DecisionRetention,
+		DecisionSpillPath:     cfg.DecisionSpillPath,
+	}
+	for _, ref := range []struct {
+		name *string
+		fg   failuregen.FailureGenerator
+	}{
+		{&pm.RecvGenerator, cfg.RecvFg},
+		{&pm.AcceptGenerator, cfg.AcceptFg},
+		{&pm.PreDialGenerator, cfg.PreDialFg},
+		{&pm.PartialReadGenerator, cfg.PartialReadFg},
+	} {
+		fgName, err := generatorName(fgs, ref.fg)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to record proxy %s", name)
+		}
+		if _, ok := m.Generators[fgName]; fgName != "" && !ok {
+			return errors.Errorf(
+				"Failed to record proxy %s: generator %s not added",
+				name,
+				fgName)
+		}
+		*ref.name = fgName
+	}
+	m.Proxies[name] = pm
+	return nil
+}
+
+// Write saves the manifest to path
+func (m *RunManifest) Write(path string) error {
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to serialize run manifest")
+	}
+	return errors.Wrapf(
+		os.WriteFile(path, bytes, 0644),
+		"Failed to write run manifest: %s",
+		path)
+}
+
+// ReadRunManifest loads the manifest saved at path
+func ReadRunManifest(path string) (*RunManifest, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read run manifest: %s", path)
+	}
+	m := &RunManifest{}
+	if err := json.Unmarshal(bytes, m); err != nil {
+		return nil, errors.Wrapf(err, "Malformed run manifest: %s", path)
+	}
+	return m, nil
+}
+
+// NewGenerators re-instantiates the recorded generators, by name. They make
+// the same decisions as the recorded ones given the same sequence of calls.
+func (m *RunManifest) NewGenerators() (
+	map[string]failuregen.FailureGenerator,
+	error,
+) {
+	fgs := make(map[string]failuregen.FailureGenerator, len(m.Generators))
+	for name, gm := range m.Generators {
+		fg := failuregen.NewFailureGeneratorWithSeed(gm.Seed)
+		if err := fg.SetFailureProbability(
+			gm.Config.FailureProbability,
+		); err != nil {
+			return nil, errors.Wrapf(err, "generator %s", name)
+		}
+		if err := fg.SetDelayConfig(gm.Config.Delay); err != nil {
+			return nil, errors.Wrapf(err, "generator %s", name)
+		}
+		fgs[name] = fg
+	}
+	return fgs, nil
+}
+
+// RestorePlans saves the recorded plans to their stores, keyed by plan name
+func (m *RunManifest) RestorePlans(
+	stores map[string]failuregen.PlanStore,
+) error {
+	names := make([]string, 0, len(m.Plans))
+	for name := range m.Plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		store, ok := stores[name]
+		if !ok {
+			return errors.Errorf("No store for plan %s", name)
+		}
+		if err := store.Save(m.Plans[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartProxy re-instantiates the proxy recorded under name, using fgs as
+// returned by NewGenerators. The proxy listens on the recorded frontend, set
+// ProxyManifest.Frontend beforehand to listen elsewhere.
+func (m *RunManifest) StartProxy(
+	ctx context.Context,
+	name string,
+	fgs map[string]failuregen.FailureGenerator,
+) (*tcpproxy.Proxy, error) {
+	pm, ok := m.Proxies[name]
+	if !ok {
+		return nil, errors.Errorf("Unknown proxy %s", name)
+	}
+	generator := func(fgName string) (failuregen.FailureGenerator, error) {
+		if fgName == "" {
+			return nil, nil
+		}
+		fg, ok := fgs[fgName]
+		if !ok {
+			return nil, errors.Errorf(
+				"Unknown generator %s of proxy %s",
+				fgName,
+				name)
+		}
+		return fg, nil
+	}
+	cfg := tcpproxy.ProxyConfig{
+		MaxConnLifetime:       pm.MaxConnLifetime,
+		ConnLifetimeJitter:    pm.ConnLifetimeJitter,
+		MaxSegmentSize:        pm.MaxSegmentSize,
+		FragmentDelay:         pm.FragmentDelay,
+		PartialReadStall:      pm.PartialReadStall,
+		FrontendSocketOptions: pm.FrontendSocketOptions,
+		BackendSocketOptions:  pm.BackendSocketOptions,
+		ByteRangeRules:        pm.ByteRangeRules,
+		ConnLimits:            pm.ConnLimits,
+		BlockedDirections:     pm.BlockedDirections,
+		TraceBufferSize:       pm.TraceBufferSize,
+		RecordCorruptions:     pm.RecordCorruptions,
+		DecisionRetention:     pm.DecisionRetention,
+		DecisionSpillPath:     pm.DecisionSpillPath,
+	}
+	var err error
+	for _, ref := range []struct {
+		fg     *failuregen.FailureGenerator
+		fgName string
+	}{
+		{&cfg.RecvFg, pm.RecvGenerator},
+		{&cfg.AcceptFg, pm.AcceptGenerator},
+		{&cfg.PreDialFg, pm.PreDialGenerator},
+		{&cfg.PartialReadFg, pm.PartialReadGenerator},
+	} {
+		if *ref.fg, err = generator(ref.fgName); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RecvFg == nil {
+		cfg.RecvFg = failuregen.NewFailureGenerator()
+	}
+	if cfg.AcceptFg == nil {
+		cfg.AcceptFg = failuregen.NewFailureGenerator()
+	}
+	proxy, err := tcpproxy.NewProxy(
+		ctx,
+		pm.Frontend,
+		pm.Backend,
+		cfg.RecvFg,
+		cfg.AcceptFg)
+	if err != nil {
+		return nil, err
+	}
+	if err := proxy.Reconfigure(cfg); err != nil {
+		proxy.Stop()
+		return nil, err
+	}
+	return proxy, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Rubrik, Inc.
+
+package manifest_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/manifest"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunManifestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+
+	recv := failuregen.NewFailureGeneratorWithSeed(42)
+	require.NoError(t, recv.SetFailureProbability(0.3))
+	require.NoError(t, recv.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   100,
+		DelayProbability: 0.5,
+	}))
+	accept := failuregen.NewFailureGeneratorWithSeed(7)
+	fgs := map[string]failuregen.FailureGenerator{
+		"recv":   recv,
+		"accept": accept,
+	}
+
+	proxy, err := tcpproxy.NewProxy(
+		ctx,
+		"127.0.0.1:0",
+		backend.Addr().String(),
+		recv,
+		accept)
+	require.NoError(t, err)
+	cfg := proxy.Config()
+	cfg.MaxSegmentSize = 16
+	cfg.MaxConnLifetime = time.Minute
+	require.NoError(t, proxy.Reconfigure(cfg))
+
+	planStore := &failuregen.FilePlanStore{
+		Path: filepath.Join(dir, "plan.json"),
+	}
+	require.NoError(t, planStore.Save([]failuregen.FailurePoint{
+		failuregen.BeforeMetadataMigration,
+	}))
+
+	m := manifest.NewRunManifest(1234)
+	require.NotEmpty(t, m.Version)
+	require.NoError(t, m.AddGenerator("recv", recv))
+	require.NoError(t, m.AddGenerator("accept", accept))
+	require.NoError(t, m.AddPlan("upgrade", planStore))
+	require.NoError(t, m.AddProxy("db", proxy, fgs))
+	require.Error(t, m.AddProxy("other", proxy, nil))
+	proxy.Stop()
+
+	path := filepath.Join(dir, "manifest.json")
+	require.NoError(t, m.Write(path))
+	loaded, err := manifest.ReadRunManifest(path)
+	require.NoError(t, err)
+	require.Equal(t, m, loaded)
+
+	// the re-instantiated run makes the same decisions
+	replayed, err := loaded.NewGenerators()
+	require.NoError(t, err)
+	reference := failuregen.NewFailureGeneratorWithSeed(42)
+	require.NoError(t, reference.SetFailureProbability(0.3))
+	require.NoError(t, reference.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   100,
+		DelayProbability: 0.5,
+	}))
+	for i := 0; i < 100; i++ {
+		require.Equal(
+			t,
+			reference.FailMaybe() != nil,
+			replayed["recv"].FailMaybe() != nil)
+	}
+
+	restoredStore := &failuregen.FilePlanStore{
+		Path: filepath.Join(dir, "restored.json"),
+	}
+	require.NoError(t, loaded.RestorePlans(map[string]failuregen.PlanStore{
+		"upgrade": restoredStore,
+	}))
+	points, err := restoredStore.Load()
+	require.NoError(t, err)
+	require.Equal(t, m.Plans["upgrade"], points)
+
+	pm := loaded.Proxies["db"]
+	pm.Frontend = "127.0.0.1:0"
+	loaded.Proxies["db"] = pm
+	restored, err := loaded.StartProxy(ctx, "db", replayed)
+	require.NoError(t, err)
+	defer restored.Stop()
+	restoredCfg := restored.Config()
+	require.Equal(t, 16, restoredCfg.MaxSegmentSize)
+	require.Equal(t, time.Minute, restoredCfg.MaxConnLifetime)
+	require.Equal(t, replayed["recv"], restoredCfg.RecvFg)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package mockfail makes mocked dependencies consult failure generators and
+// plans when deciding to return an error, so that mock-driven unit tests use
+// the same chaos configuration as integration tests. The helpers return
+// functions with the signature of the mocked method, as accepted by mockery
+// generated testify mocks (Return) and by gomock (DoAndReturn), e.g.
+//
+//	m.On("Get", key).Return(mockfail.Val1[string](value, mockfail.FromGenerator(fg)))
+//	m.EXPECT().Put(k, v).DoAndReturn(mockfail.Err2[string, []byte](mockfail.FromPlan(plan, fp)))
+package mockfail
+
+import (
+	"sync"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// ErrFunc decides the error returned by a mocked call, nil for success
+type ErrFunc func() error
+
+// FromGenerator returns an ErrFunc injecting failures as per fg
+func FromGenerator(fg failuregen.FailureGenerator) ErrFunc {
+	return fg.FailMaybe
+}
+
+// FromPlan returns an ErrFunc injecting failures when fp is slated for
+// failure in plan
+func FromPlan(
+	plan failuregen.AssuredFailurePlan,
+	fp failuregen.FailurePoint,
+) ErrFunc {
+	return func() error {
+		return plan.FailMaybe(fp)
+	}
+}
+
+// Sequence returns an ErrFunc returning errs in order, one per call, and nil
+// once errs are exhausted. A nil entry is a successful call.
+func Sequence(errs ...error) ErrFunc {
+	var mu sync.Mutex
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(errs) == 0 {
+			return nil
+		}
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}
+}
+
+// Err0 mocks a method with no argument returning an error
+func Err0(errFn ErrFunc) func() error {
+	return func() error {
+		return errFn()
+	}
+}
+
+// Err1 mocks a method with one argument returning an error
+func Err1[A any](errFn ErrFunc) func(A) error {
+	return func(A) error {
+		return errFn()
+	}
+}
+
+// Err2 mocks a method with two arguments returning an error
+func Err2[A, B any](errFn ErrFunc) func(A, B) error {
+	return func(A, B) error {
+		return errFn()
+	}
+}
+
+// Val0 mocks a method with no argument returning v, or the zero value of R
+// along with the error returned by errFn
+func Val0[R any](v R, errFn ErrFunc) func() (R, error) {
+	return func() (R, error) {
+		return result(v, errFn())
+	}
+}
+
+// Val1 mocks a method with one argument returning v, or the zero value of R
+// along with the error returned by errFn
+func Val1[A, R any](v R, errFn ErrFunc) func(A) (R, error) {
+	return func(A) (R, error) {
+		return result(v, errFn())
+	}
+}
+
+// Val2 mocks a method with two arguments returning v, or the zero value of R
+// along with the error returned by errFn
+func Val2[A, B, R any](v R, errFn ErrFunc) func(A, B) (R, error) {
+	return func(A, B) (R, error) {
+		return result(v, errFn())
+	}
+}
+
+func result[R any](v R, err error) (R, error) {
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return v, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Rubrik, Inc.
+
+package mockfail_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/mockfail"
+)
+
+// kvStore is a dependency of the code under test
+type kvStore interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+}
+
+// fakeKVStore is a hand-written mock backed by mockfail functions, in the
+// style of mockery generated mocks
+type fakeKVStore struct {
+	get func(string) ([]byte, error)
+	put func(string, []byte) error
+}
+
+func (f *fakeKVStore) Get(key string) ([]byte, error) {
+	return f.get(key)
+}
+
+func (f *fakeKVStore) Put(key string, value []byte) error {
+	return f.put(key, value)
+}
+
+func TestMockConsultsGenerator(t *testing.T) {
+	fg := failuregen.NewFailureGenerator()
+	var store kvStore = &fakeKVStore{
+		get: mockfail.Val1[string]([]byte("v"), mockfail.FromGenerator(fg)),
+		put: mockfail.Err2[string, []byte](mockfail.FromGenerator(fg)),
+	}
+	v, err := store.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), v)
+	require.NoError(t, store.Put("k", v))
+
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	v, err = store.Get("k")
+	require.True(t, errors.Is(err, failuregen.ErrInjectedFailure))
+	require.Nil(t, v)
+	require.Error(t, store.Put("k", v))
+}
+
+func TestSequence(t *testing.T) {
+	errFn := mockfail.Sequence(nil, failuregen.ErrInjectedFailure)
+	get := mockfail.Val0(42, errFn)
+
+	v, err := get()
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+	v, err = get()
+	require.Equal(t, failuregen.ErrInjectedFailure, err)
+	require.Zero(t, v)
+	_, err = get()
+	require.NoError(t, err)
+}
@@ -0,0 +1,57 @@
+package randutil
+
+import (
+	"time"
+)
+
+// defaultRandGen backs the package level jitter helpers
+var defaultRandGen = NewLockedRandGen(time.Now().UTC().UnixNano())
+
+// Jitter returns base randomized by up to +/- frac of it, uniformly, e.g.
+// Jitter(time.Second, 0.1) is in [900ms, 1.1s]. frac is clamped to [0, 1] so
+// that the result is never negative.
+func (r *LockedRandGen) Jitter(base time.Duration, frac float64) time.Duration {
+	if frac < 0 {
+		frac = 0
+	} else if frac > 1 {
+		frac = 1
+	}
+	spread := int64(float64(base) * frac)
+	if spread <= 0 {
+		return base
+	}
+	return base - time.Duration(spread) + time.Duration(r.Int63n(2*spread+1))
+}
+
+// ExpJitterBackoff returns the backoff before retry number attempt (starting
+// at 0), drawn uniformly in [0, min(cap, base * 2^attempt)] ("full jitter"),
+// so that clients retrying together spread out
+func (r *LockedRandGen) ExpJitterBackoff(
+	attempt int,
+	base time.Duration,
+	cap time.Duration,
+) time.Duration {
+	if base <= 0 || cap <= 0 {
+		return 0
+	}
+	ceiling := base
+	for i := 0; i < attempt && ceiling < cap; i++ {
+		// doubling can't overflow as ceiling < cap
+		ceiling *= 2
+	}
+	if ceiling > cap {
+		ceiling = cap
+	}
+	return time.Duration(r.Int63n(int64(ceiling) + 1))
+}
+
+// Jitter is LockedRandGen.Jitter on a generator shared by the package
+func Jitter(base time.Duration, frac float64) time.Duration {
+	return defaultRandGen.Jitter(base, frac)
+}
+
+// ExpJitterBackoff is LockedRandGen.ExpJitterBackoff on a generator shared
+// by the package
+func ExpJitterBackoff(attempt int, base, cap time.Duration) time.Duration {
+	return defaultRandGen.ExpJitterBackoff(attempt, base, cap)
+}
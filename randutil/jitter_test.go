@@ -0,0 +1,44 @@
+package randutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	rng := NewLockedRandGen(0)
+	for i := 0; i < 1000; i++ {
+		d := rng.Jitter(time.Second, 0.1)
+		if d < 900*time.Millisecond || d > 1100*time.Millisecond {
+			t.Fatalf("jitter out of range: %v", d)
+		}
+	}
+	if d := rng.Jitter(time.Second, 0); d != time.Second {
+		t.Errorf("expected no jitter, got %v", d)
+	}
+	for i := 0; i < 1000; i++ {
+		if d := Jitter(time.Second, 5); d < 0 || d > 2*time.Second {
+			t.Fatalf("clamped jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestExpJitterBackoff(t *testing.T) {
+	rng := NewLockedRandGen(0)
+	base, cap := 10*time.Millisecond, time.Second
+	for attempt := 0; attempt < 100; attempt++ {
+		ceiling := cap
+		if attempt < 6 {
+			ceiling = base << attempt
+		}
+		for i := 0; i < 100; i++ {
+			d := rng.ExpJitterBackoff(attempt, base, cap)
+			if d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: backoff %v not in [0, %v]", attempt, d, ceiling)
+			}
+		}
+	}
+	if d := ExpJitterBackoff(3, 0, cap); d != 0 {
+		t.Errorf("expected no backoff, got %v", d)
+	}
+}
@@ -37,6 +37,22 @@ func (r *LockedRandGen) Intn(n int) int {
 	return r.Rand.Intn(n)
 }
 
+// Int63n generates a non-negative pseudo random number between
+// [0,n) using synchronization mechanism
+func (r *LockedRandGen) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Rand.Int63n(n)
+}
+
+// Seed resets the generator to the deterministic state of seed using
+// synchronization mechanism
+func (r *LockedRandGen) Seed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Rand.Seed(seed)
+}
+
 // Int31nWOLockForTest used for testing purpose only
 func (r *LockedRandGen) Int31nWOLockForTest(n int32) int32 {
 	return r.Rand.Int31n(n)
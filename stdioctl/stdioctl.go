@@ -0,0 +1,348 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package stdioctl drives failure generators and test proxies through
+// JSON-RPC 2.0 messages, one per line, read from a stream (typically stdin)
+// and answered on another (typically stdout), so that test frameworks not
+// written in Go can embed the fault injection binary as a subprocess without
+// networking. Besides responses, the supervisor emits events as JSON-RPC
+// notifications (e.g. "proxy.started").
+//
+//	-> {"jsonrpc":"2.0","id":1,"method":"generator.set","params":{"name":"recv","probability":0.1}}
+//	<- {"jsonrpc":"2.0","id":1,"result":{}}
+//	-> {"jsonrpc":"2.0","id":2,"method":"proxy.start","params":{"name":"db","frontend":"127.0.0.1:0","backend":"127.0.0.1:3306","recvGenerator":"recv"}}
+//	<- {"jsonrpc":"2.0","method":"proxy.started","params":{"name":"db","frontend":"127.0.0.1:41234"}}
+//	<- {"jsonrpc":"2.0","id":2,"result":{"frontend":"127.0.0.1:41234"}}
+//
+// Generators are referenced by name, updating a generator affects the proxies
+// using it.
+package stdioctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	// CodeParseError is returned for lines that are not valid JSON
+	CodeParseError = -32700
+	// CodeInvalidRequest is returned for messages that are not requests
+	CodeInvalidRequest = -32600
+	// CodeMethodNotFound is returned for unknown methods
+	CodeMethodNotFound = -32601
+	// CodeInvalidParams is returned for malformed or invalid params
+	CodeInvalidParams = -32602
+	// CodeInternalError is returned when a valid request fails
+	CodeInternalError = -32603
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// GeneratorParams are the params of generator.set
+type GeneratorParams struct {
+	Name        string  `json:"name"`
+	Probability float32 `json:"probability"`
+	// MaxDelayMicros and DelayProbability configure injected delays
+	MaxDelayMicros   int32   `json:"maxDelayMicros,omitempty"`
+	DelayProbability float32 `json:"delayProbability,omitempty"`
+}
+
+// ProxyParams are the params of proxy.start, generators are referenced by
+// name and must exist
+type ProxyParams struct {
+	Name            string `json:"name"`
+	Frontend        string `json:"frontend"`
+	Backend         string `json:"backend"`
+	RecvGenerator   string `json:"recvGenerator,omitempty"`
+	AcceptGenerator string `json:"acceptGenerator,omitempty"`
+}
+
+// NameParams are the params of methods acting on a named object
+type NameParams struct {
+	Name string `json:"name"`
+}
+
+// Supervisor owns the generators and proxies driven through JSON-RPC
+type Supervisor struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	gens    map[string]failuregen.FailureGenerator
+	proxies map[string]tcpproxy.TCPProxy
+	outMu   sync.Mutex
+	enc     *json.Encoder
+}
+
+// NewSupervisor creates a supervisor, proxies it starts are bound to ctx
+func NewSupervisor(ctx context.Context) *Supervisor {
+	return &Supervisor{
+		ctx:     ctx,
+		gens:    make(map[string]failuregen.FailureGenerator),
+		proxies: make(map[string]tcpproxy.TCPProxy),
+	}
+}
+
+// Serve answers the requests read from in on out until in reaches EOF or a
+// shutdown request is served. Proxies still running are stopped on return.
+func (s *Supervisor) Serve(in io.Reader, out io.Writer) error {
+	s.outMu.Lock()
+	s.enc = json.NewEncoder(out)
+	s.outMu.Unlock()
+	defer s.stopAll()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.write(message{Error: &rpcError{CodeParseError, err.Error()}})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			s.write(message{
+				ID:    req.ID,
+				Error: &rpcError{CodeInvalidRequest, "Invalid request"},
+			})
+			continue
+		}
+		result, err := s.dispatch(req)
+		if len(req.ID) != 0 {
+			resp := message{ID: req.ID, Result: result}
+			if err != nil {
+				resp.Result = nil
+				resp.Error = toRPCError(err)
+			} else if result == nil {
+				resp.Result = struct{}{}
+			}
+			if werr := s.write(resp); werr != nil {
+				return werr
+			}
+		}
+		if req.Method == "shutdown" && err == nil {
+			return nil
+		}
+	}
+	return errors.Wrap(scanner.Err(), "Failed to read control requests")
+}
+
+// Emit writes a notification to the output of Serve, it is dropped if Serve
+// has not been called
+func (s *Supervisor) Emit(event string, params interface{}) error {
+	return s.write(message{Method: event, Params: params})
+}
+
+func (s *Supervisor) write(msg message) error {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	if s.enc == nil {
+		return nil
+	}
+	msg.JSONRPC = "2.0"
+	return errors.Wrap(s.enc.Encode(msg), "Failed to write control message")
+}
+
+func toRPCError(err error) *rpcError {
+	var rerr *rpcError
+	if errors.As(err, &rerr) {
+		return rerr
+	}
+	return &rpcError{CodeInternalError, err.Error()}
+}
+
+func invalidParams(format string, args ...interface{}) error {
+	return &rpcError{CodeInvalidParams, errors.Errorf(format, args...).Error()}
+}
+
+func decodeParams(raw json.RawMessage, params interface{}) error {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return invalidParams("Malformed params: %v", err)
+	}
+	return nil
+}
+
+func (s *Supervisor) dispatch(req request) (interface{}, error) {
+	switch req.Method {
+	case "generator.set":
+		var params GeneratorParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.setGenerator(params)
+	case "generator.remove":
+		var params NameParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.gens, params.Name)
+		return nil, nil
+	case "proxy.start":
+		var params ProxyParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.startProxy(params)
+	case "proxy.stop", "proxy.stats", "proxy.block", "proxy.blockAll",
+		"proxy.unblock", "proxy.unblockAll":
+		var params NameParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.proxyMethod(req.Method, params.Name)
+	case "shutdown":
+		return nil, nil
+	}
+	return nil, &rpcError{CodeMethodNotFound, "Unknown method " + req.Method}
+}
+
+func (s *Supervisor) setGenerator(params GeneratorParams) error {
+	if params.Name == "" {
+		return invalidParams("Generator name is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fg, ok := s.gens[params.Name]
+	if !ok {
+		fg = failuregen.NewFailureGenerator()
+	}
+	if err := fg.SetFailureProbability(params.Probability); err != nil {
+		return invalidParams("%v", err)
+	}
+	err := fg.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   params.MaxDelayMicros,
+		DelayProbability: params.DelayProbability,
+	})
+	if err != nil {
+		return invalidParams("%v", err)
+	}
+	s.gens[params.Name] = fg
+	return nil
+}
+
+// generator returns the named generator, an empty name is a generator that
+// never fails
+func (s *Supervisor) generator(name string) (
+	failuregen.FailureGenerator,
+	error,
+) {
+	if name == "" {
+		return failuregen.NewFailureGenerator(), nil
+	}
+	if fg, ok := s.gens[name]; ok {
+		return fg, nil
+	}
+	return nil, invalidParams("Unknown generator %s", name)
+}
+
+func (s *Supervisor) startProxy(params ProxyParams) (interface{}, error) {
+	if params.Name == "" {
+		return nil, invalidParams("Proxy name is required")
+	}
+	s.mu.Lock()
+	if _, ok := s.proxies[params.Name]; ok {
+		s.mu.Unlock()
+		return nil, invalidParams("Proxy %s already exists", params.Name)
+	}
+	recvFg, err := s.generator(params.RecvGenerator)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	acceptFg, err := s.generator(params.AcceptGenerator)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	proxy, err := tcpproxy.NewTCPProxy(
+		s.ctx,
+		params.Frontend,
+		params.Backend,
+		recvFg,
+		acceptFg)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.proxies[params.Name] = proxy
+	s.mu.Unlock()
+
+	result := map[string]string{
+		"name":     params.Name,
+		"frontend": proxy.FrontendHostPort(),
+	}
+	s.Emit("proxy.started", result)
+	return result, nil
+}
+
+func (s *Supervisor) proxyMethod(method, name string) (interface{}, error) {
+	s.mu.Lock()
+	proxy, ok := s.proxies[name]
+	if ok && method == "proxy.stop" {
+		delete(s.proxies, name)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, invalidParams("Unknown proxy %s", name)
+	}
+	switch method {
+	case "proxy.stop":
+		proxy.Stop()
+		s.Emit("proxy.stopped", NameParams{Name: name})
+	case "proxy.stats":
+		return proxy.Stats(), nil
+	case "proxy.block":
+		proxy.BlockIncomingConns()
+	case "proxy.blockAll":
+		proxy.BlockAllTraffic()
+	case "proxy.unblock":
+		proxy.UnblockIncomingConns()
+	case "proxy.unblockAll":
+		proxy.UnblockAllTraffic()
+	}
+	return nil, nil
+}
+
+func (s *Supervisor) stopAll() {
+	s.mu.Lock()
+	proxies := s.proxies
+	s.proxies = make(map[string]tcpproxy.TCPProxy)
+	s.mu.Unlock()
+	for name, proxy := range proxies {
+		proxy.Stop()
+		s.Emit("proxy.stopped", NameParams{Name: name})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Rubrik, Inc.
+
+package stdioctl_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/rubrikinc/failure-test-utils/stdioctl"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+type client struct {
+	t   *testing.T
+	in  io.Writer
+	out *bufio.Scanner
+	id  int
+}
+
+// call sends a request and returns its response, along with the
+// notifications emitted before it
+func (c *client) call(method, params string) (message, []message) {
+	c.id++
+	_, err := io.WriteString(c.in, `{"jsonrpc":"2.0","id":`+
+		strconv.Itoa(c.id)+`,"method":"`+method+
+		`","params":`+params+"}\n")
+	require.NoError(c.t, err)
+	var events []message
+	for c.out.Scan() {
+		var msg message
+		require.NoError(c.t, json.Unmarshal(c.out.Bytes(), &msg))
+		if msg.ID == nil {
+			events = append(events, msg)
+			continue
+		}
+		require.Equal(c.t, c.id, *msg.ID)
+		return msg, events
+	}
+	c.t.Fatal("no response")
+	return message{}, nil
+}
+
+func TestSupervisor(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- stdioctl.NewSupervisor(context.Background()).Serve(inR, outW)
+		outW.Close()
+	}()
+	c := &client{t: t, in: inW, out: bufio.NewScanner(outR)}
+
+	resp, _ := c.call("generator.set", `{"name":"accept","probability":1}`)
+	require.Nil(t, resp.Error)
+	resp, _ = c.call("generator.set", `{"name":"bad","probability":2}`)
+	require.Equal(t, stdioctl.CodeInvalidParams, resp.Error.Code)
+	resp, _ = c.call("no.such.method", `{}`)
+	require.Equal(t, stdioctl.CodeMethodNotFound, resp.Error.Code)
+
+	resp, events := c.call("proxy.start", `{"name":"p","frontend":"127.0.0.1:0",`+
+		`"backend":"`+backend.Addr().String()+`","acceptGenerator":"accept"}`)
+	require.Nil(t, resp.Error)
+	require.Len(t, events, 1)
+	require.Equal(t, "proxy.started", events[0].Method)
+	var started map[string]string
+	require.NoError(t, json.Unmarshal(resp.Result, &started))
+
+	// every connection is dropped on accept
+	conn, err := net.Dial("tcp", started["frontend"])
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	conn.Close()
+
+	resp, _ = c.call("proxy.stats", `{"name":"p"}`)
+	var stats struct{ FrontendDropCtr int64 }
+	require.NoError(t, json.Unmarshal(resp.Result, &stats))
+	require.Equal(t, int64(1), stats.FrontendDropCtr)
+
+	// generators are live, disabling accept failures lets traffic through
+	resp, _ = c.call("generator.set", `{"name":"accept","probability":0}`)
+	require.Nil(t, resp.Error)
+	conn, err = net.Dial("tcp", started["frontend"])
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf))
+	conn.Close()
+
+	resp, events = c.call("proxy.stop", `{"name":"p"}`)
+	require.Nil(t, resp.Error)
+	require.Equal(t, "proxy.stopped", events[0].Method)
+	resp, _ = c.call("proxy.stop", `{"name":"p"}`)
+	require.Equal(t, stdioctl.CodeInvalidParams, resp.Error.Code)
+
+	resp, _ = c.call("shutdown", `{}`)
+	require.Nil(t, resp.Error)
+	require.NoError(t, <-done)
+}
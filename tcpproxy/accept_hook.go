@@ -0,0 +1,79 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"net"
+
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// AcceptAction is what the proxy does with an accepted connection
+type AcceptAction int
+
+const (
+	// AcceptProxy proxies the connection as usual, subject to the faults of
+	// the proxy
+	AcceptProxy AcceptAction = iota
+	// AcceptDrop closes the connection, it counts as a frontend drop
+	AcceptDrop
+	// AcceptHijack hands the connection over to a custom handler
+	AcceptHijack
+)
+
+// AcceptDecision is the decision of an AcceptHook
+type AcceptDecision struct {
+	Action AcceptAction
+	// Handler serves hijacked connections. The connection is closed once
+	// Handler returns, or when the proxy is stopped.
+	Handler func(conn net.Conn)
+}
+
+// AcceptHook decides what to do with each connection accepted by the proxy,
+// so that specialized behaviors (e.g. a fake server for some clients) can be
+// built without forking the proxy loop. It is called before the accept
+// generator is consulted, from the accept loop of the proxy, and should thus
+// return promptly.
+type AcceptHook func(conn net.Conn) AcceptDecision
+
+// SetAcceptHook makes hook decide the fate of accepted connections, nil
+// restores proxying all connections
+func (t *Proxy) SetAcceptHook(hook AcceptHook) {
+	t.update(func(s *settings) { s.acceptHook = hook })
+}
+
+// acceptDecision returns the decision of the accept hook of s for conn
+func (t *Proxy) acceptDecision(s *settings, conn net.Conn) AcceptDecision {
+	if s.acceptHook == nil {
+		return AcceptDecision{Action: AcceptProxy}
+	}
+	decision := s.acceptHook(conn)
+	if decision.Action == AcceptHijack && decision.Handler == nil {
+		log.Warningf(
+			t.ctx,
+			"Dropping connection from %v hijacked without handler",
+			conn.RemoteAddr())
+		decision.Action = AcceptDrop
+	}
+	return decision
+}
+
+// hijack serves conn with handler until it returns or the proxy stops
+func (t *Proxy) hijack(conn net.Conn, handler func(conn net.Conn)) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-t.quit:
+				conn.Close()
+			case <-done:
+			}
+		}()
+		log.Infof(t.ctx, "Hijacked connection from %v", conn.RemoteAddr())
+		handler(conn)
+		close(done)
+		t.closeFrontendConn(conn, "hijack completed")
+	}()
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+)
+
+// Performance budget of the proxy on loopback. The budget is deliberately
+// loose (it must hold on busy CI hosts), it exists to catch gross regressions
+// when optimizing the copy loop, e.g. the 1KB buffer and the 10ms read
+// deadline used to notice termination. Note that the proxy logs forwarded
+// payloads at verbosity 4, which dominates its cost when verbose logging is
+// enabled. Run the benchmarks below for precise numbers.
+const (
+	// minThroughputBytesPerSec is the minimum echo throughput through the
+	// proxy, without faults
+	minThroughputBytesPerSec = 2 << 20
+	// maxAddedLatency is the maximum latency the proxy may add to a small
+	// request-response round trip, without faults
+	maxAddedLatency = 5 * time.Millisecond
+)
+
+// startFaultyProxy starts a proxy to an echo server whose generators delay
+// received chunks and whose writes are fragmented, without dropping
+// connections
+func startFaultyProxy(tb testing.TB) *tcpproxy.Proxy {
+	backendHostPort, _ := startEchoServer(tb)
+	recvFg := failuregen.NewFailureGenerator()
+	require.NoError(tb, recvFg.SetDelayConfig(failuregen.DelayConfig{
+		MaxDelayMicros:   100,
+		DelayProbability: 0.01,
+	}))
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		freeHostPort(tb),
+		backendHostPort,
+		recvFg,
+		failuregen.NewFailureGenerator())
+	require.NoError(tb, err)
+	tb.Cleanup(p.Stop)
+	require.NoError(tb, p.SetMaxSegmentSize(536, 0))
+	return p
+}
+
+// echo streams size bytes through conn in chunks and reads them back
+func echo(tb testing.TB, conn net.Conn, chunk []byte, size int) {
+	errCh := make(chan error, 1)
+	go func() {
+		for sent := 0; sent < size; sent += len(chunk) {
+			if _, err := conn.Write(chunk); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- nil
+	}()
+	_, err := io.CopyN(io.Discard, conn, int64(size))
+	require.NoError(tb, err)
+	require.NoError(tb, <-errCh)
+}
+
+func benchmarkThroughput(b *testing.B, p tcpproxy.TCPProxy) {
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(b, err)
+	defer conn.Close()
+
+	chunk := make([]byte, 64<<10)
+	b.SetBytes(int64(len(chunk)))
+	b.ResetTimer()
+	echo(b, conn, chunk, b.N*len(chunk))
+}
+
+func BenchmarkProxyThroughput(b *testing.B) {
+	b.Run("NoFaults", func(b *testing.B) {
+		benchmarkThroughput(b, startProxy(b))
+	})
+	b.Run("ActiveFaults", func(b *testing.B) {
+		benchmarkThroughput(b, startFaultyProxy(b))
+	})
+	b.Run("Traced", func(b *testing.B) {
+		benchmarkThroughput(b, startTracedProxy(b))
+	})
+}
+
+// startTracedProxy starts a proxy to an echo server which traces its
+// traffic, without faults
+func startTracedProxy(tb testing.TB) *tcpproxy.Proxy {
+	p := startProxy(tb)
+	require.NoError(tb, p.SetTraceBuffer(1<<20))
+	return p
+}
+
+func benchmarkRoundTrip(b *testing.B, hostPort string) {
+	conn, err := net.Dial("tcp", hostPort)
+	require.NoError(b, err)
+	defer conn.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, roundTrip(b, conn, "ping"))
+	}
+}
+
+func BenchmarkProxyRoundTrip(b *testing.B) {
+	b.Run("Direct", func(b *testing.B) {
+		backendHostPort, _ := startEchoServer(b)
+		benchmarkRoundTrip(b, backendHostPort)
+	})
+	b.Run("NoFaults", func(b *testing.B) {
+		benchmarkRoundTrip(b, startProxy(b).FrontendHostPort())
+	})
+	b.Run("ActiveFaults", func(b *testing.B) {
+		benchmarkRoundTrip(b, startFaultyProxy(b).FrontendHostPort())
+	})
+	b.Run("Traced", func(b *testing.B) {
+		benchmarkRoundTrip(b, startTracedProxy(b).FrontendHostPort())
+	})
+}
+
+// BenchmarkProxyRoundTripParallel round-trips on concurrent connections, to
+// measure the contention between connections (e.g. on the trace buffer)
+func BenchmarkProxyRoundTripParallel(b *testing.B) {
+	for name, start := range map[string]func(testing.TB) *tcpproxy.Proxy{
+		"NoFaults": startProxy,
+		"Traced":   startTracedProxy,
+	} {
+		b.Run(name, func(b *testing.B) {
+			p := start(b)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				conn, err := net.Dial("tcp", p.FrontendHostPort())
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				defer conn.Close()
+				for pb.Next() {
+					if err := roundTrip(b, conn, "ping"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// medianRoundTrip returns the median latency of rounds round trips
+func medianRoundTrip(t *testing.T, hostPort string, rounds int) time.Duration {
+	conn, err := net.Dial("tcp", hostPort)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	latencies := make([]time.Duration, rounds)
+	for i := range latencies {
+		start := time.Now()
+		require.NoError(t, roundTrip(t, conn, "ping"))
+		latencies[i] = time.Since(start)
+	}
+	for i := 1; i < len(latencies); i++ {
+		for j := i; j > 0 && latencies[j] < latencies[j-1]; j-- {
+			latencies[j], latencies[j-1] = latencies[j-1], latencies[j]
+		}
+	}
+	return latencies[len(latencies)/2]
+}
+
+// TestProxyPerformanceBudget checks the budget with tracing off and on, as
+// tracing is meant to stay enabled in performance tests
+func TestProxyPerformanceBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("performance budget is not checked in short mode")
+	}
+	backendHostPort, _ := startEchoServer(t)
+	direct := medianRoundTrip(t, backendHostPort, 200)
+	for name, start := range map[string]func(testing.TB) *tcpproxy.Proxy{
+		"NoFaults": startProxy,
+		"Traced":   startTracedProxy,
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := start(t)
+			conn, err := net.Dial("tcp", p.FrontendHostPort())
+			require.NoError(t, err)
+			defer conn.Close()
+			const size = 8 << 20
+			start := time.Now()
+			echo(t, conn, make([]byte, 64<<10), size)
+			throughput := float64(size) / time.Since(start).Seconds()
+			require.GreaterOrEqual(
+				t,
+				throughput,
+				float64(minThroughputBytesPerSec),
+				"throughput below budget")
+
+			proxied := medianRoundTrip(t, p.FrontendHostPort(), 200)
+			require.LessOrEqual(
+				t,
+				proxied-direct,
+				maxAddedLatency,
+				"added latency above budget")
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// ByteRangeAction is what is done to the bytes of a ByteRangeRule
+type ByteRangeAction string
+
+const (
+	// ByteRangeDrop removes the bytes from the stream
+	ByteRangeDrop ByteRangeAction = "drop"
+	// ByteRangeCorrupt flips all bits of the bytes
+	ByteRangeCorrupt ByteRangeAction = "corrupt"
+)
+
+// ByteRangeRule drops or corrupts bytes [Offset, Offset+Length) of every
+// stream in Direction, reproducing offset-specific parsing bugs precisely
+type ByteRangeRule struct {
+	Direction Direction
+	Offset    int64
+	Length    int64
+	Action    ByteRangeAction
+}
+
+func (r ByteRangeRule) validate() error {
+	if r.Direction != Onward && r.Direction != Return {
+		return errors.Errorf("Invalid direction %q", r.Direction)
+	}
+	if r.Offset < 0 || r.Length <= 0 {
+		return errors.Errorf(
+			"Invalid byte range [%d, %d)",
+			r.Offset,
+			r.Offset+r.Length)
+	}
+	if r.Action != ByteRangeDrop && r.Action != ByteRangeCorrupt {
+		return errors.Errorf("Invalid byte range action %q", r.Action)
+	}
+	return nil
+}
+
+// SetByteRangeRules replaces the byte range rules of the proxy, an empty set
+// of rules leaves streams intact. Rules apply to the connections targeted for
+// faults (see SetConnTargeting), from the next chunk they forward.
+func (t *Proxy) SetByteRangeRules(rules []ByteRangeRule) error {
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	if len(rules) == 0 {
+		t.update(func(s *settings) { s.byteRangeRules = nil })
+		return nil
+	}
+	rules = append([]ByteRangeRule(nil), rules...)
+	t.update(func(s *settings) { s.byteRangeRules = rules })
+	if log.V(3) {
+		log.Infof(t.ctx, "Byte range rules set to %+v", rules)
+	}
+	return nil
+}
+
+// applyByteRanges applies the byte range rules to chunk, which starts at the
+// given stream offset, and returns the chunk to forward. Offsets are those of
+// the stream received by the proxy, delivered is the number of bytes of the
+// stream forwarded so far.
+func (t *Proxy) applyByteRanges(
+	s *settings,
+	pc *proxyConn,
+	dir Direction,
+	offset int64,
+	delivered int64,
+	chunk []byte,
+) []byte {
+	if s.byteRangeRules == nil || !pc.targeted {
+		return chunk
+	}
+	end := offset + int64(len(chunk))
+	var dropped, corrupted []bool
+	for _, r := range s.byteRangeRules {
+		if r.Direction != dir {
+			continue
+		}
+		from, to := max64(r.Offset, offset), min64(r.Offset+r.Length, end)
+		if from >= to {
+			continue
+		}
+		for i := from - offset; i < to-offset; i++ {
+			switch r.Action {
+			case ByteRangeCorrupt:
+				chunk[i] ^= 0xff
+				if corrupted == nil {
+					corrupted = make([]bool, len(chunk))
+				}
+				corrupted[i] = true
+			case ByteRangeDrop:
+				if dropped == nil {
+					dropped = make([]bool, len(chunk))
+				}
+				dropped[i] = true
+			}
+		}
+	}
+	if corrupted != nil && s.recordCorruptions {
+		t.corruptions.record(pc.decisions.Seq, dir, delivered, dropped, corrupted)
+	}
+	if dropped == nil {
+		return chunk
+	}
+	kept := chunk[:0]
+	for i, b := range chunk {
+		if !dropped[i] {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// connectHandshakeTimeout bounds the time a client takes to send its CONNECT
+// request
+const connectHandshakeTimeout = 10 * time.Second
+
+// NewConnectProxy creates a proxy acting as an HTTP CONNECT proxy, so that
+// applications configured with standard proxy settings can be faulted
+// without changing their target addresses. handshakeFg injects failures of
+// the CONNECT handshake (answered with 503), recvFg and acceptFg are as for
+// NewTCPProxy and apply to the tunneled bytes. Lazy dial does not apply to
+// CONNECT proxies, the target is dialed as part of the handshake.
+func NewConnectProxy(
+	ctx context.Context,
+	frontendHostPort string,
+	recvFg failuregen.FailureGenerator,
+	acceptFg failuregen.FailureGenerator,
+	handshakeFg failuregen.FailureGenerator,
+) (*Proxy, error) {
+	return newTCPProxy(
+		ctx,
+		frontendHostPort,
+		"",
+		recvFg,
+		acceptFg,
+		handshakeFg,
+		0)
+}
+
+// readConnectRequest reads the CONNECT request of a client, it returns the
+// target of the request and the tunneled bytes the client sent along with it
+func (t *Proxy) readConnectRequest(
+	conn net.Conn,
+) (string, []byte, error) {
+	if err := conn.SetReadDeadline(
+		time.Now().Add(connectHandshakeTimeout),
+	); err != nil {
+		return "", nil, t.organicErr(err, ErrCategoryRead, "set deadline")
+	}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-t.quit:
+			_ = conn.SetReadDeadline(time.Now())
+		case <-doneCh:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return "", nil, t.organicErr(err, ErrCategoryRead, "read CONNECT")
+	}
+	if req.Method != http.MethodConnect {
+		writeConnectResponse(conn, http.StatusMethodNotAllowed)
+		return "", nil, errors.Errorf("Unexpected %s request", req.Method)
+	}
+	var buffered []byte
+	if n := reader.Buffered(); n > 0 {
+		buffered, _ = reader.Peek(n)
+	}
+	return req.Host, buffered, nil
+}
+
+// acceptConnect runs the CONNECT handshake of a client, up to dialing the
+// target, it returns the target and the tunneled bytes already received
+func (t *Proxy) acceptConnect(
+	conn net.Conn,
+	pc *proxyConn,
+) (string, []byte, error) {
+	target, buffered, err := t.readConnectRequest(conn)
+	if err != nil {
+		return "", nil, err
+	}
+	if pc.targeted {
+		if err := t.connectFg.FailMaybe(); err != nil {
+			t.stats.incrementFrontendDropCtr()
+			writeConnectResponse(conn, http.StatusServiceUnavailable)
+			return "", nil, errors.Wrap(err, "injected CONNECT failure")
+		}
+	}
+	log.Infof(t.ctx, "CONNECT from %v to %s", conn.RemoteAddr(), target)
+	return target, buffered, nil
+}
+
+func writeConnectResponse(conn net.Conn, status int) {
+	_, _ = fmt.Fprintf(
+		conn,
+		"HTTP/1.1 %d %s\r\n\r\n",
+		status,
+		http.StatusText(status))
+}
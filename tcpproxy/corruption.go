@@ -0,0 +1,121 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"sync"
+)
+
+// CorruptedRange is a range of bytes corrupted by a ByteRangeCorrupt rule
+type CorruptedRange struct {
+	// Seq is the order in which the connection was accepted, see
+	// ConnDecisions
+	Seq       int64
+	Direction Direction
+	// Offset is that of the stream received by the peer, i.e. it excludes
+	// the bytes dropped by the proxy
+	Offset int64
+	Length int64
+}
+
+// Overlaps tells if both ranges share bytes of the same stream
+func (r CorruptedRange) Overlaps(o CorruptedRange) bool {
+	return r.Seq == o.Seq &&
+		r.Direction == o.Direction &&
+		r.Offset < o.end() &&
+		o.Offset < r.end()
+}
+
+func (r CorruptedRange) end() int64 {
+	return r.Offset + r.Length
+}
+
+// UndetectedRanges returns the corrupted ranges which overlap none of the
+// detected ones, tests assert it is empty to verify that the application
+// detected every corrupted region (e.g. detected holds the blocks whose
+// checksum mismatched)
+func UndetectedRanges(corrupted, detected []CorruptedRange) []CorruptedRange {
+	var undetected []CorruptedRange
+	for _, c := range corrupted {
+		found := false
+		for _, d := range detected {
+			if c.Overlaps(d) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			undetected = append(undetected, c)
+		}
+	}
+	return undetected
+}
+
+// corruptionLog records the ranges corrupted by the proxy
+type corruptionLog struct {
+	mu     sync.Mutex
+	ranges []CorruptedRange
+}
+
+// record logs the corrupted bytes of a chunk, delivered is the offset at
+// which the chunk, without its dropped bytes (if any), is received by the
+// peer. Ranges continuing the latest one of the stream are merged into it.
+func (l *corruptionLog) record(
+	seq int64,
+	dir Direction,
+	delivered int64,
+	dropped []bool,
+	corrupted []bool,
+) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last := -1
+	for i := len(l.ranges) - 1; i >= 0; i-- {
+		if l.ranges[i].Seq == seq && l.ranges[i].Direction == dir {
+			last = i
+			break
+		}
+	}
+	offset := delivered
+	for i := range corrupted {
+		if dropped != nil && dropped[i] {
+			continue
+		}
+		if corrupted[i] {
+			if last >= 0 && l.ranges[last].end() == offset {
+				l.ranges[last].Length++
+			} else {
+				l.ranges = append(l.ranges, CorruptedRange{
+					Seq:       seq,
+					Direction: dir,
+					Offset:    offset,
+					Length:    1,
+				})
+				last = len(l.ranges) - 1
+			}
+		}
+		offset++
+	}
+}
+
+// RecordCorruptions starts (or stops) recording the byte ranges corrupted by
+// the byte range rules of the proxy, see CorruptedRanges. Enabling recording
+// discards the ranges previously recorded.
+func (t *Proxy) RecordCorruptions(enabled bool) {
+	t.update(func(s *settings) {
+		if enabled && !s.recordCorruptions {
+			t.corruptions.mu.Lock()
+			t.corruptions.ranges = nil
+			t.corruptions.mu.Unlock()
+		}
+		s.recordCorruptions = enabled
+	})
+}
+
+// CorruptedRanges returns the byte ranges corrupted since recording was
+// enabled, in the order they were corrupted
+func (t *Proxy) CorruptedRanges() []CorruptedRange {
+	t.corruptions.mu.Lock()
+	defer t.corruptions.mu.Unlock()
+	return append([]CorruptedRange(nil), t.corruptions.ranges...)
+}
@@ -0,0 +1,416 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/log"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+)
+
+// Direction of proxied traffic
+type Direction string
+
+const (
+	// Onward is the client -> backend direction
+	Onward Direction = "onward"
+	// Return is the backend -> client direction
+	Return Direction = "return"
+)
+
+// ConnDecisions records the injection decisions taken for one proxied
+// connection. Recorded decisions can be replayed against a new run of the
+// same test to reproduce proxy-induced failures deterministically.
+type ConnDecisions struct {
+	// Seq is the order in which the connection was accepted, starting at 0
+	Seq int64
+	// Seed of the per-connection random generator (used for lifetime jitter)
+	Seed int64
+	// AcceptDropped is set if the connection was dropped on accept
+	AcceptDropped bool `json:",omitempty"`
+	// PreDialDropped is set if the connection was dropped before lazily
+	// dialing the backend
+	PreDialDropped bool `json:",omitempty"`
+	// DropAt is the stream offset, per direction, at which the connection was
+	// dropped by an injected receive failure
+	DropAt map[Direction]int64 `json:",omitempty"`
+	// Lifetime is the max lifetime of the connection, 0 if unlimited
+	Lifetime time.Duration `json:",omitempty"`
+	// PartialReads are the chunks forwarded as partial reads, per direction
+	// in stream order
+	PartialReads map[Direction][]PartialRead `json:",omitempty"`
+}
+
+// PartialRead records a chunk forwarded in two parts, the second one after
+// a stall (see Proxy.EnablePartialReads)
+type PartialRead struct {
+	// Offset is the stream offset of the chunk
+	Offset int64
+	// Split is the number of bytes of the chunk forwarded before the stall
+	Split int
+	// Stall is the delay before the rest of the chunk was forwarded
+	Stall time.Duration
+}
+
+func (d ConnDecisions) deepCopy() ConnDecisions {
+	if d.DropAt != nil {
+		dropAt := make(map[Direction]int64, len(d.DropAt))
+		for dir, offset := range d.DropAt {
+			dropAt[dir] = offset
+		}
+		d.DropAt = dropAt
+	}
+	if d.PartialReads != nil {
+		partialReads := make(map[Direction][]PartialRead, len(d.PartialReads))
+		for dir, reads := range d.PartialReads {
+			partialReads[dir] = append([]PartialRead(nil), reads...)
+		}
+		d.PartialReads = partialReads
+	}
+	return d
+}
+
+// DefaultDecisionRetention is the default number of connections whose
+// decisions are retained in memory
+const DefaultDecisionRetention = 100000
+
+// decisionLog records the decisions of recent connections in a ring buffer
+// and holds the decisions being replayed, if any
+type decisionLog struct {
+	sync.Mutex
+	// recorded is a ring buffer of the decisions of the latest connections,
+	// ordered oldest first starting at index head
+	recorded []*ConnDecisions
+	head     int
+	// retention bounds the length of recorded, 0 means default
+	retention int
+	// spillPath, if set, is a file to which evicted decisions are appended as
+	// JSON lines
+	spillPath string
+	nextSeq   int64
+	replay    map[int64]ConnDecisions
+	// replaying is set once ReplayDecisions is called, connections without
+	// replayed decisions are then not faulted at all
+	replaying bool
+}
+
+func (l *decisionLog) maxLen() int {
+	if l.retention > 0 {
+		return l.retention
+	}
+	return DefaultDecisionRetention
+}
+
+// appendLocked records d, evicting the oldest decisions once retention is
+// reached. head stays 0 till the buffer is full.
+func (l *decisionLog) appendLocked(d *ConnDecisions) error {
+	if len(l.recorded) < l.maxLen() {
+		l.recorded = append(l.recorded, d)
+		return nil
+	}
+	evicted := l.recorded[l.head]
+	l.recorded[l.head] = d
+	l.head = (l.head + 1) % len(l.recorded)
+	return l.spillLocked([]*ConnDecisions{evicted})
+}
+
+// spillLocked appends evicted decisions to the spill file, if configured
+func (l *decisionLog) spillLocked(evicted []*ConnDecisions) error {
+	if l.spillPath == "" || len(evicted) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(
+		l.spillPath,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0644)
+	if err != nil {
+		return errors.Wrapf(err, "open decision spill file %s", l.spillPath)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, d := range evicted {
+		if err := enc.Encode(d); err != nil {
+			return errors.Wrapf(err, "spill decisions to %s", l.spillPath)
+		}
+	}
+	return nil
+}
+
+// orderedLocked returns the retained decisions oldest first
+func (l *decisionLog) orderedLocked() []*ConnDecisions {
+	ordered := make([]*ConnDecisions, 0, len(l.recorded))
+	ordered = append(ordered, l.recorded[l.head:]...)
+	return append(ordered, l.recorded[:l.head]...)
+}
+
+// ConnTargeting selects, by order of acceptance (starting at 0), the
+// connections which are subject to faults
+type ConnTargeting func(seq int64) bool
+
+// FirstConnOnly targets only the first connection accepted by the proxy,
+// typically the bootstrap / control connection of a client
+func FirstConnOnly(seq int64) bool {
+	return seq == 0
+}
+
+// proxyConn is the per-connection state of the proxy
+type proxyConn struct {
+	decisions *ConnDecisions
+	// replay holds the decisions to replay, nil if generators are consulted
+	replay  *ConnDecisions
+	randGen *randutil.LockedRandGen
+	// targeted is false for connections exempt from faults
+	targeted bool
+}
+
+var errReplayedFailure = errors.Wrap(
+	failuregen.ErrInjectedFailure,
+	"replayed injection decision")
+
+// Decisions returns the injection decisions of the retained connections,
+// one per accepted connection in order of acceptance
+func (t *Proxy) Decisions() []ConnDecisions {
+	t.decisions.Lock()
+	defer t.decisions.Unlock()
+	recorded := t.decisions.orderedLocked()
+	decisions := make([]ConnDecisions, len(recorded))
+	for i, d := range recorded {
+		decisions[i] = d.deepCopy()
+	}
+	return decisions
+}
+
+// SetDecisionRetention bounds the number of connections whose decisions are
+// kept in memory (0 restores DefaultDecisionRetention), so that multi-day
+// soak runs don't grow without bound. Decisions evicted from memory are
+// appended as JSON lines to spillPath, unless it is empty. Updates to the
+// decisions of connections that are still open when evicted are not spilled.
+func (t *Proxy) SetDecisionRetention(
+	maxConns int,
+	spillPath string,
+) error {
+	if maxConns < 0 {
+		return errors.Errorf("Invalid decision retention %d", maxConns)
+	}
+	t.decisions.Lock()
+	defer t.decisions.Unlock()
+	ordered := t.decisions.orderedLocked()
+	t.decisions.retention = maxConns
+	t.decisions.spillPath = spillPath
+	var evicted []*ConnDecisions
+	if excess := len(ordered) - t.decisions.maxLen(); excess > 0 {
+		evicted = ordered[:excess]
+		ordered = ordered[excess:]
+	}
+	t.decisions.recorded = ordered
+	t.decisions.head = 0
+	return t.decisions.spillLocked(evicted)
+}
+
+// ReplayDecisions makes the proxy apply the given decisions, matched by
+// connection sequence number, instead of consulting failure generators.
+// Connections for which no decision is given are not faulted.
+func (t *Proxy) ReplayDecisions(decisions []ConnDecisions) {
+	t.decisions.Lock()
+	defer t.decisions.Unlock()
+	t.decisions.replaying = true
+	t.decisions.replay = make(map[int64]ConnDecisions, len(decisions))
+	for _, d := range decisions {
+		t.decisions.replay[d.Seq] = d.deepCopy()
+	}
+}
+
+// newProxyConn creates the state of a connection accepted with settings s
+func (t *Proxy) newProxyConn(s *settings) *proxyConn {
+	t.decisions.Lock()
+	defer t.decisions.Unlock()
+	seq := t.decisions.nextSeq
+	t.decisions.nextSeq++
+	pc := &proxyConn{decisions: &ConnDecisions{Seq: seq}, targeted: true}
+	if s.connTargeting != nil {
+		pc.targeted = s.connTargeting(seq)
+	}
+	if t.decisions.replaying {
+		replay := t.decisions.replay[seq]
+		replay.Seq = seq
+		pc.replay = &replay
+		pc.decisions.Seed = replay.Seed
+	} else {
+		pc.decisions.Seed = t.randGen.Int63n(1 << 62)
+	}
+	pc.randGen = randutil.NewLockedRandGen(pc.decisions.Seed)
+	if err := t.decisions.appendLocked(pc.decisions); err != nil {
+		log.Errorf(t.ctx, "Couldn't record decisions: %v", err)
+	}
+	return pc
+}
+
+// decide consults fg, or the replayed decision if replaying, and records the
+// outcome in the decision selected by field. fault is the fault injected on
+// failure.
+func (t *Proxy) decide(
+	pc *proxyConn,
+	fg failuregen.FailureGenerator,
+	fault ProxyFault,
+	field func(d *ConnDecisions) *bool,
+) error {
+	var err error
+	if pc.replay != nil {
+		if *field(pc.replay) {
+			err = errReplayedFailure
+		}
+	} else if pc.targeted {
+		err = fg.FailMaybe()
+	}
+	if err != nil {
+		t.decisions.Lock()
+		*field(pc.decisions) = true
+		t.decisions.Unlock()
+		t.emitInjection(InjectionEvent{
+			Fault:    fault,
+			Seq:      pc.decisions.Seq,
+			Replayed: pc.replay != nil,
+		}, err)
+	}
+	return err
+}
+
+// recvFailure decides whether a chunk received in direction dir at the given
+// stream offset is to be dropped. It returns the number of leading bytes of
+// the chunk to forward before dropping and the injected error, or nil if
+// the chunk is to be forwarded normally.
+func (t *Proxy) recvFailure(
+	s *settings,
+	pc *proxyConn,
+	dir Direction,
+	offset int64,
+	chunk []byte,
+) (int, error) {
+	if pc.replay != nil {
+		dropAt, ok := pc.replay.DropAt[dir]
+		if !ok || offset+int64(len(chunk)) <= dropAt {
+			return 0, nil
+		}
+		t.recordDrop(pc, dir, dropAt, errReplayedFailure)
+		if dropAt < offset {
+			return 0, errReplayedFailure
+		}
+		return int(dropAt - offset), errReplayedFailure
+	}
+
+	if !pc.targeted {
+		return 0, nil
+	}
+	var err error
+	// TODO(CDM-362117)(Ambar) Change to a KMP filter to make this robust
+	recvFg := s.recvFg
+	condFailGen, ok := recvFg.(failuregen.ConditionalFailureGenerator)
+	if ok {
+		if err = condFailGen.FailOnCondition(chunk); err != nil {
+			err = errors.Wrap(err, "injected recv failure on satisfying condition")
+		}
+	} else {
+		if err = recvFg.FailMaybe(); err != nil {
+			err = errors.Wrap(err, "injected recv failure")
+		}
+	}
+	if err != nil {
+		t.recordDrop(pc, dir, offset, err)
+	}
+	return 0, err
+}
+
+// recordDrop records that the stream of direction dir was dropped at offset
+// on the injected failure err
+func (t *Proxy) recordDrop(
+	pc *proxyConn,
+	dir Direction,
+	offset int64,
+	err error,
+) {
+	t.decisions.Lock()
+	if pc.decisions.DropAt == nil {
+		pc.decisions.DropAt = make(map[Direction]int64)
+	}
+	pc.decisions.DropAt[dir] = offset
+	t.decisions.Unlock()
+	t.emitInjection(InjectionEvent{
+		Fault:     FaultRecvDrop,
+		Seq:       pc.decisions.Seq,
+		Direction: dir,
+		Offset:    offset,
+		Replayed:  pc.replay != nil,
+	}, err)
+}
+
+// partialRead decides whether a chunk of size bytes received in direction
+// dir at the given stream offset is forwarded as a partial read. It returns
+// the number of bytes to forward before stalling, 0 to forward the chunk
+// whole, and the stall. Replayed partial reads apply to chunks received at
+// the offsets recorded.
+func (t *Proxy) partialRead(
+	s *settings,
+	pc *proxyConn,
+	dir Direction,
+	offset int64,
+	size int,
+) (int, time.Duration) {
+	if pc.replay != nil {
+		reads := pc.replay.PartialReads[dir]
+		i := sort.Search(len(reads), func(i int) bool {
+			return reads[i].Offset >= offset
+		})
+		if i == len(reads) || reads[i].Offset != offset ||
+			reads[i].Split <= 0 || reads[i].Split >= size {
+			return 0, 0
+		}
+		t.recordPartialRead(pc, dir, reads[i], errReplayedFailure)
+		return reads[i].Split, reads[i].Stall
+	}
+
+	fg := s.partialFg
+	if fg == nil || size < 2 || !pc.targeted {
+		return 0, 0
+	}
+	err := fg.FailMaybe()
+	if err == nil {
+		return 0, 0
+	}
+	read := PartialRead{
+		Offset: offset,
+		Split:  1 + pc.randGen.Intn(size-1),
+		Stall:  s.partialStall,
+	}
+	t.recordPartialRead(pc, dir, read, err)
+	return read.Split, read.Stall
+}
+
+// recordPartialRead records the partial read of the stream of direction dir
+// injected on err
+func (t *Proxy) recordPartialRead(
+	pc *proxyConn,
+	dir Direction,
+	read PartialRead,
+	err error,
+) {
+	t.decisions.Lock()
+	if pc.decisions.PartialReads == nil {
+		pc.decisions.PartialReads = make(map[Direction][]PartialRead)
+	}
+	pc.decisions.PartialReads[dir] = append(pc.decisions.PartialReads[dir], read)
+	t.decisions.Unlock()
+	t.emitInjection(InjectionEvent{
+		Fault:     FaultPartialRead,
+		Seq:       pc.decisions.Seq,
+		Direction: dir,
+		Offset:    read.Offset,
+		Replayed:  pc.replay != nil,
+	}, err)
+}
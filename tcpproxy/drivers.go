@@ -0,0 +1,132 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+const (
+	// CassandraNativePort is the default port of the CQL native protocol
+	CassandraNativePort = 9042
+	// MySQLPort is the default port of the MySQL protocol
+	MySQLPort = 3306
+)
+
+// CQL native protocol opcodes of requests that carry statements
+const (
+	cqlOpQuery   = 0x07
+	cqlOpPrepare = 0x09
+	cqlOpExecute = 0x0A
+	cqlOpBatch   = 0x0D
+)
+
+// MySQL protocol commands that carry statements
+const (
+	mysqlComQuery       = 0x03
+	mysqlComStmtPrepare = 0x16
+	mysqlComStmtExecute = 0x17
+)
+
+// DriverProxy is a TCP proxy wired with failure generators suitable for
+// driver-resilience tests against a particular database protocol
+type DriverProxy struct {
+	*Proxy
+	// StatementFg fails connections on receiving a chunk which starts a
+	// statement request (query, prepare, execute or batch)
+	StatementFg failuregen.ConditionalFailureGenerator
+	// AcceptFg fails new connections
+	AcceptFg failuregen.FailureGenerator
+}
+
+// IsCQLStatementRequest reports whether buf starts with a CQL native
+// protocol request frame carrying a statement. Response frames (which have
+// the direction bit of the version set) never match.
+func IsCQLStatementRequest(buf []byte) bool {
+	if len(buf) < 5 || buf[0]&0x80 != 0 {
+		return false
+	}
+	switch buf[4] {
+	case cqlOpQuery, cqlOpPrepare, cqlOpExecute, cqlOpBatch:
+		return true
+	}
+	return false
+}
+
+// IsMySQLStatementCommand reports whether buf starts with a MySQL command
+// packet carrying a statement. Commands are the only packets with sequence
+// id 0 sent by clients.
+func IsMySQLStatementCommand(buf []byte) bool {
+	if len(buf) < 5 || buf[3] != 0 {
+		return false
+	}
+	switch buf[4] {
+	case mysqlComQuery, mysqlComStmtPrepare, mysqlComStmtExecute:
+		return true
+	}
+	return false
+}
+
+func newDriverProxy(
+	ctx context.Context,
+	frontendHostPort string,
+	backendHost string,
+	backendPort int,
+	isStatement func(buf []byte) bool,
+) (*DriverProxy, error) {
+	statementFg := &failuregen.ConditionalFailureGeneratorImpl{
+		Fg:        failuregen.NewFailureGenerator(),
+		Condition: isStatement,
+	}
+	acceptFg := failuregen.NewFailureGenerator()
+	p, err := NewProxy(
+		ctx,
+		frontendHostPort,
+		net.JoinHostPort(backendHost, strconv.Itoa(backendPort)),
+		statementFg,
+		acceptFg)
+	if err != nil {
+		return nil, err
+	}
+	return &DriverProxy{
+		Proxy:       p,
+		StatementFg: statementFg,
+		AcceptFg:    acceptFg,
+	}, nil
+}
+
+// NewCassandraProxy creates a proxy in front of the CQL native port of
+// backendHost (e.g. for gocql resilience tests). Faults are disabled until
+// the probabilities of the returned generators are raised.
+func NewCassandraProxy(
+	ctx context.Context,
+	frontendHostPort string,
+	backendHost string,
+) (*DriverProxy, error) {
+	return newDriverProxy(
+		ctx,
+		frontendHostPort,
+		backendHost,
+		CassandraNativePort,
+		IsCQLStatementRequest)
+}
+
+// NewMySQLProxy creates a proxy in front of the MySQL port of backendHost
+// (e.g. for go-sql-driver/mysql resilience tests). Faults are disabled until
+// the probabilities of the returned generators are raised.
+func NewMySQLProxy(
+	ctx context.Context,
+	frontendHostPort string,
+	backendHost string,
+) (*DriverProxy, error) {
+	return newDriverProxy(
+		ctx,
+		frontendHostPort,
+		backendHost,
+		MySQLPort,
+		IsMySQLStatementCommand)
+}
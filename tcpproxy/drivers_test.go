@@ -0,0 +1,55 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+)
+
+func TestIsCQLStatementRequest(t *testing.T) {
+	// version 4 request, no flags, stream 1, QUERY
+	require.True(t, tcpproxy.IsCQLStatementRequest(
+		[]byte{0x04, 0x00, 0x00, 0x01, 0x07, 0, 0, 0, 0}))
+	// OPTIONS request
+	require.False(t, tcpproxy.IsCQLStatementRequest(
+		[]byte{0x04, 0x00, 0x00, 0x01, 0x05, 0, 0, 0, 0}))
+	// version 4 response to a QUERY
+	require.False(t, tcpproxy.IsCQLStatementRequest(
+		[]byte{0x84, 0x00, 0x00, 0x01, 0x07, 0, 0, 0, 0}))
+	require.False(t, tcpproxy.IsCQLStatementRequest([]byte{0x04}))
+}
+
+func TestIsMySQLStatementCommand(t *testing.T) {
+	// COM_QUERY "select 1"
+	require.True(t, tcpproxy.IsMySQLStatementCommand(
+		append([]byte{0x09, 0x00, 0x00, 0x00, 0x03}, "select 1"...)))
+	// COM_PING
+	require.False(t, tcpproxy.IsMySQLStatementCommand(
+		[]byte{0x01, 0x00, 0x00, 0x00, 0x0e}))
+	// server greeting (protocol version 10)
+	require.False(t, tcpproxy.IsMySQLStatementCommand(
+		[]byte{0x4a, 0x00, 0x00, 0x00, 0x0a}))
+	// result set packet with sequence id 1
+	require.False(t, tcpproxy.IsMySQLStatementCommand(
+		[]byte{0x01, 0x00, 0x00, 0x01, 0x03}))
+}
+
+func TestNewCassandraProxy(t *testing.T) {
+	p, err := tcpproxy.NewCassandraProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		"cassandra.local")
+	require.NoError(t, err)
+	defer p.Stop()
+
+	require.Equal(t, "cassandra.local:9042", p.BackendHostPort())
+	require.NoError(t, p.StatementFg.FailOnCondition([]byte{4, 0, 0, 1, 7}))
+	require.NoError(t, p.StatementFg.SetFailureProbability(1.0))
+	require.Error(t, p.StatementFg.FailOnCondition([]byte{4, 0, 0, 1, 7}))
+	require.NoError(t, p.StatementFg.FailOnCondition([]byte{4, 0, 0, 1, 5}))
+}
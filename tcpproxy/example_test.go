@@ -0,0 +1,70 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+)
+
+// A proxy in front of an echo server forwards traffic until it is told to
+// block it.
+func ExampleNewTCPProxy() {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	p, err := tcpproxy.NewTCPProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		backend.Addr().String(),
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	if err != nil {
+		panic(err)
+	}
+	defer p.Stop()
+
+	echo := func() error {
+		conn, err := net.Dial("tcp", p.FrontendHostPort())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			return err
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		fmt.Println(string(buf))
+		return nil
+	}
+
+	_ = echo()
+	p.BlockAllTraffic()
+	fmt.Println("blocked:", echo() != nil)
+	// Output:
+	// ping
+	// blocked: true
+}
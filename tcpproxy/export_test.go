@@ -0,0 +1,12 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+// CloseListener closes the listener of the proxy underneath it, as if its
+// port had been stolen
+func CloseListener(p TCPProxy) error {
+	return p.(*Proxy).listener.Close()
+}
+
+// TraceRecordSize is the memory taken by a record in the trace buffer
+var TraceRecordSize = traceRecordSize
@@ -0,0 +1,79 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// LatencyFault delays the chunks received by the proxy as per delay, for use
+// with failuregen.CombinationDriver
+func LatencyFault(p Reconfigurer, delay failuregen.DelayConfig) failuregen.Fault {
+	return failuregen.Fault{
+		Name: "latency",
+		Enable: func() error {
+			return p.Config().RecvFg.SetDelayConfig(delay)
+		},
+		Disable: func() error {
+			return p.Config().RecvFg.SetDelayConfig(failuregen.DelayConfig{})
+		},
+	}
+}
+
+// DropFault drops connections on receiving a chunk with probability prob
+func DropFault(p Reconfigurer, prob float32) failuregen.Fault {
+	return failuregen.Fault{
+		Name: "drop",
+		Enable: func() error {
+			return p.Config().RecvFg.SetFailureProbability(prob)
+		},
+		Disable: func() error {
+			return p.Config().RecvFg.SetFailureProbability(0)
+		},
+	}
+}
+
+// PartitionFault blocks all traffic of the proxy
+func PartitionFault(p TCPProxy) failuregen.Fault {
+	return failuregen.Fault{
+		Name: "partition",
+		Enable: func() error {
+			p.BlockAllTraffic()
+			return nil
+		},
+		Disable: func() error {
+			p.UnblockAllTraffic()
+			return nil
+		},
+	}
+}
+
+// OneWayPartitionFault blocks the traffic of the proxy flowing in direction
+// dir, see Proxy.BlockDirection
+func OneWayPartitionFault(p Partitioner, dir Direction) failuregen.Fault {
+	return failuregen.Fault{
+		Name: "partition-" + string(dir),
+		Enable: func() error {
+			p.BlockDirection(dir)
+			return nil
+		},
+		Disable: func() error {
+			p.UnblockDirection(dir)
+			return nil
+		},
+	}
+}
+
+// CorruptionFault applies byte range rules (typically ByteRangeCorrupt ones)
+// to the streams of the proxy
+func CorruptionFault(p *Proxy, rules []ByteRangeRule) failuregen.Fault {
+	return failuregen.Fault{
+		Name: "corruption",
+		Enable: func() error {
+			return p.SetByteRangeRules(rules)
+		},
+		Disable: func() error {
+			return p.SetByteRangeRules(nil)
+		},
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// ProxyFault is a fault injected by the proxy
+type ProxyFault string
+
+const (
+	// FaultAcceptDrop is a connection dropped on accept
+	FaultAcceptDrop ProxyFault = "accept-drop"
+	// FaultPreDialDrop is a connection dropped before lazily dialing the
+	// backend
+	FaultPreDialDrop ProxyFault = "pre-dial-drop"
+	// FaultRecvDrop is a connection dropped on an injected receive failure
+	FaultRecvDrop ProxyFault = "recv-drop"
+	// FaultSubstitute is a chunk replaced by a Substitution
+	FaultSubstitute ProxyFault = "substitute"
+	// FaultPartialRead is a chunk forwarded as a partial read
+	FaultPartialRead ProxyFault = "partial-read"
+)
+
+// InjectionEvent describes a fault injected by the proxy, see OnInject. The
+// embedded event describes the injected failure as per its generator, its
+// CallSite is empty as proxy faults are not requested by the code under test.
+type InjectionEvent struct {
+	failuregen.InjectionEvent
+	Fault ProxyFault
+	// Seq is the order in which the connection was accepted, see
+	// ConnDecisions
+	Seq int64
+	// Direction and Offset locate the fault in the stream, for FaultRecvDrop,
+	// FaultSubstitute and FaultPartialRead
+	Direction Direction
+	Offset    int64
+	// Replayed is set for faults replaying recorded decisions
+	Replayed bool
+}
+
+// OnInject registers fn to be called, synchronously, whenever the proxy
+// injects a fault, so that tests can record when and on which connection
+// faults fired and correlate them with the logs of the system under test
+func (t *Proxy) OnInject(fn func(event InjectionEvent)) {
+	for {
+		old := t.injectHooks.Load()
+		var hooks []func(InjectionEvent)
+		if old != nil {
+			hooks = append(hooks, *old...)
+		}
+		hooks = append(hooks, fn)
+		if t.injectHooks.CompareAndSwap(old, &hooks) {
+			return
+		}
+	}
+}
+
+// emitInjection calls the OnInject hooks with event, err being the injected
+// failure
+func (t *Proxy) emitInjection(event InjectionEvent, err error) {
+	hooks := t.injectHooks.Load()
+	if hooks == nil {
+		return
+	}
+	if info, ok := failuregen.InfoFromError(err); ok {
+		event.GeneratorID = info.GeneratorID
+		event.InjectionID = info.InjectionID
+		event.FailurePoint = info.FailurePoint
+		event.Sequence = info.Sequence
+	}
+	event.Time = time.Now()
+	event.Kind = failuregen.InjectionKindFailure
+	for _, fn := range *hooks {
+		fn(event)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaultBufferSize is the size of the buffers connections are copied with
+const defaultBufferSize = 1024
+
+// ConnLimits bound the resources the proxy uses, so that scale tests
+// through the proxy don't exhaust memory. Zero values are unbounded /
+// defaults.
+type ConnLimits struct {
+	// MaxConns bounds the number of connections served concurrently.
+	// Connections beyond the limit are not accepted until others close,
+	// they wait in the listen backlog of the OS.
+	MaxConns int
+	// BufferSize is the size of the (pooled) buffers each direction of a
+	// connection is copied with, 1KiB by default
+	BufferSize int
+}
+
+func (l ConnLimits) validate() error {
+	if l.MaxConns < 0 {
+		return errors.Errorf("Invalid max conns %d", l.MaxConns)
+	}
+	if l.BufferSize < 0 {
+		return errors.Errorf("Invalid buffer size %d", l.BufferSize)
+	}
+	return nil
+}
+
+// connLimiter bounds the number of connections served concurrently
+type connLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	max    int
+	active int
+	closed bool
+}
+
+func newConnLimiter() *connLimiter {
+	l := &connLimiter{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until a connection may be served, it returns false once
+// the limiter is closed
+func (l *connLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for !l.closed && l.max > 0 && l.active >= l.max {
+		l.cond.Wait()
+	}
+	if l.closed {
+		return false
+	}
+	l.active++
+	return true
+}
+
+func (l *connLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+func (l *connLimiter) setMax(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = max
+	l.cond.Broadcast()
+}
+
+func (l *connLimiter) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.cond.Broadcast()
+}
+
+var bufferPool sync.Pool
+
+// getBuffer returns a pooled buffer of the given size
+func getBuffer(size int) *[]byte {
+	if buf, ok := bufferPool.Get().(*[]byte); ok && cap(*buf) >= size {
+		*buf = (*buf)[:size]
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+func putBuffer(buf *[]byte) {
+	bufferPool.Put(buf)
+}
+
+// SetConnLimits bounds the resources of the proxy, see ConnLimits. The max
+// conns limit applies to connections accepted after the call, the buffer
+// size to connections established after the call.
+func (t *Proxy) SetConnLimits(limits ConnLimits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	t.update(func(s *settings) {
+		s.connLimits = limits
+		t.limiter.setMax(limits.MaxConns)
+	})
+	return nil
+}
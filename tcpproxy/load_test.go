@@ -0,0 +1,156 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build unix
+
+package tcpproxy_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// loadTestConns is the number of concurrent connections of the load
+	// test, scaled down to what the fd limit allows
+	loadTestConns = 10000
+	// maxBytesPerConn is the memory budget of a connection through the
+	// proxy, it includes the client and echo server sides of the test
+	maxBytesPerConn = 128 << 10
+)
+
+// fdBoundConns returns the number of proxied connections the fd limit of
+// the process allows, each one takes 6 fds (client, proxy frontend and
+// backend, echo server, and the pipe the echo server splices through on
+// Linux)
+func fdBoundConns(t *testing.T) int {
+	var rlimit syscall.Rlimit
+	require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit))
+	n := (int(rlimit.Cur) - 256) / 6
+	if n > loadTestConns {
+		return loadTestConns
+	}
+	return n
+}
+
+func memInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse + m.StackInuse
+}
+
+func TestProxyManyConnections(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	n := fdBoundConns(t)
+	if n < loadTestConns {
+		t.Logf("fd limit allows %d connections", n)
+	}
+	p := startProxy(t)
+	require.NoError(t, p.SetConnLimits(tcpproxy.ConnLimits{BufferSize: 512}))
+
+	before := memInUse()
+	conns := make([]net.Conn, n)
+	var wg sync.WaitGroup
+	dialers := make(chan struct{}, 64)
+	errs := make(chan error, n)
+	for i := range conns {
+		wg.Add(1)
+		dialers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-dialers }()
+			conn, err := net.DialTimeout(
+				"tcp",
+				p.FrontendHostPort(),
+				10*time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// all connections are proxied concurrently
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn net.Conn) {
+			defer wg.Done()
+			msg := fmt.Sprintf("conn-%d", i)
+			buf := make([]byte, len(msg))
+			_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Error(err)
+				return
+			}
+			if string(buf) != msg {
+				t.Errorf("got %q, want %q", buf, msg)
+			}
+		}(i, conn)
+	}
+	wg.Wait()
+
+	perConn := (memInUse() - before) / uint64(n)
+	t.Logf("%d connections, %d bytes per connection", n, perConn)
+	require.Less(t, perConn, uint64(maxBytesPerConn))
+}
+
+func TestProxyMaxConns(t *testing.T) {
+	p := startProxy(t)
+	require.Error(t, p.SetConnLimits(tcpproxy.ConnLimits{MaxConns: -1}))
+	require.NoError(t, p.SetConnLimits(tcpproxy.ConnLimits{MaxConns: 2}))
+	require.Equal(t, 2, p.Config().ConnLimits.MaxConns)
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", p.FrontendHostPort())
+		require.NoError(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	require.NoError(t, roundTrip(t, conns[0], "a"))
+	require.NoError(t, roundTrip(t, conns[1], "b"))
+
+	// the third connection waits in the backlog
+	_, err := conns[2].Write([]byte("c"))
+	require.NoError(t, err)
+	require.NoError(
+		t,
+		conns[2].SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = conns[2].Read(make([]byte, 1))
+	require.Error(t, err)
+
+	conns[0].Close()
+	require.NoError(t, conns[2].SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 1)
+	_, err = conns[2].Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "c", string(buf))
+}
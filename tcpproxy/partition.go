@@ -0,0 +1,78 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// setBlocked blocks or unblocks dir
+func (t *Proxy) setBlocked(dir Direction, blocked bool) {
+	t.update(func(s *settings) {
+		set := blockedSet(directionsBlocked(s))
+		set[dir] = blocked
+		s.blocked = set
+	})
+}
+
+// directionsBlocked returns the directions blocked in s, in a stable order
+func directionsBlocked(s *settings) []Direction {
+	var dirs []Direction
+	for _, dir := range []Direction{Onward, Return} {
+		if s.isBlocked(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// blockedSet returns the set of blocked directions dirs
+func blockedSet(dirs []Direction) map[Direction]bool {
+	set := make(map[Direction]bool, len(dirs))
+	for _, dir := range dirs {
+		set[dir] = true
+	}
+	return set
+}
+
+// BlockDirection simulates an asymmetric partition: the traffic of all
+// connections, existing and new ones, flowing in direction dir is held by
+// the proxy while the other direction flows as usual (e.g. blocking Return
+// lets clients send but not receive). Connections are not closed, so peers
+// observe stalled reads and, once their buffers are full, stalled writes,
+// as with a real one-way partition. Held traffic is forwarded once dir is
+// unblocked.
+func (t *Proxy) BlockDirection(dir Direction) {
+	t.setBlocked(dir, true)
+	log.Infof(t.ctx, "Blocking %s traffic", dir)
+}
+
+// UnblockDirection ends the asymmetric partition of direction dir
+func (t *Proxy) UnblockDirection(dir Direction) {
+	t.setBlocked(dir, false)
+	log.Infof(t.ctx, "Unblocking %s traffic", dir)
+}
+
+// awaitUnblocked waits until dir is not blocked and returns the settings it
+// is unblocked in, or nil if the copy is to terminate meanwhile
+func (t *Proxy) awaitUnblocked(
+	dir Direction,
+	peerTermCh <-chan struct{},
+	expiredCh <-chan struct{},
+) *settings {
+	for {
+		s := t.settings.Load()
+		if !s.isBlocked(dir) {
+			return s
+		}
+		select {
+		case <-s.superseded:
+		case <-peerTermCh:
+			return nil
+		case <-expiredCh:
+			return nil
+		case <-t.quit:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// PortHolder is a process holding a port
+type PortHolder struct {
+	// PID of the process
+	PID int
+	// Command is the name of the executable of the process
+	Command string
+}
+
+// PortConflictError is returned when the frontend port of a proxy is in use.
+// Holders lists the processes listening on the port, as far as they can be
+// found (this is only supported on Linux, and only reports processes the
+// current user may inspect).
+type PortConflictError struct {
+	// HostPort the proxy failed to listen on
+	HostPort string
+	// Holders are the processes holding the port
+	Holders []PortHolder
+	// Err is the listen error
+	Err error
+}
+
+func (e *PortConflictError) Error() string {
+	if len(e.Holders) == 0 {
+		return fmt.Sprintf("Port of %s is in use: %v", e.HostPort, e.Err)
+	}
+	holders := make([]string, 0, len(e.Holders))
+	for _, h := range e.Holders {
+		holders = append(holders, fmt.Sprintf("%s (pid %d)", h.Command, h.PID))
+	}
+	return fmt.Sprintf(
+		"Port of %s is in use by %s: %v",
+		e.HostPort,
+		strings.Join(holders, ", "),
+		e.Err)
+}
+
+// Unwrap returns the listen error
+func (e *PortConflictError) Unwrap() error {
+	return e.Err
+}
+
+// listenFrontend listens on hostPort, or on one of the portRetries ports
+// following it if it is in use. A conflict on the last port tried yields a
+// PortConflictError.
+func listenFrontend(hostPort string, portRetries int) (net.Listener, error) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid frontend %s", hostPort)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port == 0 {
+		// let net resolve named and ephemeral ports
+		portRetries = 0
+	}
+	for i := 0; ; i++ {
+		addr := hostPort
+		if i > 0 {
+			addr = net.JoinHostPort(host, strconv.Itoa(port+i))
+		}
+		l, err := net.Listen("tcp", addr)
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+		if i >= portRetries || port+i >= 65535 {
+			return nil, errors.WithStack(&PortConflictError{
+				HostPort: addr,
+				Holders:  portHolders(port + i),
+				Err:      err,
+			})
+		}
+	}
+}
+
+// NewTCPProxyNearPort creates a new instance of an L4 test proxy, as
+// NewTCPProxy does, except that if the port of frontendHostPort is in use
+// the following portRetries ports are tried in turn. FrontendHostPort
+// reports the port picked.
+func NewTCPProxyNearPort(
+	ctx context.Context,
+	frontendHostPort string,
+	portRetries int,
+	backendHostPort string,
+	recvFg failuregen.FailureGenerator,
+	acceptFg failuregen.FailureGenerator,
+) (*Proxy, error) {
+	return newTCPProxy(
+		ctx,
+		frontendHostPort,
+		backendHostPort,
+		recvFg,
+		acceptFg,
+		nil,
+		portRetries)
+}
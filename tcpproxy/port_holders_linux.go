@@ -0,0 +1,79 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build linux
+
+package tcpproxy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListenState is the TCP_LISTEN state in /proc/net/tcp
+const tcpListenState = "0A"
+
+// listeningInodes returns the inodes of the sockets listening on port, as
+// per /proc/net/tcp and /proc/net/tcp6
+func listeningInodes(port int) map[string]struct{} {
+	inodes := make(map[string]struct{})
+	suffix := fmt.Sprintf(":%04X", port)
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// sl local_address rem_address st tx:rx tr:when retrnsmt uid
+			// timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || fields[3] != tcpListenState ||
+				!strings.HasSuffix(fields[1], suffix) {
+				continue
+			}
+			inodes[fields[9]] = struct{}{}
+		}
+		f.Close()
+	}
+	return inodes
+}
+
+// portHolders returns the processes holding sockets listening on port, by
+// matching the socket inodes to the file descriptors of processes
+func portHolders(port int) []PortHolder {
+	inodes := listeningInodes(port)
+	if len(inodes) == 0 {
+		return nil
+	}
+	fdDirs, _ := filepath.Glob("/proc/[0-9]*/fd")
+	var holders []PortHolder
+	for _, fdDir := range fdDirs {
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, ok := inodes[inode]; !ok {
+				continue
+			}
+			procDir := filepath.Dir(fdDir)
+			pid, _ := strconv.Atoi(filepath.Base(procDir))
+			comm, _ := os.ReadFile(filepath.Join(procDir, "comm"))
+			holders = append(holders, PortHolder{
+				PID:     pid,
+				Command: strings.TrimSpace(string(comm)),
+			})
+			break
+		}
+	}
+	return holders
+}
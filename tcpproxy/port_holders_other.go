@@ -0,0 +1,10 @@
+// Copyright 2024 Rubrik, Inc.
+
+//go:build !linux
+
+package tcpproxy
+
+// portHolders is not supported on this platform
+func portHolders(port int) []PortHolder {
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+// The goroutines of the proxy carry profiler labels, so that CPU and
+// goroutine profiles taken during chaos runs attribute the overhead of the
+// proxy, including the delays it injects, to the test utilities rather than
+// to the system under test
+const (
+	// LabelComponent is set to "tcpproxy" on the goroutines of proxies
+	LabelComponent = "failure-test-utils"
+	// LabelProxy is the frontend host:port of the proxy
+	LabelProxy = "tcpproxy.proxy"
+	// LabelConn is the sequence number of the proxied connection (see
+	// ConnDecisions.Seq)
+	LabelConn = "tcpproxy.conn"
+	// LabelDirection is the Direction copied by the goroutine
+	LabelDirection = "tcpproxy.direction"
+)
+
+// labelGoroutine sets the profiler labels of the calling goroutine, which
+// must be owned by the proxy, to those of the proxy and the given key-value
+// pairs, and returns the context holding the labels
+func labelGoroutine(
+	ctx context.Context,
+	args ...string,
+) context.Context {
+	ctx = pprof.WithLabels(ctx, pprof.Labels(args...))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
+
+// proxyLabels returns the context of the goroutines of the proxy
+func (t *Proxy) proxyLabels() context.Context {
+	return pprof.WithLabels(t.ctx, pprof.Labels(
+		LabelComponent, "tcpproxy",
+		LabelProxy, t.frontendHostPort))
+}
+
+// connLabels returns the labels of the goroutines serving pc
+func connLabels(pc *proxyConn) []string {
+	return []string{LabelConn, strconv.FormatInt(pc.decisions.Seq, 10)}
+}
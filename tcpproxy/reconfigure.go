@@ -0,0 +1,209 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// ProxyConfig holds the fault settings of a proxy. Get the current settings
+// with Config, modify them and apply them with Reconfigure to change network
+// conditions in the middle of a test.
+type ProxyConfig struct {
+	// RecvFg injects drops of received chunks, it also governs delays
+	RecvFg failuregen.FailureGenerator
+	// AcceptFg injects drops of accepted connections
+	AcceptFg failuregen.FailureGenerator
+	// MaxConnLifetime and ConnLifetimeJitter are as per SetMaxConnLifetime
+	MaxConnLifetime    time.Duration
+	ConnLifetimeJitter time.Duration
+	// PreDialFg enables lazy dial when non-nil, as per EnableLazyDial
+	PreDialFg failuregen.FailureGenerator
+	// MaxSegmentSize and FragmentDelay are as per SetMaxSegmentSize
+	MaxSegmentSize int
+	FragmentDelay  time.Duration
+	// ConnTargeting is as per SetConnTargeting
+	ConnTargeting ConnTargeting
+	// PartialReadFg enables partial reads when non-nil, stalling for
+	// PartialReadStall, as per EnablePartialReads
+	PartialReadFg    failuregen.FailureGenerator
+	PartialReadStall time.Duration
+	// FrontendSocketOptions and BackendSocketOptions are as per
+	// SetSocketOptions
+	FrontendSocketOptions SocketOptions
+	BackendSocketOptions  SocketOptions
+	// ByteRangeRules are as per SetByteRangeRules
+	ByteRangeRules []ByteRangeRule
+	// ConnLimits are as per SetConnLimits
+	ConnLimits ConnLimits
+	// AcceptHook is as per SetAcceptHook
+	AcceptHook AcceptHook
+	// Substitutions are as per SetSubstitutions
+	Substitutions []Substitution
+	// BlockedDirections are the directions held by a one-way partition, as
+	// per BlockDirection
+	BlockedDirections []Direction
+	// TraceBufferSize is as per SetTraceBuffer, the traced records are kept
+	// unless the size changes
+	TraceBufferSize int
+	// RecordCorruptions is as per RecordCorruptions
+	RecordCorruptions bool
+	// DecisionRetention and DecisionSpillPath are as per
+	// SetDecisionRetention
+	DecisionRetention int
+	DecisionSpillPath string
+	// DropExistingConns makes Reconfigure close the connections open at the
+	// time of the call, so that all traffic is subject to the new settings
+	DropExistingConns bool
+}
+
+func (cfg ProxyConfig) validate() error {
+	if cfg.RecvFg == nil || cfg.AcceptFg == nil {
+		return errors.New("Recv and accept failure generators are required")
+	}
+	if cfg.MaxConnLifetime < 0 {
+		return errors.Errorf("Invalid max conn lifetime %v", cfg.MaxConnLifetime)
+	}
+	if cfg.MaxSegmentSize < 0 {
+		return errors.Errorf("Invalid max segment size %d", cfg.MaxSegmentSize)
+	}
+	for _, r := range cfg.ByteRangeRules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	for _, sub := range cfg.Substitutions {
+		if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	for _, dir := range cfg.BlockedDirections {
+		if dir != Onward && dir != Return {
+			return errors.Errorf("Invalid direction %q", dir)
+		}
+	}
+	if _, err := traceRecords(cfg.TraceBufferSize); err != nil {
+		return err
+	}
+	if cfg.DecisionRetention < 0 {
+		return errors.Errorf(
+			"Invalid decision retention %d",
+			cfg.DecisionRetention)
+	}
+	if err := cfg.ConnLimits.validate(); err != nil {
+		return err
+	}
+	if err := cfg.FrontendSocketOptions.validate(); err != nil {
+		return errors.Wrap(err, "frontend")
+	}
+	return errors.Wrap(cfg.BackendSocketOptions.validate(), "backend")
+}
+
+// Config returns the current fault settings of the proxy
+func (t *Proxy) Config() ProxyConfig {
+	s := t.settings.Load()
+	cfg := ProxyConfig{
+		RecvFg:                s.recvFg,
+		AcceptFg:              s.acceptFg,
+		MaxConnLifetime:       s.maxConnLifetime,
+		ConnLifetimeJitter:    s.connLifetimeJitter,
+		PreDialFg:             s.preDialFg,
+		MaxSegmentSize:        s.maxSegmentSize,
+		FragmentDelay:         s.fragmentDelay,
+		ConnTargeting:         s.connTargeting,
+		PartialReadFg:         s.partialFg,
+		PartialReadStall:      s.partialStall,
+		FrontendSocketOptions: s.sockOpts.frontend,
+		BackendSocketOptions:  s.sockOpts.backend,
+		ByteRangeRules:        append([]ByteRangeRule(nil), s.byteRangeRules...),
+		ConnLimits:            s.connLimits,
+		AcceptHook:            s.acceptHook,
+		Substitutions:         append([]Substitution(nil), s.substitutions...),
+		BlockedDirections:     directionsBlocked(s),
+		TraceBufferSize:       s.trace.size(),
+		RecordCorruptions:     s.recordCorruptions,
+	}
+	t.decisions.Lock()
+	cfg.DecisionRetention = t.decisions.retention
+	cfg.DecisionSpillPath = t.decisions.spillPath
+	t.decisions.Unlock()
+	return cfg
+}
+
+// Reconfigure applies cfg to the running proxy. The settings are validated
+// as a whole, then published at once: each connection accepted, and each
+// chunk forwarded, is subject to either the old or the new settings, never
+// to a mix of both. Concurrent reconfigurations are serialized. Existing
+// connections are kept (and are subject to the new drop and delay settings)
+// unless cfg.DropExistingConns is set.
+func (t *Proxy) Reconfigure(cfg ProxyConfig) error {
+	if err := cfg.validate(); err != nil {
+		return errors.Wrap(err, "Invalid proxy config")
+	}
+	t.reconfigMu.Lock()
+	defer t.reconfigMu.Unlock()
+
+	old := t.settings.Load()
+	s := &settings{
+		recvFg:             cfg.RecvFg,
+		acceptFg:           cfg.AcceptFg,
+		maxConnLifetime:    cfg.MaxConnLifetime,
+		connLifetimeJitter: cfg.ConnLifetimeJitter,
+		preDialFg:          cfg.PreDialFg,
+		maxSegmentSize:     cfg.MaxSegmentSize,
+		fragmentDelay:      cfg.FragmentDelay,
+		connTargeting:      cfg.ConnTargeting,
+		partialFg:          cfg.PartialReadFg,
+		partialStall:       cfg.PartialReadStall,
+		sockOpts: socketOptions{
+			frontend: cfg.FrontendSocketOptions,
+			backend:  cfg.BackendSocketOptions,
+		},
+		connLimits:        cfg.ConnLimits,
+		acceptHook:        cfg.AcceptHook,
+		blocked:           blockedSet(cfg.BlockedDirections),
+		trace:             old.trace,
+		recordCorruptions: cfg.RecordCorruptions,
+	}
+	if len(cfg.ByteRangeRules) > 0 {
+		s.byteRangeRules = append([]ByteRangeRule(nil), cfg.ByteRangeRules...)
+	}
+	if len(cfg.Substitutions) > 0 {
+		s.substitutions = append([]Substitution(nil), cfg.Substitutions...)
+	}
+	if cfg.TraceBufferSize != old.trace.size() {
+		n, _ := traceRecords(cfg.TraceBufferSize)
+		s.trace = newTraceBuffer(n)
+	}
+	if cfg.RecordCorruptions && !old.recordCorruptions {
+		t.corruptions.mu.Lock()
+		t.corruptions.ranges = nil
+		t.corruptions.mu.Unlock()
+	}
+	t.publishLocked(s)
+	t.limiter.setMax(cfg.ConnLimits.MaxConns)
+
+	if cfg.DropExistingConns {
+		t.dropMu.Lock()
+		close(t.dropCh)
+		t.dropCh = make(chan struct{})
+		t.dropMu.Unlock()
+	}
+	log.Infof(t.ctx, "Reconfigured proxy (drop existing conns: %v)",
+		cfg.DropExistingConns)
+	return errors.Wrap(
+		t.SetDecisionRetention(cfg.DecisionRetention, cfg.DecisionSpillPath),
+		"Failed to apply decision retention")
+}
+
+// dropSignal returns a channel closed when existing connections are to be
+// dropped by a reconfiguration
+func (t *Proxy) dropSignal() <-chan struct{} {
+	t.dropMu.Lock()
+	defer t.dropMu.Unlock()
+	return t.dropCh
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+)
+
+// settings is an immutable snapshot of the fault settings of a proxy. Setters
+// and Reconfigure publish a modified copy with a single store; the accept
+// loop reads the snapshot once per connection and the copy loops once per
+// chunk, so that no connection or chunk is subject to a mix of old and new
+// settings.
+type settings struct {
+	recvFg             failuregen.FailureGenerator
+	acceptFg           failuregen.FailureGenerator
+	maxConnLifetime    time.Duration
+	connLifetimeJitter time.Duration
+	// preDialFg is non-nil when lazy-dial is enabled
+	preDialFg      failuregen.FailureGenerator
+	maxSegmentSize int
+	fragmentDelay  time.Duration
+	connTargeting  ConnTargeting
+	// partialFg is non-nil when partial reads are enabled
+	partialFg      failuregen.FailureGenerator
+	partialStall   time.Duration
+	sockOpts       socketOptions
+	byteRangeRules []ByteRangeRule
+	substitutions  []Substitution
+	connLimits     ConnLimits
+	acceptHook     AcceptHook
+	// blocked holds the directions held by a one-way partition
+	blocked map[Direction]bool
+	// trace is nil unless tracing
+	trace             *traceBuffer
+	recordCorruptions bool
+	// superseded is closed once a newer snapshot is published
+	superseded chan struct{}
+}
+
+// isBlocked tells if dir is held by a one-way partition
+func (s *settings) isBlocked(dir Direction) bool {
+	return s.blocked[dir]
+}
+
+// bufferSize returns the size of the buffers to copy connections with
+func (s *settings) bufferSize() int {
+	if s.connLimits.BufferSize > 0 {
+		return s.connLimits.BufferSize
+	}
+	return defaultBufferSize
+}
+
+// update publishes a copy of the current settings modified by fn
+func (t *Proxy) update(fn func(s *settings)) {
+	t.reconfigMu.Lock()
+	defer t.reconfigMu.Unlock()
+	s := *t.settings.Load()
+	fn(&s)
+	t.publishLocked(&s)
+}
+
+// publishLocked makes s the current settings, reconfigMu must be held
+func (t *Proxy) publishLocked(s *settings) {
+	s.superseded = make(chan struct{})
+	if old := t.settings.Swap(s); old != nil {
+		close(old.superseded)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SocketOptions are TCP options applied to the sockets of proxied
+// connections. Zero values leave the OS (or Go runtime) defaults in place.
+type SocketOptions struct {
+	// KeepAlive enables or disables TCP keepalive, nil leaves the default
+	KeepAlive *bool
+	// KeepAlivePeriod is the interval between keepalive probes
+	KeepAlivePeriod time.Duration
+	// NoDelay enables or disables TCP_NODELAY (i.e. disables or enables
+	// Nagle's algorithm), nil leaves the default
+	NoDelay *bool
+	// ReadBufferSize is the size of the socket receive buffer (SO_RCVBUF)
+	ReadBufferSize int
+	// WriteBufferSize is the size of the socket send buffer (SO_SNDBUF)
+	WriteBufferSize int
+	// Linger is as per net.TCPConn.SetLinger (SO_LINGER), in seconds, nil
+	// leaves the default. A linger of 0 makes the proxy reset connections
+	// rather than close them gracefully, e.g. to test how peers handle
+	// resets, on Windows as on Unix.
+	Linger *int
+}
+
+// socketOptions holds the options for both sides of proxied connections
+type socketOptions struct {
+	frontend SocketOptions
+	backend  SocketOptions
+}
+
+func (o SocketOptions) validate() error {
+	if o.KeepAlivePeriod < 0 {
+		return errors.Errorf("Invalid keepalive period %v", o.KeepAlivePeriod)
+	}
+	if o.ReadBufferSize < 0 {
+		return errors.Errorf("Invalid read buffer size %d", o.ReadBufferSize)
+	}
+	if o.WriteBufferSize < 0 {
+		return errors.Errorf("Invalid write buffer size %d", o.WriteBufferSize)
+	}
+	return nil
+}
+
+// apply sets the options on conn, conns that are not TCP are left as is
+func (o SocketOptions) apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if o.KeepAlive != nil {
+		if err := tcpConn.SetKeepAlive(*o.KeepAlive); err != nil {
+			return errors.Wrap(err, "set keepalive")
+		}
+	}
+	if o.KeepAlivePeriod > 0 {
+		if err := tcpConn.SetKeepAlivePeriod(o.KeepAlivePeriod); err != nil {
+			return errors.Wrap(err, "set keepalive period")
+		}
+	}
+	if o.NoDelay != nil {
+		if err := tcpConn.SetNoDelay(*o.NoDelay); err != nil {
+			return errors.Wrap(err, "set nodelay")
+		}
+	}
+	if o.ReadBufferSize > 0 {
+		if err := tcpConn.SetReadBuffer(o.ReadBufferSize); err != nil {
+			return errors.Wrap(err, "set read buffer")
+		}
+	}
+	if o.WriteBufferSize > 0 {
+		if err := tcpConn.SetWriteBuffer(o.WriteBufferSize); err != nil {
+			return errors.Wrap(err, "set write buffer")
+		}
+	}
+	if o.Linger != nil {
+		if err := tcpConn.SetLinger(*o.Linger); err != nil {
+			return errors.Wrap(err, "set linger")
+		}
+	}
+	return nil
+}
+
+// SetSocketOptions sets the TCP options of the frontend (client facing) and
+// backend sockets of proxied connections. The options apply to connections
+// accepted after the call.
+func (t *Proxy) SetSocketOptions(frontend, backend SocketOptions) error {
+	if err := frontend.validate(); err != nil {
+		return errors.Wrap(err, "frontend")
+	}
+	if err := backend.validate(); err != nil {
+		return errors.Wrap(err, "backend")
+	}
+	t.update(func(s *settings) {
+		s.sockOpts = socketOptions{frontend: frontend, backend: backend}
+	})
+	return nil
+}
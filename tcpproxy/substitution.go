@@ -0,0 +1,95 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/log"
+)
+
+// Substitution replaces chunks of traffic with wrong but valid ones (e.g. a
+// stale read, or a response with an off-by-one sequence number), to inject
+// semantic faults that peers can't detect as corruption
+type Substitution struct {
+	Direction Direction
+	// Fg decides which chunks are replaced, those for which it injects a
+	// failure
+	Fg failuregen.FailureGenerator
+	// Replace returns the chunk to forward in place of chunk, which it must
+	// not retain. Chunks are as received by the proxy, they are aligned with
+	// the messages of the protocol only if its peers write whole messages.
+	Replace func(chunk []byte) []byte
+}
+
+func (s Substitution) validate() error {
+	if s.Direction != Onward && s.Direction != Return {
+		return errors.Errorf("Invalid direction %q", s.Direction)
+	}
+	if s.Fg == nil || s.Replace == nil {
+		return errors.New("Substitution needs a generator and a replacement")
+	}
+	return nil
+}
+
+// SetSubstitutions replaces the substitutions of the proxy, an empty set of
+// substitutions leaves streams intact. Substitutions apply to the
+// connections targeted for faults (see SetConnTargeting), from the next chunk
+// they forward, after the byte range rules (see SetByteRangeRules). Each
+// substitution is injected as a FaultSubstitute.
+func (t *Proxy) SetSubstitutions(subs []Substitution) error {
+	for _, s := range subs {
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	if len(subs) == 0 {
+		t.update(func(s *settings) { s.substitutions = nil })
+		return nil
+	}
+	subs = append([]Substitution(nil), subs...)
+	t.update(func(s *settings) { s.substitutions = subs })
+	if log.V(3) {
+		log.Infof(t.ctx, "%d substitutions set", len(subs))
+	}
+	return nil
+}
+
+// substitute applies the substitutions to chunk, which starts at the given
+// stream offset, and returns the chunk to forward
+func (t *Proxy) substitute(
+	s *settings,
+	pc *proxyConn,
+	dir Direction,
+	offset int64,
+	chunk []byte,
+) []byte {
+	if s.substitutions == nil || !pc.targeted || len(chunk) == 0 {
+		return chunk
+	}
+	for _, sub := range s.substitutions {
+		if sub.Direction != dir {
+			continue
+		}
+		err := sub.Fg.FailMaybe()
+		if err == nil {
+			continue
+		}
+		chunk = sub.Replace(chunk)
+		if log.V(3) {
+			log.Infof(
+				t.ctx,
+				"Substituted %s chunk at offset %d of connection %d",
+				dir,
+				offset,
+				pc.decisions.Seq)
+		}
+		t.emitInjection(InjectionEvent{
+			Fault:     FaultSubstitute,
+			Seq:       pc.decisions.Seq,
+			Direction: dir,
+			Offset:    offset,
+		}, err)
+	}
+	return chunk
+}
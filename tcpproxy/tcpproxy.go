@@ -5,16 +5,22 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/rubrikinc/failure-test-utils/failuregen"
 	"github.com/rubrikinc/failure-test-utils/log"
+	"github.com/rubrikinc/failure-test-utils/randutil"
+	"go.uber.org/atomic"
 )
 
-// TCPProxy is the interface for test L4 proxy
+// TCPProxy is the interface for test L4 proxy. The fault settings beyond
+// blocking are methods of *Proxy, some of which are grouped in small
+// interfaces (e.g. Tracer) for callers holding a TCPProxy to type-assert.
 type TCPProxy interface {
 	Stop()
 	Stats() ProxyStats
@@ -26,6 +32,35 @@ type TCPProxy interface {
 	FrontendHostPort() string
 }
 
+// Reconfigurer is implemented by proxies whose fault settings can be read
+// and replaced as a whole, see Proxy.Reconfigure
+type Reconfigurer interface {
+	Config() ProxyConfig
+	Reconfigure(cfg ProxyConfig) error
+}
+
+// Tracer is implemented by proxies tracing their traffic, see
+// Proxy.SetTraceBuffer
+type Tracer interface {
+	SetTraceBuffer(size int) error
+	Trace() []TraceRecord
+	DumpTrace(w io.Writer) error
+}
+
+// Partitioner is implemented by proxies able to block a direction of their
+// traffic, see Proxy.BlockDirection
+type Partitioner interface {
+	BlockDirection(dir Direction)
+	UnblockDirection(dir Direction)
+}
+
+var (
+	_ TCPProxy     = (*Proxy)(nil)
+	_ Reconfigurer = (*Proxy)(nil)
+	_ Tracer       = (*Proxy)(nil)
+	_ Partitioner  = (*Proxy)(nil)
+)
+
 // ProxyStats stores TCP proxy stats
 type ProxyStats struct {
 	// connections accepted by proxy from client, includes only the ones that
@@ -37,7 +72,41 @@ type ProxyStats struct {
 	FrontendDropCtr int64
 	// Connection those were getting served but got dropped due to failure
 	// policy set on the response receiving side.
-	backendDropCtr int64
+	BackendDropCtr int64
+	// Connections closed by the proxy because they outlived the configured
+	// max connection lifetime
+	LifetimeExpiryCtr int64
+	// Errors not injected by the proxy (e.g. environmental flakiness), by
+	// category. Drop and expiry counters above only account for injected
+	// faults.
+	OrganicErrCtrs map[ErrCategory]int64
+}
+
+// ErrCategory classifies errors not injected by the proxy
+type ErrCategory string
+
+const (
+	// ErrCategoryAccept is a failure to accept a client connection
+	ErrCategoryAccept ErrCategory = "accept"
+	// ErrCategoryDial is a failure to connect to the backend
+	ErrCategoryDial ErrCategory = "dial"
+	// ErrCategoryReset is a connection reset by a peer
+	ErrCategoryReset ErrCategory = "reset"
+	// ErrCategoryRead is any other failure to read from a peer
+	ErrCategoryRead ErrCategory = "read"
+	// ErrCategoryWrite is any other failure to write to a peer
+	ErrCategoryWrite ErrCategory = "write"
+)
+
+// OrganicErrCount returns the total number of errors not injected by the
+// proxy. Tests can assert it to be zero to make sure only injected faults
+// occurred.
+func (st ProxyStats) OrganicErrCount() int64 {
+	total := int64(0)
+	for _, n := range st.OrganicErrCtrs {
+		total += n
+	}
+	return total
 }
 
 type proxyStatsWrapper struct {
@@ -45,27 +114,45 @@ type proxyStatsWrapper struct {
 	value ProxyStats
 }
 
-type testTCPProxy struct {
+// Proxy is the test L4 proxy created by NewProxy, it implements TCPProxy
+type Proxy struct {
 	ctx              context.Context
 	listener         net.Listener
 	frontendHostPort string
 	backendHostPort  string
 	quit             chan interface{}
 	wg               sync.WaitGroup
-	recvFg           failuregen.FailureGenerator
-	acceptFg         failuregen.FailureGenerator
 	stats            proxyStatsWrapper
+	randGen          *randutil.LockedRandGen
+	// settings is replaced as a whole by setters, under reconfigMu
+	settings    atomic.Pointer[settings]
+	reconfigMu  sync.Mutex
+	corruptions corruptionLog
+	decisions   decisionLog
+	// connectFg is non-nil for HTTP CONNECT proxies
+	connectFg failuregen.FailureGenerator
+	// dropCh is closed to drop the existing connections
+	dropCh chan struct{}
+	dropMu sync.Mutex
+	// errCh receives the error the proxy died of, and is closed once the
+	// proxy no longer accepts connections
+	errCh chan error
+	// limiter bounds the number of connections of the proxy
+	limiter     *connLimiter
+	injectHooks atomic.Pointer[[]func(InjectionEvent)]
 }
 
-func (t *testTCPProxy) BackendHostPort() string {
+func (t *Proxy) BackendHostPort() string {
 	return t.backendHostPort
 }
 
-func (t *testTCPProxy) FrontendHostPort() string {
+func (t *Proxy) FrontendHostPort() string {
 	return t.frontendHostPort
 }
 
-// NewTCPProxy creates a new instance of an L4 test proxy
+// NewTCPProxy creates a new instance of an L4 test proxy. If the port of
+// frontendHostPort is 0, an ephemeral port is picked and reported by
+// FrontendHostPort.
 func NewTCPProxy(
 	ctx context.Context,
 	frontendHostPort string,
@@ -73,35 +160,87 @@ func NewTCPProxy(
 	recvFg failuregen.FailureGenerator,
 	acceptFg failuregen.FailureGenerator,
 ) (TCPProxy, error) {
+	p, err := NewProxy(
+		ctx,
+		frontendHostPort,
+		backendHostPort,
+		recvFg,
+		acceptFg)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewProxy creates a proxy as NewTCPProxy does, and returns it as a *Proxy
+// for its fault settings to be reachable
+func NewProxy(
+	ctx context.Context,
+	frontendHostPort string,
+	backendHostPort string,
+	recvFg failuregen.FailureGenerator,
+	acceptFg failuregen.FailureGenerator,
+) (*Proxy, error) {
+	return newTCPProxy(
+		ctx,
+		frontendHostPort,
+		backendHostPort,
+		recvFg,
+		acceptFg,
+		nil,
+		0)
+}
+
+func newTCPProxy(
+	ctx context.Context,
+	frontendHostPort string,
+	backendHostPort string,
+	recvFg failuregen.FailureGenerator,
+	acceptFg failuregen.FailureGenerator,
+	connectFg failuregen.FailureGenerator,
+	portRetries int,
+) (*Proxy, error) {
 	uuidStr := uuid.New().String()
-	t := &testTCPProxy{
+	t := &Proxy{
 		ctx:              log.WithLogTag(ctx, uuidStr, nil),
 		quit:             make(chan interface{}),
 		frontendHostPort: frontendHostPort,
 		backendHostPort:  backendHostPort,
-		recvFg:           recvFg,
-		acceptFg:         acceptFg,
 		stats:            proxyStatsWrapper{value: ProxyStats{}},
+		randGen:          randutil.NewLockedRandGen(time.Now().UnixNano()),
+		dropCh:           make(chan struct{}),
+		connectFg:        connectFg,
+		errCh:            make(chan error, 1),
+		limiter:          newConnLimiter(),
 	}
-	l, err := net.Listen("tcp", frontendHostPort)
+	t.publishLocked(&settings{recvFg: recvFg, acceptFg: acceptFg})
+	l, err := listenFrontend(frontendHostPort, portRetries)
 	if err != nil {
 		return nil, errors.Wrap(err, "listen")
 	}
 	t.listener = l
+	// report the port actually listened on if it was picked by the OS (port
+	// 0) or moved due to a conflict
+	_, port, err := net.SplitHostPort(frontendHostPort)
+	_, actualPort, _ := net.SplitHostPort(l.Addr().String())
+	if err == nil && port != actualPort {
+		t.frontendHostPort = l.Addr().String()
+	}
 	t.wg.Add(1)
 	go t.serve()
-	log.Infof(t.ctx, "Started TCP-proxy on %d", frontendHostPort)
+	log.Infof(t.ctx, "Started TCP-proxy on %s", t.frontendHostPort)
 	return t, nil
 }
 
 // Stop stops the proxy from listening and also forcibly closes any connections.
-func (t *testTCPProxy) Stop() {
+func (t *Proxy) Stop() {
 	log.Warningf(
 		t.ctx,
 		"Stopping %s -> %s TCP-proxy",
 		t.frontendHostPort,
 		t.backendHostPort)
 	close(t.quit)
+	t.limiter.close()
 	if err := t.listener.Close(); err != nil {
 		log.Error(t.ctx, err)
 	}
@@ -122,59 +261,277 @@ func (stats *proxyStatsWrapper) getActiveConnCtr() int64 {
 }
 
 // Stats provides the tcp proxy stats
-func (t *testTCPProxy) Stats() ProxyStats {
+func (t *Proxy) Stats() ProxyStats {
 	t.stats.Lock()
 	defer t.stats.Unlock()
 
-	return t.stats.value
+	stats := t.stats.value
+	stats.OrganicErrCtrs = make(map[ErrCategory]int64, len(stats.OrganicErrCtrs))
+	for category, n := range t.stats.value.OrganicErrCtrs {
+		stats.OrganicErrCtrs[category] = n
+	}
+	return stats
 }
 
 func (st ProxyStats) String() string {
 	return fmt.Sprintf(
-		"stats{activeConn: %d, frontendDrop: %d, backendDrop: %d}\n",
+		"stats{activeConn: %d, frontendDrop: %d, backendDrop: %d, "+
+			"lifetimeExpiry: %d, organicErrs: %v}\n",
 		st.activeConnCtr,
 		st.FrontendDropCtr,
-		st.backendDropCtr)
+		st.BackendDropCtr,
+		st.LifetimeExpiryCtr,
+		st.OrganicErrCtrs)
 }
 
 // BlockIncomingConns blocks all new incoming connections to the TCP proxy by
 // dropping them. Existing connections which are already accepted and handled
 // by TCP proxy will continue to serve till completed.
-func (t *testTCPProxy) BlockIncomingConns() {
-	t.acceptFg.SetFailureProbability(1.0)
+func (t *Proxy) BlockIncomingConns() {
+	t.settings.Load().acceptFg.SetFailureProbability(1.0)
 	if log.V(3) {
 		log.Infof(t.ctx, "Going to drop new connections from client")
 	}
 }
 
 // BlockAllTraffic blocks all traffic in both directions
-func (t *testTCPProxy) BlockAllTraffic() {
-	t.acceptFg.SetFailureProbability(1.0)
-	t.recvFg.SetFailureProbability(1.0)
+func (t *Proxy) BlockAllTraffic() {
+	t.settings.Load().acceptFg.SetFailureProbability(1.0)
+	t.settings.Load().recvFg.SetFailureProbability(1.0)
 	if log.V(3) {
 		log.Infof(t.ctx, "Going to drop all traffic")
 	}
 }
 
 // UnblockIncomingConns unblocks all new incoming connections to the TCP proxy
-func (t *testTCPProxy) UnblockIncomingConns() {
-	t.acceptFg.SetFailureProbability(0.0)
+func (t *Proxy) UnblockIncomingConns() {
+	t.settings.Load().acceptFg.SetFailureProbability(0.0)
 	if log.V(3) {
 		log.Infof(t.ctx, "Unblocking new connections from client")
 	}
 }
 
 // UnblockAllTraffic unblocks all traffic in both directions
-func (t *testTCPProxy) UnblockAllTraffic() {
-	t.acceptFg.SetFailureProbability(0.0)
-	t.recvFg.SetFailureProbability(0.0)
+func (t *Proxy) UnblockAllTraffic() {
+	t.settings.Load().acceptFg.SetFailureProbability(0.0)
+	t.settings.Load().recvFg.SetFailureProbability(0.0)
 	if log.V(3) {
 		log.Infof(t.ctx, "Unblocking all traffic")
 	}
 }
 
+// SetMaxConnLifetime makes the proxy close connections once they have been
+// open for lifetime, randomly adjusted by up to +/- jitter, simulating
+// middleboxes that recycle long-lived flows. A zero lifetime disables the
+// limit. The setting applies to connections accepted after the call.
+func (t *Proxy) SetMaxConnLifetime(
+	lifetime time.Duration,
+	jitter time.Duration,
+) {
+	t.update(func(s *settings) {
+		s.maxConnLifetime, s.connLifetimeJitter = lifetime, jitter
+	})
+	if log.V(3) {
+		log.Infof(
+			t.ctx,
+			"Max connection lifetime set to %v (jitter %v)",
+			lifetime,
+			jitter)
+	}
+}
+
+// connLifetime returns the lifetime of a new connection, 0 if unlimited
+func (t *Proxy) connLifetime(s *settings, pc *proxyConn) time.Duration {
+	if pc.replay != nil {
+		return pc.replay.Lifetime
+	}
+	if !pc.targeted {
+		return 0
+	}
+	lifetime := s.maxConnLifetime
+	if lifetime <= 0 {
+		return 0
+	}
+	if jitter := s.connLifetimeJitter; jitter > 0 {
+		lifetime += time.Duration(pc.randGen.Int63n(2*int64(jitter)+1)) - jitter
+	}
+	if lifetime <= 0 {
+		// expire immediately rather than never
+		lifetime = time.Nanosecond
+	}
+	return lifetime
+}
+
+// EnableLazyDial defers dialing the backend until the client sends its first
+// bytes. preDialFg is consulted right before dialing, an injected failure
+// drops the client connection without ever reaching the backend.
+func (t *Proxy) EnableLazyDial(preDialFg failuregen.FailureGenerator) {
+	t.update(func(s *settings) { s.preDialFg = preDialFg })
+	if log.V(3) {
+		log.Infof(t.ctx, "Deferring backend dial until first byte")
+	}
+}
+
+// DisableLazyDial makes the proxy dial the backend as soon as a connection
+// is accepted
+func (t *Proxy) DisableLazyDial() {
+	t.update(func(s *settings) { s.preDialFg = nil })
+	if log.V(3) {
+		log.Infof(t.ctx, "Dialing backend on accept")
+	}
+}
+
+// awaitFirstChunk blocks till the client sends data, returns nil if the
+// client or the proxy goes away first
+func (t *Proxy) awaitFirstChunk(conn net.Conn) ([]byte, error) {
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-t.quit:
+			return nil, nil
+		default:
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+			return nil, t.organicErr(err, ErrCategoryRead, "set source deadline")
+		}
+		nr, err := conn.Read(buf)
+		if nr > 0 {
+			return buf[:nr], nil
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil && !isTimeout(err) {
+			return nil, t.organicErr(err, ErrCategoryRead, "read")
+		}
+	}
+}
+
+// SetMaxSegmentSize caps the size of individual writes forwarded by the
+// proxy (e.g. 1460 or 536 bytes) to simulate a small effective MSS, waiting
+// fragmentDelay between the fragments of a chunk. A size of 0 removes the cap.
+func (t *Proxy) SetMaxSegmentSize(
+	size int,
+	fragmentDelay time.Duration,
+) error {
+	if size < 0 {
+		return errors.Errorf("Invalid max segment size %d", size)
+	}
+	t.update(func(s *settings) {
+		s.maxSegmentSize, s.fragmentDelay = size, fragmentDelay
+	})
+	if log.V(3) {
+		log.Infof(
+			t.ctx,
+			"Max segment size set to %d (fragment delay %v)",
+			size,
+			fragmentDelay)
+	}
+	return nil
+}
+
+// write forwards buf to dest, fragmenting it as per the max segment size
+func (t *Proxy) write(s *settings, dest net.Conn, buf []byte) (int, error) {
+	segment := s.maxSegmentSize
+	if segment <= 0 || len(buf) <= segment {
+		return dest.Write(buf)
+	}
+	written := 0
+	for written < len(buf) {
+		if written > 0 {
+			if delay := s.fragmentDelay; delay > 0 {
+				time.Sleep(delay)
+			}
+		}
+		end := written + segment
+		if end > len(buf) {
+			end = len(buf)
+		}
+		n, err := dest.Write(buf[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// SetConnTargeting restricts faults (drops, lifetime expiry) to connections
+// selected by targeting, e.g. FirstConnOnly to fault only the bootstrap
+// connection of a client. A nil targeting subjects all connections to
+// faults. The setting applies to connections accepted after the call.
+func (t *Proxy) SetConnTargeting(targeting ConnTargeting) {
+	t.update(func(s *settings) { s.connTargeting = targeting })
+}
+
+// EnablePartialReads makes the proxy split received chunks for which fg
+// injects a failure: only a random prefix of the chunk is forwarded, the
+// remainder follows after stall. This tests parsers against slow trickle
+// delivery of a message. Partial reads are recorded in ConnDecisions.
+func (t *Proxy) EnablePartialReads(
+	fg failuregen.FailureGenerator,
+	stall time.Duration,
+) {
+	t.update(func(s *settings) { s.partialFg, s.partialStall = fg, stall })
+	if log.V(3) {
+		log.Infof(t.ctx, "Partial reads enabled (stall %v)", stall)
+	}
+}
+
+// DisablePartialReads makes the proxy forward received chunks whole
+func (t *Proxy) DisablePartialReads() {
+	t.update(func(s *settings) { s.partialFg = nil })
+	if log.V(3) {
+		log.Infof(t.ctx, "Partial reads disabled")
+	}
+}
+
+// forward writes a chunk received in direction dir at the given stream
+// offset to dest, possibly as a partial read
+func (t *Proxy) forward(
+	s *settings,
+	dest net.Conn,
+	chunk []byte,
+	pc *proxyConn,
+	dir Direction,
+	offset int64,
+) error {
+	if split, stall := t.partialRead(s, pc, dir, offset, len(chunk)); split > 0 {
+		if _, err := t.write(s, dest, chunk[:split]); err != nil {
+			return err
+		}
+		if log.V(4) {
+			log.Infof(
+				t.ctx,
+				"forwarded %d of %d bytes to %v, stalling for %v",
+				split,
+				len(chunk),
+				dest.RemoteAddr(),
+				stall)
+		}
+		if !t.pause(stall) {
+			return nil
+		}
+		chunk = chunk[split:]
+	}
+	_, err := t.write(s, dest, chunk)
+	return err
+}
+
+// pause waits for d, it returns false if the proxy is stopped meanwhile
+func (t *Proxy) pause(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.quit:
+		return false
+	}
+}
+
 // close connections gracefully
-func (t *testTCPProxy) closeFrontendConn(
+func (t *Proxy) closeFrontendConn(
 	conn net.Conn,
 	reason string,
 ) {
@@ -188,27 +545,112 @@ func (t *testTCPProxy) closeFrontendConn(
 		t.stats.incrementFrontendDropCtr()
 	}
 	t.stats.decrementActiveConnCtr()
+	t.limiter.release()
+}
+
+// maxAcceptFailureDuration is how long accept may keep failing with
+// temporary errors before the proxy is considered dead
+const maxAcceptFailureDuration = 5 * time.Second
+
+// Err returns a channel which receives the error the proxy died of if it
+// stops accepting connections unexpectedly (e.g. its listener is closed
+// underneath it, or accept keeps failing due to fd exhaustion). The channel
+// is closed once the proxy no longer accepts connections, without an error
+// if it was stopped through Stop.
+func (t *Proxy) Err() <-chan error {
+	return t.errCh
 }
 
-func (t *testTCPProxy) serve() {
+// isTemporary tells if an accept error may go away on retry
+func isTemporary(err error) bool {
+	var tempErr interface{ Temporary() bool }
+	return errors.As(err, &tempErr) && tempErr.Temporary()
+}
+
+// acceptFailed handles an accept error and tells if serving must stop,
+// failingSince is when accept started failing
+func (t *Proxy) acceptFailed(err error, failingSince time.Time) bool {
+	select {
+	case <-t.quit:
+		// error was because the proxy was stopped, safe to ignore
+		return true
+	default:
+	}
+	err = t.organicErr(err, ErrCategoryAccept, "accept")
+	log.Errorf(t.ctx, "accept error: %v", err)
+	if isTemporary(err) && time.Since(failingSince) < maxAcceptFailureDuration {
+		return false
+	}
+	log.Errorf(t.ctx, "TCP-proxy on %s died: %v", t.frontendHostPort, err)
+	if cerr := t.listener.Close(); cerr != nil {
+		log.Warningf(t.ctx, "failed closing listener: %v", cerr)
+	}
+	t.errCh <- errors.Wrapf(err, "TCP-proxy on %s died", t.frontendHostPort)
+	return true
+}
+
+func (t *Proxy) serve() {
+	labelGoroutine(t.proxyLabels())
 	defer t.wg.Done()
+	defer close(t.errCh)
 
+	var failingSince time.Time
+	backoff := time.Duration(0)
 	for {
+		if !t.limiter.acquire() {
+			return
+		}
 		conn, err := t.listener.Accept()
 		if err != nil {
+			t.limiter.release()
+			if failingSince.IsZero() {
+				failingSince = time.Now()
+			}
+			if t.acceptFailed(err, failingSince) {
+				return
+			}
+			// back off like net/http does, so that a persistent error does
+			// not spin
+			if backoff = 2*backoff + time.Millisecond; backoff > time.Second {
+				backoff = time.Second
+			}
 			select {
+			case <-time.After(backoff):
 			case <-t.quit:
-				// error was because the proxy was stopped, safe to ignore
 				return
-			default:
-				log.Errorf(t.ctx, "accept error: %v", err)
 			}
 		} else {
+			failingSince, backoff = time.Time{}, 0
 			log.Infof(t.ctx, "Accepted connection from %v", conn.RemoteAddr())
 
 			t.stats.incrementActiveConnCtr()
 
-			if err := t.acceptFg.FailMaybe(); err != nil {
+			s := t.settings.Load()
+			if err := s.sockOpts.frontend.apply(conn); err != nil {
+				log.Warningf(
+					t.ctx,
+					"failed setting socket options of %v: %v",
+					conn.RemoteAddr(),
+					err)
+			}
+
+			decision := t.acceptDecision(s, conn)
+			switch decision.Action {
+			case AcceptDrop:
+				t.closeFrontendConn(conn, "drop")
+				continue
+			case AcceptHijack:
+				t.hijack(conn, decision.Handler)
+				continue
+			}
+
+			pc := t.newProxyConn(s)
+			if err := t.decide(
+				pc,
+				s.acceptFg,
+				FaultAcceptDrop,
+				func(d *ConnDecisions) *bool { return &d.AcceptDropped },
+			); err != nil {
 				log.Warningf(
 					t.ctx,
 					"injected accept failure %v,  %v",
@@ -219,9 +661,10 @@ func (t *testTCPProxy) serve() {
 			}
 			t.wg.Add(1)
 			go func() {
+				ctx := labelGoroutine(t.proxyLabels(), connLabels(pc)...)
 				log.Infof(t.ctx, "Accepted connection from %v",
 					conn.RemoteAddr())
-				if err := t.handle(conn); err != nil {
+				if err := t.handle(ctx, conn, pc); err != nil {
 					log.Errorf(t.ctx, "handle err: %v", err)
 				}
 				t.wg.Done()
@@ -245,7 +688,31 @@ func (stats *proxyStatsWrapper) decrementActiveConnCtr() {
 func (stats *proxyStatsWrapper) incrementBackendDropCtr() {
 	stats.Lock()
 	defer stats.Unlock()
-	stats.value.backendDropCtr++
+	stats.value.BackendDropCtr++
+}
+
+func (stats *proxyStatsWrapper) incrementOrganicErrCtr(category ErrCategory) {
+	stats.Lock()
+	defer stats.Unlock()
+	if stats.value.OrganicErrCtrs == nil {
+		stats.value.OrganicErrCtrs = make(map[ErrCategory]int64)
+	}
+	stats.value.OrganicErrCtrs[category]++
+}
+
+// organicErr records an error not injected by the proxy in the stats and
+// wraps it with msg. Resets by peers are categorized as such regardless of
+// the operation that observed them.
+func (t *Proxy) organicErr(
+	err error,
+	category ErrCategory,
+	msg string,
+) error {
+	if errors.Is(err, syscall.ECONNRESET) {
+		category = ErrCategoryReset
+	}
+	t.stats.incrementOrganicErrCtr(category)
+	return errors.Wrap(err, msg)
 }
 
 func (stats *proxyStatsWrapper) incrementFrontendDropCtr() {
@@ -254,63 +721,106 @@ func (stats *proxyStatsWrapper) incrementFrontendDropCtr() {
 	stats.value.FrontendDropCtr++
 }
 
-func (t *testTCPProxy) copy(
+func (stats *proxyStatsWrapper) incrementLifetimeExpiryCtr() {
+	stats.Lock()
+	defer stats.Unlock()
+	stats.value.LifetimeExpiryCtr++
+}
+
+// streamEnd signals the end of the copy of one direction of a connection
+type streamEnd struct {
+	// eof is closed once the source half-closed the stream
+	eof chan struct{}
+	// term is closed once the copy terminated
+	term chan struct{}
+}
+
+func newStreamEnd() *streamEnd {
+	return &streamEnd{eof: make(chan struct{}), term: make(chan struct{})}
+}
+
+func (t *Proxy) copy(
 	dest, src net.Conn,
-	selfTermCh chan struct{},
-	peerTermCh chan struct{},
+	pc *proxyConn,
+	dir Direction,
+	self *streamEnd,
+	peer *streamEnd,
+	expiredCh chan struct{},
 ) error {
-	defer close(selfTermCh)
-	buf := make([]byte, 1024)
-	// Robustly close connections when proxy closes
+	defer close(self.term)
+	pooled := getBuffer(t.settings.Load().bufferSize())
+	defer putBuffer(pooled)
+	buf := *pooled
+	offset, delivered := int64(0), int64(0)
+	// Robustly close connections when proxy closes, reads are interrupted
+	// by interruptReads rather than polled for termination
 	// https://eli.thegreenplace.net/2020/graceful-shutdown-of-a-tcp-server-in-go/#id1
 	for {
 		var nr int
+		// the settings are read once per chunk
+		var s *settings
 		select {
-		case <-peerTermCh:
+		case <-peer.term:
+			return nil
+		case <-expiredCh:
 			return nil
 		case <-t.quit:
 			return nil
 		default:
-			if err := src.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
-				return errors.Wrap(err, "set source deadline")
-			}
 			var err error
 			nr, err = src.Read(buf)
 			if err != nil {
-				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				if isTimeout(err) {
 					continue
 				} else if err != io.EOF {
-					return errors.Wrap(err, "read")
+					return t.organicErr(err, ErrCategoryRead, "read")
 				}
 			}
 			if nr == 0 {
+				t.halfClose(dest, self, peer, expiredCh)
 				return nil
 			}
 			if log.V(4) {
 				log.Infof(t.ctx, "received from %v: %s", src.RemoteAddr(),
 					string(buf[:nr]))
 			}
+			// the chunk, and the reads that follow, are held while dir is
+			// partitioned, so that the traffic is delayed rather than lost
+			if s = t.awaitUnblocked(dir, peer.term, expiredCh); s == nil {
+				return nil
+			}
 
-			// TODO(CDM-362117)(Ambar) Change to a KMP filter to make this robust
-			condFailGen, ok := (t.recvFg).(failuregen.ConditionalFailureGenerator)
-			if ok {
-				if err := condFailGen.FailOnCondition(buf); err != nil {
-					t.stats.incrementBackendDropCtr()
-					return errors.Wrap(err, "injected recv failure on satisfying condition")
-				}
-			} else {
-				if err := t.recvFg.FailMaybe(); err != nil {
-					t.stats.incrementBackendDropCtr()
-					return errors.Wrap(err, "injected recv failure")
+			if n, err := t.recvFailure(s, pc, dir, offset, buf[:nr]); err != nil {
+				if n > 0 {
+					_, _ = t.write(s, dest, buf[:n])
 				}
+				s.trace.record(TraceRecord{
+					Seq:       pc.decisions.Seq,
+					Direction: dir,
+					Offset:    offset,
+					Received:  int32(nr),
+					Delivered: int32(n),
+					Dropped:   true,
+				})
+				t.stats.incrementBackendDropCtr()
+				return err
 			}
-			return nil
-
 		}
-		_, err := dest.Write(buf[:nr])
+		chunk := t.applyByteRanges(s, pc, dir, offset, delivered, buf[:nr])
+		chunk = t.substitute(s, pc, dir, offset, chunk)
+		s.trace.record(TraceRecord{
+			Seq:       pc.decisions.Seq,
+			Direction: dir,
+			Offset:    offset,
+			Received:  int32(nr),
+			Delivered: int32(len(chunk)),
+		})
+		err := t.forward(s, dest, chunk, pc, dir, offset)
+		offset += int64(nr)
+		delivered += int64(len(chunk))
 
 		if err != nil {
-			return errors.Wrap(err, "write")
+			return t.organicErr(err, ErrCategoryWrite, "write")
 		}
 		if log.V(4) {
 			log.Infof(t.ctx, "written to %v: %s", dest.RemoteAddr(),
@@ -319,28 +829,129 @@ func (t *testTCPProxy) copy(
 	}
 }
 
-func (t *testTCPProxy) handle(frontendConn net.Conn) error {
+func (t *Proxy) handle(
+	ctx context.Context,
+	frontendConn net.Conn,
+	pc *proxyConn,
+) error {
 	defer t.closeFrontendConn(frontendConn, "task completed")
-	backendConn, err := net.Dial("tcp", t.backendHostPort)
+
+	s := t.settings.Load()
+	backendHostPort := t.backendHostPort
+	var firstChunk []byte
+	if t.connectFg != nil {
+		var err error
+		backendHostPort, firstChunk, err = t.acceptConnect(frontendConn, pc)
+		if err != nil {
+			return err
+		}
+	} else if preDialFg := s.preDialFg; preDialFg != nil {
+		var err error
+		firstChunk, err = t.awaitFirstChunk(frontendConn)
+		if err != nil || firstChunk == nil {
+			return err
+		}
+		if err := t.decide(
+			pc,
+			preDialFg,
+			FaultPreDialDrop,
+			func(d *ConnDecisions) *bool { return &d.PreDialDropped },
+		); err != nil {
+			t.stats.incrementFrontendDropCtr()
+			return errors.Wrap(err, "injected pre-dial failure")
+		}
+	}
+
+	backendConn, err := net.Dial("tcp", backendHostPort)
 	if err != nil {
-		return errors.Wrap(err, "failed dialing to backend port")
+		if t.connectFg != nil {
+			writeConnectResponse(frontendConn, http.StatusBadGateway)
+		}
+		return t.organicErr(
+			err,
+			ErrCategoryDial,
+			"failed dialing to backend port")
 	}
 	defer backendConn.Close()
+	if t.connectFg != nil {
+		writeConnectResponse(frontendConn, http.StatusOK)
+	}
+	if err := s.sockOpts.backend.apply(backendConn); err != nil {
+		log.Warningf(
+			t.ctx,
+			"failed setting socket options of %v: %v",
+			backendConn.LocalAddr(),
+			err)
+	}
 	log.Infof(
 		t.ctx,
 		"Created proxy connection %v -> %v",
 		backendConn.LocalAddr(),
 		backendConn.RemoteAddr())
 
+	if len(firstChunk) > 0 {
+		if _, err := t.write(s, backendConn, firstChunk); err != nil {
+			return t.organicErr(err, ErrCategoryWrite, "write")
+		}
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	defer wg.Wait()
 
-	onwardTermCh := make(chan struct{})
-	returnTermCh := make(chan struct{})
+	onwardEnd, returnEnd := newStreamEnd(), newStreamEnd()
+	expiredCh := make(chan struct{})
+	var expireOnce sync.Once
+	expire := func() { expireOnce.Do(func() { close(expiredCh) }) }
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	// deadlines set while awaiting the first chunk or the CONNECT request
+	// must not interrupt copying
+	_ = frontendConn.SetReadDeadline(time.Time{})
+	go func(dropCh <-chan struct{}) {
+		select {
+		case <-dropCh:
+			log.Infof(
+				t.ctx,
+				"closing connection to %v on reconfiguration",
+				frontendConn.RemoteAddr())
+			expire()
+		case <-onwardEnd.term:
+		case <-returnEnd.term:
+		case <-expiredCh:
+		case <-t.quit:
+		case <-doneCh:
+			return
+		}
+		interruptReads(frontendConn, backendConn)
+	}(t.dropSignal())
+	lifetime := t.connLifetime(s, pc)
+	t.decisions.Lock()
+	pc.decisions.Lifetime = lifetime
+	t.decisions.Unlock()
+	if lifetime > 0 {
+		timer := time.AfterFunc(lifetime, func() {
+			log.Infof(
+				t.ctx,
+				"closing connection to %v after max lifetime of %v",
+				frontendConn.RemoteAddr(),
+				lifetime)
+			t.stats.incrementLifetimeExpiryCtr()
+			expire()
+		})
+		defer timer.Stop()
+	}
 
 	go func() {
-		err := t.copy(backendConn, frontendConn, onwardTermCh, returnTermCh)
+		labelGoroutine(ctx, LabelDirection, string(Onward))
+		err := t.copy(
+			backendConn,
+			frontendConn,
+			pc,
+			Onward,
+			onwardEnd,
+			returnEnd,
+			expiredCh)
 		if err != nil {
 			log.Errorf(
 				t.ctx,
@@ -351,7 +962,62 @@ func (t *testTCPProxy) handle(frontendConn net.Conn) error {
 		}
 		wg.Done()
 	}()
-	return t.copy(frontendConn, backendConn, returnTermCh, onwardTermCh)
+	labelGoroutine(ctx, LabelDirection, string(Return))
+	return t.copy(
+		frontendConn,
+		backendConn,
+		pc,
+		Return,
+		returnEnd,
+		onwardEnd,
+		expiredCh)
+}
+
+// halfClose forwards the end of the stream of self to dest, then waits for
+// the other direction of the connection to end too, so that peers which
+// half-close their connection (e.g. once they sent a request) still receive
+// what the other peer sends. dest is closed as a whole if it can't be
+// half-closed.
+func (t *Proxy) halfClose(
+	dest net.Conn,
+	self *streamEnd,
+	peer *streamEnd,
+	expiredCh <-chan struct{},
+) {
+	close(self.eof)
+	closer, ok := dest.(interface{ CloseWrite() error })
+	if !ok {
+		return
+	}
+	if err := closer.CloseWrite(); err != nil {
+		// the peer is gone, the other direction ends on its own
+		if log.V(3) {
+			log.Infof(t.ctx, "failed half-closing %v: %v", dest.RemoteAddr(), err)
+		}
+		return
+	}
+	select {
+	case <-peer.eof:
+	case <-peer.term:
+	case <-expiredCh:
+	case <-t.quit:
+	}
+}
+
+// interruptReads makes pending and future reads of conns fail with a
+// timeout, the copy loops then notice why they must terminate
+func interruptReads(conns ...net.Conn) {
+	for _, conn := range conns {
+		_ = conn.SetReadDeadline(time.Unix(1, 0))
+	}
+}
+
+// isTimeout reports whether err is a deadline expiry. The concrete error type
+// differs across platforms (e.g. Windows wraps WSA errors differently), so
+// rely on net.Error rather than *net.OpError.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 func localhostAddress(port int) string {
@@ -0,0 +1,1236 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// startEchoServer starts a server echoing back everything it receives, it
+// returns the address of the server and a counter of accepted connections
+func startEchoServer(t testing.TB) (string, *atomic.Int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	accepted := atomic.NewInt32(0)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Inc()
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String(), accepted
+}
+
+// freeHostPort returns a localhost address that is free at the time of call
+func freeHostPort(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func startProxy(t testing.TB) *tcpproxy.Proxy {
+	backendHostPort, _ := startEchoServer(t)
+	return startProxyTo(t, backendHostPort)
+}
+
+func startProxyTo(t testing.TB, backendHostPort string) *tcpproxy.Proxy {
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		freeHostPort(t),
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+	return p
+}
+
+func roundTrip(t testing.TB, conn net.Conn, msg string) error {
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	require.Equal(t, msg, string(buf))
+	return nil
+}
+
+func TestProxyForwardsTraffic(t *testing.T) {
+	p := startProxy(t)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, msg := range []string{"hello", "world"} {
+		require.NoError(t, roundTrip(t, conn, msg))
+	}
+}
+
+func TestProxyBlockAllTrafficDropsConnections(t *testing.T) {
+	p := startProxy(t)
+	p.BlockAllTraffic()
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Error(t, roundTrip(t, conn, "hello"))
+
+	p.UnblockAllTraffic()
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+}
+
+func TestProxyClosesConnectionsAfterMaxLifetime(t *testing.T) {
+	p := startProxy(t)
+	p.SetMaxConnLifetime(100*time.Millisecond, 50*time.Millisecond)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+
+	time.Sleep(300 * time.Millisecond)
+	require.Error(t, roundTrip(t, conn, "hello"))
+	require.Equal(t, int64(1), p.Stats().LifetimeExpiryCtr)
+
+	p.SetMaxConnLifetime(0, 0)
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, roundTrip(t, conn, "hello"))
+}
+
+func TestProxyLazyDialDefersBackendConnection(t *testing.T) {
+	backendHostPort, accepted := startEchoServer(t)
+	p := startProxyTo(t, backendHostPort)
+	preDialFg := failuregen.NewFailureGenerator()
+	p.EnableLazyDial(preDialFg)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	require.Zero(t, accepted.Load())
+
+	require.NoError(t, roundTrip(t, conn, "hello"))
+	require.Equal(t, int32(1), accepted.Load())
+
+	// pre-dial failures drop the client before the backend is dialed
+	require.NoError(t, preDialFg.SetFailureProbability(1.0))
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Error(t, roundTrip(t, conn, "hello"))
+	require.Equal(t, int32(1), accepted.Load())
+	require.Equal(t, int64(1), p.Stats().FrontendDropCtr)
+
+	p.DisableLazyDial()
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(
+		t,
+		func() bool { return accepted.Load() == 2 },
+		time.Second,
+		10*time.Millisecond)
+}
+
+func TestProxyRecordsAndReplaysDecisions(t *testing.T) {
+	acceptFg := failuregen.NewFailureGenerator()
+	backendHostPort, _ := startEchoServer(t)
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		freeHostPort(t),
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		acceptFg)
+	require.NoError(t, err)
+	defer p.Stop()
+
+	dialAndRoundTrip := func(p *tcpproxy.Proxy) error {
+		conn, err := net.Dial("tcp", p.FrontendHostPort())
+		require.NoError(t, err)
+		defer conn.Close()
+		return roundTrip(t, conn, "hello")
+	}
+
+	require.NoError(t, acceptFg.SetFailureProbability(1.0))
+	require.Error(t, dialAndRoundTrip(p))
+	require.NoError(t, acceptFg.SetFailureProbability(0.0))
+	require.NoError(t, dialAndRoundTrip(p))
+
+	recorded := p.Decisions()
+	require.Len(t, recorded, 2)
+	require.True(t, recorded[0].AcceptDropped)
+	require.False(t, recorded[1].AcceptDropped)
+
+	// replay against a proxy whose generators never fail
+	replayed := startProxyTo(t, backendHostPort)
+	recorded = append(recorded, tcpproxy.ConnDecisions{
+		Seq:    2,
+		DropAt: map[tcpproxy.Direction]int64{tcpproxy.Onward: 3},
+	})
+	replayed.ReplayDecisions(recorded)
+	require.Error(t, dialAndRoundTrip(replayed))
+	require.NoError(t, dialAndRoundTrip(replayed))
+	require.Error(t, dialAndRoundTrip(replayed))
+	// connections beyond the replayed decisions are not faulted
+	require.NoError(t, dialAndRoundTrip(replayed))
+
+	require.Eventually(
+		t,
+		func() bool { return len(replayed.Decisions()) == 4 },
+		time.Second,
+		10*time.Millisecond)
+	decisions := replayed.Decisions()
+	require.Equal(t, recorded[0].Seed, decisions[0].Seed)
+	require.True(t, decisions[0].AcceptDropped)
+	require.Equal(
+		t,
+		map[tcpproxy.Direction]int64{tcpproxy.Onward: 3},
+		decisions[2].DropAt)
+	require.Empty(t, decisions[3].DropAt)
+}
+
+func TestProxyDecisionRetentionIsBounded(t *testing.T) {
+	p := startProxy(t)
+	spillPath := filepath.Join(t.TempDir(), "decisions.jsonl")
+	require.NoError(t, p.SetDecisionRetention(2, spillPath))
+
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", p.FrontendHostPort())
+		require.NoError(t, err)
+		require.NoError(t, roundTrip(t, conn, "hello"))
+		conn.Close()
+	}
+
+	decisions := p.Decisions()
+	require.Len(t, decisions, 2)
+	require.Equal(t, int64(3), decisions[0].Seq)
+	require.Equal(t, int64(4), decisions[1].Seq)
+
+	f, err := os.Open(spillPath)
+	require.NoError(t, err)
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for seq := int64(0); seq < 3; seq++ {
+		var d tcpproxy.ConnDecisions
+		require.NoError(t, dec.Decode(&d))
+		require.Equal(t, seq, d.Seq)
+	}
+
+	require.NoError(t, p.SetDecisionRetention(1, ""))
+	require.Len(t, p.Decisions(), 1)
+	require.Equal(t, int64(4), p.Decisions()[0].Seq)
+}
+
+func TestProxyFragmentsWrites(t *testing.T) {
+	// backend records the sizes of the reads it observes
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	readSizes := make(chan int, 100)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(readSizes)
+				return
+			}
+			readSizes <- n
+		}
+	}()
+
+	p := startProxyTo(t, l.Addr().String())
+	require.Error(t, p.SetMaxSegmentSize(-1, 0))
+	require.NoError(t, p.SetMaxSegmentSize(4, 20*time.Millisecond))
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	conn.Close()
+
+	var sizes []int
+	for n := range readSizes {
+		sizes = append(sizes, n)
+	}
+	require.Equal(t, []int{4, 4, 2}, sizes)
+}
+
+func TestProxyTargetsFirstConnOnly(t *testing.T) {
+	acceptFg := failuregen.NewFailureGenerator()
+	require.NoError(t, acceptFg.SetFailureProbability(1.0))
+	backendHostPort, _ := startEchoServer(t)
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		acceptFg)
+	require.NoError(t, err)
+	defer p.Stop()
+	p.SetConnTargeting(tcpproxy.FirstConnOnly)
+
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", p.FrontendHostPort())
+		require.NoError(t, err)
+		if i == 0 {
+			require.Error(t, roundTrip(t, conn, "hello"))
+		} else {
+			require.NoError(t, roundTrip(t, conn, "hello"))
+		}
+		conn.Close()
+	}
+}
+
+func TestProxyPartialReads(t *testing.T) {
+	p := startProxy(t)
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	p.EnablePartialReads(fg, 50*time.Millisecond)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start := time.Now()
+	require.NoError(t, roundTrip(t, conn, "0123456789"))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	p.DisablePartialReads()
+	start = time.Now()
+	require.NoError(t, roundTrip(t, conn, "0123456789"))
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestProxyRecordsAndReplaysPartialReads(t *testing.T) {
+	p := startProxy(t)
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	p.EnablePartialReads(fg, 50*time.Millisecond)
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	require.NoError(t, roundTrip(t, conn, "0123456789"))
+	conn.Close()
+
+	recorded := p.Decisions()
+	require.Len(t, recorded, 1)
+	onward := recorded[0].PartialReads[tcpproxy.Onward]
+	require.Len(t, onward, 1)
+	require.Zero(t, onward[0].Offset)
+	require.Equal(t, 50*time.Millisecond, onward[0].Stall)
+	require.Greater(t, onward[0].Split, 0)
+	require.Less(t, onward[0].Split, 10)
+
+	// replay against a proxy without partial reads
+	replayed := startProxy(t)
+	replayed.ReplayDecisions(recorded)
+	conn, err = net.Dial("tcp", replayed.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	start := time.Now()
+	require.NoError(t, roundTrip(t, conn, "0123456789"))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Equal(
+		t,
+		onward,
+		replayed.Decisions()[0].PartialReads[tcpproxy.Onward])
+}
+
+func TestProxyStopInterruptsPartialReadStall(t *testing.T) {
+	backendHostPort, _ := startEchoServer(t)
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		freeHostPort(t),
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.SetFailureProbability(1.0))
+	p.EnablePartialReads(fg, time.Hour)
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	require.Eventually(
+		t,
+		func() bool {
+			decisions := p.Decisions()
+			return len(decisions) == 1 && len(decisions[0].PartialReads) > 0
+		},
+		time.Second,
+		10*time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked on a partial-read stall")
+	}
+}
+
+func TestProxyDistinguishesInjectedAndOrganicErrors(t *testing.T) {
+	p := startProxy(t)
+	p.BlockIncomingConns()
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	require.Error(t, roundTrip(t, conn, "hello"))
+	conn.Close()
+
+	stats := p.Stats()
+	require.Equal(t, int64(1), stats.FrontendDropCtr)
+	require.Zero(t, stats.OrganicErrCount())
+
+	// nothing listens on the backend port of this proxy
+	unreachable := startProxyTo(t, freeHostPort(t))
+	conn, err = net.Dial("tcp", unreachable.FrontendHostPort())
+	require.NoError(t, err)
+	require.Error(t, roundTrip(t, conn, "hello"))
+	conn.Close()
+
+	stats = unreachable.Stats()
+	require.Zero(t, stats.FrontendDropCtr)
+	require.Equal(
+		t,
+		map[tcpproxy.ErrCategory]int64{tcpproxy.ErrCategoryDial: 1},
+		stats.OrganicErrCtrs)
+	require.Equal(t, int64(1), stats.OrganicErrCount())
+}
+
+func TestProxySocketOptions(t *testing.T) {
+	p := startProxy(t)
+
+	require.Error(t, p.SetSocketOptions(
+		tcpproxy.SocketOptions{ReadBufferSize: -1},
+		tcpproxy.SocketOptions{}))
+
+	disabled, enabled := false, true
+	require.NoError(t, p.SetSocketOptions(
+		tcpproxy.SocketOptions{
+			KeepAlive:       &disabled,
+			NoDelay:         &enabled,
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+		},
+		tcpproxy.SocketOptions{
+			KeepAlive:       &enabled,
+			KeepAlivePeriod: time.Second,
+			NoDelay:         &disabled,
+		}))
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+	require.Zero(t, p.Stats().OrganicErrCount())
+}
+
+// startBackend starts a server serving each accepted connection with serve
+func startBackend(t testing.TB, serve func(conn net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestProxyForwardsHalfClose(t *testing.T) {
+	// the backend answers once the client is done sending, as e.g. HTTP/1.0
+	// servers do
+	p := startProxyTo(t, startBackend(t, func(conn net.Conn) {
+		request, err := io.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		_, _ = conn.Write(append([]byte("got "), request...))
+	}))
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "got hello", string(response))
+	require.Zero(t, p.Stats().OrganicErrCount())
+}
+
+func TestProxyLinger(t *testing.T) {
+	for _, linger := range []*int{nil, new(int)} {
+		readErrCh := make(chan error, 1)
+		p := startProxyTo(t, startBackend(t, func(conn net.Conn) {
+			_, err := io.ReadAll(conn)
+			readErrCh <- err
+		}))
+		require.NoError(t, p.SetSocketOptions(
+			tcpproxy.SocketOptions{},
+			tcpproxy.SocketOptions{Linger: linger}))
+		require.NoError(t, p.Config().RecvFg.SetFailureProbability(1))
+
+		conn, err := net.Dial("tcp", p.FrontendHostPort())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+		select {
+		case err := <-readErrCh:
+			// a dropped connection is closed gracefully unless it lingers
+			// for 0s, in which case it is reset
+			if linger == nil {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "backend connection not closed")
+		}
+	}
+}
+
+func TestProxyReconfigure(t *testing.T) {
+	p := startProxy(t)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+
+	cfg := p.Config()
+	cfg.MaxSegmentSize = -1
+	require.Error(t, p.Reconfigure(cfg))
+
+	// existing connections survive reconfiguration by default
+	cfg = p.Config()
+	cfg.MaxSegmentSize = 2
+	require.NoError(t, p.Reconfigure(cfg))
+	require.NoError(t, roundTrip(t, conn, "hello"))
+	require.Equal(t, 2, p.Config().MaxSegmentSize)
+
+	// new generators take effect for existing connections
+	blockingFg := failuregen.NewFailureGenerator()
+	require.NoError(t, blockingFg.SetFailureProbability(1.0))
+	cfg.RecvFg = blockingFg
+	require.NoError(t, p.Reconfigure(cfg))
+	require.Error(t, roundTrip(t, conn, "hello"))
+
+	cfg.RecvFg = failuregen.NewFailureGenerator()
+	require.NoError(t, p.Reconfigure(cfg))
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+
+	cfg.DropExistingConns = true
+	require.NoError(t, p.Reconfigure(cfg))
+	time.Sleep(100 * time.Millisecond)
+	require.Error(t, roundTrip(t, conn, "hello"))
+}
+
+func TestProxyConfigRoundTrip(t *testing.T) {
+	p := startProxy(t)
+	require.NoError(t, p.SetTraceBuffer(1<<10))
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+	require.Len(t, p.Trace(), 2)
+
+	spillPath := filepath.Join(t.TempDir(), "decisions.jsonl")
+	p.SetMaxConnLifetime(time.Hour, time.Minute)
+	p.EnableLazyDial(failuregen.NewFailureGenerator())
+	require.NoError(t, p.SetMaxSegmentSize(512, time.Millisecond))
+	p.SetConnTargeting(tcpproxy.FirstConnOnly)
+	p.EnablePartialReads(failuregen.NewFailureGenerator(), time.Second)
+	noDelay := true
+	require.NoError(t, p.SetSocketOptions(
+		tcpproxy.SocketOptions{NoDelay: &noDelay},
+		tcpproxy.SocketOptions{ReadBufferSize: 4096}))
+	require.NoError(t, p.SetByteRangeRules([]tcpproxy.ByteRangeRule{{
+		Direction: tcpproxy.Return,
+		Offset:    1,
+		Length:    1,
+		Action:    tcpproxy.ByteRangeCorrupt,
+	}}))
+	require.NoError(t, p.SetConnLimits(tcpproxy.ConnLimits{BufferSize: 2048}))
+	p.SetAcceptHook(func(conn net.Conn) tcpproxy.AcceptDecision {
+		return tcpproxy.AcceptDecision{Action: tcpproxy.AcceptProxy}
+	})
+	require.NoError(t, p.SetSubstitutions([]tcpproxy.Substitution{{
+		Direction: tcpproxy.Onward,
+		Fg:        failuregen.NewFailureGenerator(),
+		Replace:   func(chunk []byte) []byte { return chunk },
+	}}))
+	p.BlockDirection(tcpproxy.Return)
+	p.RecordCorruptions(true)
+	require.NoError(t, p.SetDecisionRetention(10, spillPath))
+
+	// code can't be compared, only its presence
+	comparable := func(cfg tcpproxy.ProxyConfig) tcpproxy.ProxyConfig {
+		require.NotNil(t, cfg.ConnTargeting)
+		require.NotNil(t, cfg.AcceptHook)
+		require.Len(t, cfg.Substitutions, 1)
+		require.NotNil(t, cfg.Substitutions[0].Replace)
+		cfg.ConnTargeting, cfg.AcceptHook = nil, nil
+		cfg.Substitutions = append([]tcpproxy.Substitution(nil),
+			cfg.Substitutions...)
+		cfg.Substitutions[0].Replace = nil
+		return cfg
+	}
+	cfg := p.Config()
+	require.Equal(t, []tcpproxy.Direction{tcpproxy.Return},
+		cfg.BlockedDirections)
+	require.Equal(t, 10, cfg.DecisionRetention)
+	require.Equal(t, spillPath, cfg.DecisionSpillPath)
+	require.True(t, cfg.RecordCorruptions)
+	require.NotZero(t, cfg.TraceBufferSize)
+
+	// a round trip changes nothing, traced records included
+	require.NoError(t, p.Reconfigure(cfg))
+	require.Equal(t, comparable(cfg), comparable(p.Config()))
+	require.Len(t, p.Trace(), 2)
+
+	// the config applies to another proxy as a whole
+	q := startProxy(t)
+	require.NoError(t, q.Reconfigure(cfg))
+	require.Equal(t, comparable(cfg), comparable(q.Config()))
+
+	cfg.BlockedDirections = []tcpproxy.Direction{"sideways"}
+	require.Error(t, q.Reconfigure(cfg))
+}
+
+func TestProxyByteRangeRules(t *testing.T) {
+	p := startProxy(t)
+	require.Error(t, p.SetByteRangeRules([]tcpproxy.ByteRangeRule{
+		{Direction: tcpproxy.Onward, Offset: 0, Length: 0},
+	}))
+	require.NoError(t, p.SetByteRangeRules([]tcpproxy.ByteRangeRule{
+		// drops "cd" of the request
+		{
+			Direction: tcpproxy.Onward,
+			Offset:    2,
+			Length:    2,
+			Action:    tcpproxy.ByteRangeDrop,
+		},
+		// corrupts "y" of the second echoed response, the backend echoes
+		// the request without the dropped bytes
+		{
+			Direction: tcpproxy.Return,
+			Offset:    6,
+			Length:    1,
+			Action:    tcpproxy.ByteRangeCorrupt,
+		},
+	}))
+	require.Len(t, p.Config().ByteRangeRules, 2)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "abef", string(buf))
+
+	_, err = conn.Write([]byte("wxyz"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{'w', 'x', 'y' ^ 0xff, 'z'}, buf)
+
+	require.NoError(t, p.SetByteRangeRules(nil))
+	require.NoError(t, roundTrip(t, conn, "hello"))
+}
+
+func TestProxyCorruptedRanges(t *testing.T) {
+	p := startProxy(t)
+	p.RecordCorruptions(true)
+	require.NoError(t, p.SetByteRangeRules([]tcpproxy.ByteRangeRule{
+		{
+			Direction: tcpproxy.Onward,
+			Offset:    0,
+			Length:    2,
+			Action:    tcpproxy.ByteRangeDrop,
+		},
+		// offsets 4-5 of the request, 2-3 of the stream received by the
+		// backend
+		{
+			Direction: tcpproxy.Onward,
+			Offset:    4,
+			Length:    2,
+			Action:    tcpproxy.ByteRangeCorrupt,
+		},
+		{
+			Direction: tcpproxy.Onward,
+			Offset:    6,
+			Length:    1,
+			Action:    tcpproxy.ByteRangeCorrupt,
+		},
+	}))
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("abcdefgh"))
+	require.NoError(t, err)
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]byte{'c', 'd', 'e' ^ 0xff, 'f' ^ 0xff, 'g' ^ 0xff, 'h'},
+		buf)
+
+	corrupted := p.CorruptedRanges()
+	require.Equal(t, []tcpproxy.CorruptedRange{{
+		Seq:       0,
+		Direction: tcpproxy.Onward,
+		Offset:    2,
+		Length:    3,
+	}}, corrupted)
+
+	detected := []tcpproxy.CorruptedRange{
+		{Direction: tcpproxy.Onward, Offset: 0, Length: 2},
+	}
+	require.Equal(t, corrupted, tcpproxy.UndetectedRanges(corrupted, detected))
+	detected[0].Length = 4
+	require.Empty(t, tcpproxy.UndetectedRanges(corrupted, detected))
+
+	p.RecordCorruptions(false)
+	p.RecordCorruptions(true)
+	require.Empty(t, p.CorruptedRanges())
+}
+
+// connectThrough runs the CONNECT handshake with proxy for target, returning
+// the tunnel and the response status
+func connectThrough(
+	t *testing.T,
+	proxy string,
+	target string,
+) (net.Conn, int) {
+	conn, err := net.Dial("tcp", proxy)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = fmt.Fprintf(
+		conn,
+		"CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n",
+		target,
+		target)
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	return conn, resp.StatusCode
+}
+
+func TestConnectProxy(t *testing.T) {
+	backendHostPort, _ := startEchoServer(t)
+	handshakeFg := failuregen.NewFailureGenerator()
+	p, err := tcpproxy.NewConnectProxy(
+		context.Background(),
+		freeHostPort(t),
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator(),
+		handshakeFg)
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+
+	conn, status := connectThrough(t, p.FrontendHostPort(), backendHostPort)
+	require.Equal(t, http.StatusOK, status)
+	require.NoError(t, roundTrip(t, conn, "hello"))
+
+	_, status = connectThrough(t, p.FrontendHostPort(), freeHostPort(t))
+	require.Equal(t, http.StatusBadGateway, status)
+
+	require.NoError(t, handshakeFg.SetFailureProbability(1.0))
+	_, status = connectThrough(t, p.FrontendHostPort(), backendHostPort)
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, int64(1), p.Stats().FrontendDropCtr)
+}
+
+func TestProxyErr(t *testing.T) {
+	p := startProxy(t)
+	select {
+	case err := <-p.Err():
+		t.Fatalf("unexpected proxy error %v", err)
+	default:
+	}
+
+	// a closed listener is a permanent failure, the proxy must report it
+	require.NoError(t, tcpproxy.CloseListener(p))
+	select {
+	case err, ok := <-p.Err():
+		require.True(t, ok)
+		require.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy death not reported")
+	}
+	_, ok := <-p.Err()
+	require.False(t, ok)
+
+	// a stopped proxy closes the channel without error
+	backendHostPort, _ := startEchoServer(t)
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		freeHostPort(t),
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	p.Stop()
+	_, ok = <-p.Err()
+	require.False(t, ok)
+}
+
+func TestProxyPortConflict(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = tcpproxy.NewTCPProxy(
+		context.Background(),
+		l.Addr().String(),
+		"127.0.0.1:1",
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	var conflictErr *tcpproxy.PortConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	require.Equal(t, l.Addr().String(), conflictErr.HostPort)
+	if runtime.GOOS == "linux" {
+		// the test process holds the port
+		require.Len(t, conflictErr.Holders, 1)
+		require.Equal(t, os.Getpid(), conflictErr.Holders[0].PID)
+		require.Contains(t, err.Error(), conflictErr.Holders[0].Command)
+	}
+
+	backendHostPort, _ := startEchoServer(t)
+	p, err := tcpproxy.NewTCPProxyNearPort(
+		context.Background(),
+		l.Addr().String(),
+		10,
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	defer p.Stop()
+	require.NotEqual(t, l.Addr().String(), p.FrontendHostPort())
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+}
+
+func TestProxyFaultCombinations(t *testing.T) {
+	p := startProxy(t)
+	d, err := failuregen.NewCombinationDriver([]failuregen.Fault{
+		tcpproxy.LatencyFault(p, failuregen.DelayConfig{
+			MaxDelayMicros:   1000,
+			DelayProbability: 1,
+		}),
+		tcpproxy.DropFault(p, 1),
+		tcpproxy.PartitionFault(p),
+	}, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Step())
+	require.Equal(t, "latency+drop", d.Active().String())
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Error(t, roundTrip(t, conn, "hello"))
+
+	require.NoError(t, d.Stop())
+	recvFg := p.Config().RecvFg.(*failuregen.FailureGeneratorImpl)
+	require.Equal(t, failuregen.DelayConfig{}, recvFg.Config().Delay)
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+}
+
+func TestProxyAcceptHook(t *testing.T) {
+	p := startProxy(t)
+	var seen atomic.Int64
+	p.SetAcceptHook(func(conn net.Conn) tcpproxy.AcceptDecision {
+		switch seen.Inc() {
+		case 1:
+			return tcpproxy.AcceptDecision{Action: tcpproxy.AcceptDrop}
+		case 2:
+			return tcpproxy.AcceptDecision{
+				Action: tcpproxy.AcceptHijack,
+				Handler: func(conn net.Conn) {
+					conn.Write([]byte("hijacked"))
+				},
+			}
+		}
+		return tcpproxy.AcceptDecision{Action: tcpproxy.AcceptProxy}
+	})
+	require.NotNil(t, p.Config().AcceptHook)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Error(t, roundTrip(t, conn, "hello"))
+
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "hijacked", string(resp))
+
+	conn, err = net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+	require.Equal(t, int64(1), p.Stats().FrontendDropCtr)
+
+	p.SetAcceptHook(nil)
+	require.Nil(t, p.Config().AcceptHook)
+}
+
+func TestProxyOnInject(t *testing.T) {
+	backendHostPort, _ := startEchoServer(t)
+	acceptFg := failuregen.NewFailureGenerator()
+	p, err := tcpproxy.NewProxy(
+		context.Background(),
+		freeHostPort(t),
+		backendHostPort,
+		failuregen.NewFailureGenerator(),
+		acceptFg)
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+	events := make(chan tcpproxy.InjectionEvent, 10)
+	p.OnInject(func(event tcpproxy.InjectionEvent) { events <- event })
+
+	require.NoError(t, acceptFg.SetFailureProbability(1))
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Error(t, roundTrip(t, conn, "hello"))
+
+	event := <-events
+	require.Equal(t, tcpproxy.FaultAcceptDrop, event.Fault)
+	require.Equal(t, int64(0), event.Seq)
+	require.Equal(t, failuregen.InjectionKindFailure, event.Kind)
+	require.NotEmpty(t, event.InjectionID)
+	require.False(t, event.Time.IsZero())
+}
+
+func TestProxyBlockDirection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("greeting"))
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			received <- string(buf)
+		}
+	}()
+	p := startProxyTo(t, l.Addr().String())
+	p.BlockDirection(tcpproxy.Onward)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	// the client receives but can't send
+	buf := make([]byte, len("greeting"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "greeting", string(buf))
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	select {
+	case msg := <-received:
+		t.Fatalf("received %q across the partition", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// held traffic flows once the partition heals
+	p.UnblockDirection(tcpproxy.Onward)
+	select {
+	case msg := <-received:
+		require.Equal(t, "hello", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("held traffic not forwarded")
+	}
+}
+
+func TestProxyBlockReturnDirection(t *testing.T) {
+	p := startProxy(t)
+	p.BlockDirection(tcpproxy.Return)
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 5))
+	require.Error(t, err)
+
+	p.UnblockDirection(tcpproxy.Return)
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+}
+
+func TestProxyProfilerLabels(t *testing.T) {
+	p := startProxy(t)
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "labeled"))
+
+	var profile strings.Builder
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&profile, 1))
+	for _, dir := range []tcpproxy.Direction{tcpproxy.Onward, tcpproxy.Return} {
+		require.Contains(
+			t,
+			profile.String(),
+			fmt.Sprintf("%q:%q", tcpproxy.LabelDirection, dir))
+	}
+	require.Contains(
+		t,
+		profile.String(),
+		fmt.Sprintf("%q:%q", tcpproxy.LabelProxy, p.FrontendHostPort()))
+	require.Contains(t, profile.String(), `"tcpproxy.conn":"0"`)
+}
+
+func TestProxyTrace(t *testing.T) {
+	p := startProxy(t)
+	require.Error(t, p.SetTraceBuffer(-1))
+	require.Error(t, p.SetTraceBuffer(tcpproxy.TraceRecordSize-1))
+	require.NoError(t, p.SetTraceBuffer(1<<20))
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+	require.NoError(t, roundTrip(t, conn, "world!"))
+
+	trace := p.Trace()
+	require.Len(t, trace, 4)
+	for i, dir := range []tcpproxy.Direction{
+		tcpproxy.Onward, tcpproxy.Return, tcpproxy.Onward, tcpproxy.Return,
+	} {
+		require.Equal(t, dir, trace[i].Direction)
+		require.Equal(t, int64(0), trace[i].Seq)
+	}
+	require.Equal(t, int64(5), trace[2].Offset)
+	require.Equal(t, int32(6), trace[2].Received)
+	require.Equal(t, int32(6), trace[2].Delivered)
+
+	var dump bytes.Buffer
+	require.NoError(t, p.DumpTrace(&dump))
+	require.Equal(t, 4, strings.Count(dump.String(), "\n"))
+
+	// the buffer retains the latest records only
+	require.NoError(t, p.SetTraceBuffer(3*tcpproxy.TraceRecordSize))
+	for _, msg := range []string{"a", "bb", "ccc"} {
+		require.NoError(t, roundTrip(t, conn, msg))
+	}
+	trace = p.Trace()
+	require.Len(t, trace, 3)
+	require.Equal(t, tcpproxy.Return, trace[0].Direction)
+	require.Equal(t, int32(2), trace[0].Received)
+	require.Equal(t, int32(3), trace[2].Received)
+
+	require.NoError(t, p.SetTraceBuffer(0))
+	require.NoError(t, roundTrip(t, conn, "untraced"))
+	require.Empty(t, p.Trace())
+}
+
+func TestProxyTraceConcurrentConns(t *testing.T) {
+	p := startProxy(t)
+	require.NoError(t, p.SetTraceBuffer(1<<20))
+	const conns, rounds = 8, 50
+	errCh := make(chan error, conns)
+	for i := 0; i < conns; i++ {
+		go func() {
+			conn, err := net.Dial("tcp", p.FrontendHostPort())
+			if err != nil {
+				errCh <- err
+				return
+			}
+			defer conn.Close()
+			for j := 0; j < rounds; j++ {
+				if err := roundTrip(t, conn, "ping"); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			errCh <- nil
+		}()
+	}
+	for i := 0; i < conns; i++ {
+		require.NoError(t, <-errCh)
+	}
+
+	// records are ordered within each stream, and none is missing
+	trace := p.Trace()
+	type stream struct {
+		seq int64
+		dir tcpproxy.Direction
+	}
+	offsets := make(map[stream]int64)
+	for _, r := range trace {
+		s := stream{r.Seq, r.Direction}
+		require.Equal(t, offsets[s], r.Offset)
+		offsets[s] += int64(r.Received)
+	}
+	require.Len(t, offsets, 2*conns)
+	for _, offset := range offsets {
+		require.Equal(t, int64(len("ping")*rounds), offset)
+	}
+}
+
+type failedT struct {
+	testing.TB
+	cleanups []func()
+	logs     []string
+}
+
+func (f *failedT) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+
+func (f *failedT) Failed() bool { return true }
+
+func (f *failedT) Logf(format string, args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+
+func TestDumpTraceOnFailure(t *testing.T) {
+	p := startProxy(t)
+	require.NoError(t, p.SetTraceBuffer(1<<10))
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, roundTrip(t, conn, "hello"))
+
+	path := filepath.Join(t.TempDir(), "trace.json")
+	ft := &failedT{TB: t}
+	tcpproxy.DumpTraceOnFailure(ft, p, path)
+	require.NoFileExists(t, path)
+	for _, fn := range ft.cleanups {
+		fn()
+	}
+	require.Len(t, ft.logs, 1)
+	dump, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(dump), "\n"))
+}
+
+func TestProxySubstitutions(t *testing.T) {
+	p := startProxy(t)
+	require.Error(t, p.SetSubstitutions([]tcpproxy.Substitution{{
+		Direction: tcpproxy.Return,
+	}}))
+	fg := failuregen.NewFailureGenerator()
+	require.NoError(t, fg.(*failuregen.FailureGeneratorImpl).SetCountSchedule(
+		failuregen.CountSchedule{OnCall: 2}))
+	require.NoError(t, p.SetSubstitutions([]tcpproxy.Substitution{{
+		Direction: tcpproxy.Return,
+		Fg:        fg,
+		Replace: func(chunk []byte) []byte {
+			// off-by-one sequence number
+			return []byte{chunk[0] - 1}
+		},
+	}}))
+	events := make(chan tcpproxy.InjectionEvent, 10)
+	p.OnInject(func(event tcpproxy.InjectionEvent) { events <- event })
+
+	conn, err := net.Dial("tcp", p.FrontendHostPort())
+	require.NoError(t, err)
+	defer conn.Close()
+	buf := make([]byte, 1)
+	for _, seq := range []byte{'1', '2', '3'} {
+		_, err := conn.Write([]byte{seq})
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		if seq == '2' {
+			require.Equal(t, byte('1'), buf[0])
+		} else {
+			require.Equal(t, seq, buf[0])
+		}
+	}
+	require.Len(t, events, 1)
+	event := <-events
+	require.Equal(t, tcpproxy.FaultSubstitute, event.Fault)
+	require.Equal(t, tcpproxy.Return, event.Direction)
+	require.Equal(t, int64(1), event.Offset)
+
+	require.NoError(t, p.SetSubstitutions(nil))
+	require.NoError(t, roundTrip(t, conn, "intact"))
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 Rubrik, Inc.
+
+// Package testbackends provides lightweight backend servers to point test
+// proxies at, so that tests validating the fault behavior of the proxy don't
+// need a real service: an echo server, a fixed-latency responder, a byte
+// sink and a scripted responder. Servers listen on an ephemeral localhost
+// port.
+package testbackends
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+)
+
+// Server is a test backend server
+type Server struct {
+	listener net.Listener
+	handler  func(s *Server, conn net.Conn)
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	accepted atomic.Int64
+	received atomic.Int64
+}
+
+// Start serves connections with handler, which owns the connection (it is
+// closed once handler returns, or when the server is closed)
+func Start(handler func(conn net.Conn)) (*Server, error) {
+	return start(func(_ *Server, conn net.Conn) { handler(conn) })
+}
+
+func start(handler func(s *Server, conn net.Conn)) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to listen for test backend")
+	}
+	s := &Server{
+		listener: l,
+		handler:  handler,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		s.accepted.Inc()
+		go func() {
+			defer s.wg.Done()
+			defer s.forget(conn)
+			s.handler(s, conn)
+		}()
+	}
+}
+
+func (s *Server) forget(conn net.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// Addr returns the host:port the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Accepted returns the number of connections accepted by the server
+func (s *Server) Accepted() int64 {
+	return s.accepted.Load()
+}
+
+// Received returns the number of bytes received by the server
+func (s *Server) Received() int64 {
+	return s.received.Load()
+}
+
+// Close stops the server and closes its connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return errors.Wrap(err, "Failed to close test backend")
+}
+
+// countingReader counts the bytes received by the server
+type countingReader struct {
+	s    *Server
+	conn net.Conn
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+	r.s.received.Add(int64(n))
+	return n, err
+}
+
+// StartEcho starts a server echoing what it receives
+func StartEcho() (*Server, error) {
+	return start(func(s *Server, conn net.Conn) {
+		_, _ = io.Copy(conn, countingReader{s, conn})
+	})
+}
+
+// StartLatency starts a server echoing what it receives after latency, as a
+// slow service would
+func StartLatency(latency time.Duration) (*Server, error) {
+	return start(func(s *Server, conn net.Conn) {
+		buf := make([]byte, 32*1024)
+		r := countingReader{s, conn}
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				time.Sleep(latency)
+				if _, err := conn.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+// StartSink starts a server discarding what it receives, see Received
+func StartSink() (*Server, error) {
+	return start(func(s *Server, conn net.Conn) {
+		_, _ = io.Copy(io.Discard, countingReader{s, conn})
+	})
+}
+
+// Step is a step of the script of a scripted responder
+type Step struct {
+	// Expect is read before responding, the connection is closed if other
+	// bytes are received. Nothing is read if empty.
+	Expect []byte
+	// Delay is waited before responding
+	Delay time.Duration
+	// Respond is written in response, if not empty
+	Respond []byte
+	// Close closes the connection once the step is done
+	Close bool
+}
+
+// StartScripted starts a server playing script on every connection, e.g. to
+// mimic the handshake of a protocol. The connection is closed at the end of
+// the script.
+func StartScripted(script []Step) (*Server, error) {
+	return start(func(s *Server, conn net.Conn) {
+		r := countingReader{s, conn}
+		for _, step := range script {
+			if len(step.Expect) > 0 {
+				buf := make([]byte, len(step.Expect))
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return
+				}
+				if !bytes.Equal(buf, step.Expect) {
+					return
+				}
+			}
+			time.Sleep(step.Delay)
+			if len(step.Respond) > 0 {
+				if _, err := conn.Write(step.Respond); err != nil {
+					return
+				}
+			}
+			if step.Close {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Rubrik, Inc.
+
+package testbackends_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rubrikinc/failure-test-utils/failuregen"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy"
+	"github.com/rubrikinc/failure-test-utils/tcpproxy/testbackends"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestEcho(t *testing.T) {
+	s, err := testbackends.StartEcho()
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn := dial(t, s.Addr())
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+	require.EqualValues(t, 1, s.Accepted())
+	require.EqualValues(t, 5, s.Received())
+}
+
+func TestLatency(t *testing.T) {
+	s, err := testbackends.StartLatency(50 * time.Millisecond)
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn := dial(t, s.Addr())
+	start := time.Now()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestSink(t *testing.T) {
+	s, err := testbackends.StartSink()
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn := dial(t, s.Addr())
+	_, err = conn.Write(make([]byte, 1000))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return s.Received() == 1000
+	}, time.Second, time.Millisecond)
+}
+
+func TestScripted(t *testing.T) {
+	s, err := testbackends.StartScripted([]testbackends.Step{
+		{Respond: []byte("220 ready\n")},
+		{Expect: []byte("HELO\n"), Respond: []byte("250 ok\n")},
+		{Expect: []byte("QUIT\n"), Respond: []byte("221 bye\n"), Close: true},
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn := dial(t, s.Addr())
+	_, err = conn.Write([]byte("HELO\nQUIT\n"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "220 ready\n250 ok\n221 bye\n", string(out))
+
+	// unexpected input ends the script
+	conn = dial(t, s.Addr())
+	_, err = conn.Write([]byte("EHLO\n"))
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "220 ready\n", string(out))
+}
+
+func TestBehindProxy(t *testing.T) {
+	s, err := testbackends.StartSink()
+	require.NoError(t, err)
+	defer s.Close()
+
+	recvFg := failuregen.NewFailureGenerator()
+	p, err := tcpproxy.NewTCPProxy(
+		context.Background(),
+		"127.0.0.1:0",
+		s.Addr(),
+		recvFg,
+		failuregen.NewFailureGenerator())
+	require.NoError(t, err)
+	defer p.Stop()
+
+	conn := dial(t, p.FrontendHostPort())
+	_, err = conn.Write([]byte("through the proxy"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return s.Received() == int64(len("through the proxy"))
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, recvFg.SetFailureProbability(1))
+	_, err = conn.Write([]byte("dropped"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(len("through the proxy")), s.Received())
+}
+
+func TestClose(t *testing.T) {
+	s, err := testbackends.StartEcho()
+	require.NoError(t, err)
+	conn := dial(t, s.Addr())
+	require.Eventually(t, func() bool {
+		return s.Accepted() == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, s.Close())
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	_, err = net.Dial("tcp", s.Addr())
+	require.Error(t, err)
+}
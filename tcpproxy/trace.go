@@ -0,0 +1,200 @@
+// Copyright 2024 Rubrik, Inc.
+
+package tcpproxy
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+)
+
+// TraceRecord is the metadata of a chunk of traffic received by the proxy,
+// see SetTraceBuffer
+type TraceRecord struct {
+	Time time.Time
+	// Seq is the order in which the connection was accepted, see
+	// ConnDecisions
+	Seq       int64
+	Direction Direction
+	// Offset is that of the chunk in the stream received by the proxy
+	Offset int64
+	// Received is the size of the chunk
+	Received int32
+	// Delivered is the number of bytes of the chunk forwarded to the peer,
+	// which differs from Received when bytes are dropped
+	Delivered int32
+	// Dropped is set if the connection was dropped by an injected receive
+	// failure upon receiving the chunk
+	Dropped bool `json:",omitempty"`
+}
+
+// traceRecordSize is the memory taken by a record in the trace buffer
+var traceRecordSize = int(unsafe.Sizeof(traceSlot{}))
+
+// traceSlot holds a record of the trace buffer. Its lock is only contended
+// by writers which claimed the slot a lap apart, or by Trace.
+type traceSlot struct {
+	mu sync.Mutex
+	// claim is 1 + the index of the record in the slot, 0 if empty
+	claim  int64
+	record TraceRecord
+}
+
+// traceBuffer is a ring buffer of the latest trace records, preallocated so
+// that tracing doesn't allocate on the data path. Writers claim slots with an
+// atomic increment, so that connections don't serialize on a shared lock.
+type traceBuffer struct {
+	slots []traceSlot
+	// next is the total number of records claimed, the slot of the next
+	// record being next % len(slots)
+	next atomic.Int64
+}
+
+// record appends a record to the buffer, overwriting the oldest record once
+// the buffer is full. A nil buffer records nothing.
+func (b *traceBuffer) record(r TraceRecord) {
+	if b == nil {
+		return
+	}
+	r.Time = time.Now()
+	i := b.next.Inc() - 1
+	slot := &b.slots[i%int64(len(b.slots))]
+	slot.mu.Lock()
+	// a writer descheduled for a lap must not overwrite the newer record
+	if slot.claim <= i {
+		slot.claim, slot.record = i+1, r
+	}
+	slot.mu.Unlock()
+}
+
+// records returns the records of the latest lap, oldest first. Slots claimed
+// but not written yet are skipped.
+func (b *traceBuffer) records() []TraceRecord {
+	n := int64(len(b.slots))
+	oldest := b.next.Load() - n
+	type claimedRecord struct {
+		claim  int64
+		record TraceRecord
+	}
+	claimed := make([]claimedRecord, 0, n)
+	for i := range b.slots {
+		slot := &b.slots[i]
+		slot.mu.Lock()
+		if slot.claim > 0 && slot.claim > oldest {
+			claimed = append(claimed, claimedRecord{slot.claim, slot.record})
+		}
+		slot.mu.Unlock()
+	}
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].claim < claimed[j].claim
+	})
+	records := make([]TraceRecord, len(claimed))
+	for i := range claimed {
+		records[i] = claimed[i].record
+	}
+	return records
+}
+
+// SetTraceBuffer starts tracing the metadata of the traffic of the proxy (not
+// its payload) into an in-memory ring buffer of size bytes, which retains the
+// latest records only. Unlike a full capture, tracing takes no I/O and
+// doesn't allocate on the data path, so it can stay enabled in performance
+// tests; the trace is dumped on demand (see Trace and DumpTrace) or when the
+// test fails (see DumpTraceOnFailure). A size of 0 stops tracing. Setting the
+// buffer discards the records previously traced.
+func (t *Proxy) SetTraceBuffer(size int) error {
+	n, err := traceRecords(size)
+	if err != nil {
+		return err
+	}
+	t.update(func(s *settings) { s.trace = newTraceBuffer(n) })
+	return nil
+}
+
+// traceRecords returns the number of records a trace buffer of size bytes
+// holds
+func traceRecords(size int) (int, error) {
+	if size < 0 {
+		return 0, errors.Errorf("Invalid trace buffer size %d", size)
+	}
+	n := size / traceRecordSize
+	if size > 0 && n == 0 {
+		return 0, errors.Errorf(
+			"Trace buffer size %d is smaller than a record (%d bytes)",
+			size,
+			traceRecordSize)
+	}
+	return n, nil
+}
+
+// newTraceBuffer returns a buffer of n records, nil if n is 0
+func newTraceBuffer(n int) *traceBuffer {
+	if n == 0 {
+		return nil
+	}
+	return &traceBuffer{slots: make([]traceSlot, n)}
+}
+
+// size returns the size of the buffer in bytes, 0 if nil
+func (b *traceBuffer) size() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.slots) * traceRecordSize
+}
+
+// Trace returns the records in the trace buffer, oldest first
+func (t *Proxy) Trace() []TraceRecord {
+	b := t.settings.Load().trace
+	if b == nil {
+		return nil
+	}
+	return b.records()
+}
+
+// DumpTrace writes the records in the trace buffer to w as JSON lines,
+// oldest first
+func (t *Proxy) DumpTrace(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range t.Trace() {
+		if err := encoder.Encode(r); err != nil {
+			return errors.Wrap(err, "Failed to dump proxy trace")
+		}
+	}
+	return nil
+}
+
+// FailureT is the subset of testing.TB used by DumpTraceOnFailure
+type FailureT interface {
+	Cleanup(func())
+	Failed() bool
+	Logf(format string, args ...interface{})
+}
+
+// DumpTraceOnFailure dumps the trace buffer of proxy to the file at path
+// (see DumpTrace) once the test ends, if it failed
+func DumpTraceOnFailure(t FailureT, proxy Tracer, path string) {
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Logf("Failed to dump proxy trace: %v", err)
+			return
+		}
+		defer f.Close()
+		if err := proxy.DumpTrace(f); err != nil {
+			t.Logf("%v", err)
+			return
+		}
+		t.Logf("Dumped proxy trace to %s", path)
+	})
+}